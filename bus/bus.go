@@ -4,6 +4,7 @@ import "errors"
 
 var (
 	ErrRegionNotFound = errors.New("region not found")
+	ErrBusError       = errors.New("bus error")
 )
 
 // Buser is the required interface for all peripherals.
@@ -18,6 +19,13 @@ type Buser interface {
 	Length() uint64
 }
 
+// ReadModifyWriter is implemented by peripherals that observe indivisible
+// read-modify-write cycles, e.g. of the 68000 tas instruction.  Other
+// peripherals see a read followed by a write.
+type ReadModifyWriter interface {
+	ReadModifyWrite(uint64, uint64, func([]byte) []byte)
+}
+
 type buser struct {
 	Buser
 
@@ -59,7 +67,7 @@ func (b *Bus) Reset(powerOn bool) {
 // Lookup translates address to peripheral ID.
 func (b *Bus) Lookup(address uint64) (int, error) {
 	for k, v := range b.peripherals {
-		if v.start <= address && v.end >= address {
+		if v.start <= address && v.end > address {
 			return k, nil
 		}
 	}
@@ -67,25 +75,44 @@ func (b *Bus) Lookup(address uint64) (int, error) {
 }
 
 // Read from peripheral at provided address.  Address is always looked up in
-// the peripheral list.  It is therefore recommended to use ReadID.
-func (b *Bus) Read(address uint64, length uint64) []byte {
+// the peripheral list.  It is therefore recommended to use ReadID.  A read that
+// is not entirely within a peripheral returns ErrBusError.
+func (b *Bus) Read(address uint64, length uint64) ([]byte, error) {
 	id, err := b.Lookup(address)
-	if err != nil {
-		// assert bus error
-		panic("bus error")
+	if err != nil || address+length > b.peripherals[id].end {
+		return nil, ErrBusError
 	}
-	return b.ReadID(id, address, length)
+	return b.ReadID(id, address, length), nil
 }
 
 // Write to peripheral at provided address.  Address is always looked up in
-// the peripheral list.  It is therefore recommended to use WriteID.
-func (b *Bus) Write(address uint64, data []byte) {
+// the peripheral list.  It is therefore recommended to use WriteID.  A write
+// that is not entirely within a peripheral returns ErrBusError.
+func (b *Bus) Write(address uint64, data []byte) error {
 	id, err := b.Lookup(address)
-	if err != nil {
-		// assert bus error
-		panic("bus error")
+	if err != nil || address+uint64(len(data)) > b.peripherals[id].end {
+		return ErrBusError
 	}
 	b.WriteID(id, address, data)
+	return nil
+}
+
+// ReadModifyWrite reads length bytes from the peripheral at provided address
+// and writes back the bytes modify returns in one indivisible cycle.  An
+// access that is not entirely within a peripheral returns ErrBusError.
+func (b *Bus) ReadModifyWrite(address uint64, length uint64,
+	modify func([]byte) []byte) error {
+	id, err := b.Lookup(address)
+	if err != nil || address+length > b.peripherals[id].end {
+		return ErrBusError
+	}
+	p := b.peripherals[id]
+	if rmw, ok := p.Buser.(ReadModifyWriter); ok {
+		rmw.ReadModifyWrite(address-p.start, length, modify)
+		return nil
+	}
+	p.Write(address-p.start, modify(p.Read(address-p.start, length)))
+	return nil
 }
 
 // ReadID read from peripheral id at provided address.
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"bufio"
 	"encoding/binary"
+	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"runtime"
 	"strconv"
@@ -12,62 +16,193 @@ import (
 	"github.com/marcopeereboom/byo/bus"
 	"github.com/marcopeereboom/byo/cpu"
 	"github.com/marcopeereboom/byo/cpu/m68000"
+	"github.com/marcopeereboom/byo/cpu/m68881"
 	"github.com/marcopeereboom/byo/memory"
 )
 
 func singleCPU(bus *bus.Bus, cpu cpu.CPUer) error {
 	bus.Reset(true)
 	cpu.Reset()
-	err := cpu.Step()
+	_, err := cpu.Step()
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// run executes instructions until the cpu halts.  A halted cpu, e.g. a
+// program that terminated through its host services, is not an error.
+func run(bus *bus.Bus, c cpu.CPUer) error {
+	for {
+		_, err := c.Step()
+		switch {
+		case err == cpu.ErrHalted:
+			return nil
+		case err != nil:
+			return err
+		case c.State() == cpu.Stopped:
+			// nothing raises interrupts, the cpu would never resume
+			return fmt.Errorf("cpu stopped")
+		case c.State() == cpu.Background:
+			return fmt.Errorf("cpu in background debug mode")
+		}
+	}
+}
+
+// loadS68 writes the Motorola S-records in file name to bus and returns the
+// start address of the termination record, 0 if there is none.
+func loadS68(name string, bus *bus.Bus) (uint32, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	invalid := func(line int, reason string) error {
+		return fmt.Errorf("%v:%v: %v", name, line, reason)
+	}
+	start := uint32(0)
+	s := bufio.NewScanner(f)
+	for line := 1; s.Scan(); line++ {
+		r := strings.TrimSpace(s.Text())
+		if r == "" {
+			continue
+		}
+		if len(r) < 4 || r[0] != 'S' {
+			return 0, invalid(line, "invalid record")
+		}
+		b, err := hex.DecodeString(r[2:])
+		if err != nil || len(b) < 1 || int(b[0]) != len(b)-1 {
+			return 0, invalid(line, "invalid record")
+		}
+		sum := byte(0)
+		for _, v := range b {
+			sum += v
+		}
+		if sum != 0xff {
+			return 0, invalid(line, "checksum")
+		}
+
+		// address length by record type
+		var n int
+		switch r[1] {
+		case '1', '9':
+			n = 2
+		case '2', '8':
+			n = 3
+		case '3', '7':
+			n = 4
+		case '0', '5', '6':
+			continue
+		default:
+			return 0, invalid(line, "invalid type")
+		}
+		if len(b) < n+2 {
+			return 0, invalid(line, "invalid record")
+		}
+		address := uint32(0)
+		for _, v := range b[1 : 1+n] {
+			address = address<<8 | uint32(v)
+		}
+		if r[1] >= '7' {
+			start = address
+			continue
+		}
+		err = bus.Write(uint64(address), b[1+n:len(b)-1])
+		if err != nil {
+			return 0, invalid(line, err.Error())
+		}
+	}
+	return start, s.Err()
+}
+
 func parseCPU(name string, bus *bus.Bus) (cpu.CPUer, error) {
 	switch name {
-	case m68000.M68000:
-		ssp := make([]byte, 4)
-		pc := make([]byte, 4)
-		binary.BigEndian.PutUint32(ssp, 0x1000)
-		binary.BigEndian.PutUint32(pc, 0x2000)
-		bus.Write(0x0, ssp)
-		bus.Write(0x4, pc)
-		// move.l d1,a2
-		//bus.Write(0x2000, []byte{0x24, 0x41})
-		// adda.l d1,a2
-		bus.Write(0x2000, []byte{0xd5, 0xc1})
-		return m68000.New(bus)
+	case m68000.M68000, m68000.M68008, m68000.M68008FN, m68000.M68010,
+		m68000.M68020, m68000.MCPU32, m68000.MColdFire:
+		return m68000.NewModel(name, bus)
 	}
 
 	return nil, fmt.Errorf("invalid CPU type: %v", name)
 }
 
-func parseRAM(ramRegions string, bus *bus.Bus) error {
+// resetVectors writes the initial supervisor stack pointer ssp and program
+// counter pc to the reset vectors.
+func resetVectors(bus *bus.Bus, ssp, pc uint32) error {
+	v := make([]byte, 8)
+	binary.BigEndian.PutUint32(v, ssp)
+	binary.BigEndian.PutUint32(v[4:], pc)
+	return bus.Write(0x0, v)
+}
+
+// demo sets up the reset vectors and the instruction executed when no
+// program is given.
+func demo(bus *bus.Bus) error {
+	err := resetVectors(bus, 0x1000, 0x2000)
+	if err != nil {
+		return err
+	}
+	// move.l d1,a2
+	//return bus.Write(0x2000, []byte{0x24, 0x41})
+	// adda.l d1,a2
+	return bus.Write(0x2000, []byte{0xd5, 0xc1})
+}
+
+// parseFPU attaches the FPU described by fpu, <type>[@address], to c.  CPUs
+// with a coprocessor interface connect it directly, the others reach it
+// through its interface registers at address.
+func parseFPU(fpu string, bus *bus.Bus, c cpu.CPUer) error {
+	s := strings.Split(fpu, "@")
+	f, err := m68881.New(s[0])
+	if err != nil {
+		return err
+	}
+	if coprocessor, ok := c.(interface {
+		AttachFPU(*m68881.FPU) error
+	}); ok && len(s) == 1 {
+		return coprocessor.AttachFPU(f)
+	}
+	if len(s) != 2 {
+		return fmt.Errorf("FPU requires an address: %v", fpu)
+	}
+	address, err := strconv.ParseUint(s[1], 0, 64)
+	if err != nil {
+		return fmt.Errorf("invalid address: %v", fpu)
+	}
+	_, err = bus.Attach(address, m68881.NewInterface(f))
+	return err
+}
+
+// parseRAM attaches the RAM regions and returns the address following the
+// highest one.
+func parseRAM(ramRegions string, bus *bus.Bus) (uint64, error) {
+	top := uint64(0)
 	regions := strings.Split(ramRegions, ",")
 	for _, region := range regions {
 		// split size@address
 		s := strings.Split(region, "@")
 		if len(s) != 2 {
-			return fmt.Errorf("invalid RAM region: %v", region)
+			return 0, fmt.Errorf("invalid RAM region: %v", region)
 		}
 		size, err := strconv.ParseUint(s[0], 0, 64)
 		if err != nil {
-			return fmt.Errorf("invalid size: %v", region)
+			return 0, fmt.Errorf("invalid size: %v", region)
 		}
 		address, err := strconv.ParseUint(s[1], 0, 64)
 		if err != nil {
-			return fmt.Errorf("invalid address: %v", region)
+			return 0, fmt.Errorf("invalid address: %v", region)
 		}
 		ram := memory.NewRAM(size)
 		_, err = bus.Attach(address, ram)
 		if err != nil {
-			return err
+			return 0, err
+		}
+		if address+size > top {
+			top = address + size
 		}
 	}
 
-	return nil
+	return top, nil
 }
 
 func main() {
@@ -77,14 +212,23 @@ func main() {
 	cpuType := flag.String("cpu", "68000", "CPU type")
 	ramRegions := flag.String("ram", "0x8000@0x0000",
 		"RAM <size@address>[,size@address]")
+	fpuType := flag.String("fpu", "", "FPU <type>[@address]")
+	s68 := flag.String("s68", "", "run S-record file")
+	easy68k := flag.Bool("easy68k", false, "EASy68K TRAP #15 services")
+	// EASy68K file tasks are opt-in, the program may create, overwrite
+	// and delete any file in the directory
+	easy68kFiles := flag.String("easy68k-files", "",
+		"EASy68K file task directory, the program may modify any "+
+			"file in it")
 	flag.Parse()
 
 	var cpu cpu.CPUer
+	var top uint64
 	bus, err := bus.New()
 	if err != nil {
 		goto done
 	}
-	err = parseRAM(*ramRegions, bus)
+	top, err = parseRAM(*ramRegions, bus)
 	if err != nil {
 		goto done
 	}
@@ -92,7 +236,46 @@ func main() {
 	if err != nil {
 		goto done
 	}
+	if *fpuType != "" {
+		err = parseFPU(*fpuType, bus, cpu)
+		if err != nil {
+			goto done
+		}
+	}
+
+	if *easy68k {
+		simulator, ok := cpu.(interface {
+			EASy68K(io.Reader, io.Writer, string) error
+		})
+		if !ok {
+			err = errors.New("EASy68K requires a 68000 family CPU")
+			goto done
+		}
+		err = simulator.EASy68K(os.Stdin, os.Stdout, *easy68kFiles)
+		if err != nil {
+			goto done
+		}
+	}
+	if *s68 != "" {
+		var start uint32
+		start, err = loadS68(*s68, bus)
+		if err != nil {
+			goto done
+		}
+		// the stack starts at the top of RAM like in EASy68K
+		err = resetVectors(bus, uint32(top), start)
+		if err != nil {
+			goto done
+		}
+		cpu.Reset()
+		err = run(bus, cpu)
+		goto done
+	}
 
+	err = demo(bus)
+	if err != nil {
+		goto done
+	}
 	err = singleCPU(bus, cpu)
 done:
 	if err != nil {
@@ -3,11 +3,56 @@ package cpu
 import "errors"
 
 type CPUer interface {
-	Reset()      // reset cpu
-	Interrupt()  // interrupt cpu
-	Step() error // execute next instruction
+	Reset() // reset cpu
+
+	// Interrupt asserts interrupt request level on the cpu.  The device is
+	// asked for the vector number during the interrupt acknowledge cycle.
+	// A nil device negates the request.
+	Interrupt(level int, device Acknowledger)
+
+	Step() (int, error) // execute next instruction, returns clock cycles
+	State() State       // run state
+}
+
+// State is the run state of a cpu.  A stopped cpu executes no instructions
+// until an interrupt arrives, a halted cpu executes no instructions until it
+// is reset.  A cpu in background debug mode executes no instructions until
+// the debugger resumes it.  The machine loop may idle while the cpu is not
+// running.
+type State int
+
+const (
+	Running State = iota
+	Stopped
+	Halted
+	Background
+)
+
+// Acknowledger is implemented by devices that request interrupts.
+// Acknowledge is called during the interrupt acknowledge cycle and returns the
+// vector number for the interrupt at level, Autovector or Spurious.
+type Acknowledger interface {
+	Acknowledge(level int) int
 }
 
+// Vector is an Acknowledger that always supplies the same vector number.
+type Vector int
+
+// Acknowledge returns v.  This is part of the Acknowledger interface.
+func (v Vector) Acknowledge(level int) int {
+	return int(v)
+}
+
+const (
+	// Autovector lets the CPU derive the vector from the interrupt level.
+	Autovector = Vector(-1)
+
+	// Spurious terminates the interrupt acknowledge cycle with a bus
+	// error.
+	Spurious = Vector(-2)
+)
+
 var (
 	ErrInvalidOpcode = errors.New("invalid opcode")
+	ErrHalted        = errors.New("cpu halted")
 )
@@ -2,26 +2,90 @@ package m68000
 
 import (
 	"encoding/binary"
+	"fmt"
 
 	"github.com/marcopeereboom/byo/bus"
 	"github.com/marcopeereboom/byo/cpu"
+	"github.com/marcopeereboom/byo/cpu/m68881"
 )
 
+// Supported models.
 const (
-	M68000 = "68000"
+	M68000    = "68000"
+	M68008    = "68008"   // 48 pin DIP, 20 address lines
+	M68008FN  = "68008fn" // 52 pin PLCC, 22 address lines
+	M68010    = "68010"
+	M68020    = "68020"
+	MCPU32    = "cpu32"    // 683xx core
+	MColdFire = "coldfire" // V2 core with EMAC
+)
 
+const (
 	carry    = 1 << 0
 	overflow = 1 << 1
 	zero     = 1 << 2
 	negative = 1 << 3
 	extend   = 1 << 4
+
+	interruptMask = 0x0700
+	master        = 1 << 12
+	supervisor    = 1 << 13
+	trace         = 1 << 15
+
+	ccrMask = 0x001f
+	srMask  = trace | supervisor | master | interruptMask | ccrMask
+)
+
+// Exception stack frame styles.
+const (
+	frames68000    = iota // no format word
+	frames68010           // formats 0 and 8
+	frames68020           // formats 0, 1, 2 and A
+	framesCPU32           // formats 0, 2 and C
+	framesColdFire        // formats 4-7
 )
 
 var (
 	_ cpu.CPUer = (*m68k)(nil) // ensure interface is satisfied
 
+	models = map[string]*model{
+		M68000: {opcodes: opcodes},
+		M68008: {opcodes: opcodes, addressMask: 0x0fffff,
+			byteBus: true},
+		M68008FN: {opcodes: opcodes, addressMask: 0x3fffff,
+			byteBus: true},
+		M68010: {opcodes: opcodes68010, frames: frames68010,
+			controls: controls68010},
+		M68020: {opcodes: opcodes68020, frames: frames68020,
+			controls: controls68020, fullFormat: true,
+			indirect: true, misaligned: true, master: true,
+			coprocessor: true},
+		MCPU32: {opcodes: opcodesCPU32, frames: framesCPU32,
+			controls: controls68010, fullFormat: true},
+		MColdFire: {opcodes: opcodesColdFire, frames: framesColdFire,
+			controls: controlsColdFire, longIndex: true,
+			misaligned: true, singleStack: true},
+	}
 )
 
+// model describes how a member of the family differs from the 68000.  All
+// models share the 68000 decoder, a model's instruction set adds to or
+// replaces the 68000 patterns or, for the ColdFire, is a subset of them.
+type model struct {
+	opcodes     *[0x10000]instruction // decoded instruction set
+	frames      int                   // exception stack frame style
+	controls    []uint32              // movec control registers
+	fullFormat  bool                  // scaled and full format index words
+	longIndex   bool                  // brief format, scaled long index
+	indirect    bool                  // memory indirect full format modes
+	misaligned  bool                  // word and long data at odd addresses
+	master      bool                  // master stack pointer and M bit
+	singleStack bool                  // A7 is shared by all modes
+	coprocessor bool                  // line 1111 coprocessor interface
+	addressMask uint32                // address lines, 0 if all decoded
+	byteBus     bool                  // 8 bit data bus
+}
+
 // m68k represents the Motorola 68000 CPU.  Note that this is a big endian CPU,
 // however register content will be stored in native format.  Exception are the
 // bit only adressable registers.
@@ -33,68 +97,404 @@ type m68k struct {
 	a []uint32
 
 	// other registers
-	pc uint32
-	sr uint16 // user instructions may not touch upper 8 bits
+	pc  uint32
+	sr  uint16 // user instructions may not touch upper 8 bits
+	usp uint32 // user stack pointer while in supervisor mode
+	ssp uint32 // supervisor (interrupt) stack pointer while not in use
+	msp uint32 // master stack pointer while not in use
+	vbr uint32 // vector base register
+	sfc uint32 // source function code
+	dfc uint32 // destination function code
+
+	// 68020 cache registers, the caches are not emulated
+	cacr uint32
+	caar uint32
 
-	// bus
-	bus *bus.Bus
+	// current instruction
+	ir   uint16 // instruction register
+	size uint32 // operation size in bytes
+	ea   uint32 // calculated memory effective address
+	ext  int    // extension bytes consumed from operand
+
+	jumped  bool // instruction loaded the program counter
+	cycles  int  // clock periods taken by the current instruction
+	stretch int  // clock periods added by byte bus cycles
+	state   cpu.State
+
+	// prefetch queue
+	prefetch bool       // emulate the prefetch queue
+	queue    [2]uint16  // IRD and IRC
+	queuePC  uint32     // address of queue[0]
+	queued   int        // valid words in queue
+	fault    *exception // fault of the opcode prefetch
+
+	// CPU32 background debug mode
+	pcc uint32 // address of the bgnd instruction
+
+	// ColdFire EMAC unit
+	acc     [4]int64 // accumulators, sign extended from 48 bits
+	macsr   uint32
+	macMask uint32
+
+	// 68010 loop mode
+	loop   bool   // executing a dbcc loop from the loop buffer
+	loopPC uint32 // address of the loop instruction
+
+	// interrupt request per level, level 7 is edge triggered
+	irq [8]cpu.Acknowledger
+	nmi bool
+
+	fpu *m68881.FPU // coprocessor ID 1, nil if none is attached
+
+	hooks [vectorTrap + 16]Hook // indexed by vector, see Hook
+
+	model *model
+	bus   *bus.Bus
 }
 
-// New returns a new m68k instance.
+// New returns a new 68000 instance.
 func New(bus *bus.Bus) (*m68k, error) {
+	return NewModel(M68000, bus)
+}
+
+// NewModel returns a new instance of the named model, e.g. M68010.
+func NewModel(name string, bus *bus.Bus) (*m68k, error) {
+	m, ok := models[name]
+	if !ok {
+		return nil, fmt.Errorf("invalid model: %v", name)
+	}
 	cpu := m68k{
-		bus: bus,
-		a:   make([]uint32, 8),
-		d:   make([]uint32, 8),
+		model: m,
+		bus:   bus,
+		a:     make([]uint32, 8),
+		d:     make([]uint32, 8),
 	}
 	return &cpu, nil
 }
 
-// Interrupt asserts the CPU's interrupt.  This is part of the CPUer interface.
-func (c *m68k) Interrupt() {
+// Interrupt asserts interrupt request level.  The request is level sensitive
+// and remains asserted until the device negates it with a nil device.  This is
+// part of the CPUer interface.
+func (c *m68k) Interrupt(level int, device cpu.Acknowledger) {
+	if level < 1 || level > 7 {
+		return
+	}
+	if level == 7 && c.irq[7] == nil && device != nil {
+		c.nmi = true
+	}
+	c.irq[level] = device
 }
 
 // Reset asserts the CPU's reset.  This is part of the CPUer interface.  The
 // 68000 CPU sets the SSP to the vector found in $0-$3 and the PC to the vector
-// found in $4-$7.  These locations are usually shadowed by ROM.
+// found in $4-$7.  These locations are usually shadowed by ROM.  The CPU
+// starts in supervisor mode with all interrupts masked and the vector base
+// register cleared.  A bus or address error while fetching the vectors halts
+// the CPU.
 func (c *m68k) Reset() {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		if _, ok := r.(exception); !ok {
+			panic(r)
+		}
+		c.state = cpu.Halted
+	}()
+
+	c.state = cpu.Running
+	c.flush()
+	c.sr = supervisor | interruptMask
+	c.vbr = 0
 	c.a[7] = c.read32(0)
 	c.pc = c.read32(4)
 }
 
-// Step executes the next instruction on the CPU.  This is part of the CPUer
-// interface.
-func (c *m68k) Step() error {
-	opcode := c.read16(c.pc)
-	i, found := opcodes[opcode]
-	if !found {
-		return cpu.ErrInvalidOpcode
+// Step executes the next instruction on the CPU and returns the number of
+// clock periods it took.  A stopped CPU only processes interrupts and
+// otherwise returns without taking any time.  A double fault halts the CPU
+// and Step returns cpu.ErrHalted until the CPU is reset.  A CPU in background
+// debug mode returns without taking any time until it is resumed, see Go.
+// This is part of the CPUer interface.
+//
+// When the trace bit is set at the start of an instruction a trace exception
+// is taken once the instruction completes.  An instruction that completes by
+// taking a TRAP, TRAPV, CHK or divide by zero exception is traced after that
+// exception has been processed.  Instructions aborted by a bus, address,
+// illegal or privilege exception are not traced.  A pending interrupt is
+// taken by the next Step, before the first instruction of the trace handler.
+//
+// On the 68008 every word transferred takes an extra byte bus cycle of 4
+// clock periods which is added to the 68000 time.
+//
+// Line 1010, line 1111 and TRAP #n instructions with a hook run it in place
+// of the exception, see Hook.
+func (c *m68k) Step() (cycles int, err error) {
+	if c.state == cpu.Halted {
+		return 0, cpu.ErrHalted
+	}
+	if c.state == cpu.Background {
+		return 0, nil
 	}
 
-	operand := i.fetchOperand(c, c.pc+2, i.operandSize)
+	c.stretch = 0
+	tracing, start := false, c.pc
+	defer func() {
+		r := recover()
+		if r != nil {
+			e, ok := r.(exception)
+			if !ok {
+				panic(r)
+			}
+			switch {
+			case c.emulate(e):
+				if tracing && c.state != cpu.Halted {
+					err = c.trace(start)
+				}
+			default:
+				err = c.process(e)
+				if err == nil && tracing &&
+					group(e.vector) == 2 {
+					err = c.trace(start)
+				}
+			}
+			cycles = c.cycles
+		}
+		cycles += c.stretch
+	}()
+
+	if c.interrupt() {
+		return c.cycles, nil
+	}
+	if c.state == cpu.Stopped {
+		return 0, nil
+	}
+
+	tracing, start = c.sr&trace != 0, c.pc
+
+	var opcode uint16
+	if c.prefetch {
+		opcode = c.fetchOpcode()
+	} else {
+		opcode = c.fetch16(c.pc)
+	}
+	i := &c.model.opcodes[opcode]
+	c.ir = opcode
+	if i.execute == nil {
+		c.unimplemented(opcode)
+	}
+
+	c.size = i.size
+	c.ext = 0
+	c.jumped = false
+	c.cycles = i.cycles
+	if c.loop && c.pc == c.loopPC {
+		// no opcode fetch in loop mode
+		c.cycles -= 4
+	}
+
+	operand := c.operand(i, c.pc)
+	if c.prefetch {
+		operand = c.prefetched(operand)
+	}
 	source := i.fetchSource(c, i.source, operand)
 	destination := i.fetchDestination(c, i.destination, operand)
+	if c.prefetch {
+		c.prefetchOpcode(c.next(operand))
+	}
 	intermediate := i.execute(c, source, destination, operand)
+	if c.prefetch {
+		c.prefetchFault()
+	}
 	i.storeDestination(c, i.destination, intermediate, operand)
+	if c.prefetch {
+		c.prefetchExtension()
+	}
 
-	c.pc += 2 + uint32(len(operand))
+	if !c.jumped {
+		c.pc += 2 + uint32(len(operand))
+	}
+	if tracing {
+		err = c.trace(start)
+		return c.cycles, err
+	}
+
+	return c.cycles, nil
+}
+
+// State returns the run state of the CPU.  This is part of the CPUer
+// interface.
+func (c *m68k) State() cpu.State {
+	return c.state
+}
+
+// jump loads the program counter with address.  Step does not advance the
+// program counter past an instruction that jumped.
+func (c *m68k) jump(address uint32) {
+	c.pc = address
+	c.jumped = true
+}
+
+// functionCode returns the function code of a program or data access in the
+// current mode.
+func (c *m68k) functionCode(program bool) uint16 {
+	fc := uint16(functionUserData)
+	if program {
+		fc = functionUserProgram
+	}
+	if c.sr&supervisor != 0 {
+		fc += functionSupervisorData - functionUserData
+	}
+	return fc
+}
+
+// align raises an address error when a word or long is accessed at an odd
+// address.  The stacked program counter points past the opcode of the current
+// instruction.  Models that support misaligned data only raise address errors
+// for instruction fetches.
+func (c *m68k) align(address uint32, access uint16) {
+	if address&1 == 0 {
+		return
+	}
+	if c.model.misaligned && access&accessNotInstruction != 0 {
+		return
+	}
+	panic(exception{vector: vectorAddressError, pc: c.pc + 2,
+		address: address, access: access})
+}
+
+// physical returns the address the CPU drives on its address lines.
+func (c *m68k) physical(address uint32) uint64 {
+	if c.model.addressMask != 0 {
+		address &= c.model.addressMask
+	}
+	return uint64(address)
+}
+
+// byteCycles accounts for the extra byte bus cycles of an 8 bit data bus when
+// length bytes are transferred.
+func (c *m68k) byteCycles(length uint64) {
+	c.stretch += 4 * int(length/2)
+}
 
-	return nil
+// load reads length bytes from the bus and raises a bus error when the
+// transaction is not acknowledged.  An 8 bit data bus reads one byte per
+// cycle.
+func (c *m68k) load(address uint32, length uint64, access uint16) []byte {
+	if !c.model.byteBus {
+		v, err := c.bus.Read(c.physical(address), length)
+		if err != nil {
+			panic(exception{vector: vectorBusError, pc: c.pc + 2,
+				address: address, access: access})
+		}
+		return v
+	}
+
+	v := make([]byte, length)
+	for k := range v {
+		b, err := c.bus.Read(c.physical(address+uint32(k)), 1)
+		if err != nil {
+			panic(exception{vector: vectorBusError, pc: c.pc + 2,
+				address: address, access: access})
+		}
+		v[k] = b[0]
+	}
+	c.byteCycles(length)
+	return v
+}
+
+// store writes v to the bus and raises a bus error when the transaction is
+// not acknowledged.  An 8 bit data bus writes one byte per cycle.
+func (c *m68k) store(address uint32, v []byte, access uint16) {
+	if !c.model.byteBus {
+		err := c.bus.Write(c.physical(address), v)
+		if err != nil {
+			panic(exception{vector: vectorBusError, pc: c.pc + 2,
+				address: address, access: access})
+		}
+		return
+	}
+
+	for k := range v {
+		err := c.bus.Write(c.physical(address+uint32(k)), v[k:k+1])
+		if err != nil {
+			panic(exception{vector: vectorBusError, pc: c.pc + 2,
+				address: address, access: access})
+		}
+	}
+	c.byteCycles(uint64(len(v)))
+}
+
+// fetch reads length bytes of instruction stream from program space.
+func (c *m68k) fetch(address uint32, length uint64) []byte {
+	return c.load(address, length, accessRead|c.functionCode(true))
+}
+
+// fetch16 reads an instruction word from program space.
+func (c *m68k) fetch16(address uint32) uint16 {
+	c.align(address, accessRead|c.functionCode(true))
+	return binary.BigEndian.Uint16(c.fetch(address, 2))
 }
 
 // write32 is a helper function to convert memory bytes into host endianess.
 func (c *m68k) write32(address uint32, value uint32) {
+	access := accessNotInstruction | c.functionCode(false)
+	c.align(address, access)
 	v := make([]byte, 4)
 	binary.BigEndian.PutUint32(v, value)
-	c.bus.Write(uint64(address), v)
+	c.store(address, v, access)
+}
+
+// write16 is a helper function to convert host endianess into memory bytes.
+func (c *m68k) write16(address uint32, value uint16) {
+	access := accessNotInstruction | c.functionCode(false)
+	c.align(address, access)
+	v := make([]byte, 2)
+	binary.BigEndian.PutUint16(v, value)
+	c.store(address, v, access)
+}
+
+// write8 writes a single byte to memory.
+func (c *m68k) write8(address uint32, value uint8) {
+	c.store(address, []byte{value},
+		accessNotInstruction|c.functionCode(false))
+}
+
+// readModifyWrite8 replaces the byte at address with the result of modify in
+// an indivisible read-modify-write cycle and returns the byte read.
+func (c *m68k) readModifyWrite8(address uint32,
+	modify func(uint8) uint8) uint8 {
+	access := accessRead | accessNotInstruction | c.functionCode(false)
+	var v uint8
+	err := c.bus.ReadModifyWrite(c.physical(address), 1,
+		func(b []byte) []byte {
+			v = b[0]
+			return []byte{modify(v)}
+		})
+	if err != nil {
+		panic(exception{vector: vectorBusError, pc: c.pc + 2,
+			address: address, access: access})
+	}
+	return v
 }
 
 // read32 is a helper function to convert memory bytes into host endianess.
 func (c *m68k) read32(address uint32) uint32 {
-	return binary.BigEndian.Uint32(c.bus.Read(uint64(address), 4))
+	access := accessRead | accessNotInstruction | c.functionCode(false)
+	c.align(address, access)
+	return binary.BigEndian.Uint32(c.load(address, 4, access))
 }
 
 // read16 is a helper function to convert memory bytes into host endianess.
 func (c *m68k) read16(address uint32) uint16 {
-	return binary.BigEndian.Uint16(c.bus.Read(uint64(address), 2))
+	access := accessRead | accessNotInstruction | c.functionCode(false)
+	c.align(address, access)
+	return binary.BigEndian.Uint16(c.load(address, 2, access))
+}
+
+// read8 reads a single byte from memory.
+func (c *m68k) read8(address uint32) uint8 {
+	access := accessRead | accessNotInstruction | c.functionCode(false)
+	return c.load(address, 1, access)[0]
 }
@@ -1,10 +1,17 @@
 package m68000
 
 import (
+	"bytes"
 	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/marcopeereboom/byo/bus"
+	"github.com/marcopeereboom/byo/cpu"
+	"github.com/marcopeereboom/byo/cpu/m68881"
 	"github.com/marcopeereboom/byo/memory"
 )
 
@@ -13,6 +20,9 @@ const (
 	pcStart = 0x1000      // start PC
 )
 
+// testModel is the model newCpu returns.
+var testModel = M68000
+
 func newCpu() (*bus.Bus, *m68k) {
 	b, err := bus.New()
 	if err != nil {
@@ -33,7 +43,7 @@ func newCpu() (*bus.Bus, *m68k) {
 	b.Write(0x4, pc)
 
 	// setup cpu
-	c, err := New(b)
+	c, err := NewModel(testModel, b)
 	if err != nil {
 		panic(err)
 	}
@@ -45,14 +55,23 @@ func newCpu() (*bus.Bus, *m68k) {
 	return b, c
 }
 
+// newModel returns a cpu of the named model set up like newCpu.
+func newModel(t *testing.T, name string) (*bus.Bus, *m68k) {
+	defer func(m string) {
+		testModel = m
+	}(testModel)
+	testModel = name
+	return newCpu()
+}
+
 func TestMOVEL(t *testing.T) {
 	b, c := newCpu()
-	b.Write(pcStart, []byte{0x24, 0x41}) // move.l d1,a2
+	b.Write(pcStart, []byte{0x24, 0x41}) // movea.l d1,a2
 
 	// test 0
 	c.d[1] = 0x0
 	c.a[2] = 0xffffffff
-	err := c.Step()
+	_, err := c.Step()
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -63,8 +82,8 @@ func TestMOVEL(t *testing.T) {
 	if c.a[2] != c.d[1] {
 		t.Fatalf("move.l 0x%x != 0x3000", c.a[2])
 	}
-	if c.sr&0x1f != 0x4 {
-		t.Fatalf("sr 0x%x != 0x4", c.sr)
+	if c.sr&0x1f != 0x0 {
+		t.Fatalf("sr 0x%x != 0x0", c.sr)
 	}
 	d, _, err := c.disassemble(pcStart)
 	if err != nil {
@@ -77,7 +96,7 @@ func TestMOVEL(t *testing.T) {
 	c.a[2] = 0x1
 	c.pc = pcStart
 	c.sr = 0x0
-	err = c.Step()
+	_, err = c.Step()
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -88,7 +107,7 @@ func TestMOVEL(t *testing.T) {
 	if c.a[2] != c.d[1] {
 		t.Fatalf("move.l 0x%x != 0x3000", c.a[2])
 	}
-	if c.sr&0x1f != 0x8 {
+	if c.sr&0x1f != 0x0 {
 		t.Fatalf("sr 0x%x != 0x0", c.sr)
 	}
 	d, _, err = c.disassemble(pcStart)
@@ -102,7 +121,7 @@ func TestMOVEL(t *testing.T) {
 	c.a[2] = 0x1
 	c.pc = pcStart
 	c.sr = 0x0
-	err = c.Step()
+	_, err = c.Step()
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -128,7 +147,7 @@ func TestMOVEL(t *testing.T) {
 	c.a[2] = 0x4000
 	c.pc = pcStart
 	c.sr = 0x0
-	err = c.Step()
+	_, err = c.Step()
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -200,10 +219,11 @@ func TestADDAL(t *testing.T) {
 	b, c := newCpu()
 	b.Write(pcStart, []byte{0xd5, 0xc1}) // adda.l d1,a2
 
-	// test 0
+	// test 0, adda does not affect the condition codes
 	c.d[1] = 0xffffffff
 	c.a[2] = 0x1
-	err := c.Step()
+	c.sr = 0x0a
+	_, err := c.Step()
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -214,8 +234,8 @@ func TestADDAL(t *testing.T) {
 	if c.a[2] != 0x0 {
 		t.Fatalf("adda.l 0x%x != 0x0", c.a[2])
 	}
-	if c.sr&0x1f != 0x15 {
-		t.Fatalf("sr 0x%x != 0x15", c.sr)
+	if c.sr&0x1f != 0x0a {
+		t.Fatalf("sr 0x%x != 0x0a", c.sr)
 	}
 	d, _, err := c.disassemble(pcStart)
 	if err != nil {
@@ -228,7 +248,7 @@ func TestADDAL(t *testing.T) {
 	c.a[2] = 0x1
 	c.pc = pcStart
 	c.sr = 0x0
-	err = c.Step()
+	_, err = c.Step()
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -239,8 +259,8 @@ func TestADDAL(t *testing.T) {
 	if c.a[2] != 0x80000000 {
 		t.Fatalf("adda.l 0x%x != 0x80000000", c.a[2])
 	}
-	if c.sr&0x1f != 0x2 {
-		t.Fatalf("sr 0x%x != 0x2", c.sr)
+	if c.sr&0x1f != 0x0 {
+		t.Fatalf("sr 0x%x != 0x0", c.sr)
 	}
 	t.Logf("0x%08x sr %02x -> %v", c.a[2], c.sr, c.ccr())
 
@@ -248,8 +268,8 @@ func TestADDAL(t *testing.T) {
 	c.d[1] = 0x1
 	c.a[2] = 0x1
 	c.pc = pcStart
-	c.sr = 0x0
-	err = c.Step()
+	c.sr = 0x15
+	_, err = c.Step()
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -260,8 +280,3481 @@ func TestADDAL(t *testing.T) {
 	if c.a[2] != 0x2 {
 		t.Fatalf("adda.l 0x%x != 0x2", c.a[2])
 	}
-	if c.sr&0x1f != 0x0 {
-		t.Fatalf("sr 0x%x != 0x0", c.sr)
+	if c.sr&0x1f != 0x15 {
+		t.Fatalf("sr 0x%x != 0x15", c.sr)
 	}
 	t.Logf("0x%08x sr %02x -> %v", c.a[2], c.sr, c.ccr())
 }
+
+func TestGenerate(t *testing.T) {
+	_, c := newCpu()
+
+	tests := []struct {
+		opcode uint16
+		text   string
+	}{
+		{0x2441, "movea.l\td1,a2"},
+		{0x2481, "move.l\td1,(a2)"},
+		{0x2e88, "move.l\ta0,(a7)"},
+		{0xd5c1, "adda.l\td1,a2"},
+		{0xdfc8, "adda.l\ta0,a7"},
+	}
+	for _, test := range tests {
+		i := &opcodes[test.opcode]
+		if i.execute == nil {
+			t.Fatalf("opcode 0x%04x not generated", test.opcode)
+		}
+		d, _, err := i.disassemble(c, test.opcode, operandNop)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d != test.text {
+			t.Fatalf("opcode 0x%04x: got %q want %q", test.opcode, d,
+				test.text)
+		}
+	}
+
+	// tas a1 is not a valid encoding
+	if opcodes[0x4ac9].execute != nil {
+		t.Fatalf("opcode 0x4ac9 should be invalid")
+	}
+}
+
+func TestEA(t *testing.T) {
+	b, c := newCpu()
+
+	// ext words: d16 = 0x10, brief d1.w + 4, abs.w 0x4000, abs.l 0x4010
+	operand := []byte{0x00, 0x10, 0x10, 0x04, 0x40, 0x00, 0x00, 0x00,
+		0x40, 0x10}
+	b.Write(0x4000, []byte{0x11, 0x22, 0x33, 0x44})
+	b.Write(0x4010, []byte{0x55, 0x66, 0x77, 0x88})
+	c.a[0] = 0x4000
+	c.a[7] = 0x4010
+	c.d[1] = 0xfffffffc // -4
+	c.pc = pcStart
+
+	tests := []struct {
+		ea    uint32
+		size  uint32
+		ext   int // operand offset
+		value uint32
+		a0    uint32
+		a7    uint32
+	}{
+		{0x10, 1, 0, 0x11, 0x4000, 0x4010},       // (a0)
+		{0x18, 2, 0, 0x1122, 0x4002, 0x4010},     // (a0)+
+		{0x1f, 1, 0, 0x55, 0x4002, 0x4012},       // (a7)+
+		{0x27, 1, 0, 0x55, 0x4002, 0x4010},       // -(a7)
+		{0x20, 2, 0, 0x1122, 0x4000, 0x4010},     // -(a0)
+		{0x28, 4, 0, 0x55667788, 0x4000, 0x4010}, // $10(a0)
+		{0x30, 4, 2, 0x11223344, 0x4000, 0x4010}, // 4(a0,d1.w)
+		{0x38, 2, 4, 0x1122, 0x4000, 0x4010},     // $4000.w
+		{0x39, 1, 6, 0x55, 0x4000, 0x4010},       // $4010.l
+		{0x3c, 4, 0, 0x00101004, 0x4000, 0x4010}, // #$101004
+		{0x01, 2, 0, 0xfffc, 0x4000, 0x4010},     // d1
+		{0x0f, 4, 0, 0x4010, 0x4000, 0x4010},     // a7
+		{0x3a, 2, 0, 0x0000, 0x4000, 0x4010},     // $10(pc)
+		{0x3b, 1, 2, 0x00, 0x4000, 0x4010},       // 4(pc,d1.w)
+	}
+	for k, test := range tests {
+		c.size = test.size
+		c.ext = test.ext
+		v := fetchEA(c, test.ea, operand)
+		if v != test.value {
+			t.Fatalf("%v: ea 0x%x got 0x%x want 0x%x", k, test.ea, v,
+				test.value)
+		}
+		if c.a[0] != test.a0 || c.a[7] != test.a7 {
+			t.Fatalf("%v: ea 0x%x a0 0x%x a7 0x%x", k, test.ea, c.a[0],
+				c.a[7])
+		}
+	}
+
+	// only the low size bytes of a data register are stored
+	c.d[2] = 0x12345678
+	c.size = 1
+	storeEA(c, 0x02, 0xaabbccdd, operand)
+	if c.d[2] != 0x123456dd {
+		t.Fatalf("d2 0x%x != 0x123456dd", c.d[2])
+	}
+	c.size = 2
+	storeEA(c, 0x02, 0xaabbccdd, operand)
+	if c.d[2] != 0x1234ccdd {
+		t.Fatalf("d2 0x%x != 0x1234ccdd", c.d[2])
+	}
+}
+
+func TestPush(t *testing.T) {
+	b, c := newCpu()
+	b.Write(pcStart, []byte{0x2f, 0x00})   // move.l d0,-(a7)
+	b.Write(pcStart+2, []byte{0x24, 0x1f}) // move.l (a7)+,d2
+
+	c.d[0] = 0xdeadbeef
+	sp := c.a[7]
+	_, err := c.Step()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.a[7] != sp-4 {
+		t.Fatalf("sp 0x%x != 0x%x", c.a[7], sp-4)
+	}
+	if v := c.read32(c.a[7]); v != 0xdeadbeef {
+		t.Fatalf("stack 0x%x != 0xdeadbeef", v)
+	}
+	_, err = c.Step()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.a[7] != sp || c.d[2] != 0xdeadbeef {
+		t.Fatalf("sp 0x%x d2 0x%x", c.a[7], c.d[2])
+	}
+
+	tests := []struct {
+		opcode  uint16
+		operand []byte
+		text    string
+	}{
+		{0x2f00, operandNop, "move.l\td0,-(a7)"},
+		{0x2d68, []byte{0xff, 0xfe, 0x00, 0x08},
+			"move.l\t-$2(a0),$8(a6)"},
+		{0x21bb, []byte{0x98, 0x06, 0x00, 0x00},
+			"move.l\t$6(pc,a1.l),$0(a0,d0.w)"},
+		{0x23fc, []byte{0x12, 0x34, 0x56, 0x78, 0x00, 0xff, 0x00, 0x00},
+			"move.l\t#$12345678,$ff0000.l"},
+		{0x21f8, []byte{0x80, 0x00, 0x10, 0x00}, "move.l\t-$8000.w,$1000.w"},
+	}
+	for _, test := range tests {
+		d, n, err := opcodes[test.opcode].disassemble(c, test.opcode,
+			test.operand)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d != test.text || n != 2+len(test.operand) {
+			t.Fatalf("0x%04x: got %q %v want %q", test.opcode, d, n,
+				test.text)
+		}
+	}
+}
+
+func TestBitManipulation(t *testing.T) {
+	// data registers are longs, only Z is changed
+	tests := []struct {
+		name    string
+		code    []byte
+		d0, d1  uint32
+		ccr     uint16
+		wantD1  uint32
+		wantCCR uint16
+	}{
+		{"btst #3,d1", []byte{0x08, 0x01, 0x00, 0x03}, 0, 0x8, 0x04,
+			0x8, 0x00},
+		{"btst d0,d1", []byte{0x01, 0x01}, 35, 0x8, 0x1b, 0x8, 0x1b},
+		{"btst d0,d1", []byte{0x01, 0x01}, 2, 0x8, 0x1b, 0x8, 0x1f},
+		{"bset d0,d1", []byte{0x01, 0xc1}, 31, 0x0, 0x00,
+			0x80000000, 0x04},
+		{"bchg #33,d1", []byte{0x08, 0x41, 0x00, 0x21}, 0, 0x3, 0x00,
+			0x1, 0x00},
+		{"bchg d0,d1", []byte{0x01, 0x41}, 16, 0x0, 0x13,
+			0x10000, 0x17},
+		{"bclr d0,d1", []byte{0x01, 0x81}, 4, 0x30, 0x04,
+			0x20, 0x00},
+		{"bclr #0,d1", []byte{0x08, 0x81, 0x00, 0x00}, 0, 0x2, 0x00,
+			0x2, 0x04},
+	}
+	for _, test := range tests {
+		b, c := newCpu()
+		c.d[0] = test.d0
+		c.d[1] = test.d1
+		c.sr = c.sr&^ccrMask | test.ccr
+		run(t, b, c, test.code...)
+		if c.d[1] != test.wantD1 {
+			t.Fatalf("%v: d1 0x%x", test.name, c.d[1])
+		}
+		if c.sr&ccrMask != test.wantCCR {
+			t.Fatalf("%v: ccr %v want 0x%02x", test.name, c.ccr(),
+				test.wantCCR)
+		}
+		d, _, err := c.disassemble(pcStart)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d != strings.Replace(test.name, " ", "\t", 1) {
+			t.Fatalf("disassembled %q want %q", d, test.name)
+		}
+	}
+
+	// memory operands are bytes with bit numbers modulo 8
+	b, c := newCpu()
+	c.a[0] = 0x4000
+	c.d[0] = 9
+	b.Write(0x4000, []byte{0x01, 0x00})
+	run(t, b, c, 0x01, 0x50) // bchg d0,(a0)
+	if v := c.read16(0x4000); v != 0x0300 || c.sr&zero == 0 {
+		t.Fatalf("bchg 0x%04x ccr %v", v, c.ccr())
+	}
+	run(t, b, c, 0x08, 0x90, 0x00, 0x08) // bclr #8,(a0)
+	if v := c.read16(0x4000); v != 0x0200 || c.sr&zero != 0 {
+		t.Fatalf("bclr 0x%04x ccr %v", v, c.ccr())
+	}
+
+	// btst only reads memory and may test an immediate
+	b, c = newModel(t, M68000)
+	r := &recorder{}
+	if _, err := b.Attach(0x200000, r); err != nil {
+		t.Fatal(err)
+	}
+	c.a[0] = 0x200010
+	run(t, b, c, 0x08, 0x10, 0x00, 0x01) // btst #1,(a0)
+	if fmt.Sprint(r.cycles) != "[r10/1]" || c.sr&zero == 0 {
+		t.Fatalf("btst cycles %v ccr %v", r.cycles, c.ccr())
+	}
+	c.d[0] = 7
+	run(t, b, c, 0x01, 0x3c, 0x00, 0x81) // btst d0,#$81
+	if c.sr&zero != 0 {
+		t.Fatalf("btst immediate ccr %v", c.ccr())
+	}
+
+	// modifying a bit in the upper word of a register takes 2 more clock
+	// periods
+	for _, code := range [][]byte{
+		{0x08, 0x41, 0x00, 0x00}, // bchg #n,d1
+		{0x08, 0x81, 0x00, 0x00}, // bclr #n,d1
+		{0x08, 0xc1, 0x00, 0x00}, // bset #n,d1
+	} {
+		var cycles [2]int
+		for k, n := range []byte{15, 16} {
+			b, c := newCpu()
+			code[3] = n
+			b.Write(pcStart, code)
+			c.pc = pcStart
+			var err error
+			if cycles[k], err = c.Step(); err != nil {
+				t.Fatal(err)
+			}
+			cycles[k] -= c.stretch
+		}
+		if cycles[1] != cycles[0]+2 {
+			t.Fatalf("0x%02x%02x cycles %v", code[0], code[1],
+				cycles)
+		}
+	}
+}
+
+// run writes code at pcStart and executes it as a single instruction.
+func run(t *testing.T, b *bus.Bus, c *m68k, code ...byte) {
+	t.Helper()
+	b.Write(pcStart, code)
+	c.pc = pcStart
+	_, err := c.Step()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.pc != pcStart+uint32(len(code)) {
+		t.Fatalf("pc 0x%x != 0x%x", c.pc, pcStart+uint32(len(code)))
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    []byte
+		d0, d1  uint32
+		a1      uint32
+		ccr     uint16
+		wantD1  uint32
+		wantA1  uint32
+		wantCCR uint16
+	}{
+		{"add.b d0,d1", []byte{0xd2, 0x00}, 0x7f, 0x12345601, 0, 0,
+			0x12345680, 0, 0x0a},
+		{"add.w d0,d1", []byte{0xd2, 0x40}, 0xffff, 0x1, 0, 0,
+			0x0, 0, 0x15},
+		{"add.l d0,d1", []byte{0xd2, 0x80}, 0x80000000, 0x80000000, 0, 0,
+			0x0, 0, 0x17},
+		{"sub.l d0,d1", []byte{0x92, 0x80}, 0x1, 0x0, 0, 0,
+			0xffffffff, 0, 0x19},
+		{"sub.b d0,d1", []byte{0x92, 0x00}, 0x1, 0x80, 0, 0,
+			0x7f, 0, 0x02},
+		{"cmp.w d0,d1", []byte{0xb2, 0x40}, 0x5, 0x5, 0, 0x10,
+			0x5, 0, 0x14},
+		{"cmpa.w d0,a1", []byte{0xb2, 0xc0}, 0xffff, 0, 0xffffffff, 0,
+			0, 0xffffffff, 0x04},
+		{"cmpi.l #$1,d1", []byte{0x0c, 0x81, 0x00, 0x00, 0x00, 0x01}, 0,
+			0, 0, 0x10, 0, 0, 0x19},
+		{"negx.b d1", []byte{0x40, 0x01}, 0, 0, 0, 0x14,
+			0xff, 0, 0x19},
+		{"negx.b d1", []byte{0x40, 0x01}, 0, 0, 0, 0x04,
+			0x0, 0, 0x04},
+		{"addx.l d0,d1", []byte{0xd3, 0x80}, 0xffffffff, 0, 0, 0x14,
+			0x0, 0, 0x15},
+		{"addx.l d0,d1", []byte{0xd3, 0x80}, 0x1, 0, 0, 0x04,
+			0x1, 0, 0x00},
+		{"subx.w d0,d1", []byte{0x93, 0x40}, 0, 0, 0, 0x14,
+			0xffff, 0, 0x19},
+		{"neg.l d1", []byte{0x44, 0x81}, 0, 0x1, 0, 0,
+			0xffffffff, 0, 0x19},
+		{"neg.l d1", []byte{0x44, 0x81}, 0, 0x80000000, 0, 0,
+			0x80000000, 0, 0x1b},
+		{"neg.w d1", []byte{0x44, 0x41}, 0, 0x0, 0, 0x1f,
+			0x0, 0, 0x04},
+		{"addq.w #8,d1", []byte{0x50, 0x41}, 0, 0xfff8, 0, 0,
+			0x0, 0, 0x15},
+		{"addq.l #1,a1", []byte{0x52, 0x89}, 0, 0, 0xffffffff, 0x0a,
+			0, 0x0, 0x0a},
+		{"subq.w #1,a1", []byte{0x53, 0x49}, 0, 0, 0x10000, 0,
+			0, 0xffff, 0},
+		{"subq.b #1,d1", []byte{0x53, 0x01}, 0, 0x100, 0, 0,
+			0x1ff, 0, 0x19},
+		{"addi.w #$1234,d1", []byte{0x06, 0x41, 0x12, 0x34}, 0, 0, 0, 0,
+			0x1234, 0, 0x00},
+		{"subi.b #$1,d1", []byte{0x04, 0x01, 0x00, 0x01}, 0, 0x1, 0, 0,
+			0x0, 0, 0x04},
+		{"suba.w d0,a1", []byte{0x92, 0xc0}, 0xffff, 0, 0x0, 0x1f,
+			0, 0x1, 0x1f},
+		{"adda.w d0,a1", []byte{0xd2, 0xc0}, 0x8000, 0, 0x0, 0,
+			0, 0xffff8000, 0},
+	}
+	for _, test := range tests {
+		b, c := newCpu()
+		c.d[0] = test.d0
+		c.d[1] = test.d1
+		c.a[1] = test.a1
+		c.sr = test.ccr
+		run(t, b, c, test.code...)
+		if c.d[1] != test.wantD1 || c.a[1] != test.wantA1 {
+			t.Fatalf("%v: d1 0x%x a1 0x%x", test.name, c.d[1], c.a[1])
+		}
+		if c.sr&0x1f != test.wantCCR {
+			t.Fatalf("%v: ccr %v want 0x%02x", test.name, c.ccr(),
+				test.wantCCR)
+		}
+		d, _, err := c.disassemble(pcStart)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d != strings.Replace(test.name, " ", "\t", 1) {
+			t.Fatalf("disassembled %q want %q", d, test.name)
+		}
+	}
+}
+
+func TestMultiPrecision(t *testing.T) {
+	b, c := newCpu()
+	b.Write(0x4000, []byte{0x01, 0xff})
+	b.Write(0x4010, []byte{0x00, 0x01})
+	c.a[0] = 0x4002
+	c.a[1] = 0x4012
+	c.sr = zero
+
+	// addx.b -(a0),-(a1) twice
+	run(t, b, c, 0xd3, 0x08)
+	if c.sr&0x1f != 0x15 {
+		t.Fatalf("ccr %v", c.ccr())
+	}
+	run(t, b, c, 0xd3, 0x08)
+	if c.sr&0x1f != 0x00 {
+		t.Fatalf("ccr %v", c.ccr())
+	}
+	if v := c.read16(0x4010); v != 0x0200 || c.a[0] != 0x4000 ||
+		c.a[1] != 0x4010 {
+		t.Fatalf("result 0x%x a0 0x%x a1 0x%x", v, c.a[0], c.a[1])
+	}
+
+	// cmpm.w (a0)+,(a1)+
+	b.Write(0x4010, []byte{0x01, 0xff})
+	run(t, b, c, 0xb3, 0x48)
+	if c.sr&0x1f != 0x04 || c.a[0] != 0x4002 || c.a[1] != 0x4012 {
+		t.Fatalf("ccr %v a0 0x%x a1 0x%x", c.ccr(), c.a[0], c.a[1])
+	}
+	d, _, err := c.disassemble(pcStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d != "cmpm.w\t(a0)+,(a1)+" {
+		t.Fatalf("disassembled %q", d)
+	}
+}
+
+func TestLogical(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    []byte
+		d0, d1  uint32
+		ccr     uint16
+		wantD1  uint32
+		wantCCR uint16
+	}{
+		{"and.b d0,d1", []byte{0xc2, 0x00}, 0xf0, 0x12345688, 0x13,
+			0x12345680, 0x18},
+		{"and.l d0,d1", []byte{0xc2, 0x80}, 0x0f0f0f0f, 0xf0f0f0f0, 0x03,
+			0x0, 0x04},
+		{"or.w d0,d1", []byte{0x82, 0x40}, 0x8000, 0x0001, 0x00,
+			0x8001, 0x08},
+		{"eor.l d0,d1", []byte{0xb1, 0x81}, 0xffffffff, 0x0000ffff, 0x10,
+			0xffff0000, 0x18},
+		{"not.w d1", []byte{0x46, 0x41}, 0, 0x1234ffff, 0x1f,
+			0x12340000, 0x14},
+		{"andi.w #$ff,d1", []byte{0x02, 0x41, 0x00, 0xff}, 0, 0x1234, 0,
+			0x34, 0x00},
+		{"ori.b #$80,d1", []byte{0x00, 0x01, 0x00, 0x80}, 0, 0x1, 0,
+			0x81, 0x08},
+		{"eori.l #$ffffffff,d1", []byte{0x0a, 0x81, 0xff, 0xff, 0xff,
+			0xff}, 0, 0xffffffff, 0, 0x0, 0x04},
+		{"andi\t#$1b,ccr", []byte{0x02, 0x3c, 0x00, 0x1b}, 0, 0, 0x1f,
+			0, 0x1b},
+		{"ori\t#$4,ccr", []byte{0x00, 0x3c, 0x00, 0x04}, 0, 0, 0x10,
+			0, 0x14},
+		{"eori\t#$11,ccr", []byte{0x0a, 0x3c, 0x00, 0x11}, 0, 0, 0x10,
+			0, 0x01},
+		{"move.w\td0,ccr", []byte{0x44, 0xc0}, 0xff0a, 0, 0x00,
+			0, 0x0a},
+		{"move.w\tsr,d1", []byte{0x40, 0xc1}, 0, 0xffff0000, 0x01,
+			0xffff2701, 0x01},
+	}
+	for _, test := range tests {
+		b, c := newCpu()
+		c.d[0] = test.d0
+		c.d[1] = test.d1
+		c.sr = c.sr&^ccrMask | test.ccr
+		run(t, b, c, test.code...)
+		if c.d[1] != test.wantD1 {
+			t.Fatalf("%v: d1 0x%x", test.name, c.d[1])
+		}
+		if c.sr&ccrMask != test.wantCCR {
+			t.Fatalf("%v: ccr %v want 0x%02x", test.name, c.ccr(),
+				test.wantCCR)
+		}
+		d, _, err := c.disassemble(pcStart)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d != strings.Replace(test.name, " ", "\t", 1) {
+			t.Fatalf("disassembled %q want %q", d, test.name)
+		}
+	}
+}
+
+func TestStatusRegister(t *testing.T) {
+	b, c := newCpu()
+
+	// move.l a0,usp
+	c.a[0] = 0x3000
+	run(t, b, c, 0x4e, 0x60)
+	if c.usp != 0x3000 {
+		t.Fatalf("usp 0x%x", c.usp)
+	}
+
+	// andi #$dfff,sr drops into user mode and switches stacks
+	ssp := c.a[7]
+	run(t, b, c, 0x02, 0x7c, 0xdf, 0xff)
+	if c.sr != 0x0700 || c.a[7] != 0x3000 || c.ssp != ssp {
+		t.Fatalf("sr 0x%04x a7 0x%x ssp 0x%x", c.sr, c.a[7], c.ssp)
+	}
+
+	// ori #$2000,sr is a privilege violation
+	b.Write(vectorPrivilege*4, []byte{0x00, 0x00, 0x50, 0x00})
+	b.Write(pcStart, []byte{0x00, 0x7c, 0x20, 0x00})
+	c.pc = pcStart
+	c.sr |= zero
+	_, err := c.Step()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.pc != 0x5000 || c.sr != 0x2704 ||
+		c.a[7] != ssp-frameSize(c, vectorPrivilege) {
+		t.Fatalf("pc 0x%x sr 0x%04x a7 0x%x", c.pc, c.sr, c.a[7])
+	}
+	if sr, pc := c.read16(c.a[7]), c.read32(c.a[7]+2); sr != 0x0704 ||
+		pc != pcStart {
+		t.Fatalf("stacked sr 0x%04x pc 0x%x", sr, pc)
+	}
+	if c.usp != 0x3000 {
+		t.Fatalf("usp 0x%x", c.usp)
+	}
+
+	// move.l usp,a1
+	run(t, b, c, 0x4e, 0x69)
+	if c.a[1] != 0x3000 {
+		t.Fatalf("a1 0x%x", c.a[1])
+	}
+
+	// privilege is checked before the effective address is evaluated
+	tests := []struct {
+		model string
+		code  []byte
+	}{
+		{M68000, []byte{0x46, 0xd8}},             // move (a0)+,sr
+		{M68010, []byte{0x40, 0xe0}},             // move sr,-(a0)
+		{M68010, []byte{0x0e, 0x58, 0x10, 0x00}}, // moves.w (a0)+,d1
+		{M68020, []byte{0xf3, 0x20}},             // fsave -(a0)
+	}
+	for _, test := range tests {
+		b, c := newModel(t, test.model)
+		vectors(c)
+		c.setSR(0)
+		c.a[0] = 0x4000
+		b.Write(pcStart, test.code)
+		step(t, c, pcStart)
+		if c.pc != 0x10000+vectorPrivilege*4 || c.a[0] != 0x4000 {
+			t.Fatalf("%v %x: pc 0x%x a0 0x%x", test.model, test.code,
+				c.pc, c.a[0])
+		}
+	}
+}
+
+func TestShift(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    []byte
+		d0, d1  uint32
+		ccr     uint16
+		wantD1  uint32
+		wantCCR uint16
+	}{
+		{"asl.b #1,d1", []byte{0xe3, 0x01}, 0, 0xff40, 0x00,
+			0xff80, 0x0a},
+		{"asl.w #2,d1", []byte{0xe5, 0x41}, 0, 0xc000, 0x00,
+			0x0000, 0x17},
+		{"asr.w #1,d1", []byte{0xe2, 0x41}, 0, 0x8001, 0x00,
+			0xc000, 0x19},
+		{"asr.l #8,d1", []byte{0xe0, 0x81}, 0, 0x7fffffff, 0x00,
+			0x007fffff, 0x11},
+		{"lsr.l d0,d1", []byte{0xe0, 0xa9}, 0, 0x1, 0x11,
+			0x1, 0x10},
+		{"lsl.l d0,d1", []byte{0xe1, 0xa9}, 32, 0x1, 0x00,
+			0x0, 0x15},
+		{"lsr.b d0,d1", []byte{0xe0, 0x29}, 65, 0x03, 0x00,
+			0x01, 0x11},
+		{"rol.b #1,d1", []byte{0xe3, 0x19}, 0, 0x81, 0x10,
+			0x03, 0x11},
+		{"ror.w #4,d1", []byte{0xe8, 0x59}, 0, 0x000f, 0x00,
+			0xf000, 0x09},
+		{"rol.l d0,d1", []byte{0xe1, 0xb9}, 0, 0x1, 0x11,
+			0x1, 0x10},
+		{"roxl.b #1,d1", []byte{0xe3, 0x11}, 0, 0x80, 0x10,
+			0x01, 0x11},
+		{"roxr.l d0,d1", []byte{0xe0, 0xb1}, 0, 0x0, 0x10,
+			0x0, 0x15},
+		{"roxr.w #1,d1", []byte{0xe2, 0x51}, 0, 0x1, 0x00,
+			0x0, 0x15},
+		{"roxl.w d0,d1", []byte{0xe1, 0x71}, 17, 0x1234, 0x00,
+			0x1234, 0x00},
+	}
+	for _, test := range tests {
+		b, c := newCpu()
+		c.d[0] = test.d0
+		c.d[1] = test.d1
+		c.sr = c.sr&^ccrMask | test.ccr
+		run(t, b, c, test.code...)
+		if c.d[1] != test.wantD1 {
+			t.Fatalf("%v: d1 0x%x", test.name, c.d[1])
+		}
+		if c.sr&ccrMask != test.wantCCR {
+			t.Fatalf("%v: ccr %v want 0x%02x", test.name, c.ccr(),
+				test.wantCCR)
+		}
+		d, _, err := c.disassemble(pcStart)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d != strings.Replace(test.name, " ", "\t", 1) {
+			t.Fatalf("disassembled %q want %q", d, test.name)
+		}
+	}
+
+	// asl.w (a0)
+	b, c := newCpu()
+	b.Write(0x4000, []byte{0x40, 0x01})
+	c.a[0] = 0x4000
+	run(t, b, c, 0xe1, 0xd0)
+	if v := c.read16(0x4000); v != 0x8002 || c.sr&ccrMask != 0x0a {
+		t.Fatalf("asl.w (a0) 0x%x ccr %v", v, c.ccr())
+	}
+	d, _, err := c.disassemble(pcStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d != "asl.w\t(a0)" {
+		t.Fatalf("disassembled %q", d)
+	}
+}
+
+// step executes a single instruction at pc.
+func step(t *testing.T, c *m68k, pc uint32) {
+	t.Helper()
+	c.pc = pc
+	_, err := c.Step()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCondition(t *testing.T) {
+	// ccr values for which each condition is true
+	tests := []struct {
+		cc    uint16
+		holds []uint16
+		fails []uint16
+	}{
+		{0x00, []uint16{0x00, 0x1f}, nil},
+		{0x01, nil, []uint16{0x00, 0x1f}},
+		{0x02, []uint16{0x00, 0x0a}, []uint16{0x01, 0x04}},
+		{0x03, []uint16{0x01, 0x04}, []uint16{0x00, 0x0a}},
+		{0x04, []uint16{0x0e}, []uint16{0x01}},
+		{0x05, []uint16{0x01}, []uint16{0x0e}},
+		{0x06, []uint16{0x0b}, []uint16{0x04}},
+		{0x07, []uint16{0x04}, []uint16{0x0b}},
+		{0x08, []uint16{0x0d}, []uint16{0x02}},
+		{0x09, []uint16{0x02}, []uint16{0x0d}},
+		{0x0a, []uint16{0x07}, []uint16{0x08}},
+		{0x0b, []uint16{0x08}, []uint16{0x07}},
+		{0x0c, []uint16{0x00, 0x0a}, []uint16{0x08, 0x02}},
+		{0x0d, []uint16{0x08, 0x02}, []uint16{0x00, 0x0a}},
+		{0x0e, []uint16{0x00, 0x0a}, []uint16{0x04, 0x08, 0x0e}},
+		{0x0f, []uint16{0x04, 0x08, 0x02}, []uint16{0x00, 0x0a}},
+	}
+	_, c := newCpu()
+	for _, test := range tests {
+		for _, ccr := range test.holds {
+			c.sr = ccr
+			if !c.condition(test.cc) {
+				t.Fatalf("%v false with ccr 0x%02x", conditions[test.cc],
+					ccr)
+			}
+		}
+		for _, ccr := range test.fails {
+			c.sr = ccr
+			if c.condition(test.cc) {
+				t.Fatalf("%v true with ccr 0x%02x", conditions[test.cc],
+					ccr)
+			}
+		}
+	}
+}
+
+func TestProgramControl(t *testing.T) {
+	b, c := newCpu()
+
+	// bne.s *+$10
+	b.Write(pcStart, []byte{0x66, 0x0e})
+	c.sr &^= zero
+	step(t, c, pcStart)
+	if c.pc != pcStart+0x10 {
+		t.Fatalf("bne taken pc 0x%x", c.pc)
+	}
+	c.sr |= zero
+	step(t, c, pcStart)
+	if c.pc != pcStart+2 {
+		t.Fatalf("bne not taken pc 0x%x", c.pc)
+	}
+
+	// bra.w *-$2
+	b.Write(pcStart, []byte{0x60, 0x00, 0xff, 0xfc})
+	step(t, c, pcStart)
+	if c.pc != pcStart-2 {
+		t.Fatalf("bra pc 0x%x", c.pc)
+	}
+	d, _, err := c.disassemble(pcStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d != "bra.w\t*-$2" {
+		t.Fatalf("disassembled %q", d)
+	}
+
+	// bsr.s *+$20 and rts
+	sp := c.a[7]
+	b.Write(pcStart, []byte{0x61, 0x1e})
+	b.Write(pcStart+0x20, []byte{0x4e, 0x75})
+	step(t, c, pcStart)
+	if c.pc != pcStart+0x20 || c.a[7] != sp-4 ||
+		c.read32(c.a[7]) != pcStart+2 {
+		t.Fatalf("bsr pc 0x%x sp 0x%x", c.pc, c.a[7])
+	}
+	step(t, c, c.pc)
+	if c.pc != pcStart+2 || c.a[7] != sp {
+		t.Fatalf("rts pc 0x%x sp 0x%x", c.pc, c.a[7])
+	}
+
+	// dbf d0,*+$0
+	b.Write(pcStart, []byte{0x51, 0xc8, 0xff, 0xfe})
+	c.d[0] = 0xabcd0002
+	for _, want := range []uint32{pcStart, pcStart, pcStart + 4} {
+		step(t, c, pcStart)
+		if c.pc != want {
+			t.Fatalf("dbf pc 0x%x != 0x%x", c.pc, want)
+		}
+	}
+	if c.d[0] != 0xabcdffff {
+		t.Fatalf("dbf d0 0x%x", c.d[0])
+	}
+	d, _, err = c.disassemble(pcStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d != "dbf\td0,*+$0" {
+		t.Fatalf("disassembled %q", d)
+	}
+
+	// dbeq d0,*+$0 terminates on condition
+	b.Write(pcStart, []byte{0x57, 0xc8, 0xff, 0xfe})
+	c.sr |= zero
+	step(t, c, pcStart)
+	if c.pc != pcStart+4 || c.d[0] != 0xabcdffff {
+		t.Fatalf("dbeq pc 0x%x d0 0x%x", c.pc, c.d[0])
+	}
+
+	// seq d1, sne d1
+	c.d[1] = 0x12345600
+	run(t, b, c, 0x57, 0xc1)
+	if c.d[1] != 0x123456ff {
+		t.Fatalf("seq d1 0x%x", c.d[1])
+	}
+	run(t, b, c, 0x56, 0xc1)
+	if c.d[1] != 0x12345600 {
+		t.Fatalf("sne d1 0x%x", c.d[1])
+	}
+
+	// jmp (a0), jsr $10(a0)
+	c.a[0] = 0x3000
+	b.Write(pcStart, []byte{0x4e, 0xd0})
+	step(t, c, pcStart)
+	if c.pc != 0x3000 {
+		t.Fatalf("jmp pc 0x%x", c.pc)
+	}
+	b.Write(pcStart, []byte{0x4e, 0xa8, 0x00, 0x10})
+	step(t, c, pcStart)
+	if c.pc != 0x3010 || c.read32(c.a[7]) != pcStart+4 {
+		t.Fatalf("jsr pc 0x%x", c.pc)
+	}
+	d, _, err = c.disassemble(pcStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d != "jsr\t$10(a0)" {
+		t.Fatalf("disassembled %q", d)
+	}
+
+	// rtr only restores the condition codes
+	c.push32(0x2000)
+	c.push16(0xff1f)
+	b.Write(pcStart, []byte{0x4e, 0x77})
+	step(t, c, pcStart)
+	if c.pc != 0x2000 || c.sr != 0x271f {
+		t.Fatalf("rtr pc 0x%x sr 0x%04x", c.pc, c.sr)
+	}
+
+	// rte to user mode switches to the user stack
+	c.usp = 0x5000
+	if c.model.frames != frames68000 {
+		c.push16(0) // format 0
+	}
+	c.push32(0x2100)
+	c.push16(0x0004)
+	b.Write(pcStart, []byte{0x4e, 0x73})
+	step(t, c, pcStart)
+	if c.pc != 0x2100 || c.sr != 0x0004 || c.a[7] != 0x5000 {
+		t.Fatalf("rte pc 0x%x sr 0x%04x a7 0x%x", c.pc, c.sr, c.a[7])
+	}
+}
+
+func TestMultiplyDivide(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    []byte
+		d0, d1  uint32
+		ccr     uint16
+		wantD1  uint32
+		wantCCR uint16
+	}{
+		{"mulu.w d0,d1", []byte{0xc2, 0xc0}, 0xffff, 0x1234ffff, 0x03,
+			0xfffe0001, 0x08},
+		{"muls.w d0,d1", []byte{0xc3, 0xc0}, 0xffff, 0x2, 0x00,
+			0xfffffffe, 0x08},
+		{"muls.w d0,d1", []byte{0xc3, 0xc0}, 0x10000, 0x1234, 0x10,
+			0x0, 0x14},
+		{"divu.w d0,d1", []byte{0x82, 0xc0}, 7, 100, 0x13,
+			0x0002000e, 0x10},
+		{"divu.w d0,d1", []byte{0x82, 0xc0}, 1, 0x10000, 0x05,
+			0x10000, 0x0a},
+		{"divs.w d0,d1", []byte{0x83, 0xc0}, 2, 0xfffffff9, 0x00,
+			0xfffffffd, 0x08},
+		{"divs.w d0,d1", []byte{0x83, 0xc0}, 0xffff, 0x80000000, 0x00,
+			0x80000000, 0x0a},
+		{"divs.w #$10,d1", []byte{0x83, 0xfc, 0x00, 0x10}, 0, 0x100,
+			0x00, 0x10, 0x00},
+	}
+	for _, test := range tests {
+		b, c := newCpu()
+		c.d[0] = test.d0
+		c.d[1] = test.d1
+		c.sr = c.sr&^ccrMask | test.ccr
+		run(t, b, c, test.code...)
+		if c.d[1] != test.wantD1 {
+			t.Fatalf("%v: d1 0x%x", test.name, c.d[1])
+		}
+		if c.sr&ccrMask != test.wantCCR {
+			t.Fatalf("%v: ccr %v want 0x%02x", test.name, c.ccr(),
+				test.wantCCR)
+		}
+		d, _, err := c.disassemble(pcStart)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d != strings.Replace(test.name, " ", "\t", 1) {
+			t.Fatalf("disassembled %q want %q", d, test.name)
+		}
+	}
+
+	// divu.w #0,d1 takes the zero divide exception
+	b, c := newCpu()
+	b.Write(vectorZeroDivide*4, []byte{0x00, 0x00, 0x60, 0x00})
+	b.Write(pcStart, []byte{0x82, 0xfc, 0x00, 0x00})
+	c.d[1] = 0x1234
+	sp := c.a[7]
+	step(t, c, pcStart)
+	if c.pc != 0x6000 || c.d[1] != 0x1234 ||
+		c.a[7] != sp-frameSize(c, vectorZeroDivide) {
+		t.Fatalf("pc 0x%x d1 0x%x a7 0x%x", c.pc, c.d[1], c.a[7])
+	}
+	if pc := c.read32(c.a[7] + 2); pc != pcStart+4 {
+		t.Fatalf("stacked pc 0x%x", pc)
+	}
+	if c.sr&ccrMask != zero {
+		t.Fatalf("ccr %v", c.ccr())
+	}
+}
+
+func TestBCD(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    []byte
+		d0, d1  uint32
+		ccr     uint16
+		wantD1  uint32
+		wantCCR uint16
+	}{
+		{"abcd.b d0,d1", []byte{0xc3, 0x00}, 0x38, 0x45, 0x04,
+			0x83, 0x0a},
+		{"abcd.b d0,d1", []byte{0xc3, 0x00}, 0x01, 0xff99, 0x04,
+			0xff00, 0x15},
+		{"abcd.b d0,d1", []byte{0xc3, 0x00}, 0x00, 0x09, 0x14,
+			0x10, 0x00},
+		{"abcd.b d0,d1", []byte{0xc3, 0x00}, 0x00, 0x0f, 0x00,
+			0x15, 0x00},
+		{"abcd.b d0,d1", []byte{0xc3, 0x00}, 0x3f, 0x40, 0x00,
+			0x85, 0x0a},
+		{"sbcd.b d0,d1", []byte{0x83, 0x00}, 0x38, 0x83, 0x04,
+			0x45, 0x00},
+		{"sbcd.b d0,d1", []byte{0x83, 0x00}, 0x01, 0x00, 0x04,
+			0x99, 0x19},
+		{"sbcd.b d0,d1", []byte{0x83, 0x00}, 0x00, 0x10, 0x14,
+			0x09, 0x00},
+		{"nbcd.b d1", []byte{0x48, 0x01}, 0, 0x01, 0x04,
+			0x99, 0x19},
+		{"nbcd.b d1", []byte{0x48, 0x01}, 0, 0x00, 0x04,
+			0x00, 0x04},
+	}
+	for _, test := range tests {
+		b, c := newCpu()
+		c.d[0] = test.d0
+		c.d[1] = test.d1
+		c.sr = c.sr&^ccrMask | test.ccr
+		run(t, b, c, test.code...)
+		if c.d[1] != test.wantD1 {
+			t.Fatalf("%v: d1 0x%x", test.name, c.d[1])
+		}
+		if c.sr&ccrMask != test.wantCCR {
+			t.Fatalf("%v: ccr %v want 0x%02x", test.name, c.ccr(),
+				test.wantCCR)
+		}
+		d, _, err := c.disassemble(pcStart)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d != strings.Replace(test.name, " ", "\t", 1) {
+			t.Fatalf("disassembled %q want %q", d, test.name)
+		}
+	}
+
+	// abcd.b -(a0),-(a1) on 1234 + 0766
+	b, c := newCpu()
+	b.Write(0x4000, []byte{0x07, 0x66})
+	b.Write(0x4010, []byte{0x12, 0x34})
+	c.a[0] = 0x4002
+	c.a[1] = 0x4012
+	c.sr |= zero
+	run(t, b, c, 0xc3, 0x08)
+	run(t, b, c, 0xc3, 0x08)
+	if v := c.read16(0x4010); v != 0x2000 || c.sr&ccrMask != 0x00 {
+		t.Fatalf("abcd 0x%x ccr %v", v, c.ccr())
+	}
+}
+
+func TestDataMovement(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    []byte
+		d0, d1  uint32
+		ccr     uint16
+		wantD1  uint32
+		wantCCR uint16
+	}{
+		{"move.b d0,d1", []byte{0x12, 0x00}, 0x80, 0x12345678, 0x03,
+			0x12345680, 0x08},
+		{"move.w d0,d1", []byte{0x32, 0x00}, 0x10000, 0x12345678, 0x10,
+			0x12340000, 0x14},
+		{"moveq #-$1,d1", []byte{0x72, 0xff}, 0, 0, 0x03,
+			0xffffffff, 0x08},
+		{"swap d1", []byte{0x48, 0x41}, 0, 0x12348765, 0x00,
+			0x87651234, 0x08},
+		{"ext.w d1", []byte{0x48, 0x81}, 0, 0x12345680, 0x00,
+			0x1234ff80, 0x08},
+		{"ext.l d1", []byte{0x48, 0xc1}, 0, 0x12347fff, 0x08,
+			0x00007fff, 0x00},
+		{"clr.b d1", []byte{0x42, 0x01}, 0, 0x12345678, 0x1b,
+			0x12345600, 0x14},
+		{"tst.l d1", []byte{0x4a, 0x81}, 0, 0x0, 0x13,
+			0x0, 0x14},
+		{"tas d1", []byte{0x4a, 0xc1}, 0, 0x12345600, 0x00,
+			0x12345680, 0x04},
+		{"tas d1", []byte{0x4a, 0xc1}, 0, 0x80, 0x00,
+			0x80, 0x08},
+	}
+	for _, test := range tests {
+		b, c := newCpu()
+		c.d[0] = test.d0
+		c.d[1] = test.d1
+		c.sr = c.sr&^ccrMask | test.ccr
+		run(t, b, c, test.code...)
+		if c.d[1] != test.wantD1 {
+			t.Fatalf("%v: d1 0x%x", test.name, c.d[1])
+		}
+		if c.sr&ccrMask != test.wantCCR {
+			t.Fatalf("%v: ccr %v want 0x%02x", test.name, c.ccr(),
+				test.wantCCR)
+		}
+		d, _, err := c.disassemble(pcStart)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d != strings.Replace(test.name, " ", "\t", 1) {
+			t.Fatalf("disassembled %q want %q", d, test.name)
+		}
+	}
+
+	b, c := newCpu()
+	sp := c.a[7]
+
+	// movem.l d0-d1/a0,-(a7) stores d0 at the lowest address
+	c.d[0], c.d[1], c.a[0] = 0x11111111, 0x22222222, 0x33333333
+	run(t, b, c, 0x48, 0xe7, 0xc0, 0x80)
+	if c.a[7] != sp-12 {
+		t.Fatalf("movem a7 0x%x", c.a[7])
+	}
+	for k, v := range []uint32{0x11111111, 0x22222222, 0x33333333} {
+		if got := c.read32(c.a[7] + uint32(k)*4); got != v {
+			t.Fatalf("movem 0x%x: 0x%x != 0x%x", c.a[7]+uint32(k)*4,
+				got, v)
+		}
+	}
+
+	// movem.l (a7)+,d2-d3/a1
+	run(t, b, c, 0x4c, 0xdf, 0x02, 0x0c)
+	if c.a[7] != sp || c.d[2] != 0x11111111 || c.d[3] != 0x22222222 ||
+		c.a[1] != 0x33333333 {
+		t.Fatalf("movem a7 0x%x d2 0x%x d3 0x%x a1 0x%x", c.a[7],
+			c.d[2], c.d[3], c.a[1])
+	}
+
+	// movem.w (a0),d4 sign extends
+	b.Write(0x4000, []byte{0x80, 0x00})
+	c.a[0] = 0x4000
+	run(t, b, c, 0x4c, 0x90, 0x00, 0x10)
+	if c.d[4] != 0xffff8000 {
+		t.Fatalf("movem.w d4 0x%x", c.d[4])
+	}
+
+	// movep.l d0,$1(a0) then movep.w $3(a0),d1
+	c.d[0] = 0x11223344
+	c.d[1] = 0xffffffff
+	run(t, b, c, 0x01, 0xc8, 0x00, 0x01)
+	if v := c.read32(0x4000); v != 0x80110022 {
+		t.Fatalf("movep.l 0x%x", v)
+	}
+	if v := c.read32(0x4004); v != 0x00330044 {
+		t.Fatalf("movep.l 0x%x", v)
+	}
+	run(t, b, c, 0x03, 0x08, 0x00, 0x05)
+	if c.d[1] != 0xffff3344 {
+		t.Fatalf("movep.w d1 0x%x", c.d[1])
+	}
+
+	// link a6,#-$8 and unlk a6
+	c.a[6] = 0xa6a6a6a6
+	run(t, b, c, 0x4e, 0x56, 0xff, 0xf8)
+	if c.a[6] != sp-4 || c.a[7] != sp-12 || c.read32(sp-4) != 0xa6a6a6a6 {
+		t.Fatalf("link a6 0x%x a7 0x%x", c.a[6], c.a[7])
+	}
+	run(t, b, c, 0x4e, 0x5e)
+	if c.a[6] != 0xa6a6a6a6 || c.a[7] != sp {
+		t.Fatalf("unlk a6 0x%x a7 0x%x", c.a[6], c.a[7])
+	}
+
+	// link a7,#-$8
+	run(t, b, c, 0x4e, 0x57, 0xff, 0xf8)
+	if c.a[7] != sp-12 || c.read32(sp-4) != sp-4 {
+		t.Fatalf("link a7 0x%x (a7) 0x%x", c.a[7], c.read32(sp-4))
+	}
+	c.a[7] = sp
+
+	// lea $10(a0),a1 and pea (a1)
+	run(t, b, c, 0x43, 0xe8, 0x00, 0x10)
+	if c.a[1] != 0x4010 {
+		t.Fatalf("lea a1 0x%x", c.a[1])
+	}
+	run(t, b, c, 0x48, 0x51)
+	if c.a[7] != sp-4 || c.read32(c.a[7]) != 0x4010 {
+		t.Fatalf("pea a7 0x%x", c.a[7])
+	}
+
+	// exg d0,a1 and movea.w d0,a1
+	run(t, b, c, 0xc1, 0x89)
+	if c.d[0] != 0x4010 || c.a[1] != 0x11223344 {
+		t.Fatalf("exg d0 0x%x a1 0x%x", c.d[0], c.a[1])
+	}
+	c.d[0] = 0x8000
+	run(t, b, c, 0x32, 0x40)
+	if c.a[1] != 0xffff8000 {
+		t.Fatalf("movea.w a1 0x%x", c.a[1])
+	}
+
+	// tas is a byte read-modify-write of memory
+	b.Write(0x4000, []byte{0x01})
+	run(t, b, c, 0x4a, 0xd0)
+	if v := c.read8(0x4000); v != 0x81 {
+		t.Fatalf("tas 0x%x", v)
+	}
+
+	// peripherals that observe read-modify-write cycles see tas as one
+	// indivisible cycle, others see a read followed by a write
+	plain, locked := &recorder{}, &lockRecorder{}
+	observers := []struct {
+		peripheral bus.Buser
+		r          *recorder
+		cycles     string
+	}{
+		{plain, plain, "[r10/1 w10/1]"},
+		{locked, &locked.recorder, "[rmw10/1]"},
+	}
+	for _, test := range observers {
+		b, c := newModel(t, M68000)
+		if _, err := b.Attach(0x200000, test.peripheral); err != nil {
+			t.Fatal(err)
+		}
+		test.r.data[0x10] = 0x01
+		c.a[0] = 0x200010
+		run(t, b, c, 0x4a, 0xd0)
+		if test.r.data[0x10] != 0x81 ||
+			fmt.Sprint(test.r.cycles) != test.cycles {
+			t.Fatalf("tas 0x%x cycles %v", test.r.data[0x10],
+				test.r.cycles)
+		}
+	}
+
+	dis := []struct {
+		opcode  uint16
+		operand []byte
+		text    string
+	}{
+		{0x48e7, []byte{0xc0, 0x80}, "movem.l\td0-d1/a0,-(a7)"},
+		{0x4cdf, []byte{0x7f, 0x3f}, "movem.l\t(a7)+,d0-d5/a0-a6"},
+		{0x48a0, []byte{0x00, 0x01}, "movem.w\ta7,-(a0)"},
+		{0x01c8, []byte{0x00, 0x01}, "movep.l\td0,$1(a0)"},
+		{0x0308, []byte{0xff, 0xfe}, "movep.w\t-$2(a0),d1"},
+		{0x4e56, []byte{0xff, 0xf8}, "link\ta6,#-$8"},
+		{0x4e5e, operandNop, "unlk\ta6"},
+		{0x43e8, []byte{0x00, 0x10}, "lea\t$10(a0),a1"},
+		{0x4851, operandNop, "pea\t(a1)"},
+		{0xc189, operandNop, "exg\td0,a1"},
+		{0xcd4f, operandNop, "exg\ta6,a7"},
+		{0x3240, operandNop, "movea.w\td0,a1"},
+		{0x4ad0, operandNop, "tas\t(a0)"},
+		{0x08d0, []byte{0x00, 0x07}, "bset\t#7,(a0)"},
+	}
+	for _, test := range dis {
+		d, n, err := opcodes[test.opcode].disassemble(c, test.opcode,
+			test.operand)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d != test.text || n != 2+len(test.operand) {
+			t.Fatalf("0x%04x: got %q %v want %q", test.opcode, d, n,
+				test.text)
+		}
+	}
+}
+
+// frameSize returns the size of the exception stack frame of vector for all
+// but group 0 exceptions.
+func frameSize(c *m68k, vector uint32) uint32 {
+	switch c.model.frames {
+	case frames68000:
+		return 6
+	case frames68020, framesCPU32:
+		switch vector {
+		case vectorZeroDivide, vectorCHK, vectorTRAPV, vectorTrace:
+			return 12
+		}
+	}
+	return 8
+}
+
+// vectors points every exception vector to $10000 + vector * 4.
+func vectors(c *m68k) {
+	for v := uint32(2); v < 256; v++ {
+		c.write32(v*4, 0x10000+v*4)
+	}
+}
+
+func TestException(t *testing.T) {
+	tests := []struct {
+		name   string
+		code   []byte
+		d0, d1 uint32
+		ccr    uint16
+		vector uint32 // 0 for no exception
+		pc     uint32 // stacked program counter
+	}{
+		{"trap #3", []byte{0x4e, 0x43}, 0, 0, 0x00, vectorTrap + 3,
+			pcStart + 2},
+		{"trapv", []byte{0x4e, 0x76}, 0, 0, 0x00, 0, 0},
+		{"trapv", []byte{0x4e, 0x76}, 0, 0, 0x02, vectorTRAPV,
+			pcStart + 2},
+		{"chk.w d0,d1", []byte{0x43, 0x80}, 10, 10, 0x00, 0, 0},
+		{"chk.w d0,d1", []byte{0x43, 0x80}, 10, 0xffff, 0x00, vectorCHK,
+			pcStart + 2},
+		{"chk.w d0,d1", []byte{0x43, 0x80}, 10, 11, 0x08, vectorCHK,
+			pcStart + 2},
+		{"chk.w #$20,d1", []byte{0x43, 0xbc, 0x00, 0x20}, 0, 0x21, 0x00,
+			vectorCHK, pcStart + 4},
+		{"illegal", []byte{0x4a, 0xfc}, 0, 0, 0x00, vectorIllegal,
+			pcStart},
+		{"", []byte{0x4a, 0xc9}, 0, 0, 0x00, vectorIllegal, pcStart},
+		{"", []byte{0xa1, 0x23}, 0, 0, 0x00, vectorLineA, pcStart},
+		{"", []byte{0xff, 0xff}, 0, 0, 0x00, vectorLineF, pcStart},
+	}
+	for _, test := range tests {
+		b, c := newCpu()
+		vectors(c)
+		c.d[0] = test.d0
+		c.d[1] = test.d1
+		c.sr = c.sr&^ccrMask | test.ccr
+		sp := c.a[7]
+		b.Write(pcStart, test.code)
+		step(t, c, pcStart)
+
+		if test.name != "" {
+			d, _, err := c.disassemble(pcStart)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d != strings.Replace(test.name, " ", "\t", 1) {
+				t.Fatalf("disassembled %q want %q", d, test.name)
+			}
+		}
+		if test.vector == 0 {
+			if c.pc != pcStart+uint32(len(test.code)) || c.a[7] != sp {
+				t.Fatalf("%v: pc 0x%x a7 0x%x", test.name, c.pc,
+					c.a[7])
+			}
+			continue
+		}
+		if c.pc != 0x10000+test.vector*4 ||
+			c.a[7] != sp-frameSize(c, test.vector) {
+			t.Fatalf("%v: pc 0x%x a7 0x%x", test.name, c.pc, c.a[7])
+		}
+		if sr := c.read16(c.a[7]); sr != c.sr {
+			t.Fatalf("%v: stacked sr 0x%04x", test.name, sr)
+		}
+		if pc := c.read32(c.a[7] + 2); pc != test.pc {
+			t.Fatalf("%v: stacked pc 0x%x", test.name, pc)
+		}
+	}
+
+	// chk sets N when Dn is negative and clears it when above the bound
+	b, c := newCpu()
+	vectors(c)
+	c.d[0], c.d[1] = 10, 0x8000
+	b.Write(pcStart, []byte{0x43, 0x80})
+	step(t, c, pcStart)
+	if c.sr&ccrMask != negative {
+		t.Fatalf("chk ccr %v", c.ccr())
+	}
+
+	// privilege violation from user mode switches to the supervisor stack
+	b, c = newCpu()
+	vectors(c)
+	ssp := c.a[7]
+	c.setSR(0)
+	c.a[7] = 0x5000
+	b.Write(pcStart, []byte{0x46, 0xfc, 0x27, 0x00}) // move #$2700,sr
+	step(t, c, pcStart)
+	if c.pc != 0x10000+vectorPrivilege*4 || c.a[7] != ssp-frameSize(c, vectorPrivilege) ||
+		c.usp != 0x5000 || c.sr&supervisor == 0 {
+		t.Fatalf("privilege pc 0x%x a7 0x%x usp 0x%x sr 0x%04x", c.pc,
+			c.a[7], c.usp, c.sr)
+	}
+	if pc := c.read32(c.a[7] + 2); pc != pcStart {
+		t.Fatalf("privilege stacked pc 0x%x", pc)
+	}
+
+	// group 0 frame, Test68010BusError covers format 8 and Test68020BusError
+	// format A
+	b, c = newCpu()
+	if c.model.frames != frames68000 {
+		return
+	}
+	ssp = c.a[7]
+	c.ir = 0x3010
+	c.process(exception{vector: vectorAddressError, pc: 0x1234,
+		address: 0x4001, access: accessRead | accessNotInstruction |
+			functionSupervisorData})
+	if c.a[7] != ssp-14 || c.pc != c.read32(vectorAddressError*4) {
+		t.Fatalf("group 0 a7 0x%x pc 0x%x", c.a[7], c.pc)
+	}
+	frame := []uint32{
+		uint32(c.read16(c.a[7])), c.read32(c.a[7] + 2),
+		uint32(c.read16(c.a[7] + 6)), uint32(c.read16(c.a[7] + 8)),
+		c.read32(c.a[7] + 10),
+	}
+	want := []uint32{0x1d, 0x4001, 0x3010, 0x2700, 0x1234}
+	for k := range frame {
+		if frame[k] != want[k] {
+			t.Fatalf("group 0 frame %x want %x", frame, want)
+		}
+	}
+}
+
+func TestInterrupt(t *testing.T) {
+	b, c := newCpu()
+	vectors(c)
+	for a := uint32(0x10000); a < 0x10400; a += 2 {
+		c.write16(a, 0x4e71) // nop
+	}
+	b.Write(pcStart, []byte{0x4e, 0x71})
+
+	// masked
+	c.Interrupt(3, cpu.Autovector)
+	step(t, c, pcStart)
+	if c.pc != pcStart+2 {
+		t.Fatalf("masked pc 0x%x", c.pc)
+	}
+
+	tests := []struct {
+		level  int
+		device cpu.Acknowledger
+		vector uint32
+	}{
+		{3, cpu.Autovector, vectorAutovector + 3},
+		{5, cpu.Vector(64), 64},
+		{2, cpu.Spurious, vectorSpurious},
+	}
+	for _, test := range tests {
+		b, c = newCpu()
+		vectors(c)
+		c.setSR(supervisor | 1<<8)
+		sp := c.a[7]
+		c.Interrupt(test.level, test.device)
+		step(t, c, pcStart)
+		if c.pc != 0x10000+test.vector*4 ||
+			c.a[7] != sp-frameSize(c, test.vector) {
+			t.Fatalf("level %v: pc 0x%x a7 0x%x", test.level, c.pc,
+				c.a[7])
+		}
+		if c.sr != supervisor|uint16(test.level)<<8 {
+			t.Fatalf("level %v: sr 0x%04x", test.level, c.sr)
+		}
+		if sr := c.read16(c.a[7]); sr != supervisor|1<<8 {
+			t.Fatalf("level %v: stacked sr 0x%04x", test.level, sr)
+		}
+		if pc := c.read32(c.a[7] + 2); pc != pcStart {
+			t.Fatalf("level %v: stacked pc 0x%x", test.level, pc)
+		}
+	}
+
+	// the interrupt is not taken again at the same level and taken again
+	// once the mask is lowered until it is negated
+	b, c = newCpu()
+	vectors(c)
+	for a := uint32(0x10000); a < 0x10400; a += 2 {
+		c.write16(a, 0x4e71) // nop
+	}
+	c.setSR(supervisor)
+	c.Interrupt(4, cpu.Autovector)
+	step(t, c, pcStart)
+	handler := c.pc
+	step(t, c, handler)
+	if c.pc != handler+2 {
+		t.Fatalf("same level pc 0x%x", c.pc)
+	}
+	c.setSR(supervisor | 3<<8)
+	step(t, c, handler+2)
+	if c.pc != handler {
+		t.Fatalf("lowered mask pc 0x%x", c.pc)
+	}
+	c.Interrupt(4, nil)
+	c.setSR(supervisor)
+	step(t, c, handler)
+	if c.pc != handler+2 {
+		t.Fatalf("negated pc 0x%x", c.pc)
+	}
+
+	// level 7 is taken once per transition regardless of the mask
+	c.setSR(supervisor | interruptMask)
+	c.Interrupt(7, cpu.Autovector)
+	step(t, c, pcStart)
+	nmi := uint32(0x10000 + (vectorAutovector+7)*4)
+	if c.pc != nmi {
+		t.Fatalf("nmi pc 0x%x", c.pc)
+	}
+	step(t, c, nmi)
+	if c.pc != nmi+2 {
+		t.Fatalf("nmi retaken pc 0x%x", c.pc)
+	}
+	c.Interrupt(7, nil)
+	c.Interrupt(7, cpu.Autovector)
+	step(t, c, pcStart)
+	if c.pc != nmi {
+		t.Fatalf("second nmi pc 0x%x", c.pc)
+	}
+}
+
+func TestAddressError(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    []byte
+		user    bool
+		address uint32
+		access  uint16
+	}{
+		{"move.w (a0),d0", []byte{0x30, 0x10}, false, 0x4001,
+			accessRead | accessNotInstruction | functionSupervisorData},
+		{"move.l d0,(a0)", []byte{0x20, 0x80}, false, 0x4001,
+			accessNotInstruction | functionSupervisorData},
+		{"move.l d0,(a0)", []byte{0x20, 0x80}, true, 0x4001,
+			accessNotInstruction | functionUserData},
+		{"jmp (a0)", []byte{0x4e, 0xd0}, false, 0x4001,
+			accessRead | functionSupervisorProgram},
+	}
+	for _, test := range tests {
+		b, c := newCpu()
+		vectors(c)
+		ssp := c.a[7]
+		if test.user {
+			c.setSR(0)
+		}
+		c.a[0] = 0x4001
+		b.Write(pcStart, test.code)
+		step(t, c, pcStart)
+		if test.name == "jmp (a0)" {
+			// the fault happens on the instruction fetch
+			step(t, c, c.pc)
+		}
+		if c.pc != 0x10000+vectorAddressError*4 || c.a[7] != ssp-14 {
+			t.Fatalf("%v: pc 0x%x a7 0x%x", test.name, c.pc, c.a[7])
+		}
+		if access := c.read16(c.a[7]); access != test.access {
+			t.Fatalf("%v: access 0x%04x", test.name, access)
+		}
+		if address := c.read32(c.a[7] + 2); address != test.address {
+			t.Fatalf("%v: address 0x%x", test.name, address)
+		}
+		if ir := c.read16(c.a[7] + 6); test.name != "jmp (a0)" &&
+			ir != binary.BigEndian.Uint16(test.code) {
+			t.Fatalf("%v: ir 0x%04x", test.name, ir)
+		}
+	}
+
+	// byte accesses may be odd
+	b, c := newCpu()
+	c.a[0] = 0x4001
+	run(t, b, c, 0x10, 0x10) // move.b (a0),d0
+
+	// an odd supervisor stack double faults
+	b, c = newCpu()
+	vectors(c)
+	c.a[7] = 0x3001
+	b.Write(pcStart, []byte{0x4e, 0x40}) // trap #0
+	c.pc = pcStart
+	if _, err := c.Step(); err != cpu.ErrHalted {
+		t.Fatalf("double fault %v", err)
+	}
+	if _, err := c.Step(); err != cpu.ErrHalted {
+		t.Fatalf("halted %v", err)
+	}
+	c.Reset()
+	step(t, c, pcStart)
+}
+
+func TestBusError(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    []byte
+		a0      uint32
+		access  uint16
+		address uint32
+	}{
+		{"move.w (a0),d0", []byte{0x30, 0x10}, 0x200000,
+			accessRead | accessNotInstruction | functionSupervisorData,
+			0x200000},
+		{"move.l (a0),d0", []byte{0x20, 0x10}, size - 2,
+			accessRead | accessNotInstruction | functionSupervisorData,
+			size - 2},
+		{"move.b d0,(a0)", []byte{0x10, 0x80}, 0x200001,
+			accessNotInstruction | functionSupervisorData, 0x200001},
+		{"jmp (a0)", []byte{0x4e, 0xd0}, 0x200000,
+			accessRead | functionSupervisorProgram, 0x200000},
+	}
+	for _, test := range tests {
+		b, c := newCpu()
+		vectors(c)
+		ssp := c.a[7]
+		c.a[0] = test.a0
+		b.Write(pcStart, test.code)
+		step(t, c, pcStart)
+		if test.name == "jmp (a0)" {
+			step(t, c, c.pc)
+		}
+		if c.pc != 0x10000+vectorBusError*4 || c.a[7] != ssp-14 {
+			t.Fatalf("%v: pc 0x%x a7 0x%x", test.name, c.pc, c.a[7])
+		}
+		if access := c.read16(c.a[7]); access != test.access {
+			t.Fatalf("%v: access 0x%04x", test.name, access)
+		}
+		if address := c.read32(c.a[7] + 2); address != test.address {
+			t.Fatalf("%v: address 0x%x", test.name, address)
+		}
+	}
+
+	// a bus error while stacking a bus error frame halts the cpu
+	b, c := newCpu()
+	vectors(c)
+	c.a[7] = 0x200000
+	c.a[0] = 0x200000
+	b.Write(pcStart, []byte{0x30, 0x10}) // move.w (a0),d0
+	c.pc = pcStart
+	if _, err := c.Step(); err != cpu.ErrHalted {
+		t.Fatalf("double fault %v", err)
+	}
+
+	// no memory at the reset vectors
+	b, err := bus.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = b.Attach(0x100000, memory.NewRAM(size))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err = New(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Reset()
+	if _, err := c.Step(); err != cpu.ErrHalted {
+		t.Fatalf("reset %v", err)
+	}
+}
+
+func TestTiming(t *testing.T) {
+	tests := []struct {
+		name   string
+		code   []byte
+		d0, d1 uint32
+		ccr    uint16
+		cycles int
+	}{
+		{"move.w d0,d1", []byte{0x32, 0x00}, 0, 0, 0, 4},
+		{"move.l (a0)+,-(a1)", []byte{0x23, 0x18}, 0, 0, 0, 20},
+		{"move.w $10(a0),$4000.l", []byte{0x33, 0xe8, 0x00, 0x10, 0x00,
+			0x00, 0x40, 0x00}, 0, 0, 0, 24},
+		{"add.l d0,d1", []byte{0xd2, 0x80}, 0, 0, 0, 8},
+		{"add.w (a0),d1", []byte{0xd2, 0x50}, 0, 0, 0, 8},
+		{"add.l d1,(a0)", []byte{0xd3, 0x90}, 0, 0, 0, 20},
+		{"adda.w d0,a1", []byte{0xd2, 0xc0}, 0, 0, 0, 8},
+		{"adda.l d0,a1", []byte{0xd3, 0xc0}, 0, 0, 0, 8},
+		{"adda.l (a0),a1", []byte{0xd3, 0xd0}, 0, 0, 0, 14},
+		{"addi.l #$1,d1", []byte{0x06, 0x81, 0x00, 0x00, 0x00, 0x01}, 0,
+			0, 0, 16},
+		{"andi.l #$1,d1", []byte{0x02, 0x81, 0x00, 0x00, 0x00, 0x01}, 0,
+			0, 0, 14},
+		{"ori.l #$1,d1", []byte{0x00, 0x81, 0x00, 0x00, 0x00, 0x01}, 0,
+			0, 0, 16},
+		{"addq.w #1,a1", []byte{0x52, 0x49}, 0, 0, 0, 8},
+		{"addq.l #1,(a0)", []byte{0x52, 0x90}, 0, 0, 0, 20},
+		{"cmp.l d0,d1", []byte{0xb2, 0x80}, 0, 0, 0, 6},
+		{"lsl.l #8,d1", []byte{0xe1, 0x89}, 0, 0, 0, 24},
+		{"lsl.w d0,d1", []byte{0xe1, 0x69}, 3, 0, 0, 12},
+		{"lsl.w (a0)", []byte{0xe3, 0xd0}, 0, 0, 0, 12},
+		{"mulu.w d0,d1", []byte{0xc2, 0xc0}, 0xffff, 0, 0, 70},
+		{"mulu.w d0,d1", []byte{0xc2, 0xc0}, 0, 0, 0, 38},
+		{"muls.w d0,d1", []byte{0xc3, 0xc0}, 0x5555, 0, 0, 70},
+		{"divu.w d0,d1", []byte{0x82, 0xc0}, 1, 0, 0, 136},
+		{"divu.w d0,d1", []byte{0x82, 0xc0}, 1, 0x10000, 0, 10},
+		{"divs.w d0,d1", []byte{0x83, 0xc0}, 1, 0x10000000, 0, 16},
+		{"divu.w #$0,d1", []byte{0x82, 0xfc, 0x00, 0x00}, 0, 0, 0, 42},
+		{"bra.s *+$4", []byte{0x60, 0x02}, 0, 0, 0, 10},
+		{"beq.s *+$4", []byte{0x67, 0x02}, 0, 0, 0, 8},
+		{"beq.w *+$4", []byte{0x67, 0x00, 0x00, 0x02}, 0, 0, 0, 12},
+		{"bsr.s *+$4", []byte{0x61, 0x02}, 0, 0, 0, 18},
+		{"dbf d0,*+$4", []byte{0x51, 0xc8, 0x00, 0x02}, 1, 0, 0, 10},
+		{"dbf d0,*+$4", []byte{0x51, 0xc8, 0x00, 0x02}, 0, 0, 0, 14},
+		{"dbt d0,*+$4", []byte{0x50, 0xc8, 0x00, 0x02}, 0, 0, 0, 12},
+		{"st d1", []byte{0x50, 0xc1}, 0, 0, 0, 6},
+		{"sf d1", []byte{0x51, 0xc1}, 0, 0, 0, 4},
+		{"st (a0)", []byte{0x50, 0xd0}, 0, 0, 0, 12},
+		{"jsr (a0)", []byte{0x4e, 0x90}, 0, 0, 0, 16},
+		{"jmp $4000.w", []byte{0x4e, 0xf8, 0x40, 0x00}, 0, 0, 0, 10},
+		{"lea $10(a0),a1", []byte{0x43, 0xe8, 0x00, 0x10}, 0, 0, 0, 8},
+		{"pea (a0)", []byte{0x48, 0x50}, 0, 0, 0, 12},
+		{"movem.l d0-d1/a0,-(a7)", []byte{0x48, 0xe7, 0xc0, 0x80}, 0, 0, 0,
+			32},
+		{"movem.w (a0)+,d0-d1", []byte{0x4c, 0x98, 0x00, 0x03}, 0, 0, 0,
+			20},
+		{"btst #3,d1", []byte{0x08, 0x01, 0x00, 0x03}, 0, 0, 0, 10},
+		{"bset #17,d1", []byte{0x08, 0xc1, 0x00, 0x11}, 0, 0, 0, 12},
+		{"bclr d0,d1", []byte{0x01, 0x81}, 1, 0, 0, 8},
+		{"clr.l d1", []byte{0x42, 0x81}, 0, 0, 0, 6},
+		{"nop", []byte{0x4e, 0x71}, 0, 0, 0, 4},
+		{"rts", []byte{0x4e, 0x75}, 0, 0, 0, 16},
+		{"rte", []byte{0x4e, 0x73}, 0, 0, 0, 20},
+		{"trap #0", []byte{0x4e, 0x40}, 0, 0, 0, 34},
+		{"trapv", []byte{0x4e, 0x76}, 0, 0, overflow, 34},
+		{"chk.w d0,d1", []byte{0x43, 0x80}, 1, 2, 0, 40},
+		{"illegal", []byte{0x4a, 0xfc}, 0, 0, 0, 34},
+		{"move.w (a0),d1", []byte{0x32, 0x10}, 0, 0, 0, 50},
+	}
+	for _, test := range tests {
+		b, c := newCpu()
+		vectors(c)
+		c.d[0] = test.d0
+		c.d[1] = test.d1
+		c.a[0] = 0x4000
+		c.a[1] = 0x5000
+		if test.cycles == 50 {
+			c.a[0] = 0x4001 // address error
+		}
+		c.push32(pcStart)
+		c.push16(supervisor | interruptMask)
+		c.sr |= test.ccr
+		b.Write(pcStart, test.code)
+		c.pc = pcStart
+		cycles, err := c.Step()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cycles != test.cycles {
+			t.Fatalf("%v: %v cycles want %v", test.name, cycles,
+				test.cycles)
+		}
+	}
+
+	// interrupt acknowledge
+	_, c := newCpu()
+	vectors(c)
+	c.setSR(supervisor)
+	c.Interrupt(1, cpu.Autovector)
+	c.pc = pcStart
+	cycles, err := c.Step()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cycles != cyclesInterrupt {
+		t.Fatalf("interrupt %v cycles", cycles)
+	}
+}
+
+func TestPrefetch(t *testing.T) {
+	tests := []struct {
+		prefetch bool
+		target   uint32 // address modified by the first instruction
+		want     uint32
+	}{
+		{false, pcStart + 2, 2},
+		{true, pcStart + 2, 1}, // opcode was already prefetched
+		{false, pcStart + 4, 2},
+		{true, pcStart + 4, 2}, // fetched after the write
+	}
+	for _, test := range tests {
+		b, c := newCpu()
+		c.Prefetch(test.prefetch)
+		b.Write(pcStart, []byte{
+			0x30, 0x80, // move.w d0,(a0)
+			0x72, 0x01, // moveq #1,d1
+			0x72, 0x01, // moveq #1,d1
+		})
+		if test.target == pcStart+4 {
+			// skip the first moveq
+			b.Write(pcStart+2, []byte{0x4e, 0x71}) // nop
+		}
+		c.a[0] = test.target
+		c.d[0] = 0x7202 // moveq #2,d1
+		c.pc = pcStart
+		for n := 0; n < 3; n++ {
+			if _, err := c.Step(); err != nil {
+				t.Fatal(err)
+			}
+			if c.pc == test.target+2 {
+				break
+			}
+		}
+		if c.d[1] != test.want {
+			t.Fatalf("prefetch %v target 0x%x: d1 %v", test.prefetch,
+				test.target, c.d[1])
+		}
+	}
+
+	// the queue follows jumps and is refilled when the pc is changed
+	b, c := newCpu()
+	c.Prefetch(true)
+	b.Write(pcStart, []byte{0x60, 0x02, 0x72, 0x01, 0x72, 0x03}) // bra.s
+	step(t, c, pcStart)
+	step(t, c, c.pc)
+	if c.d[1] != 3 {
+		t.Fatalf("bra d1 %v", c.d[1])
+	}
+	step(t, c, pcStart+2)
+	if c.d[1] != 1 {
+		t.Fatalf("pc changed d1 %v", c.d[1])
+	}
+
+	// a jump refills the queue at its target, the 68008 adds the byte
+	// cycles of the refill to the jump
+	b, c = newModel(t, M68008)
+	c.Prefetch(true)
+	b.Write(pcStart, []byte{0x60, 0x02, 0x72, 0x01, 0x72, 0x03}) // bra.s
+	step(t, c, pcStart)
+	if c.queued != 2 || c.queuePC != pcStart+4 || c.queue[0] != 0x7203 {
+		t.Fatalf("refill queued %v pc 0x%x", c.queued, c.queuePC)
+	}
+	if c.stretch != 4*4 {
+		t.Fatalf("bra stretch %v", c.stretch)
+	}
+	step(t, c, c.pc)
+	if c.stretch != 2*4 {
+		t.Fatalf("moveq stretch %v", c.stretch)
+	}
+}
+
+func TestPrefetchBusError(t *testing.T) {
+	// a nop in the last word of memory faults on the prefetch
+	for _, prefetch := range []bool{false, true} {
+		b, c := newCpu()
+		vectors(c)
+		c.Prefetch(prefetch)
+		b.Write(size-2, []byte{0x4e, 0x71})
+		step(t, c, size-2)
+		if !prefetch {
+			if c.pc != size {
+				t.Fatalf("pc 0x%x", c.pc)
+			}
+			continue
+		}
+		if c.pc != 0x10000+vectorBusError*4 {
+			t.Fatalf("pc 0x%x", c.pc)
+		}
+		if access := c.read16(c.a[7]); access !=
+			accessRead|functionSupervisorProgram {
+			t.Fatalf("access 0x%04x", access)
+		}
+		if address := c.read32(c.a[7] + 2); address != size {
+			t.Fatalf("address 0x%x", address)
+		}
+		if ir := c.read16(c.a[7] + 6); ir != 0x4e71 {
+			t.Fatalf("ir 0x%04x", ir)
+		}
+	}
+
+	// instructions in the last word of memory that jump do not fault
+	tests := []struct {
+		name string
+		code []byte
+	}{
+		{"jmp (a0)", []byte{0x4e, 0xd0}},
+		{"jsr (a0)", []byte{0x4e, 0x90}},
+		{"rts", []byte{0x4e, 0x75}},
+		{"bra.s *-$2", []byte{0x60, 0xfc}},
+	}
+	for _, test := range tests {
+		b, c := newCpu()
+		vectors(c)
+		c.Prefetch(true)
+		c.a[0] = size - 4
+		c.write32(c.a[7]-4, size-4)
+		c.a[7] -= 4
+		b.Write(size-2, test.code)
+		step(t, c, size-2)
+		if c.pc != size-4 {
+			t.Fatalf("%v: pc 0x%x", test.name, c.pc)
+		}
+	}
+}
+
+// resetter is a peripheral that records reset.
+type resetter struct {
+	resets []bool
+}
+
+func (r *resetter) Read(address, length uint64) []byte {
+	return make([]byte, length)
+}
+
+func (r *resetter) Write(address uint64, data []byte) {}
+
+func (r *resetter) Reset(powerOn bool) {
+	r.resets = append(r.resets, powerOn)
+}
+
+func (r *resetter) Length() uint64 {
+	return 0x100
+}
+
+func TestStopReset(t *testing.T) {
+	b, c := newCpu()
+	vectors(c)
+
+	// stop until an interrupt above the mask arrives
+	b.Write(pcStart, []byte{0x4e, 0x72, 0x23, 0x00}) // stop #$2300
+	step(t, c, pcStart)
+	if c.State() != cpu.Stopped || c.pc != pcStart+4 || c.sr != 0x2300 {
+		t.Fatalf("stop state %v pc 0x%x sr 0x%04x", c.State(), c.pc,
+			c.sr)
+	}
+	d, _, err := c.disassemble(pcStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d != "stop\t#$2300" {
+		t.Fatalf("disassembled %q", d)
+	}
+	c.Interrupt(3, cpu.Autovector)
+	cycles, err := c.Step()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cycles != 0 || c.State() != cpu.Stopped || c.pc != pcStart+4 {
+		t.Fatalf("stopped cycles %v state %v pc 0x%x", cycles, c.State(),
+			c.pc)
+	}
+	c.Interrupt(4, cpu.Autovector)
+	if _, err = c.Step(); err != nil {
+		t.Fatal(err)
+	}
+	if c.State() != cpu.Running || c.pc != 0x10000+(vectorAutovector+4)*4 {
+		t.Fatalf("interrupted state %v pc 0x%x", c.State(), c.pc)
+	}
+	if pc := c.read32(c.a[7] + 2); pc != pcStart+4 {
+		t.Fatalf("stacked pc 0x%x", pc)
+	}
+
+	// stop is privileged
+	b, c = newCpu()
+	vectors(c)
+	c.setSR(0)
+	b.Write(pcStart, []byte{0x4e, 0x72, 0x27, 0x00})
+	step(t, c, pcStart)
+	if c.State() != cpu.Running || c.pc != 0x10000+vectorPrivilege*4 {
+		t.Fatalf("user stop state %v pc 0x%x", c.State(), c.pc)
+	}
+
+	// reset only resets the peripherals
+	b, c = newCpu()
+	r := &resetter{}
+	if _, err := b.Attach(0x200000, r); err != nil {
+		t.Fatal(err)
+	}
+	c.d[0] = 0x12345678
+	b.Write(0x4000, []byte{0xaa})
+	b.Write(pcStart, []byte{0x4e, 0x70}) // reset
+	c.pc = pcStart
+	cycles, err = c.Step()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the 68008 adds the byte cycles of its 8 bit bus to the clock periods
+	if cycles-c.stretch != 132 || c.pc != pcStart+2 ||
+		c.d[0] != 0x12345678 ||
+		c.sr != supervisor|interruptMask {
+		t.Fatalf("reset cycles %v pc 0x%x", cycles, c.pc)
+	}
+	if len(r.resets) != 1 || r.resets[0] {
+		t.Fatalf("peripheral resets %v", r.resets)
+	}
+	if c.read8(0x4000) != 0xaa {
+		t.Fatalf("memory was reset")
+	}
+
+	// a double fault halts the cpu, the RAM fills the 1M address space of
+	// the 68008 and its stack is misaligned instead
+	b, c = newCpu()
+	c.a[7] = 0x200000
+	if c.model.byteBus {
+		c.a[7] = 0x2001
+	}
+	b.Write(pcStart, []byte{0x4a, 0xfc}) // illegal
+	c.pc = pcStart
+	c.Step()
+	if c.State() != cpu.Halted {
+		t.Fatalf("state %v", c.State())
+	}
+}
+
+func TestTrace(t *testing.T) {
+	handler := func(v uint32) uint32 { return 0x10000 + v*4 }
+
+	// every instruction is followed by a trace exception
+	b, c := newCpu()
+	vectors(c)
+	c.sr |= trace
+	b.Write(pcStart, []byte{0x4e, 0x71}) // nop
+	cycles, err := c.Step()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.pc != handler(vectorTrace) || c.sr != 0x2700 ||
+		cycles-c.stretch != 4+34 {
+		t.Fatalf("trace pc 0x%x sr 0x%04x cycles %v", c.pc, c.sr,
+			cycles)
+	}
+	if sr, pc := c.read16(c.a[7]), c.read32(c.a[7]+2); sr != 0xa700 ||
+		pc != pcStart+2 {
+		t.Fatalf("trace frame sr 0x%04x pc 0x%x", sr, pc)
+	}
+
+	// trap is processed first and traced with the handler address
+	b, c = newCpu()
+	vectors(c)
+	c.sr |= trace
+	b.Write(pcStart, []byte{0x4e, 0x43}) // trap #3
+	step(t, c, pcStart)
+	n := frameSize(c, vectorTrace)
+	if c.pc != handler(vectorTrace) ||
+		c.a[7] != 0x2000-n-frameSize(c, vectorTrap+3) {
+		t.Fatalf("trap pc 0x%x sp 0x%x", c.pc, c.a[7])
+	}
+	if sr, pc := c.read16(c.a[7]), c.read32(c.a[7]+2); sr != 0x2700 ||
+		pc != handler(vectorTrap+3) {
+		t.Fatalf("trace frame sr 0x%04x pc 0x%x", sr, pc)
+	}
+	if sr, pc := c.read16(c.a[7]+n), c.read32(c.a[7]+n+2); sr != 0xa700 ||
+		pc != pcStart+2 {
+		t.Fatalf("trap frame sr 0x%04x pc 0x%x", sr, pc)
+	}
+
+	// illegal instructions are not traced
+	b, c = newCpu()
+	vectors(c)
+	c.sr |= trace
+	b.Write(pcStart, []byte{0x4a, 0xfc}) // illegal
+	step(t, c, pcStart)
+	if c.pc != handler(vectorIllegal) || c.a[7] != 0x2000-frameSize(c, vectorIllegal) {
+		t.Fatalf("illegal pc 0x%x sp 0x%x", c.pc, c.a[7])
+	}
+
+	// an interrupt is taken before the trace handler executes
+	b, c = newCpu()
+	vectors(c)
+	c.sr |= trace
+	c.Interrupt(3, cpu.Autovector)
+	b.Write(pcStart, []byte{0x46, 0xfc, 0xa0, 0x00}) // move #$a000,sr
+	step(t, c, pcStart)
+	if c.pc != handler(vectorTrace) || c.sr != 0x2000 {
+		t.Fatalf("trace pc 0x%x sr 0x%04x", c.pc, c.sr)
+	}
+	if _, err := c.Step(); err != nil {
+		t.Fatal(err)
+	}
+	if c.pc != handler(vectorAutovector+3) || c.sr != 0x2300 {
+		t.Fatalf("interrupt pc 0x%x sr 0x%04x", c.pc, c.sr)
+	}
+	if sr, pc := c.read16(c.a[7]), c.read32(c.a[7]+2); sr != 0x2000 ||
+		pc != handler(vectorTrace) {
+		t.Fatalf("interrupt frame sr 0x%04x pc 0x%x", sr, pc)
+	}
+
+	// a traced stop resumes with the trace exception
+	b, c = newCpu()
+	vectors(c)
+	c.sr |= trace
+	b.Write(pcStart, []byte{0x4e, 0x72, 0x27, 0x00}) // stop #$2700
+	step(t, c, pcStart)
+	if c.State() != cpu.Running || c.pc != handler(vectorTrace) {
+		t.Fatalf("stop state %v pc 0x%x", c.State(), c.pc)
+	}
+	if pc := c.read32(c.a[7] + 2); pc != pcStart+4 {
+		t.Fatalf("stop stacked pc 0x%x", pc)
+	}
+}
+
+func TestHook(t *testing.T) {
+	b, c := newCpu()
+	vectors(c)
+
+	// line 1010 copies the byte at (a0) to d0 and falls through otherwise
+	c.HookLineA(func(h *Trap) bool {
+		if h.Opcode != 0xa123 || h.Vector != vectorLineA {
+			return false
+		}
+		v, err := h.Read(h.A(0), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h.SetD(0, v)
+		return h.PC() == pcStart+2
+	})
+	c.a[0] = 0x3000
+	c.write8(0x3000, 0x5a)
+	run(t, b, c, 0xa1, 0x23)
+	if c.d[0] != 0x5a || c.a[7] != 0x2000 {
+		t.Fatalf("d0 0x%x a7 0x%x", c.d[0], c.a[7])
+	}
+	step(t, c, pcStart)
+	if c.cycles != cyclesGroup1 {
+		t.Fatalf("cycles %v != %v", c.cycles, cyclesGroup1)
+	}
+	b.Write(pcStart, []byte{0xa1, 0x24})
+	step(t, c, pcStart)
+	if c.pc != 0x10000+vectorLineA*4 || c.read32(c.a[7]+2) != pcStart {
+		t.Fatalf("pc 0x%x", c.pc)
+	}
+
+	// TRAP #3 stores d1 at the address following the opcode and skips it
+	b, c = newCpu()
+	vectors(c)
+	if err := c.HookTrap(16, nil); err != ErrTrapNumber {
+		t.Fatalf("trap 16: %v", err)
+	}
+	c.HookTrap(3, func(h *Trap) bool {
+		a, err := h.Read(h.PC(), 4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h.Write(a, 2, h.D(1))
+		h.SetPC(h.PC() + 4)
+		return true
+	})
+	c.d[1] = 0x1234
+	run(t, b, c, 0x4e, 0x43, 0x00, 0x00, 0x30, 0x00)
+	if c.read16(0x3000) != 0x1234 {
+		t.Fatalf("0x%x", c.read16(0x3000))
+	}
+	b.Write(pcStart, []byte{0x4e, 0x44})
+	step(t, c, pcStart)
+	if c.pc != 0x10000+(vectorTrap+4)*4 {
+		t.Fatalf("pc 0x%x", c.pc)
+	}
+
+	// a consumed instruction is traced
+	b, c = newCpu()
+	vectors(c)
+	c.HookLineF(func(h *Trap) bool { return true })
+	c.sr |= trace
+	sp := c.a[7]
+	b.Write(pcStart, []byte{0xff, 0xff})
+	step(t, c, pcStart)
+	if c.pc != 0x10000+vectorTrace*4 || c.read32(sp-4) != pcStart+2 {
+		t.Fatalf("pc 0x%x", c.pc)
+	}
+
+	// a hook may halt the CPU
+	b, c = newCpu()
+	c.HookTrap(0, func(h *Trap) bool {
+		h.Halt()
+		return true
+	})
+	b.Write(pcStart, []byte{0x4e, 0x40})
+	step(t, c, pcStart)
+	if _, err := c.Step(); err != cpu.ErrHalted {
+		t.Fatalf("%v", err)
+	}
+}
+
+func TestEASy68K(t *testing.T) {
+	b, c := newCpu()
+	vectors(c)
+	var out bytes.Buffer
+	dir := t.TempDir()
+	err := c.EASy68K(strings.NewReader("line\r\n-42\nxyz"), &out, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.write32(0x3000, 0x41424300) // "ABC"
+
+	// task runs TRAP #15 with d0-d2 and a1 set
+	task := func(d0, d1, d2, a1 uint32) {
+		t.Helper()
+		c.d[0], c.d[1], c.d[2], c.a[1] = d0, d1, d2, a1
+		run(t, b, c, 0x4e, 0x4f)
+	}
+	output := []struct {
+		d0, d1, d2 uint32
+		out        string
+	}{
+		{0, 2, 0, "AB\r\n"},
+		{1, 5, 0, "ABC\x00\x00"},
+		{3, 0xffffffd6, 0, "-42"},
+		{6, 0x21, 0, "!"},
+		{11, 0xff00, 0, "\x1b[2J\x1b[H"},
+		{11, 0x0502, 0, "\x1b[3;6H"},
+		{13, 0, 0, "ABC\r\n"},
+		{14, 0, 0, "ABC"},
+		{15, 255, 16, "FF"},
+		{17, 7, 0, "ABC7"},
+		{20, 42, 5, "   42"},
+	}
+	for _, test := range output {
+		out.Reset()
+		task(test.d0, test.d1, test.d2, 0x3000)
+		if out.String() != test.out {
+			t.Fatalf("task %v: %q != %q", test.d0, out.String(),
+				test.out)
+		}
+	}
+
+	// tasks 0 and 1 display at most 255 characters
+	b.Write(0x3400, append(bytes.Repeat([]byte{'x'}, 300), 0))
+	out.Reset()
+	task(1, 300, 0, 0x3400)
+	if out.Len() != 255 {
+		t.Fatalf("task 1: %v characters", out.Len())
+	}
+
+	task(2, 0xffff0000, 0, 0x3100)
+	if c.d[1] != 0xffff0004 || c.read32(0x3100) != 0x6c696e65 ||
+		c.read8(0x3104) != 0 {
+		t.Fatalf("read line: d1 0x%x", c.d[1])
+	}
+	task(7, 0, 0, 0)
+	if c.d[1] != 1 {
+		t.Fatalf("pending: d1 0x%x", c.d[1])
+	}
+	task(4, 0, 0, 0)
+	if c.d[1] != 0xffffffd6 {
+		t.Fatalf("read number: d1 0x%x", c.d[1])
+	}
+	task(5, 0x100, 0, 0)
+	if c.d[1] != 0x178 {
+		t.Fatalf("read character: d1 0x%x", c.d[1])
+	}
+	task(8, 0, 0, 0)
+	if c.d[1] >= 24*60*60*100 {
+		t.Fatalf("time: d1 0x%x", c.d[1])
+	}
+
+	// unsupported tasks and memory errors take the exception
+	for _, test := range []struct{ d0, a1 uint32 }{
+		{21, 0x3000},
+		{13, size - 1},
+	} {
+		c.write8(size-1, 0x41)
+		c.d[0], c.a[1] = test.d0, test.a1
+		b.Write(pcStart, []byte{0x4e, 0x4f})
+		step(t, c, pcStart)
+		if c.pc != 0x10000+(vectorTrap+15)*4 {
+			t.Fatalf("task %v: pc 0x%x", test.d0, c.pc)
+		}
+	}
+
+	// files
+	name := filepath.Join(dir, "file")
+	c.write32(0x3200, 0)
+	b.Write(0x3200, []byte("file"))
+	task(51, 0, 0, 0x3200)
+	if c.d[0]&0xffff != fileError {
+		t.Fatalf("open missing: d0 0x%x", c.d[0])
+	}
+	task(52, 0, 0, 0x3200)
+	id := c.d[1]
+	if c.d[0]&0xffff != fileSuccess {
+		t.Fatalf("create: d0 0x%x", c.d[0])
+	}
+	task(54, id, 3, 0x3000)
+	task(55, id, 1, 0)
+	task(53, id, 4, 0x3100)
+	if c.d[0]&0xffff != fileEOF || c.d[2] != 2 ||
+		c.read16(0x3100) != 0x4243 {
+		t.Fatalf("read: d0 0x%x d2 0x%x", c.d[0], c.d[2])
+	}
+	task(56, id, 0, 0)
+	if c.d[0]&0xffff != fileSuccess {
+		t.Fatalf("close: d0 0x%x", c.d[0])
+	}
+	task(56, id, 0, 0)
+	if c.d[0]&0xffff != fileError {
+		t.Fatalf("close closed: d0 0x%x", c.d[0])
+	}
+	task(51, 0, 0, 0x3200)
+	id = c.d[1]
+	task(53, id, 3, 0x3100)
+	if c.d[0]&0xffff != fileSuccess || c.d[2] != 3 {
+		t.Fatalf("reopen: d0 0x%x d2 0x%x", c.d[0], c.d[2])
+	}
+
+	// large reads stop at the end of the file, a bus error before any
+	// data is transferred leaves the file position alone
+	task(55, id, 0, 0)
+	task(53, id, 0xffffffff, size-2)
+	if c.d[0]&0xffff != fileError || c.d[2] != 0 {
+		t.Fatalf("read bus error: d0 0x%x d2 0x%x", c.d[0], c.d[2])
+	}
+	c.write32(0x3100, 0)
+	task(53, id, 0xffffffff, 0x3100)
+	if c.d[0]&0xffff != fileEOF || c.d[2] != 3 ||
+		c.read32(0x3100) != 0x41424300 {
+		t.Fatalf("read large: d0 0x%x d2 0x%x", c.d[0], c.d[2])
+	}
+	task(50, 0, 0, 0)
+	task(57, 0, 0, 0x3200)
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Fatalf("delete: %v", err)
+	}
+
+	// names may not refer outside of the directory
+	for _, escape := range []string{"../file", name} {
+		b.Write(0x3200, append([]byte(escape), 0))
+		task(52, 0, 0, 0x3200)
+		if c.d[0]&0xffff != fileError {
+			t.Fatalf("create %v: d0 0x%x", escape, c.d[0])
+		}
+	}
+
+	task(9, 0, 0, 0)
+	if _, err := c.Step(); err != cpu.ErrHalted {
+		t.Fatalf("terminate: %v", err)
+	}
+
+	// file tasks are disabled without a directory
+	b, c = newCpu()
+	vectors(c)
+	c.EASy68K(strings.NewReader(""), &out, "")
+	b.Write(0x3200, []byte("file\x00"))
+	c.d[0], c.a[1] = 52, 0x3200
+	b.Write(pcStart, []byte{0x4e, 0x4f})
+	step(t, c, pcStart)
+	if c.pc != 0x10000+(vectorTrap+15)*4 {
+		t.Fatalf("disabled: pc 0x%x", c.pc)
+	}
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Fatalf("disabled: %v", err)
+	}
+}
+
+// modelTests are the model independent tests.
+var modelTests = []struct {
+	name string
+	test func(*testing.T)
+}{
+	{"MOVEL", TestMOVEL},
+	{"ADDD", TestADDD},
+	{"ADDAL", TestADDAL},
+	{"EA", TestEA},
+	{"Push", TestPush},
+	{"Arithmetic", TestArithmetic},
+	{"MultiPrecision", TestMultiPrecision},
+	{"Logical", TestLogical},
+	{"StatusRegister", TestStatusRegister},
+	{"Shift", TestShift},
+	{"Condition", TestCondition},
+	{"ProgramControl", TestProgramControl},
+	{"MultiplyDivide", TestMultiplyDivide},
+	{"BCD", TestBCD},
+	{"DataMovement", TestDataMovement},
+	{"BitManipulation", TestBitManipulation},
+	{"Exception", TestException},
+	{"Interrupt", TestInterrupt},
+	{"Prefetch", TestPrefetch},
+	{"StopReset", TestStopReset},
+	{"Trace", TestTrace},
+}
+
+// runModelTests runs the model independent tests on model.
+func runModelTests(t *testing.T, model string) {
+	defer func(m string) {
+		testModel = m
+	}(testModel)
+	testModel = model
+
+	for _, test := range modelTests {
+		t.Run(test.name, test.test)
+	}
+}
+
+// TestModels runs the model independent tests on the other models.
+func TestModels(t *testing.T) {
+	for _, model := range []string{M68010, M68020, M68008, MCPU32} {
+		t.Run(model, func(t *testing.T) {
+			runModelTests(t, model)
+		})
+	}
+}
+
+func Test68010Instructions(t *testing.T) {
+	if opcodes[0x4e7a].execute != nil || opcodes[0x42c0].execute != nil {
+		t.Fatalf("68000 decodes 68010 instructions")
+	}
+
+	tests := []struct {
+		name string
+		code []byte
+	}{
+		{"movec d0,vbr", []byte{0x4e, 0x7b, 0x08, 0x01}},
+		{"movec vbr,a1", []byte{0x4e, 0x7a, 0x98, 0x01}},
+		{"move.w ccr,d1", []byte{0x42, 0xc1}},
+		{"rtd #$8", []byte{0x4e, 0x74, 0x00, 0x08}},
+		{"moves.l d0,(a0)", []byte{0x0e, 0x90, 0x08, 0x00}},
+		{"moves.w (a0),a1", []byte{0x0e, 0x50, 0x90, 0x00}},
+		{"bkpt #3", []byte{0x48, 0x4b}},
+	}
+	b, c := newModel(t, M68010)
+	for _, test := range tests {
+		b.Write(pcStart, test.code)
+		d, _, err := c.disassemble(pcStart)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d != strings.Replace(test.name, " ", "\t", 1) {
+			t.Fatalf("disassembled %q want %q", d, test.name)
+		}
+	}
+
+	// movec
+	c.d[0] = 0x20000
+	run(t, b, c, 0x4e, 0x7b, 0x08, 0x01) // movec d0,vbr
+	run(t, b, c, 0x4e, 0x7a, 0x98, 0x01) // movec vbr,a1
+	if c.vbr != 0x20000 || c.a[1] != 0x20000 {
+		t.Fatalf("vbr 0x%x a1 0x%x", c.vbr, c.a[1])
+	}
+	c.d[0] = 0xff
+	run(t, b, c, 0x4e, 0x7b, 0x00, 0x00) // movec d0,sfc
+	if c.sfc != 0x07 {
+		t.Fatalf("sfc 0x%x", c.sfc)
+	}
+
+	// exceptions are vectored through the vbr with format 0 frames
+	c.write32(c.vbr+vectorTrap*4, 0x3000)
+	c.write32(c.vbr+vectorIllegal*4, 0x3100)
+	sp := c.a[7]
+	b.Write(pcStart, []byte{0x4e, 0x40}) // trap #0
+	step(t, c, pcStart)
+	if c.pc != 0x3000 || c.a[7] != sp-8 || c.read16(c.a[7]+6) != 0x0080 {
+		t.Fatalf("trap pc 0x%x a7 0x%x format 0x%04x", c.pc, c.a[7],
+			c.read16(c.a[7]+6))
+	}
+	b.Write(pcStart, []byte{0x4e, 0x7a, 0x00, 0x02}) // movec cacr,d0
+	step(t, c, pcStart)
+	if c.pc != 0x3100 {
+		t.Fatalf("movec cacr pc 0x%x", c.pc)
+	}
+
+	// rte pops the format 0 frame
+	sp = c.a[7]
+	b.Write(pcStart, []byte{0x4e, 0x73})
+	step(t, c, pcStart)
+	if c.pc != pcStart || c.a[7] != sp+8 {
+		t.Fatalf("rte pc 0x%x a7 0x%x", c.pc, c.a[7])
+	}
+
+	// rtd
+	c.push32(0x2100)
+	sp = c.a[7]
+	b.Write(pcStart, []byte{0x4e, 0x74, 0x00, 0x08})
+	step(t, c, pcStart)
+	if c.pc != 0x2100 || c.a[7] != sp+12 {
+		t.Fatalf("rtd pc 0x%x a7 0x%x", c.pc, c.a[7])
+	}
+
+	// moves
+	c.a[0] = 0x4000
+	c.d[0] = 0x12348765
+	run(t, b, c, 0x0e, 0x90, 0x08, 0x00) // moves.l d0,(a0)
+	run(t, b, c, 0x0e, 0x50, 0x90, 0x00) // moves.w (a0),a1
+	if c.read32(0x4000) != 0x12348765 || c.a[1] != 0x00001234 {
+		t.Fatalf("moves 0x%x a1 0x%x", c.read32(0x4000), c.a[1])
+	}
+	c.write16(0x4000, 0x8765)
+	run(t, b, c, 0x0e, 0x50, 0x90, 0x00)
+	if c.a[1] != 0xffff8765 {
+		t.Fatalf("moves a1 0x%x", c.a[1])
+	}
+
+	// move from ccr is allowed in user mode, move from sr and movec are not
+	b, c = newModel(t, M68010)
+	vectors(c)
+	c.setSR(zero | carry)
+	run(t, b, c, 0x42, 0xc1) // move.w ccr,d1
+	if c.d[1]&0xffff != zero|carry {
+		t.Fatalf("move ccr d1 0x%x", c.d[1])
+	}
+	for _, code := range [][]byte{
+		{0x40, 0xc1},             // move.w sr,d1
+		{0x4e, 0x7a, 0x08, 0x01}, // movec vbr,d0
+		{0x0e, 0x90, 0x08, 0x00}, // moves.l d0,(a0)
+	} {
+		c.setSR(0)
+		b.Write(pcStart, code)
+		step(t, c, pcStart)
+		if c.pc != 0x10000+vectorPrivilege*4 {
+			t.Fatalf("%x: pc 0x%x", code, c.pc)
+		}
+	}
+
+	// bkpt
+	b.Write(pcStart, []byte{0x48, 0x4b})
+	step(t, c, pcStart)
+	if c.pc != 0x10000+vectorIllegal*4 {
+		t.Fatalf("bkpt pc 0x%x", c.pc)
+	}
+
+	// rte with an invalid format
+	c.push16(0x3000)
+	c.push32(pcStart)
+	c.push16(supervisor)
+	b.Write(pcStart, []byte{0x4e, 0x73})
+	step(t, c, pcStart)
+	if c.pc != 0x10000+vectorFormatError*4 {
+		t.Fatalf("format error pc 0x%x", c.pc)
+	}
+}
+
+func Test68010BusError(t *testing.T) {
+	b, c := newModel(t, M68010)
+	vectors(c)
+	handler := uint32(0x10000 + vectorBusError*4)
+	c.write16(handler, 0x4e73) // rte
+
+	ssp := c.a[7]
+	c.a[0] = 0x200000
+	b.Write(pcStart, []byte{0x30, 0x10}) // move.w (a0),d0
+	step(t, c, pcStart)
+	if c.pc != handler || c.a[7] != ssp-58 {
+		t.Fatalf("pc 0x%x a7 0x%x", c.pc, c.a[7])
+	}
+	frame := []uint32{
+		uint32(c.read16(c.a[7])), c.read32(c.a[7] + 2),
+		uint32(c.read16(c.a[7] + 6)), uint32(c.read16(c.a[7] + 8)),
+		c.read32(c.a[7] + 10), uint32(c.read16(c.a[7] + 24)),
+		c.read32(c.a[7] + 26),
+	}
+	want := []uint32{0x2700, pcStart + 2, 0x8008,
+		sswRW | sswDF | functionSupervisorData, 0x200000, 0x3010, pcStart}
+	for k := range frame {
+		if frame[k] != want[k] {
+			t.Fatalf("frame %x want %x", frame, want)
+		}
+	}
+
+	// rte restarts the instruction
+	c.a[0] = 0x4000
+	c.write16(0x4000, 0x1234)
+	if _, err := c.Step(); err != nil {
+		t.Fatal(err)
+	}
+	if c.pc != pcStart || c.a[7] != ssp {
+		t.Fatalf("rte pc 0x%x a7 0x%x", c.pc, c.a[7])
+	}
+	if _, err := c.Step(); err != nil {
+		t.Fatal(err)
+	}
+	if c.pc != pcStart+2 || c.d[0]&0xffff != 0x1234 {
+		t.Fatalf("restart pc 0x%x d0 0x%x", c.pc, c.d[0])
+	}
+}
+
+func Test68010LoopMode(t *testing.T) {
+	b, c := newModel(t, M68010)
+	b.Write(0x4000, []byte{1, 2, 3})
+	c.a[0] = 0x4000
+	c.a[1] = 0x5000
+	c.d[0] = 2
+	b.Write(pcStart, []byte{
+		0x12, 0xd8, // move.b (a0)+,(a1)+
+		0x51, 0xc8, 0xff, 0xfc, // dbf d0,*-$2
+	})
+	c.pc = pcStart
+	for k, want := range []int{12, 10, 8, 6, 8, 14} {
+		cycles, err := c.Step()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cycles != want {
+			t.Fatalf("step %v: %v cycles want %v", k, cycles, want)
+		}
+	}
+	if c.loop || c.pc != pcStart+6 || c.read16(0x5000) != 0x0102 ||
+		c.read8(0x5002) != 3 {
+		t.Fatalf("loop %v pc 0x%x", c.loop, c.pc)
+	}
+
+	// loops without a memory operand do not enter loop mode
+	b, c = newModel(t, M68010)
+	c.d[0] = 2
+	b.Write(pcStart, []byte{
+		0x32, 0x02, // move.w d2,d1
+		0x51, 0xc8, 0xff, 0xfc, // dbf d0,*-$2
+	})
+	c.pc = pcStart
+	for k, want := range []int{4, 10, 4, 10, 4, 14} {
+		cycles, err := c.Step()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cycles != want || c.loop {
+			t.Fatalf("register step %v: %v cycles want %v", k,
+				cycles, want)
+		}
+	}
+
+	// the 68000 has no loop mode
+	b, c = newCpu()
+	c.a[0] = 0x4000
+	c.a[1] = 0x5000
+	c.d[0] = 2
+	b.Write(pcStart, []byte{0x12, 0xd8, 0x51, 0xc8, 0xff, 0xfc})
+	c.pc = pcStart
+	for k, want := range []int{12, 10, 12, 10, 12, 14} {
+		cycles, err := c.Step()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cycles != want {
+			t.Fatalf("68000 step %v: %v cycles want %v", k, cycles,
+				want)
+		}
+	}
+}
+
+func Test68020Instructions(t *testing.T) {
+	if opcodes68010[0x49c1].execute != nil ||
+		opcodes68010[0xe9d0].execute != nil {
+		t.Fatalf("68010 decodes 68020 instructions")
+	}
+
+	tests := []struct {
+		name string
+		code []byte
+	}{
+		{"extb.l d1", []byte{0x49, 0xc1}},
+		{"bra.l *+$1002", []byte{0x60, 0xff, 0x00, 0x00, 0x10, 0x00}},
+		{"link.l a6,#-$8", []byte{0x48, 0x0e, 0xff, 0xff, 0xff, 0xf8}},
+		{"chk.l d1,d0", []byte{0x41, 0x01}},
+		{"trapeq", []byte{0x57, 0xfc}},
+		{"trapne.w #$1", []byte{0x56, 0xfa, 0x00, 0x01}},
+		{"mulu.l d1,d0", []byte{0x4c, 0x01, 0x00, 0x00}},
+		{"muls.l d1,d2:d0", []byte{0x4c, 0x01, 0x0c, 0x02}},
+		{"divu.l d1,d0", []byte{0x4c, 0x41, 0x00, 0x00}},
+		{"divsl.l d1,d2:d0", []byte{0x4c, 0x41, 0x08, 0x02}},
+		{"cas.w d0,d1,(a0)", []byte{0x0c, 0xd0, 0x00, 0x40}},
+		{"cas2.l d0:d1,d2:d3,(a0):(a1)",
+			[]byte{0x0e, 0xfc, 0x80, 0x80, 0x90, 0xc1}},
+		{"chk2.w (a0),d1", []byte{0x02, 0xd0, 0x18, 0x00}},
+		{"cmp2.l (a0),a1", []byte{0x04, 0xd0, 0x90, 0x00}},
+		{"pack d0,d1,#$0", []byte{0x83, 0x40, 0x00, 0x00}},
+		{"unpk -(a0),-(a1),#$3030", []byte{0x83, 0x88, 0x30, 0x30}},
+		{"bftst d0{0:1}", []byte{0xe8, 0xc0, 0x00, 0x01}},
+		{"bfextu (a0){4:8},d1", []byte{0xe9, 0xd0, 0x11, 0x08}},
+		{"bfins d2,d0{d1:32}", []byte{0xef, 0xc0, 0x28, 0x40}},
+		{"lea $0(a0,d1.l*8),a1", []byte{0x43, 0xf0, 0x1e, 0x00}},
+		{"move.l ([$10,a0,d1.w*4],$8),d0",
+			[]byte{0x20, 0x30, 0x15, 0x22, 0x00, 0x10, 0x00, 0x08}},
+		{"tst.l ([a0],d1.l,$4)",
+			[]byte{0x4a, 0xb0, 0x19, 0x16, 0x00, 0x04}},
+	}
+	b, c := newModel(t, M68020)
+	for _, test := range tests {
+		b.Write(pcStart, test.code)
+		d, n, err := c.disassemble(pcStart)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d != strings.Replace(test.name, " ", "\t", 1) ||
+			n != len(test.code) {
+			t.Fatalf("disassembled %q %v want %q", d, n, test.name)
+		}
+	}
+
+	// addressing modes
+	c.a[0] = 0x4000
+	c.d[1] = 2
+	c.write32(0x4018, 0x5000)
+	c.write32(0x5008, 0xcafef00d)
+	run(t, b, c, 0x20, 0x30, 0x15, 0x22, 0x00, 0x10, 0x00, 0x08)
+	if c.d[0] != 0xcafef00d {
+		t.Fatalf("preindexed d0 0x%x", c.d[0])
+	}
+	c.write32(0x4000, 0x6000)
+	c.write32(0x6006, 0x80000000)
+	run(t, b, c, 0x4a, 0xb0, 0x19, 0x16, 0x00, 0x04)
+	if c.sr&negative == 0 {
+		t.Fatalf("postindexed sr 0x%04x", c.sr)
+	}
+	run(t, b, c, 0x43, 0xf0, 0x1e, 0x00)
+	if c.a[1] != 0x4010 {
+		t.Fatalf("scaled index a1 0x%x", c.a[1])
+	}
+	c.write16(0x4000, 0x1234)
+	c.write16(0x4002, 0x5678)
+	c.a[0] = 0x4001
+	run(t, b, c, 0x30, 0x10) // move.w (a0),d0
+	if c.d[0]&0xffff != 0x3456 {
+		t.Fatalf("misaligned d0 0x%x", c.d[0])
+	}
+
+	// extb, multiply and divide
+	c.d[1] = 0x12345680
+	run(t, b, c, 0x49, 0xc1)
+	if c.d[1] != 0xffffff80 || c.sr&negative == 0 {
+		t.Fatalf("extb d1 0x%x sr 0x%04x", c.d[1], c.sr)
+	}
+	c.d[0], c.d[1] = 0x10000, 0x10000
+	run(t, b, c, 0x4c, 0x01, 0x00, 0x00) // mulu.l d1,d0
+	if c.d[0] != 0 || c.sr&overflow == 0 {
+		t.Fatalf("mulu.l d0 0x%x sr 0x%04x", c.d[0], c.sr)
+	}
+	c.d[0], c.d[1] = 0xfffffffe, 3
+	run(t, b, c, 0x4c, 0x01, 0x0c, 0x02) // muls.l d1,d2:d0
+	if c.d[0] != 0xfffffffa || c.d[2] != 0xffffffff ||
+		c.sr&negative == 0 {
+		t.Fatalf("muls.l d2:d0 0x%x:%x sr 0x%04x", c.d[2], c.d[0], c.sr)
+	}
+	c.d[0], c.d[1] = 100, 7
+	run(t, b, c, 0x4c, 0x41, 0x00, 0x00) // divu.l d1,d0
+	if c.d[0] != 14 {
+		t.Fatalf("divu.l d0 0x%x", c.d[0])
+	}
+	c.d[0] = 0xffffff9c                  // -100
+	run(t, b, c, 0x4c, 0x41, 0x08, 0x02) // divsl.l d1,d2:d0
+	if c.d[0] != 0xfffffff2 || c.d[2] != 0xfffffffe {
+		t.Fatalf("divsl.l d2:d0 0x%x:%x", c.d[2], c.d[0])
+	}
+
+	// compare and swap
+	c.a[0] = 0x4000
+	c.write16(0x4000, 0x1234)
+	c.d[0], c.d[1] = 0x1234, 0x5678
+	run(t, b, c, 0x0c, 0xd0, 0x00, 0x40) // cas.w d0,d1,(a0)
+	if c.read16(0x4000) != 0x5678 || c.sr&zero == 0 {
+		t.Fatalf("cas swap 0x%x sr 0x%04x", c.read16(0x4000), c.sr)
+	}
+	run(t, b, c, 0x0c, 0xd0, 0x00, 0x40)
+	if c.d[0] != 0x5678 || c.sr&zero != 0 {
+		t.Fatalf("cas compare d0 0x%x sr 0x%04x", c.d[0], c.sr)
+	}
+	c.a[1] = 0x4010
+	c.write32(0x4000, 1)
+	c.write32(0x4010, 2)
+	c.d[0], c.d[1], c.d[2], c.d[3] = 1, 2, 10, 20
+	run(t, b, c, 0x0e, 0xfc, 0x80, 0x80, 0x90, 0xc1)
+	if c.read32(0x4000) != 10 || c.read32(0x4010) != 20 {
+		t.Fatalf("cas2 0x%x 0x%x", c.read32(0x4000), c.read32(0x4010))
+	}
+
+	// pack and unpack
+	c.d[0] = 0x0304
+	run(t, b, c, 0x83, 0x40, 0x00, 0x00)
+	if c.d[1]&0xff != 0x34 {
+		t.Fatalf("pack d1 0x%x", c.d[1])
+	}
+	c.a[0], c.a[1] = 0x4001, 0x4012
+	c.write8(0x4000, 0x42)
+	run(t, b, c, 0x83, 0x88, 0x30, 0x30)
+	if c.read16(0x4010) != 0x3432 || c.a[0] != 0x4000 || c.a[1] != 0x4010 {
+		t.Fatalf("unpk 0x%x a0 0x%x a1 0x%x", c.read16(0x4010), c.a[0],
+			c.a[1])
+	}
+
+	// bit fields
+	c.a[0] = 0x4000
+	c.write16(0x4000, 0x1234)
+	run(t, b, c, 0xe9, 0xd0, 0x11, 0x08) // bfextu (a0){4:8},d1
+	if c.d[1] != 0x23 {
+		t.Fatalf("bfextu d1 0x%x", c.d[1])
+	}
+	c.a[0], c.d[1] = 0x4001, 0xfffffffc
+	run(t, b, c, 0xee, 0xd0, 0x08, 0x48) // bfset (a0){d1:8}
+	if c.read16(0x4000) != 0x1ff4 || c.sr&negative != 0 {
+		t.Fatalf("bfset 0x%x sr 0x%04x", c.read16(0x4000), c.sr)
+	}
+	c.d[0], c.d[1], c.d[2] = 0, 8, 0x11223344
+	run(t, b, c, 0xef, 0xc0, 0x28, 0x40) // bfins d2,d0{d1:32}
+	if c.d[0] != 0x44112233 {
+		t.Fatalf("bfins d0 0x%x", c.d[0])
+	}
+	c.d[0] = 0x00010000
+	run(t, b, c, 0xed, 0xc0, 0x10, 0x00) // bfffo d0{0:32},d1
+	if c.d[1] != 15 {
+		t.Fatalf("bfffo d1 %v", c.d[1])
+	}
+	c.d[0] = 0x80
+	run(t, b, c, 0xeb, 0xc0, 0x26, 0x08) // bfexts d0{24:8},d2
+	if c.d[2] != 0xffffff80 || c.sr&negative == 0 {
+		t.Fatalf("bfexts d2 0x%x sr 0x%04x", c.d[2], c.sr)
+	}
+
+	// chk2 stacks a format 2 frame with the instruction address
+	vectors(c)
+	c.a[0] = 0x4000
+	c.write16(0x4000, 0xfffb)
+	c.write16(0x4002, 0x0005)
+	c.d[1] = 3
+	run(t, b, c, 0x02, 0xd0, 0x18, 0x00) // chk2.w (a0),d1
+	if c.sr&carry != 0 {
+		t.Fatalf("chk2 in bounds sr 0x%04x", c.sr)
+	}
+	c.d[1] = 6
+	sp := c.a[7]
+	step(t, c, pcStart)
+	if c.pc != 0x10000+vectorCHK*4 || c.a[7] != sp-12 ||
+		c.read16(c.a[7]+6) != 0x2018 || c.read32(c.a[7]+8) != pcStart {
+		t.Fatalf("chk2 pc 0x%x a7 0x%x format 0x%04x address 0x%x",
+			c.pc, c.a[7], c.read16(c.a[7]+6), c.read32(c.a[7]+8))
+	}
+}
+
+func Test68020Stacks(t *testing.T) {
+	b, c := newModel(t, M68020)
+	vectors(c)
+
+	// movec
+	c.msp = 0x3000
+	run(t, b, c, 0x4e, 0x7a, 0x08, 0x03) // movec msp,d0
+	run(t, b, c, 0x4e, 0x7a, 0x18, 0x04) // movec isp,d1
+	if c.d[0] != 0x3000 || c.d[1] != c.a[7] {
+		t.Fatalf("msp 0x%x isp 0x%x", c.d[0], c.d[1])
+	}
+	c.d[0] = 0x0101
+	run(t, b, c, 0x4e, 0x7b, 0x00, 0x02) // movec d0,cacr
+	if c.cacr != 0x0101 {
+		t.Fatalf("cacr 0x%x", c.cacr)
+	}
+
+	// an interrupt on the master stack pushes a throwaway frame
+	isp := c.a[7]
+	c.setSR(supervisor | master)
+	if c.a[7] != 0x3000 || c.ssp != isp {
+		t.Fatalf("master a7 0x%x isp 0x%x", c.a[7], c.ssp)
+	}
+	c.Interrupt(4, cpu.Autovector)
+	step(t, c, pcStart)
+	c.Interrupt(4, nil)
+	if c.sr&master != 0 || c.a[7] != isp-8 || c.msp != 0x3000-8 ||
+		c.read16(c.a[7]+6) != 0x1070 {
+		t.Fatalf("interrupt sr 0x%04x a7 0x%x msp 0x%x format 0x%04x",
+			c.sr, c.a[7], c.msp, c.read16(c.a[7]+6))
+	}
+
+	// rte pops the throwaway frame and returns through the master stack
+	c.write16(c.pc, 0x4e73)
+	step(t, c, c.pc)
+	if c.pc != pcStart || c.sr&master == 0 || c.a[7] != 0x3000 ||
+		c.ssp != isp {
+		t.Fatalf("rte pc 0x%x sr 0x%04x a7 0x%x isp 0x%x", c.pc, c.sr,
+			c.a[7], c.ssp)
+	}
+}
+
+func Test68020BusError(t *testing.T) {
+	b, c := newModel(t, M68020)
+	vectors(c)
+	handler := uint32(0x10000 + vectorBusError*4)
+	c.write16(handler, 0x4e73) // rte
+
+	ssp := c.a[7]
+	c.a[0] = 0x200000
+	b.Write(pcStart, []byte{0x30, 0x10}) // move.w (a0),d0
+	step(t, c, pcStart)
+	if c.pc != handler || c.a[7] != ssp-32 {
+		t.Fatalf("pc 0x%x a7 0x%x", c.pc, c.a[7])
+	}
+	frame := []uint32{
+		uint32(c.read16(c.a[7])), uint32(c.read16(c.a[7] + 6)),
+		uint32(c.read16(c.a[7] + 10)), uint32(c.read16(c.a[7] + 12)),
+		c.read32(c.a[7] + 16), c.read32(c.a[7] + 20),
+	}
+	want := []uint32{0x2700, 0xa008,
+		sswDataFault | sswRead | functionSupervisorData, 0x3010,
+		0x200000, pcStart}
+	for k := range frame {
+		if frame[k] != want[k] {
+			t.Fatalf("frame %x want %x", frame, want)
+		}
+	}
+
+	// rte restarts the instruction
+	c.a[0] = 0x4000
+	c.write16(0x4000, 0x1234)
+	if _, err := c.Step(); err != nil {
+		t.Fatal(err)
+	}
+	if c.pc != pcStart || c.a[7] != ssp {
+		t.Fatalf("rte pc 0x%x a7 0x%x", c.pc, c.a[7])
+	}
+}
+
+func Test68020FPU(t *testing.T) {
+	b, c := newModel(t, M68020)
+	vectors(c)
+
+	// line 1111 emulator without an FPU
+	b.Write(pcStart, []byte{0xf2, 0x00, 0x00, 0x00}) // fmove.x fp0,fp0
+	step(t, c, pcStart)
+	if c.pc != 0x10000+vectorLineF*4 || c.read32(c.a[7]+2) != pcStart {
+		t.Fatalf("line f pc 0x%x stacked 0x%x", c.pc,
+			c.read32(c.a[7]+2))
+	}
+
+	b, c = newModel(t, M68020)
+	vectors(c)
+	f, err := m68881.New(m68881.M68881)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AttachFPU(f); err != nil {
+		t.Fatal(err)
+	}
+	_, c000 := newModel(t, M68000)
+	if c000.AttachFPU(f) != ErrNoCoprocessor {
+		t.Fatalf("68000 accepted an FPU")
+	}
+
+	// operands in and out
+	c.d[1] = 2
+	c.a[0] = 0x4000
+	// fmove.l #3,fp0
+	run(t, b, c, 0xf2, 0x3c, 0x40, 0x00, 0x00, 0x00, 0x00, 0x03)
+	run(t, b, c, 0xf2, 0x01, 0x40, 0x22) // fadd.l d1,fp0
+	run(t, b, c, 0xf2, 0x10, 0x60, 0x00) // fmove.l fp0,(a0)
+	if f.Float64(0) != 5 || c.read32(0x4000) != 5 {
+		t.Fatalf("fp0 %v (a0) %v", f.Float64(0), c.read32(0x4000))
+	}
+	// fmove.d #1.5,fp1
+	run(t, b, c, 0xf2, 0x3c, 0x54, 0x80,
+		0x3f, 0xf8, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00)
+	run(t, b, c, 0xf2, 0x18, 0x68, 0x80) // fmove.x fp1,(a0)+
+	if f.Float64(1) != 1.5 || c.a[0] != 0x400c ||
+		c.read32(0x4000) != 0x3fff0000 ||
+		c.read32(0x4004) != 0xc0000000 {
+		t.Fatalf("fp1 %v a0 0x%x", f.Float64(1), c.a[0])
+	}
+	c.d[0] = 0xffffffff
+	run(t, b, c, 0xf2, 0x00, 0x78, 0x80) // fmove.b fp1,d0
+	if c.d[0] != 0xffffff02 {
+		t.Fatalf("fmove.b d0 0x%x", c.d[0])
+	}
+
+	// conditionals
+	run(t, b, c, 0xf2, 0x00, 0x04, 0x38) // fcmp.x fp1,fp0
+	run(t, b, c, 0xf2, 0x42, 0x00, 0x0e) // fsne d2
+	if c.d[2]&0xff != 0xff {
+		t.Fatalf("fsne d2 0x%x", c.d[2])
+	}
+	b.Write(pcStart, []byte{0xf2, 0x81, 0x00, 0x10}) // fbeq *+$12
+	step(t, c, pcStart)
+	if c.pc != pcStart+4 {
+		t.Fatalf("fbeq pc 0x%x", c.pc)
+	}
+	b.Write(pcStart, []byte{0xf2, 0x8e, 0x00, 0x10}) // fbne *+$12
+	step(t, c, pcStart)
+	if c.pc != pcStart+0x12 {
+		t.Fatalf("fbne pc 0x%x", c.pc)
+	}
+	c.d[3] = 1
+	// fdbf d3,*-$2
+	b.Write(pcStart, []byte{0xf2, 0x4b, 0x00, 0x00, 0xff, 0xfc})
+	step(t, c, pcStart)
+	if c.pc != pcStart || c.d[3] != 0 {
+		t.Fatalf("fdbf pc 0x%x d3 0x%x", c.pc, c.d[3])
+	}
+	b.Write(pcStart, []byte{0xf2, 0x7c, 0x00, 0x0f}) // ftrapt
+	step(t, c, pcStart)
+	if c.pc != 0x10000+vectorTRAPV*4 ||
+		c.read32(c.a[7]+2) != pcStart+4 {
+		t.Fatalf("ftrapt pc 0x%x", c.pc)
+	}
+
+	// enabled exceptions are taken after the instruction
+	// fmove.l #$400,fpcr
+	run(t, b, c, 0xf2, 0x3c, 0x90, 0x00, 0x00, 0x00, 0x04, 0x00)
+	b.Write(pcStart, []byte{0xf2, 0x04, 0x40, 0x20}) // fdiv.l d4,fp0
+	step(t, c, pcStart)
+	if c.pc != 0x10000+50*4 || c.read32(c.a[7]+2) != pcStart+4 {
+		t.Fatalf("fdiv pc 0x%x", c.pc)
+	}
+
+	// fsave and frestore
+	c.sr |= supervisor
+	ssp := c.a[7]
+	run(t, b, c, 0xf3, 0x27) // fsave -(a7)
+	if c.a[7] != ssp-0x1c || c.read16(c.a[7]) != 0x1f18 {
+		t.Fatalf("fsave a7 0x%x frame 0x%04x", c.a[7],
+			c.read16(c.a[7]))
+	}
+	run(t, b, c, 0xf3, 0x5f) // frestore (a7)+
+	if c.a[7] != ssp {
+		t.Fatalf("frestore a7 0x%x", c.a[7])
+	}
+	c.write32(c.a[7]-4, 0x12340000)
+	c.a[7] -= 4
+	b.Write(pcStart, []byte{0xf3, 0x5f}) // frestore (a7)+
+	step(t, c, pcStart)
+	if c.pc != 0x10000+vectorFormatError*4 || c.a[7] != ssp-4-8 {
+		t.Fatalf("frestore format error pc 0x%x a7 0x%x", c.pc,
+			c.a[7])
+	}
+
+	// disassembly
+	tests := []struct {
+		name string
+		code []byte
+	}{
+		{"fmove.l #$3,fp0",
+			[]byte{0xf2, 0x3c, 0x40, 0x00, 0x00, 0x00, 0x00, 0x03}},
+		{"fmove.d #$3ff8000000000000,fp1",
+			[]byte{0xf2, 0x3c, 0x54, 0x80,
+				0x3f, 0xf8, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
+		{"fadd.l d1,fp0", []byte{0xf2, 0x01, 0x40, 0x22}},
+		{"fsqrt.x fp1", []byte{0xf2, 0x00, 0x04, 0x84}},
+		{"fsincos.x fp0,fp2:fp1", []byte{0xf2, 0x00, 0x00, 0xb2}},
+		{"fmovecr.x #$32,fp0", []byte{0xf2, 0x00, 0x5c, 0x32}},
+		{"fmove.p fp0,(a0){#-2}", []byte{0xf2, 0x10, 0x6c, 0x7e}},
+		{"fmove.p fp0,(a0){d1}", []byte{0xf2, 0x10, 0x7c, 0x10}},
+		{"fmove.l fpcr,d0", []byte{0xf2, 0x00, 0xb0, 0x00}},
+		{"fmovem.l (a0),fpcr/fpsr", []byte{0xf2, 0x10, 0x98, 0x00}},
+		{"fmovem.x fp0-fp2/fp7,-(a7)", []byte{0xf2, 0x27, 0xe0, 0x87}},
+		{"fmovem.x (a7)+,fp0-fp2/fp7", []byte{0xf2, 0x1f, 0xd0, 0xe1}},
+		{"fmovem.x d1,(a0)", []byte{0xf2, 0x10, 0xf8, 0x10}},
+		{"fnop", []byte{0xf2, 0x80, 0x00, 0x00}},
+		{"fbne.w *+$12", []byte{0xf2, 0x8e, 0x00, 0x10}},
+		{"fdbf d3,*-$2", []byte{0xf2, 0x4b, 0x00, 0x00, 0xff, 0xfc}},
+		{"fsne.b d2", []byte{0xf2, 0x42, 0x00, 0x0e}},
+		{"ftrapgt.w #$1", []byte{0xf2, 0x7a, 0x00, 0x12, 0x00, 0x01}},
+		{"fsave -(a7)", []byte{0xf3, 0x27}},
+		{"frestore (a7)+", []byte{0xf3, 0x5f}},
+	}
+	for _, test := range tests {
+		b.Write(pcStart, test.code)
+		d, n, err := c.disassemble(pcStart)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d != strings.Replace(test.name, " ", "\t", 1) ||
+			n != len(test.code) {
+			t.Fatalf("disassembled %q %v want %q", d, n, test.name)
+		}
+	}
+}
+
+// recorder is a peripheral that records its bus cycles.
+type recorder struct {
+	data   [0x100]byte
+	cycles []string
+}
+
+func (r *recorder) Read(address, length uint64) []byte {
+	r.cycles = append(r.cycles, fmt.Sprintf("r%x/%v", address, length))
+	return append([]byte{}, r.data[address:address+length]...)
+}
+
+func (r *recorder) Write(address uint64, data []byte) {
+	r.cycles = append(r.cycles, fmt.Sprintf("w%x/%v", address,
+		len(data)))
+	copy(r.data[address:], data)
+}
+
+func (r *recorder) Reset(powerOn bool) {}
+
+func (r *recorder) Length() uint64 {
+	return uint64(len(r.data))
+}
+
+// lockRecorder is a recorder that observes read-modify-write cycles.
+type lockRecorder struct {
+	recorder
+}
+
+func (r *lockRecorder) ReadModifyWrite(address, length uint64,
+	modify func([]byte) []byte) {
+	r.cycles = append(r.cycles, fmt.Sprintf("rmw%x/%v", address, length))
+	copy(r.data[address:],
+		modify(append([]byte{}, r.data[address:address+length]...)))
+}
+
+func Test68008Bus(t *testing.T) {
+	// addresses wrap at 1M
+	b, c := newModel(t, M68008)
+	c.a[0] = 0xf0100010
+	c.d[0] = 0x12345678
+	run(t, b, c, 0x20, 0x80) // move.l d0,(a0)
+	if v, _ := b.Read(0x10, 4); binary.BigEndian.Uint32(v) != 0x12345678 {
+		t.Fatalf("wrapped write %x", v)
+	}
+
+	// 4M on the PLCC part, beyond the RAM is a bus error
+	b, c = newModel(t, M68008FN)
+	vectors(c)
+	c.a[0] = 0x400020
+	c.d[0] = 0x12345678
+	run(t, b, c, 0x20, 0x80) // move.l d0,(a0)
+	if v, _ := b.Read(0x20, 4); binary.BigEndian.Uint32(v) != 0x12345678 {
+		t.Fatalf("wrapped write %x", v)
+	}
+	c.a[0] = 0x100010
+	b.Write(pcStart, []byte{0x20, 0x80})
+	step(t, c, pcStart)
+	if c.pc != 0x10000+vectorBusError*4 {
+		t.Fatalf("bus error pc 0x%x", c.pc)
+	}
+
+	// words and longs are split into byte cycles
+	b, err := bus.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &recorder{}
+	if _, err = b.Attach(0, memory.NewRAM(0x8000)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = b.Attach(0x8000, r); err != nil {
+		t.Fatal(err)
+	}
+	b.Write(0, []byte{0x00, 0x00, 0x20, 0x00, 0x00, 0x00, 0x10, 0x00})
+	c, err = NewModel(M68008, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Reset()
+	if c.a[7] != 0x2000 || c.pc != pcStart {
+		t.Fatalf("reset a7 0x%x pc 0x%x", c.a[7], c.pc)
+	}
+
+	c.a[0] = 0x8010
+	c.d[0] = 0x12345678
+	b.Write(pcStart, []byte{0x20, 0x80}) // move.l d0,(a0)
+	cycles, err := c.Step()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cycles != 24 {
+		t.Fatalf("move.l cycles %v", cycles)
+	}
+	b.Write(pcStart, []byte{0x32, 0x10}) // move.w (a0),d1
+	c.pc = pcStart
+	if cycles, err = c.Step(); err != nil {
+		t.Fatal(err)
+	}
+	if cycles != 16 || c.d[1] != 0x1234 {
+		t.Fatalf("move.w cycles %v d1 0x%x", cycles, c.d[1])
+	}
+	want := "w10/1 w11/1 w12/1 w13/1 r10/1 r11/1"
+	if got := strings.Join(r.cycles, " "); got != want {
+		t.Fatalf("bus cycles %v want %v", got, want)
+	}
+}
+
+func TestCPU32Instructions(t *testing.T) {
+	b, c := newModel(t, MCPU32)
+	vectors(c)
+
+	tests := []struct {
+		name string
+		code []byte
+	}{
+		{"tbls.w (a0),d1", []byte{0xf8, 0x10, 0x18, 0x40}},
+		{"tblun.b d2:d3,d1", []byte{0xf8, 0x02, 0x14, 0x03}},
+		{"tblu.l $10(a0),d0",
+			[]byte{0xf8, 0x28, 0x00, 0x80, 0x00, 0x10}},
+		{"lpstop #$2700", []byte{0xf8, 0x00, 0x01, 0xc0, 0x27, 0x00}},
+		{"bgnd", []byte{0x4a, 0xfa}},
+		{"extb.l d1", []byte{0x49, 0xc1}},
+		{"mulu.l d1,d0", []byte{0x4c, 0x01, 0x00, 0x00}},
+	}
+	for _, test := range tests {
+		b.Write(pcStart, test.code)
+		d, n, err := c.disassemble(pcStart)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d != strings.Replace(test.name, " ", "\t", 1) ||
+			n != len(test.code) {
+			t.Fatalf("disassembled %q %v want %q", d, n, test.name)
+		}
+	}
+	if opcodesCPU32[0xe8c0].execute != nil ||
+		opcodesCPU32[0x0cd0].execute != nil {
+		t.Fatalf("CPU32 decodes bit field or cas")
+	}
+
+	// table lookup and interpolate
+	tables := []struct {
+		name string
+		code []byte
+		x    uint32
+		want uint32
+		ccr  uint16
+	}{
+		// entries 100 and 200 at $4002, halfway
+		{"tblu.w (a0),d1", []byte{0xf8, 0x10, 0x10, 0x40}, 0xffff0180,
+			0xffff0096, 0},
+		{"tblun.w (a0),d1", []byte{0xf8, 0x10, 0x14, 0x40}, 0x00000140,
+			0x00007d00, 0},
+		// entries -2 and -3 in d2 and d3, a quarter
+		{"tbls.b d2:d3,d1", []byte{0xf8, 0x02, 0x18, 0x03}, 0x12345640,
+			0x123456fe, negative},
+		{"tblsn.b d2:d3,d1", []byte{0xf8, 0x02, 0x1c, 0x03}, 0x12345640,
+			0x1234fdc0, negative},
+		{"tbls.l d4:d5,d1", []byte{0xf8, 0x04, 0x18, 0x85}, 0x00000080,
+			0x40000000, 0},
+		{"tblsn.l d4:d5,d1", []byte{0xf8, 0x04, 0x1c, 0x85}, 0x00000080,
+			0x00000000, overflow | zero},
+	}
+	c.a[0] = 0x4000
+	c.write16(0x4000, 50)
+	c.write16(0x4002, 100)
+	c.write16(0x4004, 200)
+	c.d[2] = 0xfffffffe
+	c.d[3] = 0xfffffffd
+	c.d[4] = 0x7fffffff
+	c.d[5] = 0x00000001
+	for _, test := range tables {
+		c.d[1] = test.x
+		run(t, b, c, test.code...)
+		if c.d[1] != test.want || c.sr&ccrMask != test.ccr {
+			t.Fatalf("%v: d1 0x%08x ccr 0x%02x", test.name, c.d[1],
+				c.sr&ccrMask)
+		}
+	}
+
+	// memory indirection is illegal
+	b.Write(pcStart, []byte{0x20, 0x30, 0x01, 0x11}) // ([a0,d0.w]),d0
+	step(t, c, pcStart)
+	if c.pc != 0x10000+vectorIllegal*4 {
+		t.Fatalf("memory indirect pc 0x%x", c.pc)
+	}
+
+	// low power stop
+	c.sr = supervisor
+	run(t, b, c, 0xf8, 0x00, 0x01, 0xc0, 0x27, 0x00) // lpstop #$2700
+	if c.State() != cpu.Stopped || c.sr != 0x2700 {
+		t.Fatalf("lpstop state %v sr 0x%04x", c.State(), c.sr)
+	}
+}
+
+func TestCPU32Background(t *testing.T) {
+	b, c := newModel(t, MCPU32)
+	vectors(c)
+
+	if _, err := c.ReadRegister(0); err != ErrNotBackground {
+		t.Fatalf("read outside background mode %v", err)
+	}
+	c.d[3] = 0x1234
+	run(t, b, c, 0x4a, 0xfa) // bgnd
+	if c.State() != cpu.Background {
+		t.Fatalf("state %v", c.State())
+	}
+	c.Interrupt(7, cpu.Autovector)
+	if cycles, err := c.Step(); err != nil || cycles != 0 ||
+		c.pc != pcStart+2 {
+		t.Fatalf("step cycles %v pc 0x%x err %v", cycles, c.pc, err)
+	}
+	c.Interrupt(7, nil)
+
+	d3, err := c.ReadRegister(3)
+	if err != nil || d3 != 0x1234 {
+		t.Fatalf("d3 0x%x %v", d3, err)
+	}
+	pcc, _ := c.ReadSystemRegister(DebugPCC)
+	rpc, _ := c.ReadSystemRegister(DebugRPC)
+	sr, _ := c.ReadSystemRegister(DebugSR)
+	if pcc != pcStart || rpc != pcStart+2 || sr != 0x2700 {
+		t.Fatalf("pcc 0x%x rpc 0x%x sr 0x%x", pcc, rpc, sr)
+	}
+	if err := c.WriteSystemRegister(DebugPCC, 0); err != ErrDebugRegister {
+		t.Fatalf("write pcc %v", err)
+	}
+	if err := c.WriteRegister(8, 0x4000); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.WriteSystemRegister(DebugUSP, 0x5000); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.WriteSystemRegister(DebugSR, 0x0000); err != nil {
+		t.Fatal(err)
+	}
+	if c.a[7] != 0x5000 || c.a[0] != 0x4000 {
+		t.Fatalf("a7 0x%x a0 0x%x", c.a[7], c.a[0])
+	}
+
+	// resume at a new program counter
+	b.Write(0x3000, []byte{0x20, 0x83}) // move.l d3,(a0)
+	if err := c.WriteSystemRegister(DebugRPC, 0x3000); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Go(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Step(); err != nil {
+		t.Fatal(err)
+	}
+	if c.pc != 0x3002 || c.read32(0x4000) != 0x1234 {
+		t.Fatalf("resumed pc 0x%x (a0) 0x%x", c.pc, c.read32(0x4000))
+	}
+	if c.Go() != ErrNotBackground {
+		t.Fatalf("go while running")
+	}
+}
+
+func TestCPU32BusError(t *testing.T) {
+	b, c := newModel(t, MCPU32)
+	vectors(c)
+	handler := uint32(0x10000 + vectorBusError*4)
+	c.write16(handler, 0x4e73) // rte
+
+	ssp := c.a[7]
+	c.a[0] = 0x200000
+	b.Write(pcStart, []byte{0x30, 0x10}) // move.w (a0),d0
+	step(t, c, pcStart)
+	if c.pc != handler || c.a[7] != ssp-24 {
+		t.Fatalf("pc 0x%x a7 0x%x", c.pc, c.a[7])
+	}
+	frame := []uint32{
+		uint32(c.read16(c.a[7])), uint32(c.read16(c.a[7] + 6)),
+		c.read32(c.a[7] + 8), c.read32(c.a[7] + 16),
+		uint32(c.read16(c.a[7] + 22)),
+	}
+	want := []uint32{0x2700, 0xc008, 0x200000, pcStart,
+		sswRead | functionSupervisorData}
+	for k := range frame {
+		if frame[k] != want[k] {
+			t.Fatalf("frame %x want %x", frame, want)
+		}
+	}
+
+	// rte restarts the instruction
+	c.a[0] = 0x4000
+	c.write16(0x4000, 0x1234)
+	if _, err := c.Step(); err != nil {
+		t.Fatal(err)
+	}
+	if c.pc != pcStart || c.a[7] != ssp {
+		t.Fatalf("rte pc 0x%x a7 0x%x", c.pc, c.a[7])
+	}
+}
+
+func TestColdFireInstructions(t *testing.T) {
+	b, c := newModel(t, MColdFire)
+	vectors(c)
+
+	tests := []struct {
+		name string
+		code []byte
+	}{
+		{"mac.w d1.l,d2.l,acc0", []byte{0xa2, 0x02, 0x00, 0x00}},
+		{"msac.l d1,d2,<<1,acc1", []byte{0xa2, 0x82, 0x0b, 0x00}},
+		{"mac.w d5.u,d6.l,acc2", []byte{0xaa, 0x06, 0x00, 0x90}},
+		{"mac.w d1.l,d2.l,(a0)+&,d3,acc0",
+			[]byte{0xa6, 0x18, 0x10, 0x22}},
+		{"move.l d0,acc0", []byte{0xa1, 0x00}},
+		{"move.l acc0,d3", []byte{0xa1, 0x83}},
+		{"move.l mask,a1", []byte{0xad, 0x89}},
+		{"movclr.l acc0,d0", []byte{0xa1, 0xc0}},
+		{"move.l acc1,acc0", []byte{0xa1, 0x11}},
+		{"move.l macsr,ccr", []byte{0xa9, 0xc0}},
+		{"rems.l d1,d2:d0", []byte{0x4c, 0x41, 0x08, 0x02}},
+		{"divu.l d1,d0", []byte{0x4c, 0x41, 0x00, 0x00}},
+		{"tpf", []byte{0x51, 0xfc}},
+		{"tpf.w #$1", []byte{0x51, 0xfa, 0x00, 0x01}},
+		{"halt", []byte{0x4a, 0xc8}},
+		{"pulse", []byte{0x4a, 0xcc}},
+		{"movec d0,vbr", []byte{0x4e, 0x7b, 0x08, 0x01}},
+	}
+	for _, test := range tests {
+		b.Write(pcStart, test.code)
+		d, n, err := c.disassemble(pcStart)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d != strings.Replace(test.name, " ", "\t", 1) ||
+			n != len(test.code) {
+			t.Fatalf("disassembled %q %v want %q", d, n, test.name)
+		}
+	}
+
+	// the instruction subset and its addressing modes
+	valid := []uint16{
+		0x2200, // move.l d0,d1
+		0x2368, // move.l $10(a0),$20(a1)
+		0x22bc, // move.l #<data>,(a1)
+		0xd280, // add.l d0,d1
+		0x0680, // addi.l #<data>,d0
+		0xe188, // lsl.l #8,d0
+		0x4c10, // muls.l (a0),d0
+		0x08d0, // bset #<data>,(a0)
+		0x48d0, // movem.l <list>,(a0)
+	}
+	invalid := []uint16{
+		0x2370, // move.l (d8,a0,xn),$10(a1)
+		0x237c, // move.l #<data>,$10(a1)
+		0xd240, // add.w d0,d1
+		0x0690, // addi.l #<data>,(a0)
+		0x4090, // negx.l (a0)
+		0x51c8, // dbra
+		0xc141, // exg
+		0xc300, // abcd
+		0xe098, // ror.l
+		0x4380, // chk.w
+		0x027c, // andi #<data>,sr
+		0x4e77, // rtr
+		0x4e76, // trapv
+		0x4e60, // move a0,usp
+		0xb188, // cmpm.l
+		0x4c30, // muls.l (d8,a0,xn),d0
+		0x48e0, // movem.l <list>,-(a0)
+		0x4e7a, // movec <rc>,d0
+	}
+	for _, opcode := range valid {
+		if opcodesColdFire[opcode].execute == nil {
+			t.Fatalf("opcode 0x%04x not decoded", opcode)
+		}
+	}
+	for _, opcode := range invalid {
+		if opcodesColdFire[opcode].execute != nil {
+			t.Fatalf("opcode 0x%04x decoded", opcode)
+		}
+	}
+	// addi, subi, cmpi, andi, ori and eori take the time of the 68000
+	for _, opcode := range []uint16{0x0680, 0x0480, 0x0c80, 0x0280,
+		0x0080, 0x0a80} {
+		if opcodesColdFire[opcode].cycles != opcodes[opcode].cycles {
+			t.Fatalf("opcode 0x%04x %v cycles want %v", opcode,
+				opcodesColdFire[opcode].cycles,
+				opcodes[opcode].cycles)
+		}
+	}
+	b.Write(pcStart, []byte{0xd2, 0x40}) // add.w d0,d1
+	step(t, c, pcStart)
+	if c.pc != 0x10000+vectorIllegal*4 {
+		t.Fatalf("add.w pc 0x%x", c.pc)
+	}
+	b.Write(pcStart, []byte{0xa1, 0x40})
+	step(t, c, pcStart)
+	if c.pc != 0x10000+vectorLineA*4 {
+		t.Fatalf("line a pc 0x%x", c.pc)
+	}
+
+	// long index registers scaled by up to 4
+	c.a[0] = 0x4000
+	c.d[0] = 0x10
+	c.write32(0x4040, 0xcafebabe)
+	run(t, b, c, 0x22, 0x30, 0x0c, 0x00) // move.l (0,a0,d0.l*4),d1
+	if c.d[1] != 0xcafebabe {
+		t.Fatalf("indexed d1 0x%x", c.d[1])
+	}
+	for _, ext := range []byte{0x00, 0x0e, 0x09} {
+		b.Write(pcStart, []byte{0x22, 0x30, ext, 0x00})
+		step(t, c, pcStart)
+		if c.pc != 0x10000+vectorIllegal*4 {
+			t.Fatalf("index 0x%02x00 pc 0x%x", ext, c.pc)
+		}
+	}
+
+	// divide and remainder
+	divides := []struct {
+		name   string
+		code   []byte
+		d0, d2 uint32
+	}{
+		{"divs.l d1,d0", []byte{0x4c, 0x41, 0x08, 0x00}, 0xfffffffb,
+			0x55},
+		{"rems.l d1,d2:d0", []byte{0x4c, 0x41, 0x08, 0x02}, 0xffffffe9,
+			0xfffffffd},
+		{"remu.l d1,d2:d0", []byte{0x4c, 0x41, 0x00, 0x02}, 0xffffffe9,
+			0x00000001},
+	}
+	for _, test := range divides {
+		c.d[0] = 0xffffffe9 // -23
+		c.d[1] = 4
+		c.d[2] = 0x55
+		run(t, b, c, test.code...)
+		if c.d[0] != test.d0 || c.d[2] != test.d2 {
+			t.Fatalf("%v: d0 0x%x d2 0x%x", test.name, c.d[0],
+				c.d[2])
+		}
+	}
+
+	// movec only writes VBR and CACR
+	c.sr = supervisor
+	c.d[0] = 0x00123456
+	run(t, b, c, 0x4e, 0x7b, 0x08, 0x01) // movec d0,vbr
+	run(t, b, c, 0x4e, 0x7b, 0x00, 0x02) // movec d0,cacr
+	if c.vbr != 0x00100000 || c.cacr != 0x00123456 {
+		t.Fatalf("vbr 0x%x cacr 0x%x", c.vbr, c.cacr)
+	}
+	c.vbr = 0
+	b.Write(pcStart, []byte{0x4e, 0x7b, 0x08, 0x00}) // movec d0,usp
+	step(t, c, pcStart)
+	if c.pc != 0x10000+vectorIllegal*4 {
+		t.Fatalf("movec usp pc 0x%x", c.pc)
+	}
+
+	// a single stack pointer
+	c.sr = supervisor
+	c.a[7] = 0x3000
+	run(t, b, c, 0x46, 0xfc, 0x00, 0x00) // move #0,sr
+	if c.sr != 0 || c.a[7] != 0x3000 {
+		t.Fatalf("sr 0x%x a7 0x%x", c.sr, c.a[7])
+	}
+
+	// halt enters the debug halt state
+	c.sr = supervisor
+	run(t, b, c, 0x4a, 0xc8)
+	if c.State() != cpu.Background {
+		t.Fatalf("halt state %v", c.State())
+	}
+	if err := c.Go(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestColdFireException(t *testing.T) {
+	b, c := newModel(t, MColdFire)
+	vectors(c)
+	c.write16(0x10000+(vectorTrap+1)*4, 0x4e73) // rte
+
+	// the stack is aligned and the format records by how much
+	c.a[7] = 0x2003
+	b.Write(pcStart, []byte{0x4e, 0x41}) // trap #1
+	step(t, c, pcStart)
+	if c.a[7] != 0x1ff8 {
+		t.Fatalf("a7 0x%x", c.a[7])
+	}
+	frame := []uint32{uint32(c.read16(0x1ff8)), uint32(c.read16(0x1ffa)),
+		c.read32(0x1ffc)}
+	want := []uint32{0x7084, 0x2700, pcStart + 2}
+	for k := range frame {
+		if frame[k] != want[k] {
+			t.Fatalf("frame %x want %x", frame, want)
+		}
+	}
+	if _, err := c.Step(); err != nil {
+		t.Fatal(err)
+	}
+	if c.pc != pcStart+2 || c.a[7] != 0x2003 {
+		t.Fatalf("rte pc 0x%x a7 0x%x", c.pc, c.a[7])
+	}
+
+	// access errors stack the fault status and the faulted instruction
+	faults := []struct {
+		name   string
+		code   []byte
+		format uint16
+	}{
+		{"move.l (a0),d0", []byte{0x20, 0x10}, 0x4c08},
+		{"move.l d0,(a0)", []byte{0x20, 0x80}, 0x4808},
+	}
+	for _, test := range faults {
+		c.a[7] = 0x2000
+		c.a[0] = 0x200000
+		b.Write(pcStart, test.code)
+		step(t, c, pcStart)
+		if c.pc != 0x10000+vectorBusError*4 ||
+			c.read16(0x1ff8) != test.format ||
+			c.read32(0x1ffc) != pcStart {
+			t.Fatalf("%v: pc 0x%x format 0x%04x stacked pc 0x%x",
+				test.name, c.pc, c.read16(0x1ff8),
+				c.read32(0x1ffc))
+		}
+	}
+
+	// rte checks the format
+	c.a[7] = 0x2000
+	c.sr = supervisor
+	c.write16(0x2000, 0x0000)
+	b.Write(pcStart, []byte{0x4e, 0x73})
+	step(t, c, pcStart)
+	if c.pc != 0x10000+vectorFormatError*4 {
+		t.Fatalf("format error pc 0x%x", c.pc)
+	}
+}
+
+func TestColdFireEMAC(t *testing.T) {
+	b, c := newModel(t, MColdFire)
+
+	// signed integer
+	c.d[0] = 10
+	c.d[1] = 3
+	c.d[2] = 0xfffffffc
+	run(t, b, c, 0xa1, 0x00)             // move.l d0,acc0
+	run(t, b, c, 0xa2, 0x02, 0x00, 0x00) // mac.w d1.l,d2.l,acc0
+	run(t, b, c, 0xa1, 0x83)             // move.l acc0,d3
+	if c.d[3] != 0xfffffffe || c.macsr != macsrN {
+		t.Fatalf("mac d3 0x%x macsr 0x%x", c.d[3], c.macsr)
+	}
+	run(t, b, c, 0xa2, 0x82, 0x0b, 0x00) // msac.l d1,d2,<<1,acc1
+	run(t, b, c, 0xa3, 0x84)             // move.l acc1,d4
+	if c.d[4] != 24 {
+		t.Fatalf("msac d4 0x%x", c.d[4])
+	}
+	run(t, b, c, 0xa9, 0xc0) // move.l macsr,ccr
+	if c.sr&ccrMask != 0 {
+		t.Fatalf("ccr 0x%x", c.sr&ccrMask)
+	}
+	run(t, b, c, 0xa1, 0x11) // move.l acc1,acc0
+	run(t, b, c, 0xa1, 0xc0) // movclr.l acc0,d0
+	if c.d[0] != 24 || c.acc[0] != 0 {
+		t.Fatalf("movclr d0 0x%x acc0 0x%x", c.d[0], c.acc[0])
+	}
+
+	// results that do not fit in 32 bits
+	c.d[1] = 2
+	run(t, b, c, 0xa1, 0x3c, 0x7f, 0xff, 0xff, 0xff) // move.l #,acc0
+	run(t, b, c, 0xa2, 0x01, 0x08, 0x00)             // mac.l d1,d1,acc0
+	run(t, b, c, 0xa1, 0x80)                         // move.l acc0,d0
+	if c.d[0] != 0x80000003 || c.macsr != macsrEV {
+		t.Fatalf("ev d0 0x%x macsr 0x%x", c.d[0], c.macsr)
+	}
+	run(t, b, c, 0xa9, 0x3c, 0x00, 0x00, 0x00, 0x80) // move.l #,macsr
+	run(t, b, c, 0xa1, 0x80)                         // move.l acc0,d0
+	if c.d[0] != 0x7fffffff {
+		t.Fatalf("saturated d0 0x%x", c.d[0])
+	}
+	run(t, b, c, 0xab, 0x3c, 0x00, 0x01, 0xff, 0xff) // accext01
+	if c.acc[0] != -0x7ffffffd || c.acc[1] != 0x100000018 {
+		t.Fatalf("accext acc0 0x%x acc1 0x%x", c.acc[0], c.acc[1])
+	}
+
+	// signed fractional, 0.5 * 0.5
+	c.d[5] = 0x40000000
+	c.d[6] = 0x00004000
+	run(t, b, c, 0xa9, 0x3c, 0x00, 0x00, 0x00, 0x20) // move.l #,macsr
+	run(t, b, c, 0xaa, 0x06, 0x00, 0x90)             // mac.w d5.u,d6.l,acc2
+	run(t, b, c, 0xa5, 0x87)                         // move.l acc2,d7
+	if c.d[7] != 0x20000000 {
+		t.Fatalf("fractional d7 0x%x", c.d[7])
+	}
+
+	// load with a circular buffer address
+	c.macsr = 0
+	c.acc[0] = 0
+	c.d[1] = 3
+	c.d[2] = 0xfffffffc
+	c.a[0] = 0x40fc
+	c.write32(0x40fc, 0x11223344)
+	run(t, b, c, 0xad, 0x3c, 0x00, 0x00, 0xfe, 0xff) // move.l #,mask
+
+	// mac.w d1.l,d2.l,(a0)+&,d3,acc0
+	run(t, b, c, 0xa6, 0x18, 0x10, 0x22)
+	if c.d[3] != 0x11223344 || c.a[0] != 0x4000 || c.acc[0] != -12 {
+		t.Fatalf("load d3 0x%x a0 0x%x acc0 %v", c.d[3], c.a[0],
+			c.acc[0])
+	}
+}
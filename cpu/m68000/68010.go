@@ -0,0 +1,273 @@
+package m68000
+
+import "encoding/binary"
+
+// The 68010 adds the vector base register, the function code registers used
+// by moves, format words in the exception stack frames and a loop mode for
+// dbcc.  Move from SR becomes privileged and move from CCR is added instead.
+// Instruction timing is that of the 68000 except where given below.
+
+var (
+	// patterns68010 describes the instructions the 68010 adds to or
+	// changes in the 68000 instruction set.
+	patterns68010 = []pattern{
+		{mask: 0xffff, match: 0x4e7a, size: 4, cycles: tFixed(12),
+			privileged: true, gen: genWord(movec, dMovec)},
+		{mask: 0xffff, match: 0x4e7b, size: 4, cycles: tFixed(10),
+			privileged: true, gen: genWord(movec, dMovec)},
+		{mask: 0xffc0, match: 0x0e00, ea: eaMemoryAlterable, size: 1,
+			cycles: tEA(18, 18), privileged: true,
+			gen: genMovem(moves, dMoves)},
+		{mask: 0xffc0, match: 0x0e40, ea: eaMemoryAlterable, size: 2,
+			cycles: tEA(18, 18), privileged: true,
+			gen: genMovem(moves, dMoves)},
+		{mask: 0xffc0, match: 0x0e80, ea: eaMemoryAlterable, size: 4,
+			cycles: tEA(22, 22), privileged: true,
+			gen: genMovem(moves, dMoves)},
+		{mask: 0xffc0, match: 0x40c0, ea: eaDataAlterable, size: 2,
+			cycles: tRM(4, 4, 8, 8), privileged: true,
+			gen: genDestination(moveFromSR, dMoveFromSR)},
+		{mask: 0xffc0, match: 0x42c0, ea: eaDataAlterable, size: 2,
+			cycles: tRM(4, 4, 8, 8),
+			gen:    genDestination(moveFromCCR, dMoveFromCCR)},
+		{mask: 0xffff, match: 0x4e74, size: 2, cycles: tFixed(16),
+			gen: genWord(rtd, dRtd)},
+		{mask: 0xffff, match: 0x4e73, cycles: tFixed(24),
+			privileged: true, gen: genImplied(rteFormat, dRte)},
+		{mask: 0xfff8, match: 0x4848, cycles: tFixed(34),
+			gen: genImplied(bkpt, dBkpt)},
+		{mask: 0xf0f8, match: 0x50c8, size: 2, cycles: tFixed(12),
+			gen: genDbccLoop},
+	}
+
+	opcodes68010 = generate(append(patterns68010, patterns68000...))
+)
+
+// genDbccLoop generates dbcc Dn,<label> with loop mode.
+func genDbccLoop(opcode uint16, size uint32) instruction {
+	i := genDbcc(opcode, size)
+	i.execute = dbccLoop
+	return i
+}
+
+func moveFromCCR(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	return uint32(c.sr & ccrMask)
+}
+
+// controls68010 are the 68010 movec control registers.
+var controls68010 = []uint32{0x000, 0x001, 0x800, 0x801}
+
+// control returns the control register selected by the low 12 bits of a movec
+// extension word, nil if the model does not implement it.
+func (c *m68k) control(ext uint32) *uint32 {
+	ext &= 0x0fff
+	implemented := false
+	for _, r := range c.model.controls {
+		implemented = implemented || r == ext
+	}
+	if !implemented {
+		return nil
+	}
+
+	switch ext {
+	case 0x000:
+		return &c.sfc
+	case 0x001:
+		return &c.dfc
+	case 0x002:
+		return &c.cacr
+	case 0x800:
+		return c.stackPointer(0)
+	case 0x801:
+		return &c.vbr
+	case 0x802:
+		return &c.caar
+	case 0x803:
+		return c.stackPointer(supervisor | master)
+	case 0x804:
+		return c.stackPointer(supervisor)
+	}
+	return nil
+}
+
+// movec moves between a control register and the general register in the
+// extension word.  Bit 0 of the opcode selects the direction.  Unimplemented
+// control registers are illegal instructions.
+func movec(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	r := c.control(src)
+	if r == nil {
+		c.raise(vectorIllegal, c.pc)
+	}
+	g := c.movemRegister(src >> 12)
+	if c.ir&0x0001 == 0 {
+		*g = *r
+		return dest
+	}
+	*r = *g
+	c.sfc &= 0x07
+	c.dfc &= 0x07
+	return dest
+}
+
+// moves moves between the general register in the extension word and memory
+// in the address space selected by SFC or DFC.  Bit 11 of the extension word
+// is set when moving to memory.  Address registers are loaded with the sign
+// extended operand.
+func moves(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	g := c.movemRegister(src >> 12)
+	address := c.address(dest, operand)
+	if src&0x0800 != 0 {
+		c.writeSpace(address, c.size, *g, uint16(c.dfc))
+		return dest
+	}
+
+	v := c.readSpace(address, c.size, uint16(c.sfc))
+	if src&0x8000 != 0 {
+		*g = signExtend(v, c.size)
+	} else {
+		m := mask(c.size)
+		*g = *g&^m | v
+	}
+	return dest
+}
+
+// readSpace reads size bytes from address in the address space fc.  The bus
+// does not decode function codes so the address space only shows in the
+// access word of a fault.
+func (c *m68k) readSpace(address, size uint32, fc uint16) uint32 {
+	access := accessRead | accessNotInstruction | fc
+	if size > 1 {
+		c.align(address, access)
+	}
+	v := c.load(address, uint64(size), access)
+	switch size {
+	case 1:
+		return uint32(v[0])
+	case 2:
+		return uint32(binary.BigEndian.Uint16(v))
+	}
+	return binary.BigEndian.Uint32(v)
+}
+
+// writeSpace writes the low size bytes of value to address in the address
+// space fc.
+func (c *m68k) writeSpace(address, size, value uint32, fc uint16) {
+	access := accessNotInstruction | fc
+	if size > 1 {
+		c.align(address, access)
+	}
+	v := make([]byte, 4)
+	binary.BigEndian.PutUint32(v, value)
+	c.store(address, v[4-size:], access)
+}
+
+// rtd returns and deallocates the displacement from the stack.
+func rtd(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	c.jump(c.pop32())
+	c.a[7] += signExtend(src, 2)
+	return dest
+}
+
+// rteFormat returns from an exception stack frame with a format word.  Bus
+// and address error frames restart the faulted instruction, see frame8.  A
+// throwaway frame only restores the status register and the frame on the
+// newly selected stack is returned from.  Formats the model does not use take
+// the format error exception.
+func rteFormat(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	for {
+		sr := c.read16(c.a[7])
+		pc := c.read32(c.a[7] + 2)
+		format := c.read16(c.a[7]+6) >> 12
+		length, restart := c.frameLength(format)
+		if length == 0 {
+			c.raise(vectorFormatError, c.pc)
+		}
+		if restart != 0 {
+			pc = c.read32(c.a[7] + restart)
+		}
+		c.a[7] += length
+		c.setSR(sr)
+		if format != 0x1 {
+			c.jump(pc)
+			return dest
+		}
+	}
+}
+
+// bkpt runs the breakpoint acknowledge cycle.  No device responds on this bus
+// so the illegal instruction exception is taken.
+func bkpt(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	c.raise(vectorIllegal, c.pc)
+	return dest
+}
+
+// dbccLoop is dbcc with the 68010 loop mode.  A dbcc that branches back to a
+// loopable one word instruction enters loop mode and the following
+// iterations execute from the loop buffer.  The opcode fetches of the loop
+// are suppressed: the loop instruction takes 4 clock periods less and a dbcc
+// that continues the loop takes 6.
+func dbccLoop(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	looping := c.loop
+	dest = dbcc(c, src, dest, operand)
+	if !c.jumped || src != 0xfffc {
+		c.loop = false
+		return dest
+	}
+	if looping {
+		c.cycles = 6
+		return dest
+	}
+	c.loopPC = c.pc
+	c.loop = c.loopable(c.fetch16(c.loopPC))
+	return dest
+}
+
+// loopable returns true if opcode may be the body of a loop mode loop.  It
+// must be a single word move, arithmetic, logical, compare, clear, test or
+// memory shift instruction with a memory operand addressed by (An), (An)+ or
+// -(An).  Loops that only operate on registers are not loopable.
+func (c *m68k) loopable(opcode uint16) bool {
+	i := &c.model.opcodes[opcode]
+	if i.execute == nil || i.operandSize != 0 {
+		return false
+	}
+
+	// memory returns true if mode is (An), (An)+ or -(An)
+	memory := func(mode uint16) bool {
+		return mode >= 0x02 && mode <= 0x04
+	}
+	mode := opcode >> 3 & 0x07
+	x := opcode&0x0130 == 0x0100 && opcode&0x00c0 != 0x00c0
+	switch opcode >> 12 {
+	case 0x1, 0x2, 0x3:
+		// move
+		return memory(mode) || memory(opcode>>6&0x07)
+	case 0x9, 0xb, 0xd:
+		// sub, cmp, eor and add, subx, cmpm and addx with memory
+		if x {
+			return opcode&0x0008 != 0
+		}
+		return memory(mode)
+	case 0x4:
+		// negx, clr, neg, not, tst and nbcd
+		switch opcode & 0xff00 {
+		case 0x4000, 0x4200, 0x4400, 0x4600, 0x4a00:
+			return opcode&0x00c0 != 0x00c0 && memory(mode)
+		}
+		return opcode&0xffc0 == 0x4800 && memory(mode)
+	case 0x8, 0xc:
+		// or, and, sbcd and abcd but not multiply, divide and exg
+		switch {
+		case opcode&0x00c0 == 0x00c0:
+			return false
+		case x:
+			// sbcd and abcd with -(An) but not exg
+			return opcode&0x00c0 == 0 && opcode&0x0008 != 0
+		}
+		return memory(mode)
+	case 0xe:
+		// memory shifts and rotates
+		return opcode&0x08c0 == 0x00c0 && memory(mode)
+	}
+	return false
+}
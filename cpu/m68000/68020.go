@@ -0,0 +1,477 @@
+package m68000
+
+import "math/bits"
+
+// The 68020 is a 32 bit implementation with full format extension words that
+// add scaled indexes, base and outer displacements and memory indirect
+// addressing.  It adds bit field, compare and swap, 32 bit multiply and
+// divide, bounds check and BCD pack instructions, a master stack pointer and
+// the cache control registers.  Data may be accessed at odd addresses.
+//
+// The cache is not emulated, CACR and CAAR are plain registers.  CALLM and
+// RTM and the T0 trace mode are not implemented and the coprocessor interface
+// only supports a floating point unit, see fpu.go.  The 68020 executes from
+// its instruction cache with pipeline overlap so instruction timing stays
+// that of the 68010 except where given below.
+
+var (
+	// patterns68020 describes the instructions the 68020 adds to or
+	// changes in the 68010 instruction set besides patterns32.
+	patterns68020 = []pattern{
+		// the 68020 has no loop mode
+		{mask: 0xf0f8, match: 0x50c8, size: 2, cycles: tFixed(12),
+			gen: genDbcc},
+
+		// compare and swap
+		{mask: 0xffff, match: 0x0cfc, size: 2, cycles: tFixed(24),
+			gen: genCas2},
+		{mask: 0xffff, match: 0x0efc, size: 4, cycles: tFixed(24),
+			gen: genCas2},
+		{mask: 0xffc0, match: 0x0ac0, ea: eaMemoryAlterable, size: 1,
+			cycles: tEA(16, 16), gen: genMovem(cas, dCas)},
+		{mask: 0xffc0, match: 0x0cc0, ea: eaMemoryAlterable, size: 2,
+			cycles: tEA(16, 16), gen: genMovem(cas, dCas)},
+		{mask: 0xffc0, match: 0x0ec0, ea: eaMemoryAlterable, size: 4,
+			cycles: tEA(16, 16), gen: genMovem(cas, dCas)},
+
+		// binary coded decimal
+		{mask: 0xf1f0, match: 0x8140, size: 1, cycles: tX(6, 6, 16, 16),
+			gen: genWord(pack, dPack)},
+		{mask: 0xf1f0, match: 0x8180, size: 1, cycles: tX(8, 8, 16, 16),
+			gen: genWord(unpk, dUnpk)},
+
+		// bit field
+		{mask: 0xffc0, match: 0xe8c0, ea: eaDn | eaControl, size: 4,
+			cycles: tEA(12, 12), gen: genMovem(bftst, dBitfield)},
+		{mask: 0xffc0, match: 0xe9c0, ea: eaDn | eaControl, size: 4,
+			cycles: tEA(12, 12), gen: genMovem(bfextu, dBitfield)},
+		{mask: 0xffc0, match: 0xeac0, ea: eaDn | eaControlAlterable,
+			size: 4, cycles: tEA(16, 16),
+			gen: genMovem(bfchg, dBitfield)},
+		{mask: 0xffc0, match: 0xebc0, ea: eaDn | eaControl, size: 4,
+			cycles: tEA(12, 12), gen: genMovem(bfexts, dBitfield)},
+		{mask: 0xffc0, match: 0xecc0, ea: eaDn | eaControlAlterable,
+			size: 4, cycles: tEA(16, 16),
+			gen: genMovem(bfclr, dBitfield)},
+		{mask: 0xffc0, match: 0xedc0, ea: eaDn | eaControl, size: 4,
+			cycles: tEA(18, 18), gen: genMovem(bfffo, dBitfield)},
+		{mask: 0xffc0, match: 0xeec0, ea: eaDn | eaControlAlterable,
+			size: 4, cycles: tEA(16, 16),
+			gen: genMovem(bfset, dBitfield)},
+		{mask: 0xffc0, match: 0xefc0, ea: eaDn | eaControlAlterable,
+			size: 4, cycles: tEA(16, 16),
+			gen: genMovem(bfins, dBitfield)},
+	}
+
+	// patterns32 describes the 32 bit instructions the 68020 shares with
+	// the CPU32.
+	patterns32 = []pattern{
+		{mask: 0xf0ff, match: 0x60ff, cycles: tBranch,
+			gen: genBranchLong},
+		{mask: 0xfff8, match: 0x4808, size: 4, cycles: tFixed(16),
+			gen: genImmediateWord(link, dLink)},
+		{mask: 0xf1c0, match: 0x4100, ea: eaData, size: 4,
+			cycles: tEA(10, 10), gen: genLong(chk, dChk)},
+		{mask: 0xf0ff, match: 0x50fa, size: 2, cycles: tFixed(4),
+			gen: genImmediateWord(trapcc, dTrapcc)},
+		{mask: 0xf0ff, match: 0x50fb, size: 4, cycles: tFixed(4),
+			gen: genImmediateWord(trapcc, dTrapcc)},
+		{mask: 0xf0ff, match: 0x50fc, cycles: tFixed(4),
+			gen: genImplied(trapcc, dTrapcc)},
+		{mask: 0xfff8, match: 0x49c0, size: 4, cycles: tFixed(4),
+			gen: genSingle(extb, dExtb)},
+		{mask: 0xffc0, match: 0x4a00, ea: eaData, size: 1,
+			cycles: tEA(4, 4), gen: genSource(tst, dTst)},
+		{mask: 0xffc0, match: 0x4a40, ea: eaAll, size: 2,
+			cycles: tEA(4, 4), gen: genSource(tst, dTst)},
+		{mask: 0xffc0, match: 0x4a80, ea: eaAll, size: 4,
+			cycles: tEA(4, 4), gen: genSource(tst, dTst)},
+
+		// 32 bit multiply and divide
+		{mask: 0xffc0, match: 0x4c00, ea: eaData, size: 4,
+			cycles: tEA(44, 44), gen: genMovem(mull, dMull)},
+		{mask: 0xffc0, match: 0x4c40, ea: eaData, size: 4,
+			cycles: tEA(90, 90), gen: genMovem(divl, dDivl)},
+
+		// bounds check
+		{mask: 0xffc0, match: 0x00c0, ea: eaControl, size: 1,
+			cycles: tEA(18, 18), gen: genMovem(chk2, dChk2)},
+		{mask: 0xffc0, match: 0x02c0, ea: eaControl, size: 2,
+			cycles: tEA(18, 18), gen: genMovem(chk2, dChk2)},
+		{mask: 0xffc0, match: 0x04c0, ea: eaControl, size: 4,
+			cycles: tEA(18, 18), gen: genMovem(chk2, dChk2)},
+	}
+
+	opcodes68020 = generate(concat(patterns68020, patterns32,
+		patternsFPU, patterns68010, patterns68000))
+
+	// controls68020 are the 68020 movec control registers.
+	controls68020 = append([]uint32{0x002, 0x802, 0x803, 0x804},
+		controls68010...)
+)
+
+// genBranchLong generates bra, bsr and bcc with a 32 bit displacement.  It is
+// selected by an 8 bit displacement of $ff.
+func genBranchLong(opcode uint16, size uint32) instruction {
+	i := genBranch(opcode, size)
+	i.size = 4
+	i.operandSize = 4
+	i.fetchOperand = fetchOperand
+	i.fetchSource = fetchEA
+	i.source = 0x3c // #<data>
+	return i
+}
+
+// genImmediateWord returns a generator for instructions followed by an
+// immediate operand of the operation size, e.g. link.l and trapcc.
+func genImmediateWord(execute executer, disassemble disassembler) generator {
+	return func(opcode uint16, size uint32) instruction {
+		return instruction{
+			disassemble:      disassemble,
+			size:             size,
+			operandSize:      size,
+			fetchOperand:     operandFetcher(size),
+			fetchSource:      fetchEA,
+			source:           0x3c, // #<data>
+			fetchDestination: fetchNop,
+			storeDestination: storeNop,
+			execute:          execute,
+		}
+	}
+}
+
+// genCas2 generates cas2 Dc1:Dc2,Du1:Du2,(Rn1):(Rn2).  Both extension words
+// are fetched as a long.
+func genCas2(opcode uint16, size uint32) instruction {
+	i := genImplied(cas2, dCas2)(opcode, size)
+	i.operandSize = 4
+	i.fetchOperand = fetchOperand
+	return i
+}
+
+// trapcc takes the TRAPV exception if the condition is true.  The optional
+// operand is ignored.
+func trapcc(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	if c.condition(c.ir >> 8) {
+		c.cycles += cyclesTRAPV
+		c.raise(vectorTRAPV, c.next(operand))
+	}
+	return dest
+}
+
+// extb sign extends the low byte of Dn to a long.
+func extb(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	inter := signExtend(dest, 1)
+	c.evalLogical(inter)
+	return inter
+}
+
+// mull multiplies the long register Dl in the extension word by <ea>.  Bit 11
+// selects a signed multiply and bit 10 a 64 bit product in Dh:Dl.  The 32 bit
+// product sets V when it does not fit.
+func mull(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	v := fetchEA(c, dest, operand)
+	dl, dh := &c.d[src>>12&0x07], &c.d[src&0x07]
+
+	var (
+		product uint64
+		fits    bool
+	)
+	if src&0x0800 != 0 {
+		p := int64(int32(*dl)) * int64(int32(v))
+		product = uint64(p)
+		fits = p == int64(int32(p))
+	} else {
+		product = uint64(*dl) * uint64(v)
+		fits = product <= 0xffffffff
+	}
+
+	c.sr &^= overflow | carry
+	if src&0x0400 != 0 {
+		*dh = uint32(product >> 32)
+		*dl = uint32(product)
+		c.flag(negative, product&(1<<63) != 0)
+		c.flag(zero, product == 0)
+		return dest
+	}
+	*dl = uint32(product)
+	c.evalNZ(*dl, 4)
+	c.flag(overflow, !fits)
+	return dest
+}
+
+// divl divides Dq in the extension word, or the 64 bit Dr:Dq if bit 10 is
+// set, by <ea>.  Bit 11 selects a signed divide.  The remainder is stored in
+// Dr and the quotient in Dq, a quotient that does not fit sets V and leaves
+// the registers unchanged.
+func divl(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	divisor := fetchEA(c, dest, operand)
+	dq, dr := &c.d[src>>12&0x07], &c.d[src&0x07]
+	if divisor == 0 {
+		c.sr &^= carry
+		c.cycles += cyclesDivide
+		c.raise(vectorZeroDivide, c.next(operand))
+	}
+
+	var quotient, remainder uint32
+	if src&0x0800 != 0 {
+		dividend := int64(int32(*dq))
+		if src&0x0400 != 0 {
+			dividend = int64(uint64(*dr)<<32 | uint64(*dq))
+		}
+		q := dividend / int64(int32(divisor))
+		if q != int64(int32(q)) {
+			c.divOverflow()
+			return dest
+		}
+		quotient = uint32(q)
+		remainder = uint32(dividend % int64(int32(divisor)))
+	} else {
+		dividend := uint64(*dq)
+		if src&0x0400 != 0 {
+			dividend |= uint64(*dr) << 32
+		}
+		q := dividend / uint64(divisor)
+		if q > 0xffffffff {
+			c.divOverflow()
+			return dest
+		}
+		quotient = uint32(q)
+		remainder = uint32(dividend % uint64(divisor))
+	}
+
+	*dr = remainder
+	*dq = quotient
+	c.evalNZ(quotient, 4)
+	c.sr &^= overflow | carry
+	return dest
+}
+
+// cas compares Dc in the extension word with <ea>.  If they are equal Du is
+// stored to <ea>, otherwise Dc is loaded with <ea>.
+func cas(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	address := c.address(dest, operand)
+	v := c.readSized(address, c.size)
+	dc, du := &c.d[src&0x07], c.d[src>>6&0x07]
+	cmp(c, *dc&mask(c.size), v, operand)
+	if c.sr&zero != 0 {
+		c.writeSized(address, c.size, du)
+	} else {
+		m := mask(c.size)
+		*dc = *dc&^m | v
+	}
+	return dest
+}
+
+// cas2 compares Dc1 and Dc2 with the operands addressed by Rn1 and Rn2.  If
+// both are equal Du1 and Du2 are stored to the operands, otherwise Dc1 and Dc2
+// are loaded with them.
+func cas2(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	ext := c.extLong(operand)
+	ext1, ext2 := ext>>16, ext&0xffff
+	address1 := *c.movemRegister(ext1 >> 12)
+	address2 := *c.movemRegister(ext2 >> 12)
+	v1 := c.readSized(address1, c.size)
+	v2 := c.readSized(address2, c.size)
+	dc1, dc2 := &c.d[ext1&0x07], &c.d[ext2&0x07]
+
+	m := mask(c.size)
+	cmp(c, *dc1&m, v1, operand)
+	if c.sr&zero != 0 {
+		cmp(c, *dc2&m, v2, operand)
+	}
+	if c.sr&zero != 0 {
+		c.writeSized(address1, c.size, c.d[ext1>>6&0x07])
+		c.writeSized(address2, c.size, c.d[ext2>>6&0x07])
+		return dest
+	}
+	*dc1 = *dc1&^m | v1
+	*dc2 = *dc2&^m | v2
+	return dest
+}
+
+// chk2 checks the register in the extension word against the lower and upper
+// bounds at <ea>.  Address registers are checked against the sign extended
+// bounds.  A lower bound above the upper bound selects the range that wraps
+// around, i.e. signed bounds.  Bit 11 selects chk2 which takes the CHK
+// exception if the register is out of bounds, cmp2 only sets the flags.
+func chk2(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	address := c.address(dest, operand)
+	lower := c.readSized(address, c.size)
+	upper := c.readSized(address+c.size, c.size)
+	v := *c.movemRegister(src >> 12)
+	if src&0x8000 != 0 {
+		lower = signExtend(lower, c.size)
+		upper = signExtend(upper, c.size)
+	} else {
+		v &= mask(c.size)
+	}
+
+	inside := v >= lower && v <= upper
+	if lower > upper {
+		inside = v >= lower || v <= upper
+	}
+	c.flag(zero, v == lower || v == upper)
+	c.flag(carry, !inside)
+	if !inside && src&0x0800 != 0 {
+		c.cycles += cyclesCHK
+		c.raise(vectorCHK, c.next(operand))
+	}
+	return dest
+}
+
+// pack adds the adjustment in the extension word to two unpacked BCD digits
+// and packs them into a byte.  Bit 3 selects -(Ax),-(Ay) instead of Dx,Dy.
+func pack(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	rx, ry := uint32(c.ir&0x07), uint32(c.ir>>9&0x07)
+	if c.ir&0x0008 == 0 {
+		v := c.d[rx] + src
+		c.d[ry] = c.d[ry]&^0xff | v>>4&0xf0 | v&0x0f
+		return dest
+	}
+	lo := uint32(c.read8(c.address(0x20|rx, operand)))
+	hi := uint32(c.read8(c.address(0x20|rx, operand)))
+	v := (hi<<8 | lo) + src
+	c.write8(c.address(0x20|ry, operand), uint8(v>>4&0xf0|v&0x0f))
+	return dest
+}
+
+// unpk unpacks the two BCD digits of a byte into the low nibbles of a word
+// and adds the adjustment in the extension word.  Bit 3 selects -(Ax),-(Ay)
+// instead of Dx,Dy.
+func unpk(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	rx, ry := uint32(c.ir&0x07), uint32(c.ir>>9&0x07)
+	if c.ir&0x0008 == 0 {
+		b := c.d[rx] & 0xff
+		v := (b<<4&0x0f00 | b&0x0f) + src
+		c.d[ry] = c.d[ry]&^0xffff | v&0xffff
+		return dest
+	}
+	b := uint32(c.read8(c.address(0x20|rx, operand)))
+	v := (b<<4&0x0f00 | b&0x0f) + src
+	c.write8(c.address(0x20|ry, operand), uint8(v))
+	c.write8(c.address(0x20|ry, operand), uint8(v>>8))
+	return dest
+}
+
+// bitfield decodes the bit field of the extension word ext at effective
+// address ea.  It returns the field, its offset and width and a function that
+// stores a new value into the field.  The offset and width are immediate or
+// taken from a data register.  A field in a data register wraps around,
+// fields in memory start offset bits from the most significant bit of the
+// byte at the effective address and the offset of a data register is signed.
+func (c *m68k) bitfield(ext, ea uint32, operand []byte) (uint32, uint32,
+	uint32, func(uint32)) {
+
+	offset := ext >> 6 & 0x1f
+	if ext&0x0800 != 0 {
+		offset = c.d[offset&0x07]
+	}
+	width := ext & 0x1f
+	if ext&0x0020 != 0 {
+		width = c.d[width&0x07] & 0x1f
+	}
+	if width == 0 {
+		width = 32
+	}
+	m := uint32(1<<width - 1)
+
+	if ea>>3 == 0x00 {
+		r := &c.d[ea&0x07]
+		shift := int(offset & 0x1f)
+		v := bits.RotateLeft32(*r, shift) >> (32 - width)
+		return v, offset, width, func(v uint32) {
+			f := m << (32 - width)
+			rotated := bits.RotateLeft32(*r, shift)&^f | v<<(32-width)&f
+			*r = bits.RotateLeft32(rotated, -shift)
+		}
+	}
+
+	address := c.address(ea, operand) + uint32(int32(offset)>>3)
+	first := offset & 0x07
+	n := (first + width + 7) / 8
+	var field uint64
+	for k := uint32(0); k < n; k++ {
+		field = field<<8 | uint64(c.read8(address+k))
+	}
+	shift := n*8 - first - width
+	v := uint32(field>>shift) & m
+	return v, offset, width, func(v uint32) {
+		field := field&^(uint64(m)<<shift) | uint64(v&m)<<shift
+		for k := n; k > 0; k-- {
+			c.write8(address+k-1, uint8(field))
+			field >>= 8
+		}
+	}
+}
+
+// evalBitfield sets the condition codes for a bit field of width bits.  X is
+// not affected.
+func (c *m68k) evalBitfield(v, width uint32) {
+	c.flag(negative, v>>(width-1)&1 != 0)
+	c.flag(zero, v == 0)
+	c.sr &^= overflow | carry
+}
+
+func bftst(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	v, _, width, _ := c.bitfield(src, dest, operand)
+	c.evalBitfield(v, width)
+	return dest
+}
+
+func bfextu(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	v, _, width, _ := c.bitfield(src, dest, operand)
+	c.evalBitfield(v, width)
+	c.d[src>>12&0x07] = v
+	return dest
+}
+
+func bfexts(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	v, _, width, _ := c.bitfield(src, dest, operand)
+	c.evalBitfield(v, width)
+	c.d[src>>12&0x07] = uint32(int32(v<<(32-width)) >> (32 - width))
+	return dest
+}
+
+func bfchg(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	v, _, width, store := c.bitfield(src, dest, operand)
+	c.evalBitfield(v, width)
+	store(^v)
+	return dest
+}
+
+func bfclr(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	v, _, width, store := c.bitfield(src, dest, operand)
+	c.evalBitfield(v, width)
+	store(0)
+	return dest
+}
+
+func bfset(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	v, _, width, store := c.bitfield(src, dest, operand)
+	c.evalBitfield(v, width)
+	store(0xffffffff)
+	return dest
+}
+
+// bfffo finds the first set bit of the field and stores its offset, the
+// offset of the field plus its width if none is set.
+func bfffo(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	v, offset, width, _ := c.bitfield(src, dest, operand)
+	c.evalBitfield(v, width)
+	n := width
+	if v != 0 {
+		n = uint32(bits.LeadingZeros32(v << (32 - width)))
+	}
+	c.d[src>>12&0x07] = offset + n
+	return dest
+}
+
+// bfins inserts the low bits of the register into the field.
+func bfins(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	_, _, width, store := c.bitfield(src, dest, operand)
+	v := c.d[src>>12&0x07] & uint32(1<<width-1)
+	c.evalBitfield(v, width)
+	store(v)
+	return dest
+}
@@ -0,0 +1,394 @@
+package m68000
+
+// The ColdFire V2 core executes a reduced 68000 instruction set, ISA_A, with
+// the hardware divide and the EMAC unit, see emac.go.  Most instructions only
+// operate on longs and the effective address modes of many are restricted.
+// Byte and word operations are limited to move, clr, tst, scc, the word
+// multiply and divide and the sign extensions.  Decimal arithmetic, rotates,
+// dbcc, exg, chk, movep and the instructions that modify the status register
+// with an immediate are gone.  Opcodes outside of patternsColdFire take the
+// illegal instruction exception, those on line 1010 and 1111 the line A and
+// line F exceptions.
+//
+// There is a single stack pointer and data may be accessed at odd
+// addresses.  Index words only use the brief format with long index
+// registers scaled by 1, 2 or 4.  Every exception stacks the same two long
+// frame, see frameColdFire, and movec can only write the control registers.
+// VBR is aligned to 1 MiB, CACR is a plain register as the caches are not
+// emulated.  HALT enters the debug halt state which the background debug
+// methods of the CPU32, see cpu32.go, inspect and resume.  The V2 pipeline is
+// not modeled, instruction timing is that of the 68000.
+
+// eaLong are the <ea> modes of the long multiply and divide and of the
+// static bit operations.
+const eaLong = eaDn | eaAi | eaPi | eaPd | eaDi
+
+// Move sources and the destinations they may be combined with.
+const (
+	eaMoveSource   = eaDn | eaAn | eaAi | eaPi | eaPd
+	eaMoveDi       = eaDi | eaPCDi
+	eaMoveOther    = eaIx | eaPCIx | eaAbsW | eaAbsL | eaImm
+	eaMoveDestDi   = eaDn | eaAi | eaPi | eaPd | eaDi
+	eaMoveDestRest = eaDn | eaAi | eaPi | eaPd
+)
+
+var (
+	// patternsColdFire describes the ColdFire V2 instruction set.
+	patternsColdFire = []pattern{
+		// move
+		{mask: 0xf000, match: 0x1000, ea: eaMoveSource &^ eaAn,
+			ea2: eaDataAlterable, size: 1, cycles: tMove,
+			gen: genMove},
+		{mask: 0xf000, match: 0x1000, ea: eaMoveDi, ea2: eaMoveDestDi,
+			size: 1, cycles: tMove, gen: genMove},
+		{mask: 0xf000, match: 0x1000, ea: eaMoveOther,
+			ea2: eaMoveDestRest, size: 1, cycles: tMove,
+			gen: genMove},
+		{mask: 0xf000, match: 0x2000, ea: eaMoveSource,
+			ea2: eaDataAlterable, size: 4, cycles: tMove,
+			gen: genMove},
+		{mask: 0xf000, match: 0x2000, ea: eaMoveDi, ea2: eaMoveDestDi,
+			size: 4, cycles: tMove, gen: genMove},
+		{mask: 0xf000, match: 0x2000, ea: eaMoveOther,
+			ea2: eaMoveDestRest, size: 4, cycles: tMove,
+			gen: genMove},
+		{mask: 0xf000, match: 0x3000, ea: eaMoveSource,
+			ea2: eaDataAlterable, size: 2, cycles: tMove,
+			gen: genMove},
+		{mask: 0xf000, match: 0x3000, ea: eaMoveDi, ea2: eaMoveDestDi,
+			size: 2, cycles: tMove, gen: genMove},
+		{mask: 0xf000, match: 0x3000, ea: eaMoveOther,
+			ea2: eaMoveDestRest, size: 2, cycles: tMove,
+			gen: genMove},
+		{mask: 0xf1c0, match: 0x2040, ea: eaAll, size: 4, cycles: tMove,
+			gen: genAddress(movea, dMovea, true)},
+		{mask: 0xf1c0, match: 0x3040, ea: eaAll, size: 2, cycles: tMove,
+			gen: genAddress(movea, dMovea, true)},
+		{mask: 0xf100, match: 0x7000, size: 4, cycles: tFixed(4),
+			gen: genMoveq},
+
+		// add
+		{mask: 0xf1f8, match: 0xd180, size: 4, cycles: tX(4, 8, 18, 30),
+			gen: genX(addx, dAddx)},
+		{mask: 0xf1c0, match: 0xd080, ea: eaAll, size: 4,
+			cycles: tDyadic(4, 6), gen: genDyadic(add, dAdd, true)},
+		{mask: 0xf1c0, match: 0xd180, ea: eaMemoryAlterable, size: 4,
+			cycles: tEA(8, 12), gen: genDyadic(add, dAdd, true)},
+		{mask: 0xf1c0, match: 0xd1c0, ea: eaAll, size: 4,
+			cycles: tDyadic(8, 6),
+			gen:    genAddress(adda, dAdd, true)},
+		{mask: 0xfff8, match: 0x0680, size: 4,
+			cycles: tRM(8, 16, 12, 20),
+			gen:    genImmediate(add, dAddi, true)},
+		{mask: 0xf1c0, match: 0x5080, ea: eaAlterable, size: 4,
+			cycles: tQuick, gen: genQuick(add, adda, dAddq)},
+
+		// sub
+		{mask: 0xf1f8, match: 0x9180, size: 4, cycles: tX(4, 8, 18, 30),
+			gen: genX(subx, dSubx)},
+		{mask: 0xf1c0, match: 0x9080, ea: eaAll, size: 4,
+			cycles: tDyadic(4, 6), gen: genDyadic(sub, dSub, true)},
+		{mask: 0xf1c0, match: 0x9180, ea: eaMemoryAlterable, size: 4,
+			cycles: tEA(8, 12), gen: genDyadic(sub, dSub, true)},
+		{mask: 0xf1c0, match: 0x91c0, ea: eaAll, size: 4,
+			cycles: tDyadic(8, 6),
+			gen:    genAddress(suba, dSub, true)},
+		{mask: 0xfff8, match: 0x0480, size: 4,
+			cycles: tRM(8, 16, 12, 20),
+			gen:    genImmediate(sub, dSubi, true)},
+		{mask: 0xf1c0, match: 0x5180, ea: eaAlterable, size: 4,
+			cycles: tQuick, gen: genQuick(sub, suba, dSubq)},
+
+		// cmp
+		{mask: 0xf1c0, match: 0xb080, ea: eaAll, size: 4,
+			cycles: tEA(4, 6), gen: genDyadic(cmp, dCmp, false)},
+		{mask: 0xf1c0, match: 0xb1c0, ea: eaAll, size: 4,
+			cycles: tEA(6, 6), gen: genAddress(cmpa, dCmp, false)},
+		{mask: 0xfff8, match: 0x0c80, size: 4,
+			cycles: tRM(8, 14, 8, 12),
+			gen:    genImmediate(cmp, dCmpi, false)},
+
+		// neg
+		{mask: 0xfff8, match: 0x4080, size: 4, cycles: tRM(4, 6, 8, 12),
+			gen: genSingle(negx, dNegx)},
+		{mask: 0xfff8, match: 0x4480, size: 4, cycles: tRM(4, 6, 8, 12),
+			gen: genSingle(neg, dNeg)},
+
+		// logical
+		{mask: 0xf1c0, match: 0xc080, ea: eaData, size: 4,
+			cycles: tDyadic(4, 6), gen: genDyadic(and, dAnd, true)},
+		{mask: 0xf1c0, match: 0xc180, ea: eaMemoryAlterable, size: 4,
+			cycles: tEA(8, 12), gen: genDyadic(and, dAnd, true)},
+		{mask: 0xf1c0, match: 0x8080, ea: eaData, size: 4,
+			cycles: tDyadic(4, 6), gen: genDyadic(or, dOr, true)},
+		{mask: 0xf1c0, match: 0x8180, ea: eaMemoryAlterable, size: 4,
+			cycles: tEA(8, 12), gen: genDyadic(or, dOr, true)},
+		{mask: 0xf1c0, match: 0xb180, ea: eaDataAlterable, size: 4,
+			cycles: tRM(4, 8, 8, 12),
+			gen:    genDyadic(eor, dEor, true)},
+		{mask: 0xfff8, match: 0x0280, size: 4,
+			cycles: tRM(8, 14, 12, 20),
+			gen:    genImmediate(and, dAndi, true)},
+		{mask: 0xfff8, match: 0x0080, size: 4,
+			cycles: tRM(8, 16, 12, 20),
+			gen:    genImmediate(or, dOri, true)},
+		{mask: 0xfff8, match: 0x0a80, size: 4,
+			cycles: tRM(8, 16, 12, 20),
+			gen:    genImmediate(eor, dEori, true)},
+		{mask: 0xfff8, match: 0x4680, size: 4, cycles: tRM(4, 6, 8, 12),
+			gen: genSingle(not, dNot)},
+
+		// status register
+		{mask: 0xffc0, match: 0x44c0, ea: eaDn | eaImm, size: 2,
+			cycles: tEA(12, 12),
+			gen:    genSource(moveToCCR, dMoveToCCR)},
+		{mask: 0xffc0, match: 0x46c0, ea: eaDn | eaImm, size: 2,
+			cycles: tEA(12, 12), privileged: true,
+			gen: genSource(moveToSR, dMoveToSR)},
+		{mask: 0xfff8, match: 0x40c0, size: 2, cycles: tFixed(4),
+			privileged: true,
+			gen:        genDestination(moveFromSR, dMoveFromSR)},
+		{mask: 0xfff8, match: 0x42c0, size: 2, cycles: tFixed(4),
+			gen: genDestination(moveFromCCR, dMoveFromCCR)},
+
+		// shift
+		{mask: 0xf1d8, match: 0xe080, size: 4, cycles: tSize(6, 8),
+			gen: genShift(asr, dAsr)},
+		{mask: 0xf1d8, match: 0xe180, size: 4, cycles: tSize(6, 8),
+			gen: genShift(asl, dAsl)},
+		{mask: 0xf1d8, match: 0xe088, size: 4, cycles: tSize(6, 8),
+			gen: genShift(lsr, dLsr)},
+		{mask: 0xf1d8, match: 0xe188, size: 4, cycles: tSize(6, 8),
+			gen: genShift(lsl, dLsl)},
+
+		// program control
+		{mask: 0xffff, match: 0x51fa, size: 2, cycles: tFixed(4),
+			gen: genImmediateWord(nop, dTpf)},
+		{mask: 0xffff, match: 0x51fb, size: 4, cycles: tFixed(4),
+			gen: genImmediateWord(nop, dTpf)},
+		{mask: 0xffff, match: 0x51fc, cycles: tFixed(4),
+			gen: genImplied(nop, dTpf)},
+		{mask: 0xf000, match: 0x6000, cycles: tBranch, gen: genBranch},
+		{mask: 0xf0f8, match: 0x50c0, size: 1, cycles: tFixed(4),
+			gen: genDestination(scc, dScc)},
+		{mask: 0xffc0, match: 0x4ec0, ea: eaControl,
+			cycles: tControl(8, 10, 14, 10, 12, 10, 14),
+			gen:    genControl(jmp, dJmp)},
+		{mask: 0xffc0, match: 0x4e80, ea: eaControl,
+			cycles: tControl(16, 18, 22, 18, 20, 18, 22),
+			gen:    genControl(jsr, dJsr)},
+		{mask: 0xffff, match: 0x4e71, cycles: tFixed(4),
+			gen: genImplied(nop, dNop)},
+		{mask: 0xffff, match: 0x4acc, cycles: tFixed(4),
+			gen: genImplied(nop, dPulse)},
+		{mask: 0xffff, match: 0x4e72, size: 2, cycles: tFixed(4),
+			privileged: true, gen: genStatus(stop, dStop)},
+		{mask: 0xffff, match: 0x4ac8, cycles: tFixed(4),
+			privileged: true, gen: genImplied(halt, dHalt)},
+		{mask: 0xffff, match: 0x4e73, cycles: tFixed(20),
+			privileged: true, gen: genImplied(rteColdFire, dRte)},
+		{mask: 0xffff, match: 0x4e75, cycles: tFixed(16),
+			gen: genImplied(rts, dRts)},
+		{mask: 0xffff, match: 0x4e7b, size: 4, cycles: tFixed(10),
+			privileged: true, gen: genWord(movecColdFire, dMovec)},
+
+		// exceptions
+		{mask: 0xfff0, match: 0x4e40, cycles: tFixed(34),
+			gen: genImplied(trap, dTrap)},
+		{mask: 0xffff, match: 0x4afc, cycles: tFixed(34),
+			gen: genImplied(illegal, dIllegal)},
+
+		// multiply and divide
+		{mask: 0xf1c0, match: 0xc0c0, ea: eaData, size: 2,
+			cycles: tEA(38, 38), gen: genLong(mulu, dMulu)},
+		{mask: 0xf1c0, match: 0xc1c0, ea: eaData, size: 2,
+			cycles: tEA(38, 38), gen: genLong(muls, dMuls)},
+		{mask: 0xf1c0, match: 0x80c0, ea: eaData, size: 2,
+			cycles: tEA(0, 0), gen: genLong(divu, dDivu)},
+		{mask: 0xf1c0, match: 0x81c0, ea: eaData, size: 2,
+			cycles: tEA(0, 0), gen: genLong(divs, dDivs)},
+		{mask: 0xffc0, match: 0x4c00, ea: eaLong, size: 4,
+			cycles: tEA(44, 44), gen: genMovem(mulColdFire, dMull)},
+		{mask: 0xffc0, match: 0x4c40, ea: eaLong, size: 4,
+			cycles: tEA(90, 90), gen: genMovem(divColdFire, dRem)},
+
+		// data movement
+		{mask: 0xf1c0, match: 0x41c0, ea: eaControl, size: 4,
+			cycles: tControl(4, 8, 12, 8, 12, 8, 12), gen: genLea},
+		{mask: 0xffc0, match: 0x4840, ea: eaControl, size: 4,
+			cycles: tControl(12, 16, 20, 16, 20, 16, 20),
+			gen:    genControl(pea, dPea)},
+		{mask: 0xfff8, match: 0x4e50, size: 2, cycles: tFixed(16),
+			gen: genWord(link, dLink)},
+		{mask: 0xfff8, match: 0x4e58, cycles: tFixed(12),
+			gen: genImplied(unlk, dUnlk)},
+		{mask: 0xffc0, match: 0x48c0, ea: eaAi | eaDi, size: 4,
+			cycles: tMovem(4),
+			gen:    genMovem(movemToMemory, dMovem)},
+		{mask: 0xffc0, match: 0x4cc0, ea: eaAi | eaDi, size: 4,
+			cycles: tMovem(8),
+			gen:    genMovem(movemToRegisters, dMovem)},
+
+		// miscellaneous
+		{mask: 0xfff8, match: 0x4840, size: 4, cycles: tFixed(4),
+			gen: genSingle(swap, dSwap)},
+		{mask: 0xfff8, match: 0x4880, size: 2, cycles: tFixed(4),
+			gen: genSingle(ext, dExt)},
+		{mask: 0xfff8, match: 0x48c0, size: 4, cycles: tFixed(4),
+			gen: genSingle(ext, dExt)},
+		{mask: 0xfff8, match: 0x49c0, size: 4, cycles: tFixed(4),
+			gen: genSingle(extb, dExtb)},
+		{mask: 0xffc0, match: 0x4200, ea: eaDataAlterable, size: 1,
+			cycles: tRM(4, 6, 8, 12),
+			gen:    genDestination(clr, dClr)},
+		{mask: 0xffc0, match: 0x4240, ea: eaDataAlterable, size: 2,
+			cycles: tRM(4, 6, 8, 12),
+			gen:    genDestination(clr, dClr)},
+		{mask: 0xffc0, match: 0x4280, ea: eaDataAlterable, size: 4,
+			cycles: tRM(4, 6, 8, 12),
+			gen:    genDestination(clr, dClr)},
+		{mask: 0xffc0, match: 0x4a00, ea: eaData, size: 1,
+			cycles: tEA(4, 4), gen: genSource(tst, dTst)},
+		{mask: 0xffc0, match: 0x4a40, ea: eaAll, size: 2,
+			cycles: tEA(4, 4), gen: genSource(tst, dTst)},
+		{mask: 0xffc0, match: 0x4a80, ea: eaAll, size: 4,
+			cycles: tEA(4, 4), gen: genSource(tst, dTst)},
+
+		// bit manipulation
+		{mask: 0xf1c0, match: 0x0100, ea: eaData &^ eaImm,
+			cycles: tRM(6, 6, 4, 4),
+			gen:    genBit(btst, dBtst, false)},
+		{mask: 0xf1c0, match: 0x0140, ea: eaDataAlterable,
+			cycles: tRM(6, 6, 8, 8),
+			gen:    genBit(bchg, dBchg, true)},
+		{mask: 0xf1c0, match: 0x0180, ea: eaDataAlterable,
+			cycles: tRM(8, 8, 8, 8),
+			gen:    genBit(bclr, dBclr, true)},
+		{mask: 0xf1c0, match: 0x01c0, ea: eaDataAlterable,
+			cycles: tRM(6, 6, 8, 8),
+			gen:    genBit(bset, dBset, true)},
+		{mask: 0xffc0, match: 0x0800, ea: eaLong,
+			cycles: tRM(10, 10, 8, 8),
+			gen:    genBit(btst, dBtst, false)},
+		{mask: 0xffc0, match: 0x0840, ea: eaLong,
+			cycles: tRM(10, 10, 12, 12),
+			gen:    genBit(bchg, dBchg, true)},
+		{mask: 0xffc0, match: 0x0880, ea: eaLong,
+			cycles: tRM(12, 12, 12, 12),
+			gen:    genBit(bclr, dBclr, true)},
+		{mask: 0xffc0, match: 0x08c0, ea: eaLong,
+			cycles: tRM(10, 10, 12, 12),
+			gen:    genBit(bset, dBset, true)},
+
+		// EMAC
+		{mask: 0xf1c0, match: 0xa100, ea: eaDn | eaAn | eaImm, size: 4,
+			cycles: tFixed(4), gen: genSource(moveToMac, dMac)},
+		{mask: 0xf9fc, match: 0xa110, cycles: tFixed(4),
+			gen: genImplied(moveAccumulator, dMac)},
+		{mask: 0xf1f0, match: 0xa180, cycles: tFixed(4),
+			gen: genImplied(moveFromMac, dMac)},
+		{mask: 0xf9f0, match: 0xa1c0, cycles: tFixed(4),
+			gen: genImplied(movclr, dMac)},
+		{mask: 0xffff, match: 0xa9c0, cycles: tFixed(4),
+			gen: genImplied(moveMacsrToCCR, dMac)},
+		{mask: 0xf100, match: 0xa000,
+			ea: eaDn | eaAn | eaAi | eaPi | eaPd | eaDi, size: 4,
+			cycles: tRM(4, 4, 8, 8), gen: genMovem(mac, dMac)},
+	}
+
+	opcodesColdFire = generate(patternsColdFire)
+
+	// controlsColdFire are the ColdFire movec control registers.
+	controlsColdFire = []uint32{0x002, 0x801}
+)
+
+// rteColdFire returns from the exception stack frame pushed by frameColdFire
+// and restores the stack pointer alignment recorded in its format.
+func rteColdFire(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	format := c.read16(c.a[7]) >> 12
+	if format < 4 || format > 7 {
+		c.raise(vectorFormatError, c.pc)
+	}
+	sr := c.read16(c.a[7] + 2)
+	pc := c.read32(c.a[7] + 4)
+	c.a[7] += 8 + uint32(format-4)
+	c.setSR(sr)
+	c.jump(pc)
+	return dest
+}
+
+// halt stops the CPU in the debug halt state.  The program counter is
+// advanced past halt and becomes the return program counter.
+func halt(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	return bgnd(c, src, dest, operand)
+}
+
+// movecColdFire writes a control register.  The low 20 bits of VBR are
+// always zero.
+func movecColdFire(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	dest = movec(c, src, dest, operand)
+	c.vbr &= 0xfff00000
+	return dest
+}
+
+// mulColdFire is mull without the 64 bit product, bit 10 of the extension
+// word is illegal.
+func mulColdFire(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	if src&0x0400 != 0 {
+		c.raise(vectorIllegal, c.pc)
+	}
+	return mull(c, src, dest, operand)
+}
+
+// divColdFire divides Dx in bits 14-12 of the extension word by <ea>.  Bit
+// 11 selects a signed divide.  The quotient is stored in Dx when Dw in bits
+// 2-0 is Dx, otherwise the remainder is stored in Dw and Dx is unchanged.
+// The condition codes reflect the quotient, a quotient that does not fit
+// sets V and leaves the registers unchanged.
+func divColdFire(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	if src&0x0400 != 0 {
+		c.raise(vectorIllegal, c.pc)
+	}
+	divisor := fetchEA(c, dest, operand)
+	dx, dw := &c.d[src>>12&0x07], &c.d[src&0x07]
+	if divisor == 0 {
+		c.sr &^= carry
+		c.cycles += cyclesDivide
+		c.raise(vectorZeroDivide, c.next(operand))
+	}
+
+	var quotient, remainder uint32
+	if src&0x0800 != 0 {
+		q := int64(int32(*dx)) / int64(int32(divisor))
+		if q != int64(int32(q)) {
+			c.divOverflow()
+			return dest
+		}
+		quotient = uint32(q)
+		remainder = uint32(int32(*dx) % int32(divisor))
+	} else {
+		quotient = *dx / divisor
+		remainder = *dx % divisor
+	}
+
+	if dx == dw {
+		*dx = quotient
+	} else {
+		*dw = remainder
+	}
+	c.evalNZ(quotient, 4)
+	c.sr &^= overflow | carry
+	return dest
+}
+
+// faultStatus returns the fault status of a ColdFire access error for the
+// access information word of a bus or address error.
+func faultStatus(access uint16) uint16 {
+	switch {
+	case access&accessNotInstruction == 0:
+		return fsInstruction
+	case access&accessRead != 0:
+		return fsRead
+	}
+	return fsWrite
+}
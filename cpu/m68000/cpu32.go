@@ -0,0 +1,259 @@
+package m68000
+
+import (
+	"errors"
+
+	"github.com/marcopeereboom/byo/cpu"
+)
+
+// The CPU32 is the processor core of the 683xx integrated controllers.  It
+// executes the 68010 instruction set including loop mode, the 32 bit
+// instructions it shares with the 68020, see patterns32, and scaled and full
+// format index words without memory indirection.  It adds table lookup and
+// interpolate, low power stop and background debug mode.  Bus and address
+// errors stack a format C frame.  Instruction timing stays that of the 68010
+// except where given below.
+//
+// BGND enters background debug mode.  The CPU executes no instructions and
+// processes no interrupts until the host resumes it with Go.  Meanwhile the
+// host reads and writes registers with the methods that mirror the RAREG,
+// WAREG, RSREG and WSREG debug commands and accesses memory through the bus.
+// LPSTOP does not broadcast the interrupt mask to the system integration
+// module, it only loads the status register and stops the CPU.
+
+var (
+	// patternsCPU32 describes the instructions the CPU32 adds to the
+	// 68010 and patterns32 instruction sets.
+	patternsCPU32 = []pattern{
+		{mask: 0xffc0, match: 0xf800, ea: eaDn | eaControl,
+			cycles: tEA(30, 30), gen: genTable},
+		{mask: 0xffff, match: 0x4afa, cycles: tFixed(10),
+			gen: genImplied(bgnd, dBgnd)},
+	}
+
+	opcodesCPU32 = generate(concat(patternsCPU32, patterns32,
+		patterns68010, patterns68000))
+
+	ErrNotBackground = errors.New("cpu not in background debug mode")
+	ErrDebugRegister = errors.New("invalid debug register")
+)
+
+// Background debug mode system registers as numbered by the RSREG and WSREG
+// commands.
+const (
+	DebugRPC = 0x0 // return program counter
+	DebugPCC = 0x1 // current instruction program counter, read only
+	DebugVBR = 0xa
+	DebugSR  = 0xb
+	DebugUSP = 0xc
+	DebugSSP = 0xd
+	DebugSFC = 0xe
+	DebugDFC = 0xf
+)
+
+// lpstopExtension is the first extension word of lpstop.
+const lpstopExtension = 0x01c0
+
+// genTable generates the tbls, tblu, tblsn and tblun table and register
+// forms.  The extension word precedes the extension words of <ea>.  Lpstop
+// shares the opcode of the register form with D0 and is recognized by its
+// extension word which is followed by the immediate status register.
+func genTable(opcode uint16, size uint32) instruction {
+	i := genMovem(table, dTable)(opcode, size)
+	if opcode == 0xf800 {
+		i.extension = lpstopLength
+	}
+	return i
+}
+
+// lpstopLength returns the length of the lpstop immediate operand that
+// follows the extension word at address.
+func lpstopLength(c *m68k, address uint32) uint32 {
+	if c.fetch16(address) == lpstopExtension {
+		return 2
+	}
+	return 0
+}
+
+// table looks up two table entries and interpolates between them.  Bit 11 of
+// the extension word selects signed entries and bit 10 leaves the result
+// unrounded.  The table form reads entry n, the integer part in bits 15-8 of
+// Dx, and entry n+1 at <ea>, the register form takes them from Dym and Dyn.
+// The fraction in bits 7-0 of Dx interpolates between the entries.
+//
+// Rounded results replace the low operation size bits of Dx, ties are
+// rounded up.  Unrounded results keep 8 fraction bits and replace the low
+// word of Dx for byte entries and Dx otherwise, V is set when a long result
+// does not fit.
+func table(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	if c.ir == 0xf800 && src == lpstopExtension {
+		return lpstop(c, src, dest, operand)
+	}
+	size := uint32(1) << (src >> 6 & 0x03)
+	if size > 4 || src&0x8300 != 0 {
+		c.raise(vectorIllegal, c.pc)
+	}
+	signed := src&0x0800 != 0
+	x := &c.d[src>>12&0x07]
+	fraction := int64(*x & 0xff)
+
+	var y0, y1 uint32
+	if dest>>3 == 0x00 {
+		y0, y1 = c.d[dest&0x07], c.d[src&0x07]
+	} else {
+		address := c.address(dest, operand) + (*x>>8&0xff)*size
+		y0 = c.readSized(address, size)
+		y1 = c.readSized(address+size, size)
+	}
+	entry := func(y uint32) int64 {
+		if signed {
+			return int64(int32(signExtend(y, size)))
+		}
+		return int64(y & mask(size))
+	}
+	r := entry(y0)<<8 + (entry(y1)-entry(y0))*fraction
+
+	c.sr &^= overflow | carry
+	if src&0x0400 == 0 {
+		r = (r + 0x80) >> 8
+		m := mask(size)
+		*x = *x&^m | uint32(r)&m
+		c.evalNZ(uint32(r), size)
+		return dest
+	}
+
+	if size == 1 {
+		*x = *x&^0xffff | uint32(r)&0xffff
+		c.evalNZ(uint32(r), 2)
+		return dest
+	}
+	if signed && r != int64(int32(r)) || !signed && r != int64(uint32(r)) {
+		c.sr |= overflow
+	}
+	*x = uint32(r)
+	c.evalNZ(*x, 4)
+	return dest
+}
+
+// lpstop loads the status register with the immediate operand and stops the
+// CPU until an interrupt above the new mask arrives.
+func lpstop(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	c.privileged()
+	sr, _ := c.extWord(operand)
+	c.setSR(sr)
+	c.state = cpu.Stopped
+	return dest
+}
+
+// bgnd enters background debug mode.  The program counter is advanced past
+// bgnd and becomes the return program counter.
+func bgnd(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	c.pcc = c.pc
+	c.state = cpu.Background
+	return dest
+}
+
+// ReadRegister returns D0-D7, r 0-7, or A0-A7, r 8-15, in background debug
+// mode.
+func (c *m68k) ReadRegister(r int) (uint32, error) {
+	g, err := c.debugRegister(r)
+	if err != nil {
+		return 0, err
+	}
+	return *g, nil
+}
+
+// WriteRegister sets D0-D7, r 0-7, or A0-A7, r 8-15, in background debug
+// mode.
+func (c *m68k) WriteRegister(r int, v uint32) error {
+	g, err := c.debugRegister(r)
+	if err != nil {
+		return err
+	}
+	*g = v
+	return nil
+}
+
+// debugRegister returns general register r in background debug mode.
+func (c *m68k) debugRegister(r int) (*uint32, error) {
+	switch {
+	case c.state != cpu.Background:
+		return nil, ErrNotBackground
+	case r < 0 || r > 15:
+		return nil, ErrDebugRegister
+	case r < 8:
+		return &c.d[r], nil
+	}
+	return &c.a[r-8], nil
+}
+
+// ReadSystemRegister returns system register r, e.g. DebugSR, in background
+// debug mode.
+func (c *m68k) ReadSystemRegister(r int) (uint32, error) {
+	if c.state != cpu.Background {
+		return 0, ErrNotBackground
+	}
+	switch r {
+	case DebugPCC:
+		return c.pcc, nil
+	case DebugSR:
+		return uint32(c.sr), nil
+	}
+	s := c.systemRegister(r)
+	if s == nil {
+		return 0, ErrDebugRegister
+	}
+	return *s, nil
+}
+
+// WriteSystemRegister sets system register r, e.g. DebugRPC, in background
+// debug mode.
+func (c *m68k) WriteSystemRegister(r int, v uint32) error {
+	if c.state != cpu.Background {
+		return ErrNotBackground
+	}
+	switch r {
+	case DebugSR:
+		c.setSR(uint16(v))
+		return nil
+	case DebugSFC, DebugDFC:
+		v &= 0x07
+	}
+	s := c.systemRegister(r)
+	if s == nil {
+		return ErrDebugRegister
+	}
+	*s = v
+	return nil
+}
+
+// systemRegister returns the writable system register r, nil if there is
+// none.
+func (c *m68k) systemRegister(r int) *uint32 {
+	switch r {
+	case DebugRPC:
+		return &c.pc
+	case DebugVBR:
+		return &c.vbr
+	case DebugUSP:
+		return c.stackPointer(0)
+	case DebugSSP:
+		return c.stackPointer(supervisor)
+	case DebugSFC:
+		return &c.sfc
+	case DebugDFC:
+		return &c.dfc
+	}
+	return nil
+}
+
+// Go leaves background debug mode and resumes execution at the return
+// program counter.
+func (c *m68k) Go() error {
+	if c.state != cpu.Background {
+		return ErrNotBackground
+	}
+	c.flush()
+	c.state = cpu.Running
+	return nil
+}
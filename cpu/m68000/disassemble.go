@@ -2,10 +2,16 @@ package m68000
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/marcopeereboom/byo/cpu"
+	"github.com/marcopeereboom/byo/cpu/m68881"
 )
 
+// conditions are the condition code mnemonics in encoding order.
+var conditions = []string{"t", "f", "hi", "ls", "cc", "cs", "ne", "eq", "vc",
+	"vs", "pl", "mi", "ge", "lt", "gt", "le"}
+
 // ccr translates the ccr into human readable form.  This should be moved into
 // a monitor file.
 func (c *m68k) ccr() string {
@@ -35,50 +41,203 @@ func (c *m68k) ccr() string {
 
 func (c *m68k) disassemble(address uint32) (string, int, error) {
 	opcode := c.read16(address)
-	i, found := opcodes[opcode]
-	if !found {
+	i := &c.model.opcodes[opcode]
+	if i.disassemble == nil {
 		return "INVALID", 0, cpu.ErrInvalidOpcode
 	}
 
-	operand := i.fetchOperand(c, c.pc+2, i.operandSize)
+	operand := c.operand(i, address)
 
 	return i.disassemble(c, opcode, operand)
 }
 
-func disassembleSD(mrMode bool, opcode uint16, bits uint16) string {
-	var m, r uint16
-	if mrMode {
-		m, r = mr(opcode, bits)
-	} else {
-		m, r = rm(opcode, bits)
+// hex returns v in Motorola hexadecimal notation.
+func hex(v int64) string {
+	if v < 0 {
+		return fmt.Sprintf("-$%x", -v)
+	}
+	return fmt.Sprintf("$%x", v)
+}
+
+// extWord returns the next extension word from operand and the remainder.
+func extWord(operand []byte) (uint16, []byte, bool) {
+	if len(operand) < 2 {
+		return 0, operand, false
+	}
+	return uint16(operand[0])<<8 | uint16(operand[1]), operand[2:], true
+}
+
+// disassembleIndex returns the displacement and index register encoded in an
+// index extension word.  The displacements following a full format extension
+// word are consumed from operand and the remainder is returned.
+func disassembleIndex(base string, ext uint16, operand []byte) (string,
+	[]byte) {
+
+	xn := "d"
+	if ext&0x8000 != 0 {
+		xn = "a"
+	}
+	sz := "w"
+	if ext&0x0800 != 0 {
+		sz = "l"
+	}
+	xn = fmt.Sprintf("%v%v.%v", xn, ext>>12&0x07, sz)
+	if scale := ext >> 9 & 0x03; scale != 0 {
+		xn += fmt.Sprintf("*%v", 1<<scale)
+	}
+	if ext&0x0100 == 0 || len(operand) < int(fullExtensionSize(ext)) {
+		return fmt.Sprintf("%v(%v,%v)", hex(int64(int8(ext))), base,
+			xn), operand
 	}
 
+	// full format, suppressed parts are left out
+	bd, operand := displacement(ext>>4, operand)
+	od, operand := displacement(ext, operand)
+	switch {
+	case ext&0x0080 == 0:
+	case base == "pc":
+		base = "zpc"
+	default:
+		base = ""
+	}
+	if ext&0x0040 != 0 {
+		xn = ""
+	}
+	join := func(parts ...string) string {
+		var s []string
+		for _, p := range parts {
+			if p != "" {
+				s = append(s, p)
+			}
+		}
+		return strings.Join(s, ",")
+	}
+	switch iis := ext & 0x07; {
+	case iis == 0:
+		return "(" + join(bd, base, xn) + ")", operand
+	case iis < 0x04 && xn != "":
+		// preindexed
+		return "(" + join("["+join(bd, base, xn)+"]", od) + ")", operand
+	}
+	// postindexed
+	return "(" + join("["+join(bd, base)+"]", xn, od) + ")", operand
+}
+
+// displacement returns the full format displacement of the size encoded in
+// the low two bits of sz, an empty string if there is none, and the
+// remainder of operand.
+func displacement(sz uint16, operand []byte) (string, []byte) {
+	var d int64
+	switch sz & 0x03 {
+	case 0x02:
+		w, _, _ := extWord(operand)
+		d, operand = int64(int16(w)), operand[2:]
+	case 0x03:
+		hi, _, _ := extWord(operand)
+		lo, _, _ := extWord(operand[2:])
+		d = int64(int32(uint32(hi)<<16 | uint32(lo)))
+		operand = operand[4:]
+	default:
+		return "", operand
+	}
+	return hex(d), operand
+}
+
+// disassembleEA returns the effective address for mode m and register r.
+// Extension words are consumed from operand and the remainder is returned.
+func disassembleEA(m, r uint16, size uint32, operand []byte) (string, []byte) {
+	var (
+		w, lo uint16
+		ok    bool
+	)
+
 	switch m {
 	case 0x00:
 		// r = Dn
-		return fmt.Sprintf("d%v", r)
+		return fmt.Sprintf("d%v", r), operand
 	case 0x01:
 		// r = An
-		return fmt.Sprintf("a%v", r)
+		return fmt.Sprintf("a%v", r), operand
 	case 0x02:
 		// r = An -> (An)
-		return fmt.Sprintf("(a%v)", r)
+		return fmt.Sprintf("(a%v)", r), operand
 	case 0x03:
 		// r = An -> (An)+
-		return fmt.Sprintf("(a%v)+", r)
+		return fmt.Sprintf("(a%v)+", r), operand
 	case 0x04:
 		// r = An -> -(An)
-		return fmt.Sprintf("-(a%v)", r)
+		return fmt.Sprintf("-(a%v)", r), operand
 	case 0x05:
 		// r = An -> (d16,An)
+		if w, operand, ok = extWord(operand); ok {
+			return fmt.Sprintf("%v(a%v)", hex(int64(int16(w))), r),
+				operand
+		}
 	case 0x06:
 		// r = An -> (d8,An,Xn)
+		if w, operand, ok = extWord(operand); ok {
+			return disassembleIndex(fmt.Sprintf("a%v", r), w,
+				operand)
+		}
 	case 0x07:
-		// r == 0x00 -> (xxx).W
-		// r == 0x01 -> (xxx).L
+		switch r {
+		case 0x00:
+			// (xxx).W
+			if w, operand, ok = extWord(operand); ok {
+				return hex(int64(int16(w))) + ".w", operand
+			}
+		case 0x01:
+			// (xxx).L
+			if w, operand, ok = extWord(operand); !ok {
+				break
+			}
+			if lo, operand, ok = extWord(operand); ok {
+				return hex(int64(w)<<16|int64(lo)) + ".l", operand
+			}
+		case 0x02:
+			// (d16,PC)
+			if w, operand, ok = extWord(operand); ok {
+				return fmt.Sprintf("%v(pc)", hex(int64(int16(w)))),
+					operand
+			}
+		case 0x03:
+			// (d8,PC,Xn)
+			if w, operand, ok = extWord(operand); ok {
+				return disassembleIndex("pc", w, operand)
+			}
+		case 0x04:
+			// #<data>
+			if w, operand, ok = extWord(operand); !ok {
+				break
+			}
+			switch size {
+			case 1:
+				return "#" + hex(int64(w&0xff)), operand
+			case 2:
+				return "#" + hex(int64(w)), operand
+			}
+			if lo, operand, ok = extWord(operand); ok {
+				return "#" + hex(int64(w)<<16|int64(lo)), operand
+			}
+		}
 	}
 
-	return fmt.Sprintf("unhandled %v 0x%x", mrMode, m)
+	return fmt.Sprintf("unhandled 0x%x 0x%x", m, r), operand
+}
+
+// disassembleSD decodes the mode and register fields found at bits and
+// returns the effective address and the remainder of operand.
+func disassembleSD(mrMode bool, opcode uint16, bits uint16, size uint32,
+	operand []byte) (string, []byte) {
+
+	var m, r uint16
+	if mrMode {
+		m, r = mr(opcode, bits)
+	} else {
+		m, r = rm(opcode, bits)
+	}
+
+	return disassembleEA(m, r, size, operand)
 }
 
 func size2Text(size uint16) string {
@@ -119,15 +278,50 @@ func mr(opc uint16, bits uint16) (m, r uint16) {
 	return
 }
 
+// moveSize returns the move operation size in bytes.
+func moveSize(opc uint16) uint32 {
+	switch decodeSize(opc, 13) {
+	case 0x01:
+		return 1
+	case 0x03:
+		return 2
+	}
+	return 4
+}
+
 func dMove(c *m68k, opcode uint16, operand []byte) (string, int, error) {
-	source := disassembleSD(true, opcode, 5)
-	dest := disassembleSD(false, opcode, 11)
+	source, rest := disassembleSD(true, opcode, 5, moveSize(opcode), operand)
+	dest, _ := disassembleSD(false, opcode, 11, moveSize(opcode), rest)
 	size := "." + disassembleSize(opcode, 13)
 	s := fmt.Sprintf("move%v\t%v,%v", size, source, dest)
 	return s, 2 + len(operand), nil
 }
 
-func dAdd(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+// standardSize returns the operation size in bytes encoded in bits 7-6.
+func standardSize(opc uint16) uint32 {
+	switch opc >> 6 & 0x03 {
+	case 0x00:
+		return 1
+	case 0x01:
+		return 2
+	}
+	return 4
+}
+
+// sizeSuffix returns the assembler suffix for size bytes.
+func sizeSuffix(size uint32) string {
+	switch size {
+	case 1:
+		return ".b"
+	case 2:
+		return ".w"
+	}
+	return ".l"
+}
+
+// disassembleOpmode disassembles the opmode encoded <ea>,Dn, Dn,<ea> and
+// <ea>,An instructions of add, sub, cmp, and and or.
+func disassembleOpmode(mnemonic string, opcode uint16, operand []byte) (string, int, error) {
 	var sz, source, dest string
 
 	register, opmode := mr(opcode, 11) // this is right
@@ -137,17 +331,17 @@ func dAdd(c *m68k, opcode uint16, operand []byte) (string, int, error) {
 	case 0x0:
 		// byte
 		sz = ".b"
-		source = disassembleSD(true, opcode, 5)
+		source, _ = disassembleSD(true, opcode, 5, 1, operand)
 		dest = fmt.Sprintf("d%v", register)
 	case 0x1:
 		// word
 		sz = ".w"
-		source = disassembleSD(true, opcode, 5)
+		source, _ = disassembleSD(true, opcode, 5, 2, operand)
 		dest = fmt.Sprintf("d%v", register)
 	case 0x2:
 		// long
 		sz = ".l"
-		source = disassembleSD(true, opcode, 5)
+		source, _ = disassembleSD(true, opcode, 5, 4, operand)
 		dest = fmt.Sprintf("d%v", register)
 
 	// Dn + <ea> -> <ea>
@@ -155,28 +349,28 @@ func dAdd(c *m68k, opcode uint16, operand []byte) (string, int, error) {
 		// byte
 		sz = ".b"
 		source = fmt.Sprintf("d%v", register)
-		dest = disassembleSD(true, opcode, 5)
+		dest, _ = disassembleSD(true, opcode, 5, 1, operand)
 	case 0x5:
 		// word
 		sz = ".w"
 		source = fmt.Sprintf("d%v", register)
-		dest = disassembleSD(true, opcode, 5)
+		dest, _ = disassembleSD(true, opcode, 5, 2, operand)
 	case 0x6:
 		// long
 		sz = ".l"
 		source = fmt.Sprintf("d%v", register)
-		dest = disassembleSD(true, opcode, 5)
+		dest, _ = disassembleSD(true, opcode, 5, 4, operand)
 
 	// adda An + <ea> -> <ea>
 	case 0x3:
 		// word
-		sz = ".w"
-		source = disassembleSD(true, opcode, 5)
+		sz = "a.w"
+		source, _ = disassembleSD(true, opcode, 5, 2, operand)
 		dest = fmt.Sprintf("a%v", register)
 	case 0x7:
 		// long
-		sz = ".l"
-		source = disassembleSD(true, opcode, 5)
+		sz = "a.l"
+		source, _ = disassembleSD(true, opcode, 5, 4, operand)
 		dest = fmt.Sprintf("a%v", register)
 
 	default:
@@ -185,6 +379,1239 @@ func dAdd(c *m68k, opcode uint16, operand []byte) (string, int, error) {
 		dest = "inv"
 	}
 
-	s := fmt.Sprintf("add%v\t%v,%v", sz, source, dest)
+	s := fmt.Sprintf("%v%v\t%v,%v", mnemonic, sz, source, dest)
 	return s, 2 + len(operand), nil
 }
+
+// disassembleImmediate disassembles #<data>,<ea> instructions.
+func disassembleImmediate(mnemonic string, opcode uint16, operand []byte) (string, int, error) {
+	size := standardSize(opcode)
+	source, rest := disassembleEA(0x07, 0x04, size, operand)
+	dest, _ := disassembleSD(true, opcode, 5, size, rest)
+	s := fmt.Sprintf("%v%v\t%v,%v", mnemonic, sizeSuffix(size), source, dest)
+	return s, 2 + len(operand), nil
+}
+
+// disassembleQuick disassembles #<1-8>,<ea> instructions.
+func disassembleQuick(mnemonic string, opcode uint16, operand []byte) (string, int, error) {
+	data, _ := mr(opcode, 11)
+	if data == 0 {
+		data = 8
+	}
+	size := standardSize(opcode)
+	dest, _ := disassembleSD(true, opcode, 5, size, operand)
+	s := fmt.Sprintf("%v%v\t#%v,%v", mnemonic, sizeSuffix(size), data, dest)
+	return s, 2 + len(operand), nil
+}
+
+// disassembleX disassembles Dy,Dx and -(Ay),-(Ax) instructions.
+func disassembleX(mnemonic string, opcode uint16, operand []byte) (string, int, error) {
+	rx, _ := mr(opcode, 11)
+	_, ry := mr(opcode, 5)
+	f := "d%v,d%v"
+	if opcode&0x0008 != 0 {
+		f = "-(a%v),-(a%v)"
+	}
+	s := fmt.Sprintf("%v%v\t"+f, mnemonic, sizeSuffix(standardSize(opcode)),
+		ry, rx)
+	return s, 2 + len(operand), nil
+}
+
+// disassembleSingle disassembles single operand <ea> instructions.
+func disassembleSingle(mnemonic string, opcode uint16, operand []byte) (string, int, error) {
+	size := standardSize(opcode)
+	dest, _ := disassembleSD(true, opcode, 5, size, operand)
+	s := fmt.Sprintf("%v%v\t%v", mnemonic, sizeSuffix(size), dest)
+	return s, 2 + len(operand), nil
+}
+
+func dAdd(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleOpmode("add", opcode, operand)
+}
+
+func dAddi(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleImmediate("addi", opcode, operand)
+}
+
+func dAddq(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleQuick("addq", opcode, operand)
+}
+
+func dAddx(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleX("addx", opcode, operand)
+}
+
+func dSub(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleOpmode("sub", opcode, operand)
+}
+
+func dSubi(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleImmediate("subi", opcode, operand)
+}
+
+func dSubq(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleQuick("subq", opcode, operand)
+}
+
+func dSubx(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleX("subx", opcode, operand)
+}
+
+func dCmp(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleOpmode("cmp", opcode, operand)
+}
+
+func dCmpi(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleImmediate("cmpi", opcode, operand)
+}
+
+func dCmpm(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	rx, _ := mr(opcode, 11)
+	_, ry := mr(opcode, 5)
+	s := fmt.Sprintf("cmpm%v\t(a%v)+,(a%v)+",
+		sizeSuffix(standardSize(opcode)), ry, rx)
+	return s, 2 + len(operand), nil
+}
+
+func dNeg(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleSingle("neg", opcode, operand)
+}
+
+func dNegx(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleSingle("negx", opcode, operand)
+}
+
+func dAnd(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleOpmode("and", opcode, operand)
+}
+
+func dOr(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleOpmode("or", opcode, operand)
+}
+
+func dEor(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleOpmode("eor", opcode, operand)
+}
+
+// disassembleLogicalImmediate disassembles #<data>,<ea> as well as the
+// #<data>,CCR and #<data>,SR forms.
+func disassembleLogicalImmediate(mnemonic string, opcode uint16, operand []byte) (string, int, error) {
+	switch opcode & 0x00ff {
+	case 0x3c:
+		source, _ := disassembleEA(0x07, 0x04, 1, operand)
+		return fmt.Sprintf("%v\t%v,ccr", mnemonic, source), 2 + len(operand),
+			nil
+	case 0x7c:
+		source, _ := disassembleEA(0x07, 0x04, 2, operand)
+		return fmt.Sprintf("%v\t%v,sr", mnemonic, source), 2 + len(operand),
+			nil
+	}
+	return disassembleImmediate(mnemonic, opcode, operand)
+}
+
+func dAndi(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleLogicalImmediate("andi", opcode, operand)
+}
+
+func dOri(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleLogicalImmediate("ori", opcode, operand)
+}
+
+func dEori(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleLogicalImmediate("eori", opcode, operand)
+}
+
+func dNot(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleSingle("not", opcode, operand)
+}
+
+func dMoveToCCR(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	source, _ := disassembleSD(true, opcode, 5, 2, operand)
+	return fmt.Sprintf("move.w\t%v,ccr", source), 2 + len(operand), nil
+}
+
+func dMoveToSR(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	source, _ := disassembleSD(true, opcode, 5, 2, operand)
+	return fmt.Sprintf("move.w\t%v,sr", source), 2 + len(operand), nil
+}
+
+func dMoveFromSR(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	dest, _ := disassembleSD(true, opcode, 5, 2, operand)
+	return fmt.Sprintf("move.w\tsr,%v", dest), 2 + len(operand), nil
+}
+
+func dMoveUSP(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	_, r := mr(opcode, 5)
+	f := "move.l\ta%v,usp"
+	if opcode&0x0008 != 0 {
+		f = "move.l\tusp,a%v"
+	}
+	return fmt.Sprintf(f, r), 2 + len(operand), nil
+}
+
+// disassembleShift disassembles the shift and rotate register and memory
+// forms.
+func disassembleShift(mnemonic string, opcode uint16, operand []byte) (string, int, error) {
+	if opcode&0x00c0 == 0x00c0 {
+		// memory
+		dest, _ := disassembleSD(true, opcode, 5, 2, operand)
+		return fmt.Sprintf("%v.w\t%v", mnemonic, dest), 2 + len(operand), nil
+	}
+
+	count, _ := mr(opcode, 11)
+	_, r := mr(opcode, 5)
+	var source string
+	if opcode&0x0020 != 0 {
+		source = fmt.Sprintf("d%v", count)
+	} else {
+		if count == 0 {
+			count = 8
+		}
+		source = fmt.Sprintf("#%v", count)
+	}
+	s := fmt.Sprintf("%v%v\t%v,d%v", mnemonic,
+		sizeSuffix(standardSize(opcode)), source, r)
+	return s, 2 + len(operand), nil
+}
+
+func dAsl(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleShift("asl", opcode, operand)
+}
+
+func dAsr(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleShift("asr", opcode, operand)
+}
+
+func dLsl(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleShift("lsl", opcode, operand)
+}
+
+func dLsr(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleShift("lsr", opcode, operand)
+}
+
+func dRoxl(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleShift("roxl", opcode, operand)
+}
+
+func dRoxr(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleShift("roxr", opcode, operand)
+}
+
+func dRol(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleShift("rol", opcode, operand)
+}
+
+func dRor(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleShift("ror", opcode, operand)
+}
+
+// relative returns a program counter relative branch target.  Targets are
+// relative to the start of the instruction.
+func relative(disp int32) string {
+	disp += 2
+	if disp < 0 {
+		return fmt.Sprintf("*-$%x", -disp)
+	}
+	return fmt.Sprintf("*+$%x", disp)
+}
+
+func disassembleImplied(mnemonic string, operand []byte) (string, int, error) {
+	return mnemonic, 2 + len(operand), nil
+}
+
+func dNop(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleImplied("nop", operand)
+}
+
+func dRte(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleImplied("rte", operand)
+}
+
+func dRts(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleImplied("rts", operand)
+}
+
+func dRtr(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleImplied("rtr", operand)
+}
+
+func dBcc(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	var mnemonic string
+	switch cc := opcode >> 8 & 0x0f; cc {
+	case 0x00:
+		mnemonic = "bra"
+	case 0x01:
+		mnemonic = "bsr"
+	default:
+		mnemonic = "b" + conditions[cc]
+	}
+
+	disp := int32(int8(opcode))
+	sz := ".s"
+	switch {
+	case disp == 0:
+		w, _, ok := extWord(operand)
+		if !ok {
+			return "INVALID", 0, cpu.ErrInvalidOpcode
+		}
+		disp = int32(int16(w))
+		sz = ".w"
+	case disp == -1 && len(operand) == 4:
+		// 68020 and up
+		hi, rest, _ := extWord(operand)
+		lo, _, _ := extWord(rest)
+		disp = int32(uint32(hi)<<16 | uint32(lo))
+		sz = ".l"
+	}
+
+	s := fmt.Sprintf("%v%v\t%v", mnemonic, sz, relative(disp))
+	return s, 2 + len(operand), nil
+}
+
+func dDbcc(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	w, _, ok := extWord(operand)
+	if !ok {
+		return "INVALID", 0, cpu.ErrInvalidOpcode
+	}
+	_, r := mr(opcode, 5)
+	s := fmt.Sprintf("db%v\td%v,%v", conditions[opcode>>8&0x0f], r,
+		relative(int32(int16(w))))
+	return s, 2 + len(operand), nil
+}
+
+func dScc(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	dest, _ := disassembleSD(true, opcode, 5, 1, operand)
+	s := fmt.Sprintf("s%v\t%v", conditions[opcode>>8&0x0f], dest)
+	return s, 2 + len(operand), nil
+}
+
+func dJmp(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	dest, _ := disassembleSD(true, opcode, 5, 4, operand)
+	return fmt.Sprintf("jmp\t%v", dest), 2 + len(operand), nil
+}
+
+func dJsr(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	dest, _ := disassembleSD(true, opcode, 5, 4, operand)
+	return fmt.Sprintf("jsr\t%v", dest), 2 + len(operand), nil
+}
+
+// disassembleLong disassembles <ea>,Dn instructions that operate on the full
+// data register.
+func disassembleLong(mnemonic string, opcode uint16, operand []byte) (string, int, error) {
+	register, _ := mr(opcode, 11)
+	source, _ := disassembleSD(true, opcode, 5, 2, operand)
+	s := fmt.Sprintf("%v\t%v,d%v", mnemonic, source, register)
+	return s, 2 + len(operand), nil
+}
+
+func dMulu(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleLong("mulu.w", opcode, operand)
+}
+
+func dMuls(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleLong("muls.w", opcode, operand)
+}
+
+func dDivu(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleLong("divu.w", opcode, operand)
+}
+
+func dDivs(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleLong("divs.w", opcode, operand)
+}
+
+func dAbcd(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleX("abcd", opcode, operand)
+}
+
+func dSbcd(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleX("sbcd", opcode, operand)
+}
+
+func dNbcd(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleSingle("nbcd", opcode, operand)
+}
+
+func dMovea(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	_, register := rm(opcode, 11)
+	size := moveSize(opcode)
+	source, _ := disassembleSD(true, opcode, 5, size, operand)
+	s := fmt.Sprintf("movea%v\t%v,a%v", sizeSuffix(size), source, register)
+	return s, 2 + len(operand), nil
+}
+
+func dMoveq(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	register, _ := mr(opcode, 11)
+	s := fmt.Sprintf("moveq\t#%v,d%v", hex(int64(int8(opcode))), register)
+	return s, 2 + len(operand), nil
+}
+
+func dLea(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	register, _ := mr(opcode, 11)
+	source, _ := disassembleSD(true, opcode, 5, 4, operand)
+	s := fmt.Sprintf("lea\t%v,a%v", source, register)
+	return s, 2 + len(operand), nil
+}
+
+func dPea(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	source, _ := disassembleSD(true, opcode, 5, 4, operand)
+	return fmt.Sprintf("pea\t%v", source), 2 + len(operand), nil
+}
+
+func dLink(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	w, rest, ok := extWord(operand)
+	if !ok {
+		return "INVALID", 0, cpu.ErrInvalidOpcode
+	}
+	if opcode&0xfff8 == 0x4808 {
+		// link.l
+		lo, _, ok := extWord(rest)
+		if !ok {
+			return "INVALID", 0, cpu.ErrInvalidOpcode
+		}
+		s := fmt.Sprintf("link.l\ta%v,#%v", opcode&0x07,
+			hex(int64(int32(uint32(w)<<16|uint32(lo)))))
+		return s, 2 + len(operand), nil
+	}
+	s := fmt.Sprintf("link\ta%v,#%v", opcode&0x07, hex(int64(int16(w))))
+	return s, 2 + len(operand), nil
+}
+
+func dUnlk(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return fmt.Sprintf("unlk\ta%v", opcode&0x07), 2 + len(operand), nil
+}
+
+func dExg(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	rx, ry := opcode>>9&0x07, opcode&0x07
+	var f string
+	switch opcode >> 3 & 0x1f {
+	case 0x08:
+		f = "exg\td%v,d%v"
+	case 0x09:
+		f = "exg\ta%v,a%v"
+	default:
+		f = "exg\td%v,a%v"
+	}
+	return fmt.Sprintf(f, rx, ry), 2 + len(operand), nil
+}
+
+func dSwap(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return fmt.Sprintf("swap\td%v", opcode&0x07), 2 + len(operand), nil
+}
+
+func dExt(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	sz := ".w"
+	if opcode&0x0040 != 0 {
+		sz = ".l"
+	}
+	return fmt.Sprintf("ext%v\td%v", sz, opcode&0x07), 2 + len(operand), nil
+}
+
+func dClr(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleSingle("clr", opcode, operand)
+}
+
+func dTst(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleSingle("tst", opcode, operand)
+}
+
+func dTas(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	dest, _ := disassembleSD(true, opcode, 5, 1, operand)
+	return fmt.Sprintf("tas\t%v", dest), 2 + len(operand), nil
+}
+
+// registerList returns the movem register list in assembler notation.  The
+// predecrement mode stores the list in reverse order.
+func registerList(list uint16, predecrement bool) string {
+	if predecrement {
+		var r uint16
+		for n := uint(0); n < 16; n++ {
+			if list&(1<<n) != 0 {
+				r |= 1 << (15 - n)
+			}
+		}
+		list = r
+	}
+
+	var s string
+	for n := 0; n < 16; n++ {
+		if list&(1<<uint(n)) == 0 {
+			continue
+		}
+		// find the end of the range within the same register type
+		end := n
+		for end+1 < 16 && (end+1)%8 != 0 && list&(1<<uint(end+1)) != 0 {
+			end++
+		}
+		if s != "" {
+			s += "/"
+		}
+		name := func(n int) string {
+			if n < 8 {
+				return fmt.Sprintf("d%v", n)
+			}
+			return fmt.Sprintf("a%v", n-8)
+		}
+		s += name(n)
+		if end != n {
+			s += "-" + name(end)
+		}
+		n = end
+	}
+	return s
+}
+
+func dMovem(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	list, rest, ok := extWord(operand)
+	if !ok {
+		return "INVALID", 0, cpu.ErrInvalidOpcode
+	}
+	m, _ := mr(opcode, 5)
+	size := uint32(2)
+	if opcode&0x0040 != 0 {
+		size = 4
+	}
+	ea, _ := disassembleSD(true, opcode, 5, size, rest)
+	registers := registerList(list, m == 0x04)
+
+	var s string
+	if opcode&0x0400 == 0 {
+		s = fmt.Sprintf("movem%v\t%v,%v", sizeSuffix(size), registers, ea)
+	} else {
+		s = fmt.Sprintf("movem%v\t%v,%v", sizeSuffix(size), ea, registers)
+	}
+	return s, 2 + len(operand), nil
+}
+
+func dMovep(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	w, _, ok := extWord(operand)
+	if !ok {
+		return "INVALID", 0, cpu.ErrInvalidOpcode
+	}
+	dn, an := opcode>>9&0x07, opcode&0x07
+	sz := ".w"
+	if opcode&0x0040 != 0 {
+		sz = ".l"
+	}
+	mem := fmt.Sprintf("%v(a%v)", hex(int64(int16(w))), an)
+	var s string
+	if opcode&0x0080 == 0 {
+		s = fmt.Sprintf("movep%v\t%v,d%v", sz, mem, dn)
+	} else {
+		s = fmt.Sprintf("movep%v\td%v,%v", sz, dn, mem)
+	}
+	return s, 2 + len(operand), nil
+}
+
+// disassembleBit disassembles the bit manipulation instructions.
+func disassembleBit(mnemonic string, opcode uint16, operand []byte) (string, int, error) {
+	m, _ := mr(opcode, 5)
+	size := uint32(1)
+	if m == 0x00 {
+		size = 4
+	}
+
+	var source string
+	rest := operand
+	if opcode&0x0100 != 0 {
+		register, _ := mr(opcode, 11)
+		source = fmt.Sprintf("d%v", register)
+	} else {
+		var (
+			w  uint16
+			ok bool
+		)
+		w, rest, ok = extWord(operand)
+		if !ok {
+			return "INVALID", 0, cpu.ErrInvalidOpcode
+		}
+		source = fmt.Sprintf("#%v", w&0xff)
+	}
+	dest, _ := disassembleSD(true, opcode, 5, size, rest)
+	s := fmt.Sprintf("%v\t%v,%v", mnemonic, source, dest)
+	return s, 2 + len(operand), nil
+}
+
+func dBtst(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleBit("btst", opcode, operand)
+}
+
+func dBchg(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleBit("bchg", opcode, operand)
+}
+
+func dBclr(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleBit("bclr", opcode, operand)
+}
+
+func dBset(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleBit("bset", opcode, operand)
+}
+
+func dTrap(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return fmt.Sprintf("trap\t#%v", opcode&0x0f), 2 + len(operand), nil
+}
+
+func dTrapv(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleImplied("trapv", operand)
+}
+
+func dChk(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	if opcode&0x0080 != 0 {
+		return disassembleLong("chk.w", opcode, operand)
+	}
+	// chk.l
+	register, _ := mr(opcode, 11)
+	source, _ := disassembleSD(true, opcode, 5, 4, operand)
+	s := fmt.Sprintf("chk.l\t%v,d%v", source, register)
+	return s, 2 + len(operand), nil
+}
+
+func dIllegal(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleImplied("illegal", operand)
+}
+
+func dStop(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	w, _, ok := extWord(operand)
+	if !ok {
+		return "INVALID", 0, cpu.ErrInvalidOpcode
+	}
+	return fmt.Sprintf("stop\t#%v", hex(int64(w))), 2 + len(operand), nil
+}
+
+func dReset(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleImplied("reset", operand)
+}
+
+func dMoveFromCCR(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	dest, _ := disassembleSD(true, opcode, 5, 2, operand)
+	return fmt.Sprintf("move.w\tccr,%v", dest), 2 + len(operand), nil
+}
+
+// controlRegisters are the movec control register names.
+var controlRegisters = map[uint16]string{
+	0x000: "sfc",
+	0x001: "dfc",
+	0x002: "cacr",
+	0x800: "usp",
+	0x801: "vbr",
+	0x802: "caar",
+	0x803: "msp",
+	0x804: "isp",
+}
+
+// generalRegister returns the name of the general register in bits 15-12 of
+// an extension word.
+func generalRegister(ext uint16) string {
+	if ext&0x8000 != 0 {
+		return fmt.Sprintf("a%v", ext>>12&0x07)
+	}
+	return fmt.Sprintf("d%v", ext>>12&0x07)
+}
+
+func dMovec(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	ext, _, ok := extWord(operand)
+	if !ok {
+		return "INVALID", 0, cpu.ErrInvalidOpcode
+	}
+	rc, ok := controlRegisters[ext&0x0fff]
+	if !ok {
+		rc = hex(int64(ext & 0x0fff))
+	}
+	rn := generalRegister(ext)
+	if opcode&0x0001 == 0 {
+		return fmt.Sprintf("movec\t%v,%v", rc, rn), 2 + len(operand), nil
+	}
+	return fmt.Sprintf("movec\t%v,%v", rn, rc), 2 + len(operand), nil
+}
+
+func dMoves(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	ext, rest, ok := extWord(operand)
+	if !ok {
+		return "INVALID", 0, cpu.ErrInvalidOpcode
+	}
+	size := uint32(1) << (opcode >> 6 & 0x03)
+	ea, _ := disassembleSD(true, opcode, 5, size, rest)
+	rn := generalRegister(ext)
+
+	var s string
+	if ext&0x0800 != 0 {
+		s = fmt.Sprintf("moves%v\t%v,%v", sizeSuffix(size), rn, ea)
+	} else {
+		s = fmt.Sprintf("moves%v\t%v,%v", sizeSuffix(size), ea, rn)
+	}
+	return s, 2 + len(operand), nil
+}
+
+func dRtd(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	w, _, ok := extWord(operand)
+	if !ok {
+		return "INVALID", 0, cpu.ErrInvalidOpcode
+	}
+	return fmt.Sprintf("rtd\t#%v", hex(int64(int16(w)))), 2 + len(operand),
+		nil
+}
+
+func dBkpt(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return fmt.Sprintf("bkpt\t#%v", opcode&0x07), 2 + len(operand), nil
+}
+
+func dTrapcc(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleTrapcc("trap"+conditions[opcode>>8&0x0f], operand)
+}
+
+// disassembleTrapcc disassembles trapcc and tpf with their optional word or
+// long operand.
+func disassembleTrapcc(mnemonic string, operand []byte) (string, int, error) {
+	switch len(operand) {
+	case 2:
+		w, _, _ := extWord(operand)
+		return fmt.Sprintf("%v.w\t#%v", mnemonic, hex(int64(w))),
+			2 + len(operand), nil
+	case 4:
+		hi, rest, _ := extWord(operand)
+		lo, _, _ := extWord(rest)
+		return fmt.Sprintf("%v.l\t#%v", mnemonic,
+			hex(int64(hi)<<16|int64(lo))), 2 + len(operand), nil
+	}
+	return disassembleImplied(mnemonic, operand)
+}
+
+func dExtb(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return fmt.Sprintf("extb.l\td%v", opcode&0x07), 2 + len(operand), nil
+}
+
+// disassembleMulDiv disassembles the 32 bit multiply and divide instructions.
+// Bit 11 of the extension word selects the signed form and bit 10 the 64 bit
+// form that uses the register pair Dh:Dl or Dr:Dq.
+func disassembleMulDiv(mnemonic string, opcode uint16, operand []byte) (string,
+	int, error) {
+
+	ext, rest, ok := extWord(operand)
+	if !ok {
+		return "INVALID", 0, cpu.ErrInvalidOpcode
+	}
+	ea, _ := disassembleSD(true, opcode, 5, 4, rest)
+	sign := "u"
+	if ext&0x0800 != 0 {
+		sign = "s"
+	}
+	dl, dh := ext>>12&0x07, ext&0x07
+
+	var s string
+	switch {
+	case ext&0x0400 != 0:
+		s = fmt.Sprintf("%v%v.l\t%v,d%v:d%v", mnemonic, sign, ea, dh, dl)
+	case mnemonic == "div" && dl != dh:
+		s = fmt.Sprintf("%v%vl.l\t%v,d%v:d%v", mnemonic, sign, ea, dh,
+			dl)
+	default:
+		s = fmt.Sprintf("%v%v.l\t%v,d%v", mnemonic, sign, ea, dl)
+	}
+	return s, 2 + len(operand), nil
+}
+
+func dMull(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleMulDiv("mul", opcode, operand)
+}
+
+func dDivl(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleMulDiv("div", opcode, operand)
+}
+
+// casSize returns the operation size encoded in bits 10-9 of cas and cas2.
+func casSize(opcode uint16) uint32 {
+	return 1 << (opcode>>9&0x03 - 1)
+}
+
+func dCas(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	ext, rest, ok := extWord(operand)
+	if !ok {
+		return "INVALID", 0, cpu.ErrInvalidOpcode
+	}
+	size := casSize(opcode)
+	ea, _ := disassembleSD(true, opcode, 5, size, rest)
+	s := fmt.Sprintf("cas%v\td%v,d%v,%v", sizeSuffix(size), ext&0x07,
+		ext>>6&0x07, ea)
+	return s, 2 + len(operand), nil
+}
+
+func dCas2(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	ext1, rest, ok := extWord(operand)
+	if !ok {
+		return "INVALID", 0, cpu.ErrInvalidOpcode
+	}
+	ext2, _, ok := extWord(rest)
+	if !ok {
+		return "INVALID", 0, cpu.ErrInvalidOpcode
+	}
+	s := fmt.Sprintf("cas2%v\td%v:d%v,d%v:d%v,(%v):(%v)",
+		sizeSuffix(casSize(opcode)), ext1&0x07, ext2&0x07, ext1>>6&0x07,
+		ext2>>6&0x07, generalRegister(ext1), generalRegister(ext2))
+	return s, 2 + len(operand), nil
+}
+
+func dChk2(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	ext, rest, ok := extWord(operand)
+	if !ok {
+		return "INVALID", 0, cpu.ErrInvalidOpcode
+	}
+	size := uint32(1) << (opcode >> 9 & 0x03)
+	ea, _ := disassembleSD(true, opcode, 5, size, rest)
+	mnemonic := "cmp2"
+	if ext&0x0800 != 0 {
+		mnemonic = "chk2"
+	}
+	s := fmt.Sprintf("%v%v\t%v,%v", mnemonic, sizeSuffix(size), ea,
+		generalRegister(ext))
+	return s, 2 + len(operand), nil
+}
+
+// disassemblePack disassembles pack and unpk.
+func disassemblePack(mnemonic string, opcode uint16, operand []byte) (string,
+	int, error) {
+
+	w, _, ok := extWord(operand)
+	if !ok {
+		return "INVALID", 0, cpu.ErrInvalidOpcode
+	}
+	f := "%v\td%v,d%v,#%v"
+	if opcode&0x0008 != 0 {
+		f = "%v\t-(a%v),-(a%v),#%v"
+	}
+	s := fmt.Sprintf(f, mnemonic, opcode&0x07, opcode>>9&0x07, hex(int64(w)))
+	return s, 2 + len(operand), nil
+}
+
+func dPack(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassemblePack("pack", opcode, operand)
+}
+
+func dUnpk(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassemblePack("unpk", opcode, operand)
+}
+
+// bitfieldMnemonics are the bit field instruction mnemonics in encoding
+// order.
+var bitfieldMnemonics = []string{"bftst", "bfextu", "bfchg", "bfexts",
+	"bfclr", "bfffo", "bfset", "bfins"}
+
+func dBitfield(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	ext, rest, ok := extWord(operand)
+	if !ok {
+		return "INVALID", 0, cpu.ErrInvalidOpcode
+	}
+	ea, _ := disassembleSD(true, opcode, 5, 4, rest)
+	offset := fmt.Sprintf("%v", ext>>6&0x1f)
+	if ext&0x0800 != 0 {
+		offset = fmt.Sprintf("d%v", ext>>6&0x07)
+	}
+	width := fmt.Sprintf("%v", ext&0x1f)
+	switch {
+	case ext&0x0020 != 0:
+		width = fmt.Sprintf("d%v", ext&0x07)
+	case ext&0x1f == 0:
+		width = "32"
+	}
+	field := fmt.Sprintf("%v{%v:%v}", ea, offset, width)
+
+	mnemonic := bitfieldMnemonics[opcode>>8&0x07]
+	var s string
+	switch mnemonic {
+	case "bfextu", "bfexts", "bfffo":
+		s = fmt.Sprintf("%v\t%v,d%v", mnemonic, field, ext>>12&0x07)
+	case "bfins":
+		s = fmt.Sprintf("%v\td%v,%v", mnemonic, ext>>12&0x07, field)
+	default:
+		s = fmt.Sprintf("%v\t%v", mnemonic, field)
+	}
+	return s, 2 + len(operand), nil
+}
+
+// fpuMnemonics are the general floating point instruction mnemonics by
+// opmode, fsincos uses opmodes $30-$37.
+var fpuMnemonics = map[uint16]string{
+	0x00: "fmove", 0x01: "fint", 0x02: "fsinh", 0x03: "fintrz",
+	0x04: "fsqrt", 0x06: "flognp1", 0x08: "fetoxm1", 0x09: "ftanh",
+	0x0a: "fatan", 0x0c: "fasin", 0x0d: "fatanh", 0x0e: "fsin",
+	0x0f: "ftan", 0x10: "fetox", 0x11: "ftwotox", 0x12: "ftentox",
+	0x14: "flogn", 0x15: "flog10", 0x16: "flog2", 0x18: "fabs",
+	0x19: "fcosh", 0x1a: "fneg", 0x1c: "facos", 0x1d: "fcos",
+	0x1e: "fgetexp", 0x1f: "fgetman", 0x20: "fdiv", 0x21: "fmod",
+	0x22: "fadd", 0x23: "fmul", 0x24: "fsgldiv", 0x25: "frem",
+	0x26: "fscale", 0x27: "fsglmul", 0x28: "fsub", 0x38: "fcmp",
+	0x3a: "ftst",
+}
+
+// fpuFormats are the floating point data format suffixes in encoding order.
+var fpuFormats = []string{"l", "s", "x", "p", "w", "d", "b", "p"}
+
+// fpuConditions are the floating point conditional predicate mnemonics in
+// encoding order.
+var fpuConditions = []string{"f", "eq", "ogt", "oge", "olt", "ole", "ogl",
+	"or", "un", "ueq", "ugt", "uge", "ult", "ule", "ne", "t", "sf", "seq",
+	"gt", "ge", "lt", "le", "gl", "gle", "ngle", "ngl", "nle", "nlt",
+	"nge", "ngt", "sne", "st"}
+
+// fpuCondition returns the mnemonic of predicate.
+func fpuCondition(predicate uint16) string {
+	if int(predicate) < len(fpuConditions) {
+		return fpuConditions[predicate]
+	}
+	return hex(int64(predicate))
+}
+
+// fpuRegisterList returns the fmovem data register list in assembler
+// notation.  The predecrement form has FP7 in bit 7, the other FP0.
+func fpuRegisterList(list uint16, predecrement bool) string {
+	if !predecrement {
+		var r uint16
+		for n := uint(0); n < 8; n++ {
+			if list&(1<<n) != 0 {
+				r |= 1 << (7 - n)
+			}
+		}
+		list = r
+	}
+
+	var s []string
+	for n := 0; n < 8; n++ {
+		if list&(1<<uint(n)) == 0 {
+			continue
+		}
+		end := n
+		for end+1 < 8 && list&(1<<uint(end+1)) != 0 {
+			end++
+		}
+		if end != n {
+			s = append(s, fmt.Sprintf("fp%v-fp%v", n, end))
+		} else {
+			s = append(s, fmt.Sprintf("fp%v", n))
+		}
+		n = end
+	}
+	return strings.Join(s, "/")
+}
+
+// fpuControlList returns the fmovem control register list in assembler
+// notation.
+func fpuControlList(list uint16) string {
+	var s []string
+	for n, name := range []string{"fpcr", "fpsr", "fpiar"} {
+		if list&(0x4>>uint(n)) != 0 {
+			s = append(s, name)
+		}
+	}
+	return strings.Join(s, "/")
+}
+
+// disassembleFPUEA returns the effective address for the size byte operand
+// of a floating point instruction.  Immediate operands of more than a long
+// are shown as their bytes.
+func disassembleFPUEA(opcode uint16, size uint32, operand []byte) string {
+	m, r := mr(opcode, 5)
+	if m != 0x07 || r != 0x04 || size <= 4 {
+		ea, _ := disassembleEA(m, r, size, operand)
+		return ea
+	}
+	if len(operand) < int(size) {
+		return "#?"
+	}
+	return fmt.Sprintf("#$%x", operand[:size])
+}
+
+func dGeneral(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	command, rest, ok := extWord(operand)
+	if !ok {
+		return "INVALID", 0, cpu.ErrInvalidOpcode
+	}
+	_, size, _ := m68881.Operand(command)
+	ea := disassembleFPUEA(opcode, size, rest)
+	rx, ry, opmode := command>>10&0x07, command>>7&0x07, command&0x7f
+
+	var s string
+	switch command >> 13 {
+	case 0x0, 0x2:
+		if command&0xfc00 == 0x5c00 {
+			s = fmt.Sprintf("fmovecr.x\t#%v,fp%v",
+				hex(int64(opmode)), ry)
+			break
+		}
+		mnemonic, ok := fpuMnemonics[opmode]
+		if opmode >= 0x30 && opmode <= 0x37 {
+			mnemonic, ok = "fsincos", true
+		}
+		if !ok {
+			return "INVALID", 0, cpu.ErrInvalidOpcode
+		}
+		source := fmt.Sprintf("fp%v", rx)
+		mnemonic += ".x"
+		if command>>13 == 0x2 {
+			source = ea
+			mnemonic = mnemonic[:len(mnemonic)-1] + fpuFormats[rx]
+		}
+		switch {
+		case opmode >= 0x30 && opmode <= 0x37:
+			s = fmt.Sprintf("%v\t%v,fp%v:fp%v", mnemonic, source,
+				opmode&0x07, ry)
+		case opmode == 0x3a:
+			s = fmt.Sprintf("%v\t%v", mnemonic, source)
+		case command>>13 == 0x0 && rx == ry && opmode < 0x20:
+			s = fmt.Sprintf("%v\tfp%v", mnemonic, ry)
+		default:
+			s = fmt.Sprintf("%v\t%v,fp%v", mnemonic, source, ry)
+		}
+	case 0x3:
+		s = fmt.Sprintf("fmove.%v\tfp%v,%v", fpuFormats[rx], ry, ea)
+		switch rx {
+		case 0x3:
+			s += fmt.Sprintf("{#%v}", int8(command<<1)>>1)
+		case 0x7:
+			s += fmt.Sprintf("{d%v}", command>>4&0x07)
+		}
+	case 0x4, 0x5:
+		mnemonic := "fmovem.l"
+		if rx == 0x1 || rx == 0x2 || rx == 0x4 {
+			mnemonic = "fmove.l"
+		}
+		if command>>13 == 0x4 {
+			s = fmt.Sprintf("%v\t%v,%v", mnemonic, ea,
+				fpuControlList(rx))
+		} else {
+			s = fmt.Sprintf("%v\t%v,%v", mnemonic,
+				fpuControlList(rx), ea)
+		}
+	case 0x6, 0x7:
+		list := fpuRegisterList(command&0xff, command&0x1000 == 0)
+		if command&0x0800 != 0 {
+			list = fmt.Sprintf("d%v", command>>4&0x07)
+		}
+		if command>>13 == 0x6 {
+			s = fmt.Sprintf("fmovem.x\t%v,%v", ea, list)
+		} else {
+			s = fmt.Sprintf("fmovem.x\t%v,%v", list, ea)
+		}
+	default:
+		return "INVALID", 0, cpu.ErrInvalidOpcode
+	}
+	return s, 2 + len(operand), nil
+}
+
+func dFBcc(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	var disp int32
+	switch len(operand) {
+	case 2:
+		w, _, _ := extWord(operand)
+		if opcode == 0xf280 && w == 0 {
+			return "fnop", 2 + len(operand), nil
+		}
+		disp = int32(int16(w))
+	case 4:
+		hi, rest, _ := extWord(operand)
+		lo, _, _ := extWord(rest)
+		disp = int32(uint32(hi)<<16 | uint32(lo))
+	default:
+		return "INVALID", 0, cpu.ErrInvalidOpcode
+	}
+	s := fmt.Sprintf("fb%v%v\t%v", fpuCondition(opcode&0x3f),
+		sizeSuffix(uint32(len(operand))), relative(disp))
+	return s, 2 + len(operand), nil
+}
+
+func dFDbcc(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	predicate, rest, ok := extWord(operand)
+	if !ok {
+		return "INVALID", 0, cpu.ErrInvalidOpcode
+	}
+	disp, _, ok := extWord(rest)
+	if !ok {
+		return "INVALID", 0, cpu.ErrInvalidOpcode
+	}
+	s := fmt.Sprintf("fdb%v\td%v,%v", fpuCondition(predicate), opcode&0x07,
+		relative(int32(int16(disp))))
+	return s, 2 + len(operand), nil
+}
+
+func dFScc(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	predicate, rest, ok := extWord(operand)
+	if !ok {
+		return "INVALID", 0, cpu.ErrInvalidOpcode
+	}
+	ea, _ := disassembleSD(true, opcode, 5, 1, rest)
+	s := fmt.Sprintf("fs%v.b\t%v", fpuCondition(predicate), ea)
+	return s, 2 + len(operand), nil
+}
+
+func dFTrapcc(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	predicate, rest, ok := extWord(operand)
+	if !ok {
+		return "INVALID", 0, cpu.ErrInvalidOpcode
+	}
+	mnemonic := "ftrap" + fpuCondition(predicate)
+	switch len(rest) {
+	case 2:
+		w, _, _ := extWord(rest)
+		return fmt.Sprintf("%v.w\t#%v", mnemonic, hex(int64(w))),
+			2 + len(operand), nil
+	case 4:
+		hi, lo, _ := extWord(rest)
+		w, _, _ := extWord(lo)
+		return fmt.Sprintf("%v.l\t#%v", mnemonic,
+			hex(int64(hi)<<16|int64(w))), 2 + len(operand), nil
+	}
+	return mnemonic, 2 + len(operand), nil
+}
+
+func dFsave(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	ea, _ := disassembleSD(true, opcode, 5, 4, operand)
+	return fmt.Sprintf("fsave\t%v", ea), 2 + len(operand), nil
+}
+
+func dFrestore(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	ea, _ := disassembleSD(true, opcode, 5, 4, operand)
+	return fmt.Sprintf("frestore\t%v", ea), 2 + len(operand), nil
+}
+
+func dTable(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	ext, rest, ok := extWord(operand)
+	if !ok {
+		return "INVALID", 0, cpu.ErrInvalidOpcode
+	}
+	if opcode == 0xf800 && ext == lpstopExtension {
+		w, _, ok := extWord(rest)
+		if !ok {
+			return "INVALID", 0, cpu.ErrInvalidOpcode
+		}
+		return fmt.Sprintf("lpstop\t#%v", hex(int64(w))),
+			2 + len(operand), nil
+	}
+
+	mnemonic := "tblu"
+	if ext&0x0800 != 0 {
+		mnemonic = "tbls"
+	}
+	if ext&0x0400 != 0 {
+		mnemonic += "n"
+	}
+	size := uint32(1) << (ext >> 6 & 0x03)
+	ea, _ := disassembleSD(true, opcode, 5, size, rest)
+	if opcode&0x0038 == 0 {
+		ea = fmt.Sprintf("%v:d%v", ea, ext&0x07)
+	}
+	s := fmt.Sprintf("%v%v\t%v,d%v", mnemonic, sizeSuffix(size), ea,
+		ext>>12&0x07)
+	return s, 2 + len(operand), nil
+}
+
+func dBgnd(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleImplied("bgnd", operand)
+}
+
+func dTpf(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleTrapcc("tpf", operand)
+}
+
+func dPulse(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleImplied("pulse", operand)
+}
+
+func dHalt(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	return disassembleImplied("halt", operand)
+}
+
+// dRem disassembles the ColdFire long divide.  A remainder register that
+// differs from the dividend register selects rems or remu.
+func dRem(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	ext, rest, ok := extWord(operand)
+	if !ok {
+		return "INVALID", 0, cpu.ErrInvalidOpcode
+	}
+	ea, _ := disassembleSD(true, opcode, 5, 4, rest)
+	sign := "u"
+	if ext&0x0800 != 0 {
+		sign = "s"
+	}
+	dx, dw := ext>>12&0x07, ext&0x07
+	if dx == dw {
+		return fmt.Sprintf("div%v.l\t%v,d%v", sign, ea, dx),
+			2 + len(operand), nil
+	}
+	return fmt.Sprintf("rem%v.l\t%v,d%v:d%v", sign, ea, dw, dx),
+		2 + len(operand), nil
+}
+
+// registerName returns the name of general register n where D0-D7 are 0-7
+// and A0-A7 are 8-15.
+func registerName(n uint16) string {
+	return generalRegister(n << 12)
+}
+
+// dMac disassembles the EMAC instructions.  Word operands are suffixed with
+// .u or .l for the upper or lower word, a masked address with &.
+func dMac(c *m68k, opcode uint16, operand []byte) (string, int, error) {
+	switch {
+	case opcode == 0xa9c0:
+		return disassembleImplied("move.l\tmacsr,ccr", operand)
+	case opcode&0xf9fc == 0xa110:
+		return fmt.Sprintf("move.l\tacc%v,acc%v", opcode&0x03,
+			opcode>>9&0x03), 2 + len(operand), nil
+	case opcode&0xf9f0 == 0xa1c0:
+		return fmt.Sprintf("movclr.l\tacc%v,%v", opcode>>9&0x03,
+			registerName(opcode&0x0f)), 2 + len(operand), nil
+	case opcode&0xf1f0 == 0xa180:
+		r := macRegisters[opcode>>9&0x07]
+		return fmt.Sprintf("move.l\t%v,%v", r,
+			registerName(opcode&0x0f)), 2 + len(operand), nil
+	case opcode&0xf1c0 == 0xa100:
+		src, _ := disassembleSD(true, opcode, 5, 4, operand)
+		return fmt.Sprintf("move.l\t%v,%v", src,
+			macRegisters[opcode>>9&0x07]), 2 + len(operand), nil
+	}
+
+	ext, rest, ok := extWord(operand)
+	if !ok {
+		return "INVALID", 0, cpu.ErrInvalidOpcode
+	}
+	rx := opcode>>9&0x07 | opcode>>3&0x08
+	ry := opcode & 0x0f
+	load := opcode&0x0030 != 0
+	if load {
+		rx, ry = ext>>12, ext&0x0f
+	}
+
+	mnemonic, sz := "mac", ".w"
+	if ext&0x0100 != 0 {
+		mnemonic = "msac"
+	}
+	half := func(upper bool) string {
+		if upper {
+			return ".u"
+		}
+		return ".l"
+	}
+	x, y := registerName(rx), registerName(ry)
+	if ext&0x0800 != 0 {
+		sz = ".l"
+	} else {
+		x += half(ext&0x0080 != 0)
+		y += half(ext&0x0040 != 0)
+	}
+	s := []string{x, y}
+	switch ext >> 9 & 0x03 {
+	case 0x01:
+		s = append(s, "<<1")
+	case 0x03:
+		s = append(s, ">>1")
+	}
+	if load {
+		ea, _ := disassembleSD(true, opcode, 5, 4, rest)
+		if ext&0x0020 != 0 {
+			ea += "&"
+		}
+		s = append(s, ea, registerName(opcode>>9&0x07|opcode>>3&0x08))
+	}
+	s = append(s, fmt.Sprintf("acc%v", accumulator(opcode, ext)))
+	return fmt.Sprintf("%v%v\t%v", mnemonic, sz, strings.Join(s, ",")),
+		2 + len(operand), nil
+}
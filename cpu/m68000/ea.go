@@ -0,0 +1,320 @@
+package m68000
+
+// Effective address handling.  Hooks in this file take the 6 bit MMMRRR
+// effective address field as decoded by the generator and operate at the
+// size of the instruction being executed.  Extension words are consumed from
+// the operand in the order the instruction encodes them.
+
+// signExtend sign extends v of size bytes to 32 bits.
+func signExtend(v uint32, size uint32) uint32 {
+	switch size {
+	case 1:
+		return uint32(int32(int8(v)))
+	case 2:
+		return uint32(int32(int16(v)))
+	}
+	return v
+}
+
+// mask returns the bit mask for size bytes.
+func mask(size uint32) uint32 {
+	switch size {
+	case 1:
+		return 0xff
+	case 2:
+		return 0xffff
+	}
+	return 0xffffffff
+}
+
+// msb returns the sign bit for size bytes.
+func msb(size uint32) uint32 {
+	return 1 << (size*8 - 1)
+}
+
+// extWord consumes the next extension word from operand.  It returns the
+// word and the address it was fetched from.
+func (c *m68k) extWord(operand []byte) (uint16, uint32) {
+	address := c.pc + 2 + uint32(c.ext)
+	w := uint16(operand[c.ext])<<8 | uint16(operand[c.ext+1])
+	c.ext += 2
+	return w, address
+}
+
+// extLong consumes the next two extension words from operand.
+func (c *m68k) extLong(operand []byte) uint32 {
+	hi, _ := c.extWord(operand)
+	lo, _ := c.extWord(operand)
+	return uint32(hi)<<16 | uint32(lo)
+}
+
+// increment returns the (An)+ and -(An) step for register reg.  The stack
+// pointer is always kept word aligned.
+func (c *m68k) increment(reg uint32) uint32 {
+	if reg == 7 && c.size == 1 {
+		return 2
+	}
+	return c.size
+}
+
+// index decodes an index extension word and returns base plus the sign
+// extended displacement and index register.  Models with full format
+// extension words scale the index register and decode the full format, see
+// indexFull.  The ColdFire scales long index registers by up to 4 and takes
+// the illegal instruction exception for anything else.
+func (c *m68k) index(base uint32, ext uint16, operand []byte) uint32 {
+	reg := ext >> 12 & 0x07
+	var xn uint32
+	if ext&0x8000 == 0 {
+		xn = c.d[reg]
+	} else {
+		xn = c.a[reg]
+	}
+	if c.model.longIndex {
+		if ext&0x0900 != 0x0800 || ext&0x0600 == 0x0600 {
+			c.raise(vectorIllegal, c.pc)
+		}
+		xn <<= ext >> 9 & 0x03
+		return base + signExtend(uint32(ext), 1) + xn
+	}
+	if ext&0x0800 == 0 {
+		xn = signExtend(xn, 2)
+	}
+	if !c.model.fullFormat {
+		return base + signExtend(uint32(ext), 1) + xn
+	}
+	xn <<= ext >> 9 & 0x03
+	if ext&0x0100 == 0 {
+		return base + signExtend(uint32(ext), 1) + xn
+	}
+	return c.indexFull(base, xn, ext, operand)
+}
+
+// indexFull decodes a full format extension word.  The base and index may be
+// suppressed and the base displacement and outer displacement follow the
+// extension word.  Memory indirect modes read an intermediate address either
+// before (preindexed) or after (postindexed) the index is added.  Models
+// without memory indirection take the illegal instruction exception for them.
+func (c *m68k) indexFull(base, xn uint32, ext uint16, operand []byte) uint32 {
+	if ext&0x0080 != 0 {
+		base = 0
+	}
+	if ext&0x0040 != 0 {
+		xn = 0
+	}
+	iis := ext & 0x07
+	if ext&0x0030 == 0 || iis == 0x04 || ext&0x0040 != 0 && iis > 0x04 ||
+		iis != 0 && !c.model.indirect {
+		c.raise(vectorIllegal, c.pc)
+	}
+
+	var bd, od uint32
+	switch ext >> 4 & 0x03 {
+	case 0x02:
+		w, _ := c.extWord(operand)
+		bd = signExtend(uint32(w), 2)
+	case 0x03:
+		bd = c.extLong(operand)
+	}
+	switch iis & 0x03 {
+	case 0x02:
+		w, _ := c.extWord(operand)
+		od = signExtend(uint32(w), 2)
+	case 0x03:
+		od = c.extLong(operand)
+	}
+
+	switch {
+	case iis == 0:
+		// (bd,An,Xn)
+		return base + bd + xn
+	case iis < 0x04:
+		// ([bd,An,Xn],od)
+		return c.read32(base+bd+xn) + od
+	}
+	// ([bd,An],Xn,od)
+	return c.read32(base+bd) + xn + od
+}
+
+// fullExtensionSize returns the number of bytes that follow a full format
+// extension word.
+func fullExtensionSize(ext uint16) uint32 {
+	if ext&0x0100 == 0 {
+		return 0
+	}
+	var n uint32
+	switch ext >> 4 & 0x03 {
+	case 0x02:
+		n += 2
+	case 0x03:
+		n += 4
+	}
+	switch ext & 0x03 {
+	case 0x02:
+		n += 2
+	case 0x03:
+		n += 4
+	}
+	return n
+}
+
+// operand fetches the extension words of instruction i at address.  Full
+// format extension words and coprocessor command words make the length depend
+// on the extension words themselves so they are read first.
+func (c *m68k) operand(i *instruction, address uint32) []byte {
+	n := i.operandSize
+	if c.model.fullFormat {
+		for _, offset := range i.indexes {
+			ext := c.fetch16(address + 2 + offset + n - i.operandSize)
+			n += fullExtensionSize(ext)
+		}
+	}
+	if i.extension != nil {
+		n += i.extension(c, address+2)
+	}
+	return i.fetchOperand(c, address+2, n)
+}
+
+// address calculates the effective address of a memory mode and performs the
+// (An)+ and -(An) side effects.
+func (c *m68k) address(ea uint32, operand []byte) uint32 {
+	reg := ea & 0x07
+	switch ea >> 3 {
+	case 0x02:
+		// (An)
+		return c.a[reg]
+	case 0x03:
+		// (An)+
+		address := c.a[reg]
+		c.a[reg] += c.increment(reg)
+		return address
+	case 0x04:
+		// -(An)
+		c.a[reg] -= c.increment(reg)
+		return c.a[reg]
+	case 0x05:
+		// (d16,An)
+		d16, _ := c.extWord(operand)
+		return c.a[reg] + signExtend(uint32(d16), 2)
+	case 0x06:
+		// (d8,An,Xn)
+		ext, _ := c.extWord(operand)
+		return c.index(c.a[reg], ext, operand)
+	case 0x07:
+		switch reg {
+		case 0x00:
+			// (xxx).W
+			w, _ := c.extWord(operand)
+			return signExtend(uint32(w), 2)
+		case 0x01:
+			// (xxx).L
+			return c.extLong(operand)
+		case 0x02:
+			// (d16,PC)
+			d16, pc := c.extWord(operand)
+			return pc + signExtend(uint32(d16), 2)
+		case 0x03:
+			// (d8,PC,Xn)
+			ext, pc := c.extWord(operand)
+			return c.index(pc, ext, operand)
+		}
+	}
+
+	panic("invalid effective address")
+}
+
+// immediate consumes #<data> of the current size from operand.
+func (c *m68k) immediate(operand []byte) uint32 {
+	if c.size == 4 {
+		return c.extLong(operand)
+	}
+	w, _ := c.extWord(operand)
+	return uint32(w) & mask(c.size)
+}
+
+// readSized reads size bytes from address.
+func (c *m68k) readSized(address, size uint32) uint32 {
+	switch size {
+	case 1:
+		return uint32(c.read8(address))
+	case 2:
+		return uint32(c.read16(address))
+	}
+	return c.read32(address)
+}
+
+// writeSized writes the low size bytes of value to address.
+func (c *m68k) writeSized(address, size, value uint32) {
+	switch size {
+	case 1:
+		c.write8(address, uint8(value))
+	case 2:
+		c.write16(address, uint16(value))
+	default:
+		c.write32(address, value)
+	}
+}
+
+// fetchEA returns the operand at effective address ea.  Memory addresses are
+// remembered so that a read-modify-write instruction stores to the same
+// location without repeating side effects.
+func fetchEA(c *m68k, ea uint32, operand []byte) uint32 {
+	switch ea >> 3 {
+	case 0x00:
+		return c.d[ea&0x07] & mask(c.size)
+	case 0x01:
+		return c.a[ea&0x07] & mask(c.size)
+	case 0x07:
+		if ea&0x07 == 0x04 {
+			return c.immediate(operand)
+		}
+	}
+
+	c.ea = c.address(ea, operand)
+	return c.readSized(c.ea, c.size)
+}
+
+// addressEA calculates the effective address ea for a destination that is
+// written but not read.
+func addressEA(c *m68k, ea uint32, operand []byte) uint32 {
+	if ea>>3 > 0x01 {
+		c.ea = c.address(ea, operand)
+	}
+	return 0
+}
+
+// storeEA stores intermediate to effective address ea.  Only the low size
+// bytes of a data register are modified, address registers are always
+// written in full.  Memory destinations must have been calculated by
+// fetchEA or addressEA.
+func storeEA(c *m68k, ea, intermediate uint32, operand []byte) {
+	switch ea >> 3 {
+	case 0x00:
+		m := mask(c.size)
+		c.d[ea&0x07] = c.d[ea&0x07]&^m | intermediate&m
+	case 0x01:
+		c.a[ea&0x07] = intermediate
+	default:
+		c.writeSized(c.ea, c.size, intermediate)
+	}
+}
+
+// extensionSize returns the number of extension bytes the effective address
+// mode requires.
+func extensionSize(mode, reg uint16, size uint32) uint32 {
+	switch mode {
+	case 0x05, 0x06:
+		return 2
+	case 0x07:
+		switch reg {
+		case 0x01:
+			return 4
+		case 0x04:
+			if size == 4 {
+				return 4
+			}
+		}
+		return 2
+	}
+	return 0
+}
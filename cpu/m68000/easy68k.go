@@ -0,0 +1,362 @@
+package m68000
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The EASy68K simulator provides host services to programs through TRAP #15
+// with the task number in D0.B.  EASy68K implements the text and file tasks
+// below on a TRAP #15 hook, programs written for the simulator then run
+// unchanged.  Unsupported tasks, e.g. graphics and sound, and tasks that
+// access memory outside of the bus take the TRAP #15 exception.
+//
+//	0, 1	display D1.W characters, at most 255, at (A1) with and
+//		without CR, LF
+//	2	read a line to (A1), its length to D1.W
+//	3	display D1.L as a signed decimal number
+//	4	read a decimal number to D1.L
+//	5	read a character to D1.B
+//	6	display the character in D1.B
+//	7	D1.B is 1 when input is pending, otherwise 0
+//	8	hundredths of a second since midnight to D1.L
+//	9	terminate the program
+//	11	clear the screen, D1.W = $FF00, or move the cursor to
+//		column D1.W >> 8, row D1.W & $FF
+//	12	keyboard echo, ignored since the host terminal echoes
+//	13, 14	display the string at (A1) with and without CR, LF
+//	15	display D1.L as an unsigned number in base D2.B
+//	17	display the string at (A1) followed by D1.L as in task 3
+//	18	display the string at (A1) and read a number as in task 4
+//	20	display D1.L as in task 3 right justified in D2.B columns
+//
+// The file tasks return the status in D0.W, 0 on success, 1 at the end of
+// file, 2 on error and 3 when an existing file could only be opened read
+// only.  File names are NUL terminated strings at (A1).  File tasks are only
+// available when the services are given a directory, names are relative to
+// it and may not refer outside of it.  Without a directory the file tasks
+// take the exception.
+//
+//	50	close all files
+//	51, 52	open an existing or create a new file, its ID to D1.L
+//	53	read D2.L bytes from file D1.L to (A1), the count to D2.L,
+//		a bus error ends the read with status 2
+//	54	write D2.L bytes at (A1) to file D1.L
+//	55	set the position of file D1.L to D2.L
+//	56	close file D1.L
+//	57	delete the file
+//
+// Input is line buffered, task 7 therefore only reports input that was read
+// ahead by an earlier task.
+
+// File task status in D0.W.
+const (
+	fileSuccess  = 0
+	fileEOF      = 1
+	fileError    = 2
+	fileReadOnly = 3
+)
+
+// maxString limits the strings read by the display tasks, maxCount the
+// count of tasks 0 and 1.
+const (
+	maxString = 0x10000
+	maxCount  = 255
+)
+
+// fileChunk is the size of the host buffer of the file read task.
+const fileChunk = 0x1000
+
+// easy68k holds the state of the EASy68K host services.
+type easy68k struct {
+	in    *bufio.Reader
+	out   io.Writer
+	root  *os.Root // file task directory, nil if file tasks are disabled
+	files map[uint32]*os.File
+	id    uint32 // last file ID handed out
+}
+
+// EASy68K implements the EASy68K simulator tasks on TRAP #15 with console
+// input from in and output to out.  The file tasks operate in directory dir
+// and are disabled if dir is empty.  It replaces a TRAP #15 hook.
+func (c *m68k) EASy68K(in io.Reader, out io.Writer, dir string) error {
+	s := &easy68k{
+		in:    bufio.NewReader(in),
+		out:   out,
+		files: make(map[uint32]*os.File),
+	}
+	if dir != "" {
+		root, err := os.OpenRoot(dir)
+		if err != nil {
+			return err
+		}
+		s.root = root
+	}
+	return c.HookTrap(15, s.trap)
+}
+
+// trap runs the task in D0.B.  Memory errors abort the task and take the
+// exception.
+func (s *easy68k) trap(t *Trap) (consumed bool) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		if _, ok := r.(memoryError); !ok {
+			panic(r)
+		}
+		consumed = false
+	}()
+
+	switch t.D(0) & 0xff {
+	case 0, 1:
+		n := t.D(1) & 0xffff
+		if n > maxCount {
+			n = maxCount
+		}
+		s.out.Write(s.read(t, t.A(1), n))
+		if t.D(0)&0xff == 0 {
+			io.WriteString(s.out, "\r\n")
+		}
+	case 2:
+		line := s.readLine()
+		if len(line) > 80 {
+			line = line[:80]
+		}
+		s.write(t, t.A(1), append([]byte(line), 0))
+		t.SetD(1, t.D(1)&^0xffff|uint32(len(line)))
+	case 3:
+		fmt.Fprintf(s.out, "%d", int32(t.D(1)))
+	case 4:
+		t.SetD(1, s.readNumber())
+	case 5:
+		b, err := s.in.ReadByte()
+		if err != nil {
+			b = 0
+		}
+		t.SetD(1, t.D(1)&^0xff|uint32(b))
+	case 6:
+		s.out.Write([]byte{byte(t.D(1))})
+	case 7:
+		pending := uint32(0)
+		if s.in.Buffered() > 0 {
+			pending = 1
+		}
+		t.SetD(1, t.D(1)&^0xff|pending)
+	case 8:
+		now := time.Now()
+		midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0,
+			0, 0, now.Location())
+		t.SetD(1, uint32(now.Sub(midnight)/(10*time.Millisecond)))
+	case 9:
+		s.closeAll()
+		t.Halt()
+	case 11:
+		if p := t.D(1) & 0xffff; p == 0xff00 {
+			io.WriteString(s.out, "\x1b[2J\x1b[H")
+		} else {
+			fmt.Fprintf(s.out, "\x1b[%d;%dH", p&0xff+1, p>>8+1)
+		}
+	case 12:
+	case 13, 14:
+		s.out.Write(s.readString(t, t.A(1), maxString))
+		if t.D(0)&0xff == 13 {
+			io.WriteString(s.out, "\r\n")
+		}
+	case 15:
+		base := int(t.D(2) & 0xff)
+		if base < 2 || base > 36 {
+			return false
+		}
+		io.WriteString(s.out, strings.ToUpper(
+			strconv.FormatUint(uint64(t.D(1)), base)))
+	case 17:
+		s.out.Write(s.readString(t, t.A(1), maxString))
+		fmt.Fprintf(s.out, "%d", int32(t.D(1)))
+	case 18:
+		s.out.Write(s.readString(t, t.A(1), maxString))
+		t.SetD(1, s.readNumber())
+	case 20:
+		fmt.Fprintf(s.out, "%*d", int(t.D(2)&0xff), int32(t.D(1)))
+	default:
+		status, ok := s.file(t)
+		if !ok {
+			return false
+		}
+		t.SetD(0, t.D(0)&^0xffff|uint32(status))
+	}
+	return true
+}
+
+// file runs the file task in D0.B and returns its status.  It returns false
+// when D0.B is not a file task or file tasks are disabled.
+func (s *easy68k) file(t *Trap) (uint16, bool) {
+	if s.root == nil {
+		return 0, false
+	}
+	switch t.D(0) & 0xff {
+	case 50:
+		s.closeAll()
+	case 51:
+		name := string(s.readString(t, t.A(1), maxString))
+		status := uint16(fileSuccess)
+		f, err := s.root.OpenFile(name, os.O_RDWR, 0)
+		if err != nil {
+			status = fileReadOnly
+			f, err = s.root.Open(name)
+		}
+		if err != nil {
+			return fileError, true
+		}
+		t.SetD(1, s.open(f))
+		return status, true
+	case 52:
+		name := s.readString(t, t.A(1), maxString)
+		f, err := s.root.Create(string(name))
+		if err != nil {
+			return fileError, true
+		}
+		t.SetD(1, s.open(f))
+	case 53:
+		f := s.files[t.D(1)]
+		if f == nil {
+			return fileError, true
+		}
+		n, status := s.readFile(t, f, t.A(1), t.D(2))
+		t.SetD(2, n)
+		return status, true
+	case 54:
+		f := s.files[t.D(1)]
+		if f == nil {
+			return fileError, true
+		}
+		if _, err := f.Write(s.read(t, t.A(1), t.D(2))); err != nil {
+			return fileError, true
+		}
+	case 55:
+		f := s.files[t.D(1)]
+		if f == nil {
+			return fileError, true
+		}
+		if _, err := f.Seek(int64(t.D(2)), io.SeekStart); err != nil {
+			return fileError, true
+		}
+	case 56:
+		f := s.files[t.D(1)]
+		if f == nil {
+			return fileError, true
+		}
+		delete(s.files, t.D(1))
+		if f.Close() != nil {
+			return fileError, true
+		}
+	case 57:
+		name := s.readString(t, t.A(1), maxString)
+		if s.root.Remove(string(name)) != nil {
+			return fileError, true
+		}
+	default:
+		return 0, false
+	}
+	return fileSuccess, true
+}
+
+// readFile reads up to length bytes from f to address in chunks of
+// fileChunk bytes and returns the count and the task status.  The
+// destination of a chunk is checked before it is read so that a bus error
+// does not consume data the program never receives.
+func (s *easy68k) readFile(t *Trap, f *os.File, address,
+	length uint32) (uint32, uint16) {
+	b := make([]byte, fileChunk)
+	count := uint32(0)
+	for count < length {
+		n := length - count
+		if n > fileChunk {
+			n = fileChunk
+		}
+		to := address + count
+		if _, err := t.ReadBytes(to, n); err != nil {
+			return count, fileError
+		}
+		r, err := io.ReadFull(f, b[:n])
+		t.WriteBytes(to, b[:r])
+		count += uint32(r)
+		switch err {
+		case nil:
+		case io.EOF, io.ErrUnexpectedEOF:
+			return count, fileEOF
+		default:
+			return count, fileError
+		}
+	}
+	return count, fileSuccess
+}
+
+// open returns a new file ID for f.
+func (s *easy68k) open(f *os.File) uint32 {
+	s.id++
+	s.files[s.id] = f
+	return s.id
+}
+
+// closeAll closes all open files.
+func (s *easy68k) closeAll() {
+	for id, f := range s.files {
+		f.Close()
+		delete(s.files, id)
+	}
+}
+
+// readLine returns the next line of input without its line terminator.
+func (s *easy68k) readLine() string {
+	line, _ := s.in.ReadString('\n')
+	return strings.TrimRight(line, "\r\n")
+}
+
+// readNumber reads a line of input and returns it as a decimal number, 0 if
+// it is not one.
+func (s *easy68k) readNumber() uint32 {
+	n, err := strconv.ParseInt(strings.TrimSpace(s.readLine()), 10, 32)
+	if err != nil {
+		return 0
+	}
+	return uint32(n)
+}
+
+// memoryError aborts a task that accessed memory outside of the bus.
+type memoryError struct{}
+
+// read returns length bytes at address.
+func (s *easy68k) read(t *Trap, address, length uint32) []byte {
+	b, err := t.ReadBytes(address, length)
+	if err != nil {
+		panic(memoryError{})
+	}
+	return b
+}
+
+// write stores b at address.
+func (s *easy68k) write(t *Trap, address uint32, b []byte) {
+	if t.WriteBytes(address, b) != nil {
+		panic(memoryError{})
+	}
+}
+
+// readString returns the string at address up to a NUL or max characters.
+func (s *easy68k) readString(t *Trap, address, max uint32) []byte {
+	var b []byte
+	for uint32(len(b)) < max {
+		c := s.read(t, address+uint32(len(b)), 1)[0]
+		if c == 0 {
+			break
+		}
+		b = append(b, c)
+	}
+	return b
+}
@@ -0,0 +1,304 @@
+package m68000
+
+// The ColdFire enhanced multiply-accumulate unit occupies line 1010.  It has
+// four 48 bit accumulators, a status register and a mask register that
+// limits the address updates of mac with load to implement circular
+// buffers.  Operands are 16 bit words, the upper or lower half of a
+// register, or 32 bit longs.  Integer products accumulate in the low bits of
+// an accumulator, signed fractional products are aligned so that bits 39-8
+// hold the 1.31 result.
+//
+// Accumulators are kept sign extended from 48 bits.  Integer long products
+// are truncated to 48 bits and an overflow with OMC set saturates an
+// accumulator to the limits of its 48 bit range, only moves to a register
+// saturate to 32 bits.
+
+// EMAC status register bits.
+const (
+	macsrEV   = 1 << 0 // extension overflow
+	macsrV    = 1 << 1 // overflow
+	macsrZ    = 1 << 2 // zero
+	macsrN    = 1 << 3 // negative
+	macsrRT   = 1 << 4 // round fractional moves to registers
+	macsrFI   = 1 << 5 // signed fractional mode
+	macsrSU   = 1 << 6 // unsigned integer mode
+	macsrOMC  = 1 << 7 // overflow saturation mode
+	macsrPAV0 = 1 << 8 // product accumulation overflow, PAVn is PAV0 << n
+	macsrMask = 0x0fff // implemented bits
+	accMask   = 1<<48 - 1
+)
+
+// macRegisters are the EMAC register names selected by bits 11-9 of the move
+// instructions.  Accumulators use the first four only when bit 11 is clear.
+var macRegisters = []string{"acc0", "acc1", "acc2", "acc3", "macsr",
+	"accext01", "mask", "accext23"}
+
+// accumulator returns the accumulator of a mac instruction, the low bit is in
+// bit 7 of the opcode and the high bit in bit 4 of the extension word.
+func accumulator(opcode, ext uint16) uint16 {
+	return opcode>>7&0x01 | ext>>3&0x02
+}
+
+// macOperand returns the multiplier operand of register value v.  Word
+// operands are the upper or lower word of the register.
+func (c *m68k) macOperand(v uint32, long, upper bool) int64 {
+	unsigned := c.macsr&(macsrSU|macsrFI) == macsrSU
+	switch {
+	case long && unsigned:
+		return int64(v)
+	case long:
+		return int64(int32(v))
+	case upper:
+		v >>= 16
+	}
+	if unsigned {
+		return int64(uint16(v))
+	}
+	return int64(int16(v))
+}
+
+// accumulate stores r to accumulator n and sets the EMAC status.  A result
+// outside the 48 bit range sets V and PAVn and either wraps or, with OMC
+// set, saturates.
+func (c *m68k) accumulate(n uint16, r int64) {
+	min, max := int64(-1)<<47, int64(1)<<47-1
+	unsigned := c.macsr&(macsrSU|macsrFI) == macsrSU
+	if unsigned {
+		min, max = 0, accMask
+	}
+
+	c.macsr &^= macsrN | macsrZ | macsrV | macsrEV
+	switch {
+	case r >= min && r <= max:
+	case c.macsr&macsrOMC == 0:
+		c.macsr |= macsrV | macsrPAV0<<n
+	case r < min:
+		c.macsr |= macsrV | macsrPAV0<<n
+		r = min
+	default:
+		c.macsr |= macsrV | macsrPAV0<<n
+		r = max
+	}
+	r = r << 16 >> 16
+	c.acc[n] = r
+
+	if r < 0 {
+		c.macsr |= macsrN
+	}
+	if r == 0 {
+		c.macsr |= macsrZ
+	}
+	switch {
+	case c.macsr&macsrFI != 0:
+		if r != r<<24>>24 {
+			c.macsr |= macsrEV
+		}
+	case unsigned:
+		if r&accMask > 0xffffffff {
+			c.macsr |= macsrEV
+		}
+	case r != int64(int32(r)):
+		c.macsr |= macsrEV
+	}
+}
+
+// mac multiplies Rx by Ry and adds the product to, or with MSAC in bit 8 of
+// the extension word subtracts it from, an accumulator.  Bit 11 selects long
+// operands, bits 7 and 6 the upper words of Rx and Ry and bits 10-9 shift
+// the product left (01) or right (11).  Rx and Ry are in bits 11-9 and 6, 3-0
+// of the opcode.
+//
+// The forms with a memory <ea> take Rx and Ry from the extension word and
+// load Rw, in the place of Rx in the opcode, with the long at <ea> in
+// parallel.  Bit 5 of the extension word masks the address and the address
+// register update with MASK.
+func mac(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	ext := uint16(src)
+	rx := uint32(c.ir>>9&0x07 | c.ir>>3&0x08)
+	ry := dest & 0x0f
+	load := dest>>3 > 0x01
+	if load {
+		rx, ry = src>>12, src&0x0f
+	}
+
+	var v uint32
+	if load {
+		address := c.address(dest, operand)
+		if ext&0x0020 != 0 {
+			m := c.macMask | 0xffff0000
+			address &= m
+			if mode := dest >> 3; mode == 0x03 || mode == 0x04 {
+				c.a[dest&0x07] &= m
+			}
+		}
+		v = c.read32(address)
+	}
+
+	long := ext&0x0800 != 0
+	x := c.macOperand(*c.movemRegister(rx), long, ext&0x0080 != 0)
+	y := c.macOperand(*c.movemRegister(ry), long, ext&0x0040 != 0)
+	p := x * y
+	switch {
+	case c.macsr&(macsrSU|macsrFI) == macsrSU:
+		p &= accMask
+	case c.macsr&macsrFI == 0:
+		p = p << 16 >> 16
+	case long:
+		p >>= 23
+	default:
+		p <<= 9
+	}
+	switch ext >> 9 & 0x03 {
+	case 0x01:
+		p <<= 1
+	case 0x03:
+		p >>= 1
+	}
+
+	n := accumulator(c.ir, ext)
+	a := c.acc[n]
+	if c.macsr&(macsrSU|macsrFI) == macsrSU {
+		a &= accMask
+	}
+	if ext&0x0100 != 0 {
+		c.accumulate(n, a-p)
+	} else {
+		c.accumulate(n, a+p)
+	}
+
+	if load {
+		*c.movemRegister(uint32(c.ir>>9&0x07 | c.ir>>3&0x08)) = v
+	}
+	return dest
+}
+
+// accumulatorValue returns accumulator n as moved to a register.  Fractional
+// values are bits 39-8, rounded with RT set, and OMC saturates values that
+// do not fit in 32 bits.
+func (c *m68k) accumulatorValue(n uint16) uint32 {
+	a := c.acc[n]
+	switch {
+	case c.macsr&macsrFI != 0:
+		if c.macsr&macsrRT != 0 {
+			a += 0x80
+		}
+		a >>= 8
+	case c.macsr&macsrSU != 0:
+		a &= accMask
+		if c.macsr&macsrOMC != 0 && a > 0xffffffff {
+			return 0xffffffff
+		}
+		return uint32(a)
+	}
+	if c.macsr&macsrOMC != 0 && a != int64(int32(a)) {
+		if a < 0 {
+			return 0x80000000
+		}
+		return 0x7fffffff
+	}
+	return uint32(a)
+}
+
+// accumulatorExtension returns the bits of accumulator n outside of its 32
+// bit value, bits 47-32 in integer mode and bits 47-40 and 7-0 in
+// fractional mode.
+func (c *m68k) accumulatorExtension(n uint16) uint32 {
+	a := uint64(c.acc[n])
+	if c.macsr&macsrFI != 0 {
+		return uint32(a>>32&0xff00 | a&0xff)
+	}
+	return uint32(a >> 32 & 0xffff)
+}
+
+// setAccumulatorExtension sets the bits of accumulator n outside of its 32
+// bit value, see accumulatorExtension.
+func (c *m68k) setAccumulatorExtension(n uint16, v uint32) {
+	a := c.acc[n]
+	if c.macsr&macsrFI != 0 {
+		c.acc[n] = int64(int8(v>>8))<<40 | a&0xffffffff00 |
+			int64(v&0xff)
+		return
+	}
+	c.acc[n] = int64(int16(v))<<32 | a&0xffffffff
+}
+
+// macRegister returns EMAC register r, numbered as in macRegisters, as moved
+// to a general register.
+func (c *m68k) macRegister(r uint16) uint32 {
+	switch r {
+	case 0x04:
+		return c.macsr
+	case 0x05:
+		return c.accumulatorExtension(1)<<16 | c.accumulatorExtension(0)
+	case 0x06:
+		return c.macMask | 0xffff0000
+	case 0x07:
+		return c.accumulatorExtension(3)<<16 | c.accumulatorExtension(2)
+	}
+	return c.accumulatorValue(r)
+}
+
+// setMacRegister loads EMAC register r, numbered as in macRegisters.  The
+// upper word of MASK always reads as ones.  Integer accumulators are
+// loaded sign or zero extended and fractional accumulators with the value
+// in bits 39-8, loading an accumulator clears its PAV bit.
+func (c *m68k) setMacRegister(r uint16, v uint32) {
+	switch r {
+	case 0x04:
+		c.macsr = v & macsrMask
+	case 0x05:
+		c.setAccumulatorExtension(0, v)
+		c.setAccumulatorExtension(1, v>>16)
+	case 0x06:
+		c.macMask = v
+	case 0x07:
+		c.setAccumulatorExtension(2, v)
+		c.setAccumulatorExtension(3, v>>16)
+	default:
+		switch {
+		case c.macsr&macsrFI != 0:
+			c.acc[r] = int64(int32(v)) << 8
+		case c.macsr&macsrSU != 0:
+			c.acc[r] = int64(v)
+		default:
+			c.acc[r] = int64(int32(v))
+		}
+		c.macsr &^= macsrPAV0 << r
+	}
+}
+
+// moveToMac loads the EMAC register in bits 11-9 with Ry or #<data>.
+func moveToMac(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	c.setMacRegister(c.ir>>9&0x07, src)
+	return dest
+}
+
+// moveFromMac stores the EMAC register in bits 11-9 to Rx in bits 3-0.
+func moveFromMac(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	*c.movemRegister(uint32(c.ir & 0x0f)) = c.macRegister(c.ir >> 9 & 0x07)
+	return dest
+}
+
+// movclr stores the accumulator in bits 10-9 to Rx and clears it.
+func movclr(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	n := c.ir >> 9 & 0x03
+	*c.movemRegister(uint32(c.ir & 0x0f)) = c.accumulatorValue(n)
+	c.acc[n] = 0
+	c.macsr &^= macsrPAV0 << n
+	return dest
+}
+
+// moveAccumulator copies accumulator y in bits 1-0 to x in bits 10-9.
+func moveAccumulator(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	x, y := c.ir>>9&0x03, c.ir&0x03
+	c.acc[x] = c.acc[y]
+	c.macsr = c.macsr&^(macsrPAV0<<x) | c.macsr&(macsrPAV0<<y)>>y<<x
+	return dest
+}
+
+// moveMacsrToCCR copies the EMAC N, Z, V and EV flags to N, Z, V and C and
+// clears X.
+func moveMacsrToCCR(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	c.sr = c.sr&^ccrMask | uint16(c.macsr&0x0f)
+	return dest
+}
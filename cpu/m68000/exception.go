@@ -0,0 +1,458 @@
+package m68000
+
+import "github.com/marcopeereboom/byo/cpu"
+
+// Exception vector numbers.
+const (
+	vectorBusError      = 2
+	vectorAddressError  = 3
+	vectorIllegal       = 4
+	vectorZeroDivide    = 5
+	vectorCHK           = 6
+	vectorTRAPV         = 7
+	vectorPrivilege     = 8
+	vectorTrace         = 9
+	vectorLineA         = 10
+	vectorLineF         = 11
+	vectorFormatError   = 14
+	vectorUninitialized = 15
+	vectorSpurious      = 24
+	vectorAutovector    = 24 // level n uses vectorAutovector + n
+	vectorTrap          = 32 // TRAP #n uses vectorTrap + n
+)
+
+// Access information word of the group 0 stack frame.  The low three bits
+// contain the function code.
+const (
+	accessRead           = 1 << 4 // R/W, set for a read cycle
+	accessNotInstruction = 1 << 3 // I/N, set when not an instruction fetch
+
+	functionUserData          = 1
+	functionUserProgram       = 2
+	functionSupervisorData    = 5
+	functionSupervisorProgram = 6
+)
+
+// exception aborts the instruction being executed and starts exception
+// processing.  It is raised with panic and recovered by Step which ensures
+// that no further state is modified by the aborted instruction.
+type exception struct {
+	vector uint32
+	pc     uint32 // program counter to stack
+
+	// access address of group 0 exceptions, otherwise the address of the
+	// instruction that caused the exception
+	address uint32
+
+	// group 0 only
+	access uint16 // access information word
+}
+
+// group returns the exception group of vector.  Group 0 exceptions abort the
+// current bus cycle, group 1 exceptions abort the current instruction and
+// group 2 exceptions occur as part of normal instruction execution.
+func group(vector uint32) int {
+	switch vector {
+	case 0, 1, vectorBusError, vectorAddressError:
+		return 0
+	case vectorZeroDivide, vectorCHK, vectorTRAPV:
+		return 2
+	}
+	if vector >= vectorTrap && vector < vectorTrap+16 {
+		return 2
+	}
+	return 1
+}
+
+// raise aborts the current instruction and takes vector.
+func (c *m68k) raise(vector, pc uint32) {
+	panic(exception{vector: vector, pc: pc, address: c.pc})
+}
+
+// unimplemented raises the exception for an unimplemented opcode.  The line 1010
+// and line 1111 opcodes have their own vectors so that they can be emulated in
+// software.
+func (c *m68k) unimplemented(opcode uint16) {
+	switch opcode >> 12 {
+	case 0xa:
+		c.raise(vectorLineA, c.pc)
+	case 0xf:
+		c.raise(vectorLineF, c.pc)
+	}
+	c.raise(vectorIllegal, c.pc)
+}
+
+// privileged raises a privilege violation if the CPU is in user mode.
+func (c *m68k) privileged() {
+	if c.sr&supervisor == 0 {
+		c.raise(vectorPrivilege, c.pc)
+	}
+}
+
+// setSR sets the status register and switches stacks when the supervisor
+// or master bit changes.  The M bit only exists on models with a master stack
+// and models with a single stack never switch.
+func (c *m68k) setSR(sr uint16) {
+	sr &= srMask
+	if !c.model.master {
+		sr &^= master
+	}
+	if old, sp := c.stack(c.sr), c.stack(sr); old != sp &&
+		!c.model.singleStack {
+		*old = c.a[7]
+		c.a[7] = *sp
+	}
+	c.sr = sr
+}
+
+// stack returns the register that holds the stack pointer selected by sr
+// while it is not the active stack pointer in A7.
+func (c *m68k) stack(sr uint16) *uint32 {
+	switch {
+	case sr&supervisor == 0:
+		return &c.usp
+	case sr&master != 0:
+		return &c.msp
+	}
+	return &c.ssp
+}
+
+// stackPointer returns the register that holds the stack pointer selected by
+// sr, A7 if it is the active one.
+func (c *m68k) stackPointer(sr uint16) *uint32 {
+	if c.stack(sr) == c.stack(c.sr) {
+		return &c.a[7]
+	}
+	return c.stack(sr)
+}
+
+// push16 pushes a word onto the active stack.
+func (c *m68k) push16(v uint16) {
+	c.a[7] -= 2
+	c.write16(c.a[7], v)
+}
+
+// push32 pushes a long onto the active stack.
+func (c *m68k) push32(v uint32) {
+	c.a[7] -= 4
+	c.write32(c.a[7], v)
+}
+
+// pop16 pops a word from the active stack.
+func (c *m68k) pop16() uint16 {
+	v := c.read16(c.a[7])
+	c.a[7] += 2
+	return v
+}
+
+// pop32 pops a long from the active stack.
+func (c *m68k) pop32() uint32 {
+	v := c.read32(c.a[7])
+	c.a[7] += 4
+	return v
+}
+
+// process performs exception processing.  The status register is copied,
+// the CPU enters supervisor mode, the program counter and the copy of the
+// status register are stacked and execution continues at the vector.  Group 0
+// exceptions additionally stack the instruction register, the access address
+// and the access information word.  Models with format words stack the frames
+// described in frame, frame8, frameA, frameC and frameColdFire instead.
+//
+// An address or bus error while processing a group 0 exception is a double
+// fault which halts the CPU.  Any other exception raised while stacking is
+// processed in place of e.
+func (c *m68k) process(e exception) (err error) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		f, ok := r.(exception)
+		if !ok {
+			panic(r)
+		}
+		if group(e.vector) == 0 {
+			c.state = cpu.Halted
+			err = cpu.ErrHalted
+			return
+		}
+		err = c.process(f)
+	}()
+
+	switch group(e.vector) {
+	case 0:
+		c.cycles = cyclesGroup0
+	case 1:
+		c.cycles = cyclesGroup1
+	}
+
+	c.flush()
+	pc := c.pc
+	sr := c.sr
+	c.setSR(c.sr&^trace | supervisor)
+	switch {
+	case group(e.vector) != 0:
+		c.frame(sr, e.pc, e.vector, e.address)
+	case c.model.frames == frames68010:
+		c.frame8(sr, pc, e)
+	case c.model.frames == frames68020:
+		c.frameA(sr, pc, e)
+	case c.model.frames == framesCPU32:
+		c.frameC(sr, pc, e)
+	case c.model.frames == framesColdFire:
+		c.frameColdFire(sr, pc, e.vector, faultStatus(e.access))
+	default:
+		c.push32(e.pc)
+		c.push16(sr)
+		c.push16(c.ir)
+		c.push32(e.address)
+		c.push16(e.access)
+	}
+	c.pc = c.read32(c.vbr + e.vector*4)
+	return nil
+}
+
+// frame pushes the exception stack frame of all but group 0 exceptions.
+// Models with format words push format 0 and the vector offset below the
+// program counter.  The 68020 and CPU32 push format 2 with the address of
+// the instruction that caused a CHK, TRAPV, TRAPcc, trace or divide by zero
+// exception instead.  The ColdFire pushes the frame of frameColdFire.
+func (c *m68k) frame(sr uint16, pc, vector, address uint32) {
+	if c.model.frames == framesColdFire {
+		c.frameColdFire(sr, pc, vector, 0)
+		return
+	}
+	format := uint16(0)
+	if c.model.frames == frames68020 || c.model.frames == framesCPU32 {
+		switch vector {
+		case vectorZeroDivide, vectorCHK, vectorTRAPV, vectorTrace:
+			format = 0x2
+			c.push32(address)
+		}
+	}
+	if c.model.frames != frames68000 {
+		c.push16(format<<12 | uint16(vector*4))
+	}
+	c.push32(pc)
+	c.push16(sr)
+}
+
+// frameLength returns the length of an exception stack frame of format and
+// the offset of the address of the faulted instruction in it, 0 if there is
+// none.  The length is 0 for formats the model does not use.
+func (c *m68k) frameLength(format uint16) (uint32, uint32) {
+	switch c.model.frames {
+	case frames68010:
+		switch format {
+		case 0x0:
+			return 8, 0
+		case 0x8:
+			return 58, 26
+		}
+	case frames68020:
+		switch format {
+		case 0x0, 0x1:
+			return 8, 0
+		case 0x2:
+			return 12, 0
+		case 0xa:
+			return 32, 20
+		}
+	case framesCPU32:
+		switch format {
+		case 0x0:
+			return 8, 0
+		case 0x2:
+			return 12, 0
+		case 0xc:
+			return 24, 16
+		}
+	}
+	return 0, 0
+}
+
+// Special status word of the 68010 bus and address error frame.
+const (
+	sswIF = 1 << 13 // instruction fetch
+	sswDF = 1 << 12 // data fetch
+	sswRW = 1 << 8  // read cycle
+)
+
+// frame8 pushes the 29 word 68010 bus and address error frame, format 8.  The
+// 68010 stacks its internal state so that RTE can continue the faulted bus
+// cycle.  Instructions are aborted instead, therefore the first internal word
+// pair holds the address of the faulted instruction which RTE restarts.
+func (c *m68k) frame8(sr uint16, pc uint32, e exception) {
+	ssw := e.access & 0x07
+	switch {
+	case e.access&accessRead == 0:
+	case e.access&accessNotInstruction == 0:
+		ssw |= sswRW | sswIF
+	default:
+		ssw |= sswRW | sswDF
+	}
+
+	c.a[7] -= 32
+	c.write32(c.a[7], pc) // internal information
+	c.push16(c.ir)        // instruction input buffer
+	c.push16(0)
+	c.push16(0) // data input buffer
+	c.push16(0)
+	c.push16(0) // data output buffer
+	c.push16(0)
+	c.push32(e.address)
+	c.push16(ssw)
+	c.push16(0x8000 | uint16(e.vector*4))
+	c.push32(e.pc)
+	c.push16(sr)
+}
+
+// Special status word of the 68020 short bus cycle fault frame.
+const (
+	sswStageB    = 1 << 14 // fault on instruction pipe stage B
+	sswRerunB    = 1 << 12 // rerun stage B
+	sswDataFault = 1 << 8  // data cycle fault
+	sswRead      = 1 << 6  // read cycle
+)
+
+// frameA pushes the 16 word 68020 short bus cycle fault frame, format A, for
+// bus and address errors.  Like frame8 it holds the address of the faulted
+// instruction in the internal registers so that RTE restarts it.
+func (c *m68k) frameA(sr uint16, pc uint32, e exception) {
+	ssw := e.access & 0x07
+	switch {
+	case e.access&accessNotInstruction == 0:
+		ssw |= sswStageB | sswRerunB
+	case e.access&accessRead != 0:
+		ssw |= sswDataFault | sswRead
+	default:
+		ssw |= sswDataFault
+	}
+
+	c.push32(0)
+	c.push32(0)         // data output buffer
+	c.push32(pc)        // internal registers
+	c.push32(e.address) // data cycle fault address
+	c.push16(0)         // instruction pipe stage B
+	c.push16(c.ir)      // instruction pipe stage C
+	c.push16(ssw)
+	c.push16(0)
+	c.push16(0xa000 | uint16(e.vector*4))
+	c.push32(e.pc)
+	c.push16(sr)
+}
+
+// Special status word of the CPU32 bus error frame.  The read cycle bit is
+// sswRead.
+const sswInstruction = 1 << 7 // instruction fetch
+
+// frameC pushes the 12 word CPU32 bus error frame, format C, for bus and
+// address errors.  The current instruction program counter holds the address
+// of the faulted instruction which RTE restarts.
+func (c *m68k) frameC(sr uint16, pc uint32, e exception) {
+	ssw := e.access & 0x07
+	if e.access&accessRead != 0 {
+		ssw |= sswRead
+	}
+	if e.access&accessNotInstruction == 0 {
+		ssw |= sswInstruction
+	}
+
+	c.push16(ssw)
+	c.push16(0)         // transfer count
+	c.push32(pc)        // current instruction program counter
+	c.push32(0)         // data output buffer
+	c.push32(e.address) // fault address
+	c.push16(0xc000 | uint16(e.vector*4))
+	c.push32(e.pc)
+	c.push16(sr)
+}
+
+// Fault status of the ColdFire exception stack frame.
+const (
+	fsInstruction = 0x4 // error on instruction fetch
+	fsWrite       = 0x8 // error on operand write
+	fsRead        = 0xc // error on operand read
+)
+
+// frameColdFire pushes the two long ColdFire exception stack frame.  The
+// stack pointer is first aligned to a long and the format, 4-7, records by
+// how much.  The fault status of access and address errors is split around
+// the vector offset in the format word, the program counter is that of the
+// faulted instruction.
+func (c *m68k) frameColdFire(sr uint16, pc, vector uint32, fs uint16) {
+	format := 4 + uint16(c.a[7]&0x03)
+	c.a[7] &^= 0x03
+	c.push32(pc)
+	c.push16(sr)
+	c.push16(format<<12 | fs>>2<<10 | uint16(vector*4) | fs&0x03)
+}
+
+// trace takes the trace exception after the traced instruction at address
+// completed.  The exception time is added to the instruction time and a
+// stopped CPU resumes execution.
+func (c *m68k) trace(address uint32) error {
+	cycles := c.cycles
+	c.state = cpu.Running
+	err := c.process(exception{vector: vectorTrace, pc: c.pc,
+		address: address})
+	c.cycles += cycles
+	return err
+}
+
+// pending returns the highest requested interrupt level.
+func (c *m68k) pending() int {
+	for level := 7; level > 0; level-- {
+		if c.irq[level] != nil {
+			return level
+		}
+	}
+	return 0
+}
+
+// acknowledge runs the interrupt acknowledge cycle for level and returns the
+// vector number.
+func (c *m68k) acknowledge(level int) uint32 {
+	switch v := c.irq[level].Acknowledge(level); v {
+	case int(cpu.Autovector):
+		return vectorAutovector + uint32(level)
+	case int(cpu.Spurious):
+		return vectorSpurious
+	default:
+		return uint32(v) & 0xff
+	}
+}
+
+// interrupt takes the highest pending interrupt when its level is above the
+// interrupt mask.  A level 7 interrupt is taken on every transition to level 7
+// regardless of the mask.  The mask is raised to the level of the interrupt.
+// An interrupt taken on the master stack clears the M bit and pushes a format
+// 1 throwaway frame onto the interrupt stack.
+func (c *m68k) interrupt() bool {
+	level := c.pending()
+	switch {
+	case c.nmi && level == 7:
+		c.nmi = false
+	case level > int(c.sr&interruptMask>>8):
+	default:
+		return false
+	}
+
+	c.cycles = cyclesInterrupt
+	c.flush()
+	c.state = cpu.Running
+	vector := c.acknowledge(level)
+	sr := c.sr
+	c.setSR(c.sr&^(trace|interruptMask) | supervisor | uint16(level)<<8)
+	c.frame(sr, c.pc, vector, 0)
+	if c.sr&master != 0 {
+		sr = c.sr
+		c.setSR(c.sr &^ master)
+		c.push16(0x1000 | uint16(vector*4))
+		c.push32(c.pc)
+		c.push16(sr)
+	}
+	c.pc = c.read32(c.vbr + vector*4)
+	return true
+}
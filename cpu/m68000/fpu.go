@@ -0,0 +1,328 @@
+package m68000
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/marcopeereboom/byo/cpu/m68881"
+)
+
+// The 68020 coprocessor interface runs the coprocessor protocol in microcode
+// whenever it decodes a line 1111 instruction.  Only coprocessor ID 1, the
+// 68881 or 68882 floating point unit, is supported.  The CPU decodes the
+// instruction, calculates the effective address and transfers the operand
+// while the FPU interprets the command word, see m68881.FPU.  Line 1111
+// instructions for other coprocessors or without an attached FPU take the
+// line 1111 emulator exception.
+//
+// Floating point exceptions are taken once the instruction completed with
+// the program counter of the next instruction stacked.  Invalid command
+// words, invalid effective addresses for the command and BSUN are taken
+// before the instruction with its own address stacked.
+
+var (
+	// patternsFPU describes the floating point coprocessor instructions.
+	patternsFPU = []pattern{
+		{mask: 0xffc0, match: 0xf200, ea: eaAll, cycles: tEA(56, 56),
+			gen: genGeneral},
+		{mask: 0xfff8, match: 0xf248, size: 2, cycles: tFixed(20),
+			gen: genFDbcc},
+		{mask: 0xffff, match: 0xf27a, size: 2, cycles: tFixed(20),
+			gen: genFTrapcc},
+		{mask: 0xffff, match: 0xf27b, size: 4, cycles: tFixed(20),
+			gen: genFTrapcc},
+		{mask: 0xffff, match: 0xf27c, cycles: tFixed(20),
+			gen: genFTrapcc},
+		{mask: 0xffc0, match: 0xf240, ea: eaDataAlterable, size: 1,
+			cycles: tEA(20, 20), gen: genFScc},
+		{mask: 0xffc0, match: 0xf280, size: 2, cycles: tFixed(20),
+			gen: genImmediateWord(coprocessor(fbcc), dFBcc)},
+		{mask: 0xffc0, match: 0xf2c0, size: 4, cycles: tFixed(20),
+			gen: genImmediateWord(coprocessor(fbcc), dFBcc)},
+		{mask: 0xffc0, match: 0xf300, ea: eaControlAlterable | eaPd,
+			privileged: true, cycles: tEA(24, 24),
+			gen: genState(coprocessor(fsave), dFsave)},
+		{mask: 0xffc0, match: 0xf340, ea: eaControl | eaPi,
+			privileged: true, cycles: tEA(24, 24),
+			gen: genState(coprocessor(frestore), dFrestore)},
+	}
+
+	ErrNoCoprocessor = errors.New("model has no coprocessor interface")
+)
+
+// AttachFPU connects f to the coprocessor interface as coprocessor ID 1.
+// Models without the coprocessor interface return ErrNoCoprocessor, they
+// reach an FPU through its memory mapped interface registers instead, see
+// m68881.NewInterface.
+func (c *m68k) AttachFPU(f *m68881.FPU) error {
+	if !c.model.coprocessor {
+		return ErrNoCoprocessor
+	}
+	c.fpu = f
+	return nil
+}
+
+// genGeneral generates the general coprocessor instructions.  The command
+// word precedes the extension words of <ea>.  The length of an immediate
+// operand depends on the data format of the command.
+func genGeneral(opcode uint16, size uint32) instruction {
+	i := genMovem(coprocessor(general), dGeneral)(opcode, size)
+	if m, r := mr(opcode, 5); m == 0x07 && r == 0x04 {
+		i.operandSize = 2
+		i.extension = immediateLength
+	}
+	return i
+}
+
+// immediateLength returns the length of the immediate operand that follows
+// the command word at address.  Bytes are held in a word.
+func immediateLength(c *m68k, address uint32) uint32 {
+	command := c.fetch16(address)
+	direction, size, err := m68881.Operand(command)
+	switch {
+	case err != nil, direction != m68881.In:
+		return 0
+	case size == 1:
+		return 2
+	}
+	return size
+}
+
+// genFDbcc generates fdbcc Dn,<label>.  The predicate word precedes the
+// displacement.
+func genFDbcc(opcode uint16, size uint32) instruction {
+	i := genDbcc(opcode, size)
+	i.disassemble = dFDbcc
+	i.operandSize = 4
+	i.fetchSource = fetchWord
+	i.execute = coprocessor(fdbcc)
+	return i
+}
+
+// genFTrapcc generates ftrapcc with an optional word or long operand
+// following the predicate word.
+func genFTrapcc(opcode uint16, size uint32) instruction {
+	i := genWord(coprocessor(ftrapcc), dFTrapcc)(opcode, size)
+	i.operandSize = 2 + size
+	return i
+}
+
+// genFScc generates fscc <ea>.  The predicate word precedes the extension
+// words of <ea>.
+func genFScc(opcode uint16, size uint32) instruction {
+	i := genMovem(coprocessor(fscc), dFScc)(opcode, size)
+	i.fetchDestination = addressEA
+	i.storeDestination = storeEA
+	return i
+}
+
+// genState returns a generator for fsave and frestore which calculate <ea>
+// themselves as the length of the state frame is only known at run time.
+func genState(execute executer, disassemble disassembler) generator {
+	return func(opcode uint16, size uint32) instruction {
+		i := genMovem(execute, disassemble)(opcode, size)
+		i.operandSize -= 2
+		i.fetchOperand = operandFetcher(i.operandSize)
+		i.fetchSource = fetchNop
+		return i
+	}
+}
+
+// coprocessor returns execute as a coprocessor instruction which takes the
+// line 1111 emulator exception when no FPU is attached.
+func coprocessor(execute executer) executer {
+	return func(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+		if c.fpu == nil {
+			c.raise(vectorLineF, c.pc)
+		}
+		return execute(c, src, dest, operand)
+	}
+}
+
+// fpuOperand returns true if the effective address ea can hold the size byte
+// operand of command.  Data registers hold operands of up to a long, address
+// registers only FPIAR.  Register lists are moved from memory with (An)+ or a
+// control mode and to memory with -(An) for the predecrement form of the list
+// or a control alterable mode.
+func fpuOperand(command uint16, direction m68881.Direction, size,
+	ea uint32) bool {
+
+	class := command >> 13
+	switch m := ea >> 3; {
+	case direction == m68881.None:
+		return true
+	case m == 0x00:
+		return size <= 4 && class < 0x6
+	case m == 0x01:
+		return class >= 0x4 && class <= 0x5 && command&0x1c00 == 0x0400
+	case class == 0x6:
+		return m != 0x04 && ea != 0x3c
+	case class == 0x7:
+		predecrement := command&0x1000 == 0
+		return (m == 0x04) == predecrement && m != 0x03 && ea < 0x3a
+	case direction == m68881.Out:
+		return ea < 0x3a
+	}
+	return true
+}
+
+// general executes a general coprocessor instruction.  Dynamic k-factors and
+// register lists are read from the data register named by the command.
+func general(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	command := uint16(src)
+	if n, ok := m68881.Dynamic(command); ok {
+		command = m68881.Static(command, c.d[n])
+	}
+	direction, size, err := m68881.Operand(command)
+	if err != nil || !fpuOperand(command, direction, size, dest) {
+		c.raise(vectorLineF, c.pc)
+	}
+
+	var in []byte
+	if direction == m68881.In {
+		in = c.readOperand(dest, size, operand)
+	}
+	out, vector := c.fpu.Execute(command, c.pc, in)
+	if direction == m68881.Out {
+		c.writeOperand(dest, out, operand)
+	}
+	if vector != 0 {
+		c.raise(vector, c.next(operand))
+	}
+	return dest
+}
+
+// readOperand reads the size byte FPU operand at ea.  Registers hold the
+// operand in their low bytes and immediate bytes are held in a word.
+func (c *m68k) readOperand(ea, size uint32, operand []byte) []byte {
+	v := make([]byte, 4)
+	switch ea >> 3 {
+	case 0x00:
+		binary.BigEndian.PutUint32(v, c.d[ea&0x07])
+		return v[4-size:]
+	case 0x01:
+		binary.BigEndian.PutUint32(v, c.a[ea&0x07])
+		return v
+	}
+	if ea == 0x3c {
+		n := immediateLength(c, c.pc+2)
+		v = operand[c.ext : c.ext+int(n)]
+		c.ext += int(n)
+		return v[n-size:]
+	}
+
+	c.size = size
+	address := c.address(ea, operand)
+	access := accessRead | accessNotInstruction | c.functionCode(false)
+	c.align(address, access)
+	return c.load(address, uint64(size), access)
+}
+
+// writeOperand writes the FPU operand v to ea.  Only the low bytes of a data
+// register are modified.
+func (c *m68k) writeOperand(ea uint32, v []byte, operand []byte) {
+	size := uint32(len(v))
+	switch ea >> 3 {
+	case 0x00:
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint32(b, c.d[ea&0x07])
+		copy(b[4-size:], v)
+		c.d[ea&0x07] = binary.BigEndian.Uint32(b)
+		return
+	case 0x01:
+		c.a[ea&0x07] = binary.BigEndian.Uint32(v)
+		return
+	}
+
+	c.size = size
+	address := c.address(ea, operand)
+	c.writeBytes(address, v)
+}
+
+// writeBytes writes v to address.
+func (c *m68k) writeBytes(address uint32, v []byte) {
+	access := accessNotInstruction | c.functionCode(false)
+	c.align(address, access)
+	c.store(address, v, access)
+}
+
+// fpuCondition evaluates an FPU conditional predicate.  An enabled BSUN
+// exception is taken before the instruction.
+func (c *m68k) fpuCondition(predicate uint16) bool {
+	result, vector := c.fpu.Condition(predicate)
+	if vector != 0 {
+		c.raise(vector, c.pc)
+	}
+	return result
+}
+
+// fbcc branches if the predicate in bits 5-0 is true.  The displacement is
+// relative to the extension word.
+func fbcc(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	if c.fpuCondition(c.ir & 0x3f) {
+		c.jump(c.pc + 2 + signExtend(src, c.size))
+	}
+	return dest
+}
+
+// fdbcc decrements and branches until the predicate in the first extension
+// word is true.  The displacement is relative to its extension word.
+func fdbcc(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	disp, address := c.extWord(operand)
+	if c.fpuCondition(uint16(src)) {
+		return dest
+	}
+	dest = (dest - 1) & 0xffff
+	if dest != 0xffff {
+		c.jump(address + signExtend(uint32(disp), 2))
+	}
+	return dest
+}
+
+// fscc sets the byte at <ea> if the predicate is true and clears it
+// otherwise.
+func fscc(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	if c.fpuCondition(uint16(src)) {
+		return 0xff
+	}
+	return 0x00
+}
+
+// ftrapcc takes the TRAPV exception if the predicate is true.  The optional
+// operand is ignored.
+func ftrapcc(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	if c.fpuCondition(uint16(src)) {
+		c.cycles += cyclesTRAPV
+		c.raise(vectorTRAPV, c.next(operand))
+	}
+	return dest
+}
+
+// fsave saves the FPU state frame to <ea>.
+func fsave(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	frame := c.fpu.Save()
+	c.size = uint32(len(frame))
+	c.writeBytes(c.address(dest, operand), frame)
+	return dest
+}
+
+// frestore restores the FPU state frame at <ea>.  An invalid frame takes the
+// format error exception and leaves the address register of (An)+ unchanged.
+func frestore(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	var address uint32
+	if dest>>3 == 0x03 {
+		address = c.a[dest&0x07]
+	} else {
+		address = c.address(dest, operand)
+	}
+	size := c.fpu.FrameSize(c.read32(address))
+	access := accessRead | accessNotInstruction | c.functionCode(false)
+	frame := c.load(address, uint64(size), access)
+	if vector := c.fpu.Restore(frame); vector != 0 {
+		c.raise(vector, c.pc)
+	}
+	if dest>>3 == 0x03 {
+		c.a[dest&0x07] += size
+	}
+	return dest
+}
@@ -0,0 +1,172 @@
+package m68000
+
+import (
+	"errors"
+
+	"github.com/marcopeereboom/byo/cpu"
+)
+
+// Hooks let the embedding program emulate line 1010 and line 1111 opcodes
+// and TRAP #n instructions in Go, e.g. to implement operating system calls
+// without guest code.  A hook runs in place of exception processing when an
+// instruction raises the line 1010, line 1111 or TRAP #n exception.  It
+// sees the registers as they were before the instruction, with the program
+// counter past the opcode word, and either consumes the instruction or lets
+// the CPU take the exception through the guest vector.  Instructions longer
+// than a word, e.g. coprocessor instructions without a coprocessor, must
+// set the program counter when they are consumed.
+//
+// Only opcodes that take the exception reach a hook, line 1111 instructions
+// executed by an attached coprocessor do not.  A consumed instruction takes
+// the time of the exception it replaces and is traced like any other
+// instruction.
+
+var (
+	ErrTrapNumber = errors.New("invalid trap number")
+	ErrAccessSize = errors.New("invalid access size")
+)
+
+// Hook emulates the instruction that raised the exception of t.  It returns
+// true when it consumed the instruction and false to take the exception.
+type Hook func(t *Trap) bool
+
+// Trap gives a hook access to the CPU that raised the exception.  Registers
+// may be read and written, memory is accessed through the bus without
+// address translation or function codes.
+type Trap struct {
+	Opcode uint16 // opcode of the trapping instruction
+	Vector int    // exception vector number, e.g. 32 + n for TRAP #n
+
+	c *m68k
+}
+
+// HookLineA sets the hook for line 1010 opcodes, nil removes it.
+func (c *m68k) HookLineA(h Hook) {
+	c.hooks[vectorLineA] = h
+}
+
+// HookLineF sets the hook for line 1111 opcodes, nil removes it.
+func (c *m68k) HookLineF(h Hook) {
+	c.hooks[vectorLineF] = h
+}
+
+// HookTrap sets the hook for TRAP #n, nil removes it.
+func (c *m68k) HookTrap(n int, h Hook) error {
+	if n < 0 || n > 15 {
+		return ErrTrapNumber
+	}
+	c.hooks[vectorTrap+n] = h
+	return nil
+}
+
+// emulate runs the hook for exception e and returns true when it consumed
+// the instruction.  The program counter is advanced past the opcode before
+// the hook runs.
+func (c *m68k) emulate(e exception) bool {
+	if e.vector >= uint32(len(c.hooks)) || c.hooks[e.vector] == nil {
+		return false
+	}
+	if group(e.vector) == 1 {
+		c.cycles = cyclesGroup1
+	}
+
+	pc := c.pc
+	c.pc = e.address + 2
+	t := Trap{Opcode: c.ir, Vector: int(e.vector), c: c}
+	if !c.hooks[e.vector](&t) {
+		c.pc = pc
+		return false
+	}
+	c.flush()
+	return true
+}
+
+// D returns data register n.
+func (t *Trap) D(n int) uint32 {
+	return t.c.d[n&0x07]
+}
+
+// SetD sets data register n.
+func (t *Trap) SetD(n int, v uint32) {
+	t.c.d[n&0x07] = v
+}
+
+// A returns address register n, A7 is the active stack pointer.
+func (t *Trap) A(n int) uint32 {
+	return t.c.a[n&0x07]
+}
+
+// SetA sets address register n, A7 is the active stack pointer.
+func (t *Trap) SetA(n int, v uint32) {
+	t.c.a[n&0x07] = v
+}
+
+// SR returns the status register.
+func (t *Trap) SR() uint16 {
+	return t.c.sr
+}
+
+// SetSR sets the status register and switches stacks as needed.
+func (t *Trap) SetSR(sr uint16) {
+	t.c.setSR(sr)
+}
+
+// PC returns the program counter, initially the address of the word after
+// the opcode.
+func (t *Trap) PC() uint32 {
+	return t.c.pc
+}
+
+// SetPC sets the address execution continues at when the hook consumes the
+// instruction, e.g. to skip inline parameters.
+func (t *Trap) SetPC(pc uint32) {
+	t.c.pc = pc
+}
+
+// Read returns the byte, word or long of size at address.
+func (t *Trap) Read(address, size uint32) (uint32, error) {
+	switch size {
+	case 1, 2, 4:
+	default:
+		return 0, ErrAccessSize
+	}
+	b, err := t.ReadBytes(address, size)
+	if err != nil {
+		return 0, err
+	}
+	v := uint32(0)
+	for _, x := range b {
+		v = v<<8 | uint32(x)
+	}
+	return v, nil
+}
+
+// Write stores the byte, word or long v of size at address.
+func (t *Trap) Write(address, size, v uint32) error {
+	switch size {
+	case 1, 2, 4:
+	default:
+		return ErrAccessSize
+	}
+	b := make([]byte, size)
+	for k := range b {
+		b[k] = byte(v >> (8 * (size - 1 - uint32(k))))
+	}
+	return t.WriteBytes(address, b)
+}
+
+// ReadBytes returns length bytes at address.
+func (t *Trap) ReadBytes(address, length uint32) ([]byte, error) {
+	return t.c.bus.Read(t.c.physical(address), uint64(length))
+}
+
+// WriteBytes stores b at address.
+func (t *Trap) WriteBytes(address uint32, b []byte) error {
+	return t.c.bus.Write(t.c.physical(address), b)
+}
+
+// Halt halts the CPU once the hook returns, Step returns cpu.ErrHalted until
+// the CPU is reset.
+func (t *Trap) Halt() {
+	t.c.state = cpu.Halted
+}
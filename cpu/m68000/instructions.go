@@ -1,5 +1,11 @@
 package m68000
 
+import (
+	"math/bits"
+
+	"github.com/marcopeereboom/byo/cpu"
+)
+
 // instruction describes a motorola 68000 instruction in a way that it can be
 // executed and disassembled.
 type instruction struct {
@@ -7,8 +13,14 @@ type instruction struct {
 	disassemble func(*m68k, uint16, []byte) (string, int, error)
 
 	// execution
+	size         uint32 // operation size in bytes
 	operandSize  uint32
 	fetchOperand func(*m68k, uint32, uint32) []byte
+	indexes      []uint32 // operand offsets of index extension words
+
+	// extension returns the length of extension words that depends on
+	// the extension word at address, nil if there are none
+	extension func(c *m68k, address uint32) uint32
 
 	fetchSource func(*m68k, uint32, []byte) uint32
 	source      uint32
@@ -18,33 +30,69 @@ type instruction struct {
 	destination      uint32
 
 	execute func(*m68k, uint32, uint32, []byte) uint32
+
+	// timing
+	cycles int // clock periods excluding data dependent time
 }
 
 var (
 	operandNop = []byte{} // to prevent GC
 )
 
-func (c *m68k) evalNL(d uint32) {
+// flag sets or clears condition code f.
+func (c *m68k) flag(f uint16, set bool) {
+	if set {
+		c.sr |= f
+	} else {
+		c.sr &^= f
+	}
+}
+
+func (c *m68k) evalN(d, size uint32) {
 	// N
-	if d&0x8000000 == 0 {
+	if d&msb(size) == 0 {
 		c.sr &^= negative
 	} else {
 		c.sr |= negative
 	}
 }
 
-func (c *m68k) evalZL(d uint32) {
+func (c *m68k) evalZ(d, size uint32) {
 	// Z
-	if d == 0 {
+	if d&mask(size) == 0 {
 		c.sr |= zero
 	} else {
 		c.sr &^= zero
 	}
 }
 
-func (c *m68k) evalNZL(d uint32) {
-	c.evalNL(d)
-	c.evalZL(d)
+func (c *m68k) evalNZ(d, size uint32) {
+	c.evalN(d, size)
+	c.evalZ(d, size)
+}
+
+// evalX copies C into X.
+func (c *m68k) evalX() {
+	c.flag(extend, c.sr&carry != 0)
+}
+
+// evalAddVC sets V and C for inter = dest + src per page 3-18.
+func (c *m68k) evalAddVC(src, dest, inter, size uint32) {
+	m := msb(size)
+	c.flag(overflow, (src&dest&^inter|^src&^dest&inter)&m != 0)
+	c.flag(carry, (src&dest|^inter&dest|src&^inter)&m != 0)
+}
+
+// evalSubVC sets V and C for inter = dest - src per page 3-18.
+func (c *m68k) evalSubVC(src, dest, inter, size uint32) {
+	m := msb(size)
+	c.flag(overflow, (^src&dest&^inter|src&^dest&inter)&m != 0)
+	c.flag(carry, (src&^dest|inter&^dest|src&inter)&m != 0)
+}
+
+// x returns the X bit as a number.
+func (c *m68k) x() uint32 {
+	return uint32(c.sr&extend) >> 4
 }
 
 func fetchOperandNop(c *m68k, address, size uint32) []byte {
@@ -52,7 +100,7 @@ func fetchOperandNop(c *m68k, address, size uint32) []byte {
 }
 
 func fetchOperand(c *m68k, address, size uint32) []byte {
-	return c.bus.Read(uint64(address), uint64(size))
+	return c.fetch(address, uint64(size))
 }
 
 func fetchNop(c *m68k, reg uint32, operand []byte) uint32 {
@@ -63,48 +111,871 @@ func fetchDn(c *m68k, reg uint32, operand []byte) uint32 {
 	return c.d[reg]
 }
 
+// fetchData returns the data that was decoded from the opcode, e.g. the
+// quick value of addq.
+func fetchData(c *m68k, data uint32, operand []byte) uint32 {
+	return data
+}
+
+// fetchWord consumes an extension word regardless of the operation size,
+// e.g. a register list or a displacement.
+func fetchWord(c *m68k, reg uint32, operand []byte) uint32 {
+	w, _ := c.extWord(operand)
+	return uint32(w)
+}
+
 func fetchAn(c *m68k, reg uint32, operand []byte) uint32 {
 	return c.a[reg]
 }
 
-func storeAn(c *m68k, reg, intermediate uint32, operand []byte) {
-	c.a[reg] = intermediate
+func storeDn(c *m68k, reg, intermediate uint32, operand []byte) {
+	c.d[reg] = intermediate
 }
 
-func storeAnIndirect(c *m68k, reg, intermediate uint32, operand []byte) {
-	c.write32(c.a[reg], intermediate)
+func storeNop(c *m68k, reg, intermediate uint32, operand []byte) {
 }
 
-func movel(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+func storeAn(c *m68k, reg, intermediate uint32, operand []byte) {
+	c.a[reg] = intermediate
+}
+
+func move(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
 	// set flags per page 3-18
-	c.evalNZL(src)
+	c.evalNZ(src, c.size)
 	c.sr &^= overflow
 	c.sr &^= carry
 
 	return src
 }
 
-func addal(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
-	inter := src + dest
+func add(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	inter := (dest + src) & mask(c.size)
 
-	// set flags per page 3-18
-	v := src&dest&^inter | ^dest&inter
-	if v&0x80000000 == 0 {
-		c.sr &^= overflow
-	} else {
-		c.sr |= overflow
+	c.evalAddVC(src, dest, inter, c.size)
+	c.evalX()
+	c.evalNZ(inter, c.size)
+
+	return inter
+}
+
+func addx(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	inter := (dest + src + c.x()) & mask(c.size)
+
+	c.evalAddVC(src, dest, inter, c.size)
+	c.evalX()
+	c.evalN(inter, c.size)
+	if inter != 0 {
+		// Z is only ever cleared for multi precision
+		c.sr &^= zero
+	}
+
+	return inter
+}
+
+func adda(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	// condition codes are not affected
+	return dest + signExtend(src, c.size)
+}
+
+func sub(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	inter := (dest - src) & mask(c.size)
+
+	c.evalSubVC(src, dest, inter, c.size)
+	c.evalX()
+	c.evalNZ(inter, c.size)
+
+	return inter
+}
+
+func subx(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	inter := (dest - src - c.x()) & mask(c.size)
+
+	c.evalSubVC(src, dest, inter, c.size)
+	c.evalX()
+	c.evalN(inter, c.size)
+	if inter != 0 {
+		// Z is only ever cleared for multi precision
+		c.sr &^= zero
+	}
+
+	return inter
+}
+
+func suba(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	// condition codes are not affected
+	return dest - signExtend(src, c.size)
+}
+
+func cmp(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	inter := (dest - src) & mask(c.size)
+
+	// X is not affected
+	c.evalSubVC(src, dest, inter, c.size)
+	c.evalNZ(inter, c.size)
+
+	return dest
+}
+
+func cmpa(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	// source is sign extended and the comparison is always long
+	src = signExtend(src, c.size)
+	inter := dest - src
+
+	c.evalSubVC(src, dest, inter, 4)
+	c.evalNZ(inter, 4)
+
+	return dest
+}
+
+func neg(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	return sub(c, dest, 0, operand)
+}
+
+func negx(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	return subx(c, dest, 0, operand)
+}
+
+// evalLogical sets the condition codes for the logical instructions.
+func (c *m68k) evalLogical(inter uint32) {
+	c.evalNZ(inter, c.size)
+	c.sr &^= overflow
+	c.sr &^= carry
+}
+
+func and(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	inter := dest & src
+	c.evalLogical(inter)
+	return inter
+}
+
+func or(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	inter := dest | src
+	c.evalLogical(inter)
+	return inter
+}
+
+func eor(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	inter := dest ^ src
+	c.evalLogical(inter)
+	return inter
+}
+
+func not(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	inter := ^dest & mask(c.size)
+	c.evalLogical(inter)
+	return inter
+}
+
+func andiCCR(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	c.sr &= uint16(src) | ^uint16(ccrMask)
+	return dest
+}
+
+func oriCCR(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	c.sr |= uint16(src) & ccrMask
+	return dest
+}
+
+func eoriCCR(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	c.sr ^= uint16(src) & ccrMask
+	return dest
+}
+
+func andiSR(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	c.setSR(c.sr & uint16(src))
+	return dest
+}
+
+func oriSR(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	c.setSR(c.sr | uint16(src))
+	return dest
+}
+
+func eoriSR(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	c.setSR(c.sr ^ uint16(src))
+	return dest
+}
+
+func moveToCCR(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	c.sr = c.sr&^ccrMask | uint16(src)&ccrMask
+	return dest
+}
+
+func moveToSR(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	c.setSR(uint16(src))
+	return dest
+}
+
+func moveFromSR(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	return uint32(c.sr)
+}
+
+func moveToUSP(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	c.usp = src
+	return dest
+}
+
+func moveFromUSP(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	return c.usp
+}
+
+// shift returns the shift count from src.  Register counts are modulo 64.
+// Register shifts take 2 clock periods per bit.
+func (c *m68k) shift(src uint32) uint32 {
+	count := src & 0x3f
+	if c.ir&0x00c0 != 0x00c0 {
+		c.cycles += 2 * int(count)
+	}
+	return count
+}
+
+func asl(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	m, sign := mask(c.size), msb(c.size)
+
+	// V is set if the most significant bit changes at any time
+	c.sr &^= overflow | carry
+	for count := c.shift(src); count > 0; count-- {
+		out := dest & sign
+		dest = dest << 1 & m
+		c.flag(carry|extend, out != 0)
+		if dest&sign != out {
+			c.sr |= overflow
+		}
 	}
+	c.evalNZ(dest, c.size)
+
+	return dest
+}
+
+func asr(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	sign := msb(c.size)
+
+	c.sr &^= overflow | carry
+	for count := c.shift(src); count > 0; count-- {
+		c.flag(carry|extend, dest&1 != 0)
+		dest = dest>>1 | dest&sign
+	}
+	c.evalNZ(dest, c.size)
+
+	return dest
+}
+
+func lsl(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	m, sign := mask(c.size), msb(c.size)
+
+	c.sr &^= overflow | carry
+	for count := c.shift(src); count > 0; count-- {
+		c.flag(carry|extend, dest&sign != 0)
+		dest = dest << 1 & m
+	}
+	c.evalNZ(dest, c.size)
+
+	return dest
+}
+
+func lsr(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	c.sr &^= overflow | carry
+	for count := c.shift(src); count > 0; count-- {
+		c.flag(carry|extend, dest&1 != 0)
+		dest >>= 1
+	}
+	c.evalNZ(dest, c.size)
+
+	return dest
+}
+
+func rol(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	m, sign := mask(c.size), msb(c.size)
+
+	// X is not affected
+	c.sr &^= overflow | carry
+	for count := c.shift(src); count > 0; count-- {
+		out := dest & sign
+		dest = dest << 1 & m
+		if out != 0 {
+			dest |= 1
+		}
+		c.flag(carry, out != 0)
+	}
+	c.evalNZ(dest, c.size)
+
+	return dest
+}
+
+func ror(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	sign := msb(c.size)
+
+	// X is not affected
+	c.sr &^= overflow | carry
+	for count := c.shift(src); count > 0; count-- {
+		out := dest & 1
+		dest >>= 1
+		if out != 0 {
+			dest |= sign
+		}
+		c.flag(carry, out != 0)
+	}
+	c.evalNZ(dest, c.size)
+
+	return dest
+}
+
+func roxl(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	m, sign := mask(c.size), msb(c.size)
+
+	// rotate through X, C is set to X even if the count is zero
+	for count := c.shift(src); count > 0; count-- {
+		out := dest & sign
+		dest = dest<<1&m | c.x()
+		c.flag(extend, out != 0)
+	}
+	c.flag(carry, c.sr&extend != 0)
+	c.sr &^= overflow
+	c.evalNZ(dest, c.size)
+
+	return dest
+}
+
+func roxr(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	sign := msb(c.size)
+
+	// rotate through X, C is set to X even if the count is zero
+	for count := c.shift(src); count > 0; count-- {
+		out := dest & 1
+		dest >>= 1
+		if c.sr&extend != 0 {
+			dest |= sign
+		}
+		c.flag(extend, out != 0)
+	}
+	c.flag(carry, c.sr&extend != 0)
+	c.sr &^= overflow
+	c.evalNZ(dest, c.size)
 
-	ca := src&dest | ^inter&dest | src&^inter
-	if ca&0x80000000 == 0 {
-		c.sr &^= carry
-		c.sr &^= extend
+	return dest
+}
+
+// condition evaluates condition code cc per table 3-19.
+func (c *m68k) condition(cc uint16) bool {
+	sr := c.sr
+	C := sr&carry != 0
+	V := sr&overflow != 0
+	Z := sr&zero != 0
+	N := sr&negative != 0
+
+	switch cc & 0x0f {
+	case 0x00:
+		// T
+		return true
+	case 0x01:
+		// F
+		return false
+	case 0x02:
+		// HI
+		return !C && !Z
+	case 0x03:
+		// LS
+		return C || Z
+	case 0x04:
+		// CC
+		return !C
+	case 0x05:
+		// CS
+		return C
+	case 0x06:
+		// NE
+		return !Z
+	case 0x07:
+		// EQ
+		return Z
+	case 0x08:
+		// VC
+		return !V
+	case 0x09:
+		// VS
+		return V
+	case 0x0a:
+		// PL
+		return !N
+	case 0x0b:
+		// MI
+		return N
+	case 0x0c:
+		// GE
+		return N == V
+	case 0x0d:
+		// LT
+		return N != V
+	case 0x0e:
+		// GT
+		return N == V && !Z
+	}
+	// LE
+	return Z || N != V
+}
+
+// fetchAddress returns the effective address ea instead of its contents.
+func fetchAddress(c *m68k, ea uint32, operand []byte) uint32 {
+	return c.address(ea, operand)
+}
+
+// next returns the address of the instruction following the current one.
+func (c *m68k) next(operand []byte) uint32 {
+	return c.pc + 2 + uint32(len(operand))
+}
+
+func nop(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	return dest
+}
+
+func bcc(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	// displacement is relative to the extension word
+	if c.condition(c.ir >> 8) {
+		c.cycles = 10
+		c.jump(c.pc + 2 + signExtend(src, c.size))
+	}
+	return dest
+}
+
+func bsr(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	c.push32(c.next(operand))
+	c.jump(c.pc + 2 + signExtend(src, c.size))
+	return dest
+}
+
+func dbcc(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	if c.condition(c.ir >> 8) {
+		return dest
+	}
+	dest = (dest - 1) & 0xffff
+	if dest != 0xffff {
+		c.cycles = 10
+		c.jump(c.pc + 2 + signExtend(src, 2))
 	} else {
-		c.sr |= carry
-		c.sr |= extend
+		c.cycles = 14
 	}
+	return dest
+}
 
-	c.evalNZL(inter)
+func scc(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	if c.condition(c.ir >> 8) {
+		if c.ir&0x0038 == 0 {
+			c.cycles += 2
+		}
+		return 0xff
+	}
+	return 0x00
+}
+
+func jmp(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	c.jump(src)
+	return dest
+}
+
+func jsr(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	c.push32(c.next(operand))
+	c.jump(src)
+	return dest
+}
+
+func rts(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	c.jump(c.pop32())
+	return dest
+}
+
+func rtr(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	c.sr = c.sr&^ccrMask | c.pop16()&ccrMask
+	c.jump(c.pop32())
+	return dest
+}
+
+func rte(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	sr := c.pop16()
+	c.jump(c.pop32())
+	c.setSR(sr)
+	return dest
+}
 
+// mulu takes 2 clock periods for every bit set in src.
+func mulu(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	c.cycles += 2 * bits.OnesCount16(uint16(src))
+	inter := (dest & 0xffff) * src
+	c.evalNZ(inter, 4)
+	c.sr &^= overflow | carry
 	return inter
 }
+
+// muls takes 2 clock periods for every 01 or 10 bit pair in src with a 0
+// appended.
+func muls(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	v := src << 1
+	c.cycles += 2 * bits.OnesCount16(uint16(v^v>>1))
+	inter := signExtend(dest, 2) * signExtend(src, 2)
+	c.evalNZ(inter, 4)
+	c.sr &^= overflow | carry
+	return inter
+}
+
+// divOverflow sets the condition codes of a division overflow.  The
+// destination is not modified and, as observed on silicon, N is set and Z is
+// cleared.
+func (c *m68k) divOverflow() {
+	c.sr |= overflow | negative
+	c.sr &^= zero | carry
+}
+
+func divu(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	if src == 0 {
+		// silicon sets N and Z from the dividend
+		c.flag(negative, dest&0x80000000 != 0)
+		c.flag(zero, dest&0xffff0000 == 0)
+		c.sr &^= overflow | carry
+		c.cycles += cyclesDivide
+		c.raise(vectorZeroDivide, c.next(operand))
+	}
+	c.cycles += divuCycles(dest, uint16(src))
+
+	quotient := dest / src
+	if quotient > 0xffff {
+		c.divOverflow()
+		return dest
+	}
+	remainder := dest % src
+
+	c.evalNZ(quotient, 2)
+	c.sr &^= overflow | carry
+	return remainder<<16 | quotient
+}
+
+func divs(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	if src == 0 {
+		// silicon clears N and sets Z
+		c.sr &^= negative | overflow | carry
+		c.sr |= zero
+		c.cycles += cyclesDivide
+		c.raise(vectorZeroDivide, c.next(operand))
+	}
+	c.cycles += divsCycles(int32(dest), int16(src))
+
+	dividend := int64(int32(dest))
+	divisor := int64(int16(src))
+	quotient := dividend / divisor
+	if quotient < -0x8000 || quotient > 0x7fff {
+		c.divOverflow()
+		return dest
+	}
+	remainder := dividend % divisor // sign of the dividend
+
+	c.evalNZ(uint32(quotient), 2)
+	c.sr &^= overflow | carry
+	return uint32(remainder)<<16 | uint32(quotient)&0xffff
+}
+
+// evalBCD sets the condition codes of the decimal instructions for the
+// corrected result rr.  Z is only ever cleared for multi precision.
+func (c *m68k) evalBCD(carried bool, rr uint32) {
+	c.flag(carry|extend, carried)
+	c.evalN(rr, 1)
+	if rr&0xff != 0 {
+		c.sr &^= zero
+	}
+}
+
+// abcd adds decimal with extend.  The correction factor is derived from the
+// binary carries so that invalid digits give the same results as silicon.
+func abcd(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	ss := dest + src + c.x()
+
+	// binary carry out of each nibble and decimal carry of each digit
+	bc := (dest&src | ^ss&dest | ^ss&src) & 0x88
+	dc := ((ss + 0x66) ^ ss) & 0x110 >> 1
+	corf := (bc | dc) - (bc|dc)>>2
+	rr := ss + corf
+
+	c.flag(overflow, ^ss&rr&0x80 != 0)
+	c.evalBCD((bc|ss&^rr)&0x80 != 0, rr)
+
+	return rr & 0xff
+}
+
+// sbcd subtracts decimal with extend.  See abcd.
+func sbcd(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	dd := dest - src - c.x()
+
+	// binary borrow out of each nibble
+	bc := (^dest&src | dd&^dest | dd&src) & 0x88
+	corf := bc - bc>>2
+	rr := dd - corf
+
+	c.flag(overflow, dd&^rr&0x80 != 0)
+	c.evalBCD((bc|^dd&rr)&0x80 != 0, rr)
+
+	return rr & 0xff
+}
+
+func nbcd(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	return sbcd(c, dest, 0, operand)
+}
+
+func movea(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	// condition codes are not affected
+	return signExtend(src, c.size)
+}
+
+func lea(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	return src
+}
+
+func pea(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	c.push32(src)
+	return dest
+}
+
+func link(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	// link a7 pushes the decremented stack pointer
+	r := c.ir & 0x07
+	c.a[7] -= 4
+	c.write32(c.a[7], c.a[r])
+	c.a[r] = c.a[7]
+	c.a[7] += signExtend(src, c.size)
+	return dest
+}
+
+func unlk(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	r := c.ir & 0x07
+	c.a[7] = c.a[r]
+	c.a[r] = c.pop32()
+	return dest
+}
+
+func exg(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	rx, ry := c.ir>>9&0x07, c.ir&0x07
+	switch c.ir >> 3 & 0x1f {
+	case 0x08:
+		// Dx,Dy
+		c.d[rx], c.d[ry] = c.d[ry], c.d[rx]
+	case 0x09:
+		// Ax,Ay
+		c.a[rx], c.a[ry] = c.a[ry], c.a[rx]
+	case 0x11:
+		// Dx,Ay
+		c.d[rx], c.a[ry] = c.a[ry], c.d[rx]
+	}
+	return dest
+}
+
+func swap(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	inter := dest<<16 | dest>>16
+	c.evalLogical(inter)
+	return inter
+}
+
+func ext(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	// extend the next smaller size into the operation size
+	inter := signExtend(dest, c.size/2)
+	c.evalLogical(inter)
+	return inter
+}
+
+func clr(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	c.evalLogical(0)
+	return 0
+}
+
+func tst(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	c.evalLogical(src)
+	return dest
+}
+
+// tas sets bit 7 of the destination.  Memory is tested and set in an
+// indivisible read-modify-write cycle, see genTas.
+func tas(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	if c.ir&0x38 != 0 {
+		dest = uint32(c.readModifyWrite8(c.ea, func(v uint8) uint8 {
+			return v | 0x80
+		}))
+	}
+	c.evalLogical(dest)
+	return dest | 0x80
+}
+
+// movemRegister returns a pointer to register n where D0-D7 are 0-7 and
+// A0-A7 are 8-15.
+func (c *m68k) movemRegister(n uint32) *uint32 {
+	if n < 8 {
+		return &c.d[n]
+	}
+	return &c.a[n-8]
+}
+
+// movemToMemory stores the registers in list src to effective address dest.
+// The predecrement mode reverses the register list so that A7 is bit 0 and
+// stores the registers from A7 down to D0.
+func movemToMemory(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	c.cycles += 2 * int(c.size) * bits.OnesCount16(uint16(src))
+
+	if dest>>3 == 0x04 {
+		// -(An), the 68000 stores the initial value of An
+		r := dest & 0x07
+		address := c.a[r]
+		for n := uint32(0); n < 16; n++ {
+			if src&(1<<n) == 0 {
+				continue
+			}
+			address -= c.size
+			c.writeSized(address, c.size, *c.movemRegister(15 - n))
+		}
+		c.a[r] = address
+		return dest
+	}
+
+	address := c.address(dest, operand)
+	for n := uint32(0); n < 16; n++ {
+		if src&(1<<n) == 0 {
+			continue
+		}
+		c.writeSized(address, c.size, *c.movemRegister(n))
+		address += c.size
+	}
+	return dest
+}
+
+// movemToRegisters loads the registers in list src from effective address
+// dest.  Words are sign extended into the entire register.
+func movemToRegisters(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	c.cycles += 2 * int(c.size) * bits.OnesCount16(uint16(src))
+
+	var address uint32
+	postincrement := dest>>3 == 0x03
+	if postincrement {
+		address = c.a[dest&0x07]
+	} else {
+		address = c.address(dest, operand)
+	}
+
+	for n := uint32(0); n < 16; n++ {
+		if src&(1<<n) == 0 {
+			continue
+		}
+		*c.movemRegister(n) = signExtend(c.readSized(address, c.size),
+			c.size)
+		address += c.size
+	}
+
+	if postincrement {
+		c.a[dest&0x07] = address
+	}
+	return dest
+}
+
+// movep transfers a data register to or from alternate bytes of memory.  Each
+// byte is a separate bus cycle.
+func movep(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	dn, an := c.ir>>9&0x07, c.ir&0x07
+	address := c.a[an] + signExtend(src, 2)
+	shift := c.size*8 - 8
+
+	if c.ir&0x0080 == 0 {
+		// memory to register
+		var v uint32
+		for n := uint32(0); n < c.size; n++ {
+			v = v<<8 | uint32(c.read8(address+2*n))
+		}
+		m := mask(c.size)
+		c.d[dn] = c.d[dn]&^m | v
+		return dest
+	}
+
+	// register to memory
+	for n := uint32(0); n < c.size; n++ {
+		c.write8(address+2*n, uint8(c.d[dn]>>(shift-8*n)))
+	}
+	return dest
+}
+
+// bit returns the bit mask for bit number src.  Data registers are operated
+// on as a long and memory as a byte.
+func (c *m68k) bit(src uint32) uint32 {
+	return 1 << (src & (c.size*8 - 1))
+}
+
+// bitCycles returns the additional time to modify bit number src.  Bits in
+// the upper word of a data register take 2 more clock periods.
+func (c *m68k) bitCycles(src uint32) int {
+	if c.size == 4 && src&0x1f >= 16 {
+		return 2
+	}
+	return 0
+}
+
+func btst(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	c.flag(zero, dest&c.bit(src) == 0)
+	return dest
+}
+
+func bchg(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	c.cycles += c.bitCycles(src)
+	c.flag(zero, dest&c.bit(src) == 0)
+	return dest ^ c.bit(src)
+}
+
+func bclr(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	c.cycles += c.bitCycles(src)
+	c.flag(zero, dest&c.bit(src) == 0)
+	return dest &^ c.bit(src)
+}
+
+func bset(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	c.cycles += c.bitCycles(src)
+	c.flag(zero, dest&c.bit(src) == 0)
+	return dest | c.bit(src)
+}
+
+func trap(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	c.raise(vectorTrap+uint32(c.ir&0x0f), c.next(operand))
+	return dest
+}
+
+func trapv(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	if c.sr&overflow != 0 {
+		c.cycles += cyclesTRAPV
+		c.raise(vectorTRAPV, c.next(operand))
+	}
+	return dest
+}
+
+// chk raises the CHK exception when Dn is outside of 0 to src.  Z, V and C
+// are undocumented and set as observed on silicon.
+func chk(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	n := int32(signExtend(dest, c.size))
+	bound := int32(signExtend(src, c.size))
+	c.flag(zero, n == 0)
+	c.sr &^= overflow | carry
+	if n >= 0 && n <= bound {
+		return dest
+	}
+	c.flag(negative, n < 0)
+	c.cycles += cyclesCHK
+	c.raise(vectorCHK, c.next(operand))
+	return dest
+}
+
+func illegal(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	c.raise(vectorIllegal, c.pc)
+	return dest
+}
+
+// stop loads the status register and stops until an interrupt above the new
+// interrupt mask arrives.
+func stop(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	c.setSR(uint16(src))
+	c.state = cpu.Stopped
+	return dest
+}
+
+// reset asserts the reset line of all peripherals for 124 clock periods.  The
+// CPU itself is not reset.
+func reset(c *m68k, src uint32, dest uint32, operand []byte) uint32 {
+	c.bus.Reset(false)
+	return dest
+}
@@ -0,0 +1,105 @@
+package m68000
+
+// The 68000 has a two word prefetch queue.  While an instruction executes the
+// queue already holds its first extension word and the opcode of the next
+// instruction is fetched before the instruction writes its results.  Code
+// that modifies the instruction stream immediately ahead of the program
+// counter therefore executes the stale opcode.  Emulating the queue is
+// optional since it costs an extra copy of the operand on every instruction.
+
+// Prefetch enables or disables emulation of the prefetch queue.
+func (c *m68k) Prefetch(enable bool) {
+	c.prefetch = enable
+	c.queued = 0
+}
+
+// flush discards the prefetch queue, e.g. after the program counter was
+// loaded.  The 68010 loop buffer is discarded as well.
+func (c *m68k) flush() {
+	c.queued = 0
+	c.loop = false
+}
+
+// fetchOpcode returns the opcode at the program counter from the prefetch
+// queue when it is valid, otherwise the opcode is read from memory.
+func (c *m68k) fetchOpcode() uint16 {
+	if c.queued > 0 && c.queuePC == c.pc {
+		return c.queue[0]
+	}
+	c.queued = 0
+	return c.fetch16(c.pc)
+}
+
+// prefetched replaces the first extension word of operand with the word in
+// the prefetch queue.
+func (c *m68k) prefetched(operand []byte) []byte {
+	if c.queued < 2 || c.queuePC != c.pc || len(operand) < 2 {
+		return operand
+	}
+	// operand may alias memory
+	v := make([]byte, len(operand))
+	v[0], v[1] = byte(c.queue[1]>>8), byte(c.queue[1])
+	copy(v[2:], operand[2:])
+	return v
+}
+
+// prefetchOpcode fetches the opcode of the next instruction at address into
+// the queue.  This happens before the current instruction writes.  A fault
+// of the fetch is held until the instruction completes, see prefetchFault.
+func (c *m68k) prefetchOpcode(address uint32) {
+	c.queued = 0
+	c.fault = c.prefetchWord(address, &c.queue[0])
+	if c.fault == nil {
+		c.queuePC = address
+		c.queued = 1
+	}
+}
+
+// prefetchFault raises the fault of the opcode prefetch unless the
+// instruction jumped, the sequential opcode is then never executed.
+func (c *m68k) prefetchFault() {
+	if c.fault != nil && !c.jumped {
+		panic(*c.fault)
+	}
+}
+
+// prefetchExtension completes the queue with the word following the opcode
+// of the next instruction.  If the instruction jumped the queue is refilled
+// with the two words at the new program counter.  The refill is part of the
+// time of a taken branch, jmp, jsr, rts or rte, an 8 bit data bus adds its
+// byte cycles to the jump instead of the next instruction.  Faults of the
+// refill are left to the next instruction, which may not need both words.
+func (c *m68k) prefetchExtension() {
+	if c.jumped {
+		c.queued = 0
+		if c.prefetchWord(c.pc, &c.queue[0]) != nil {
+			return
+		}
+		c.queuePC = c.pc
+		c.queued = 1
+		if c.prefetchWord(c.pc+2, &c.queue[1]) == nil {
+			c.queued = 2
+		}
+		return
+	}
+	c.queue[1] = c.fetch16(c.queuePC + 2)
+	c.queued = 2
+}
+
+// prefetchWord fetches the word at address into w and returns the fault of
+// the fetch, nil if there is none.
+func (c *m68k) prefetchWord(address uint32, w *uint16) (fault *exception) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		e, ok := r.(exception)
+		if !ok {
+			panic(r)
+		}
+		fault = &e
+	}()
+	*w = c.fetch16(address)
+	return nil
+}
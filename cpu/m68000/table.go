@@ -1,39 +1,1162 @@
 package m68000
 
+// Effective address modes expressed as a bit mask.  The opcode generator uses
+// these to determine which mode/register combinations are legal for an
+// instruction.  Modes 0-6 map directly onto bits 0-6, mode 7 uses the
+// register field to select bits 7-11.
+const (
+	eaDn   = 1 << iota // Dn
+	eaAn               // An
+	eaAi               // (An)
+	eaPi               // (An)+
+	eaPd               // -(An)
+	eaDi               // (d16,An)
+	eaIx               // (d8,An,Xn)
+	eaAbsW             // (xxx).W
+	eaAbsL             // (xxx).L
+	eaPCDi             // (d16,PC)
+	eaPCIx             // (d8,PC,Xn)
+	eaImm              // #<data>
+
+	eaAll              = eaDn | eaAn | eaMemory
+	eaData             = eaAll &^ eaAn
+	eaMemory           = eaAi | eaPi | eaPd | eaDi | eaIx | eaAbsW | eaAbsL | eaPCDi | eaPCIx | eaImm
+	eaControl          = eaAi | eaDi | eaIx | eaAbsW | eaAbsL | eaPCDi | eaPCIx
+	eaAlterable        = eaDn | eaAn | eaAi | eaPi | eaPd | eaDi | eaIx | eaAbsW | eaAbsL
+	eaDataAlterable    = eaAlterable &^ eaAn
+	eaMemoryAlterable  = eaAlterable &^ (eaDn | eaAn)
+	eaControlAlterable = eaControl & eaAlterable
+)
+
+// eaBit returns the mode mask bit for the provided mode and register.
+func eaBit(mode, reg uint16) uint16 {
+	if mode < 7 {
+		return 1 << mode
+	}
+	if reg < 5 {
+		return 1 << (7 + reg)
+	}
+	return 0
+}
+
+// pattern describes an opcode bit pattern and how to generate the
+// instructions it covers.
+type pattern struct {
+	mask  uint16 // significant bits
+	match uint16 // value of the significant bits
+	ea    uint16 // legal modes of the MMMRRR field in bits 5-0, 0 if none
+	ea2   uint16 // legal modes of the RRRMMM field in bits 11-6, 0 if none
+	size  uint32 // operation size in bytes, 0 if unsized
+
+	// privileged instructions take the privilege violation in user mode
+	// before any operand is fetched
+	privileged bool
+
+	// cycles returns the execution time of opcode.
+	cycles timing
+
+	// gen returns the decoded instruction for opcode.
+	gen func(opcode uint16, size uint32) instruction
+}
+
+// valid returns true if opcode is encoded by the pattern.
+func (p *pattern) valid(opcode uint16) bool {
+	if opcode&p.mask != p.match {
+		return false
+	}
+	if p.ea != 0 && p.ea&eaBit(mr(opcode, 5)) == 0 {
+		return false
+	}
+	if p.ea2 != 0 && p.ea2&eaBit(rm(opcode, 11)) == 0 {
+		return false
+	}
+	return true
+}
+
+// indexed returns true if mode and reg select an indexed effective address.
+func indexed(mode, reg uint16) bool {
+	return mode == 0x06 || mode == 0x07 && reg == 0x03
+}
+
+// indexes returns the operand offsets of the index extension words of opcode.
+// Extension words of the effective address follow all other extension words
+// except for move where those of the destination follow the source.
+func (p *pattern) indexes(opcode uint16, operandSize uint32) []uint32 {
+	var offsets []uint32
+	if p.ea2 != 0 {
+		m, r := mr(opcode, 5)
+		if indexed(m, r) {
+			offsets = append(offsets, 0)
+		}
+		if m2, r2 := rm(opcode, 11); indexed(m2, r2) {
+			offsets = append(offsets, extensionSize(m, r, p.size))
+		}
+		return offsets
+	}
+	if p.ea != 0 && indexed(mr(opcode, 5)) {
+		offsets = append(offsets, operandSize-2)
+	}
+	return offsets
+}
+
+// supervisorFetch returns fetch preceded by the privilege check so that a
+// privilege violation leaves the registers of the effective address
+// untouched.
+func supervisorFetch(fetch func(*m68k, uint32, []byte) uint32) func(*m68k,
+	uint32, []byte) uint32 {
+	return func(c *m68k, ea uint32, operand []byte) uint32 {
+		c.privileged()
+		return fetch(c, ea, operand)
+	}
+}
+
+// concat returns the pattern lists joined in order.
+func concat(lists ...[]pattern) []pattern {
+	var patterns []pattern
+	for _, l := range lists {
+		patterns = append(patterns, l...)
+	}
+	return patterns
+}
+
+// generate decodes all 65536 opcodes using the provided patterns.  Patterns
+// are tried in order and the first one that matches wins, opcodes that match
+// no pattern are left zeroed and are therefore invalid.
+func generate(patterns []pattern) *[0x10000]instruction {
+	// all patterns decode the instruction line so bucket on it
+	var lines [16][]*pattern
+	for k := range patterns {
+		p := &patterns[k]
+		if p.mask&0xf000 != 0xf000 {
+			panic("pattern does not decode line")
+		}
+		line := p.match >> 12
+		lines[line] = append(lines[line], p)
+	}
+
+	t := new([0x10000]instruction)
+	for k := range t {
+		opcode := uint16(k)
+		for _, p := range lines[opcode>>12] {
+			if !p.valid(opcode) {
+				continue
+			}
+			t[k] = p.gen(opcode, p.size)
+			if p.privileged {
+				t[k].fetchSource = supervisorFetch(t[k].fetchSource)
+			}
+			t[k].cycles = p.cycles(opcode, p.size)
+			t[k].indexes = p.indexes(opcode, t[k].operandSize)
+			break
+		}
+	}
+
+	return t
+}
+
+// operandFetcher returns the operand fetch hook for size extension bytes.
+func operandFetcher(size uint32) func(*m68k, uint32, uint32) []byte {
+	if size == 0 {
+		return fetchOperandNop
+	}
+	return fetchOperand
+}
+
+// Generator hook types.
+type (
+	executer     = func(*m68k, uint32, uint32, []byte) uint32
+	disassembler = func(*m68k, uint16, []byte) (string, int, error)
+	generator    = func(uint16, uint32) instruction
+)
+
 var (
-	opcodes = map[uint16]instruction{
-		0x2441: {
-			// move.l d1,a2
-			disassemble:      dMove,
-			fetchOperand:     fetchOperandNop,
-			fetchSource:      fetchDn,
-			source:           1,
-			fetchDestination: fetchNop,
+	// patterns68000 describes the Motorola 68000 instruction set.
+	patterns68000 = []pattern{
+		// move
+		{mask: 0xf000, match: 0x1000, ea: eaAll &^ eaAn,
+			ea2: eaDataAlterable, size: 1, cycles: tMove,
+			gen: genMove},
+		{mask: 0xf000, match: 0x2000, ea: eaAll, ea2: eaDataAlterable,
+			size: 4, cycles: tMove, gen: genMove},
+		{mask: 0xf000, match: 0x3000, ea: eaAll, ea2: eaDataAlterable,
+			size: 2, cycles: tMove, gen: genMove},
+		{mask: 0xf1c0, match: 0x2040, ea: eaAll, size: 4, cycles: tMove,
+			gen: genAddress(movea, dMovea, true)},
+		{mask: 0xf1c0, match: 0x3040, ea: eaAll, size: 2, cycles: tMove,
+			gen: genAddress(movea, dMovea, true)},
+		{mask: 0xf100, match: 0x7000, size: 4, cycles: tFixed(4),
+			gen: genMoveq},
+
+		// add
+		{mask: 0xf1f0, match: 0xd100, size: 1, cycles: tX(4, 8, 18, 30),
+			gen: genX(addx, dAddx)},
+		{mask: 0xf1f0, match: 0xd140, size: 2, cycles: tX(4, 8, 18, 30),
+			gen: genX(addx, dAddx)},
+		{mask: 0xf1f0, match: 0xd180, size: 4, cycles: tX(4, 8, 18, 30),
+			gen: genX(addx, dAddx)},
+		{mask: 0xf1c0, match: 0xd000, ea: eaAll &^ eaAn, size: 1,
+			cycles: tDyadic(4, 6), gen: genDyadic(add, dAdd, true)},
+		{mask: 0xf1c0, match: 0xd040, ea: eaAll, size: 2,
+			cycles: tDyadic(4, 6), gen: genDyadic(add, dAdd, true)},
+		{mask: 0xf1c0, match: 0xd080, ea: eaAll, size: 4,
+			cycles: tDyadic(4, 6), gen: genDyadic(add, dAdd, true)},
+		{mask: 0xf1c0, match: 0xd100, ea: eaMemoryAlterable, size: 1,
+			cycles: tEA(8, 12), gen: genDyadic(add, dAdd, true)},
+		{mask: 0xf1c0, match: 0xd140, ea: eaMemoryAlterable, size: 2,
+			cycles: tEA(8, 12), gen: genDyadic(add, dAdd, true)},
+		{mask: 0xf1c0, match: 0xd180, ea: eaMemoryAlterable, size: 4,
+			cycles: tEA(8, 12), gen: genDyadic(add, dAdd, true)},
+		{mask: 0xf1c0, match: 0xd0c0, ea: eaAll, size: 2,
+			cycles: tDyadic(8, 6),
+			gen:    genAddress(adda, dAdd, true)},
+		{mask: 0xf1c0, match: 0xd1c0, ea: eaAll, size: 4,
+			cycles: tDyadic(8, 6),
+			gen:    genAddress(adda, dAdd, true)},
+		{mask: 0xffc0, match: 0x0600, ea: eaDataAlterable, size: 1,
+			cycles: tRM(8, 16, 12, 20),
+			gen:    genImmediate(add, dAddi, true)},
+		{mask: 0xffc0, match: 0x0640, ea: eaDataAlterable, size: 2,
+			cycles: tRM(8, 16, 12, 20),
+			gen:    genImmediate(add, dAddi, true)},
+		{mask: 0xffc0, match: 0x0680, ea: eaDataAlterable, size: 4,
+			cycles: tRM(8, 16, 12, 20),
+			gen:    genImmediate(add, dAddi, true)},
+		{mask: 0xf1c0, match: 0x5000, ea: eaDataAlterable, size: 1,
+			cycles: tQuick, gen: genQuick(add, adda, dAddq)},
+		{mask: 0xf1c0, match: 0x5040, ea: eaAlterable, size: 2,
+			cycles: tQuick, gen: genQuick(add, adda, dAddq)},
+		{mask: 0xf1c0, match: 0x5080, ea: eaAlterable, size: 4,
+			cycles: tQuick, gen: genQuick(add, adda, dAddq)},
+
+		// sub
+		{mask: 0xf1f0, match: 0x9100, size: 1, cycles: tX(4, 8, 18, 30),
+			gen: genX(subx, dSubx)},
+		{mask: 0xf1f0, match: 0x9140, size: 2, cycles: tX(4, 8, 18, 30),
+			gen: genX(subx, dSubx)},
+		{mask: 0xf1f0, match: 0x9180, size: 4, cycles: tX(4, 8, 18, 30),
+			gen: genX(subx, dSubx)},
+		{mask: 0xf1c0, match: 0x9000, ea: eaAll &^ eaAn, size: 1,
+			cycles: tDyadic(4, 6), gen: genDyadic(sub, dSub, true)},
+		{mask: 0xf1c0, match: 0x9040, ea: eaAll, size: 2,
+			cycles: tDyadic(4, 6), gen: genDyadic(sub, dSub, true)},
+		{mask: 0xf1c0, match: 0x9080, ea: eaAll, size: 4,
+			cycles: tDyadic(4, 6), gen: genDyadic(sub, dSub, true)},
+		{mask: 0xf1c0, match: 0x9100, ea: eaMemoryAlterable, size: 1,
+			cycles: tEA(8, 12), gen: genDyadic(sub, dSub, true)},
+		{mask: 0xf1c0, match: 0x9140, ea: eaMemoryAlterable, size: 2,
+			cycles: tEA(8, 12), gen: genDyadic(sub, dSub, true)},
+		{mask: 0xf1c0, match: 0x9180, ea: eaMemoryAlterable, size: 4,
+			cycles: tEA(8, 12), gen: genDyadic(sub, dSub, true)},
+		{mask: 0xf1c0, match: 0x90c0, ea: eaAll, size: 2,
+			cycles: tDyadic(8, 6),
+			gen:    genAddress(suba, dSub, true)},
+		{mask: 0xf1c0, match: 0x91c0, ea: eaAll, size: 4,
+			cycles: tDyadic(8, 6),
+			gen:    genAddress(suba, dSub, true)},
+		{mask: 0xffc0, match: 0x0400, ea: eaDataAlterable, size: 1,
+			cycles: tRM(8, 16, 12, 20),
+			gen:    genImmediate(sub, dSubi, true)},
+		{mask: 0xffc0, match: 0x0440, ea: eaDataAlterable, size: 2,
+			cycles: tRM(8, 16, 12, 20),
+			gen:    genImmediate(sub, dSubi, true)},
+		{mask: 0xffc0, match: 0x0480, ea: eaDataAlterable, size: 4,
+			cycles: tRM(8, 16, 12, 20),
+			gen:    genImmediate(sub, dSubi, true)},
+		{mask: 0xf1c0, match: 0x5100, ea: eaDataAlterable, size: 1,
+			cycles: tQuick, gen: genQuick(sub, suba, dSubq)},
+		{mask: 0xf1c0, match: 0x5140, ea: eaAlterable, size: 2,
+			cycles: tQuick, gen: genQuick(sub, suba, dSubq)},
+		{mask: 0xf1c0, match: 0x5180, ea: eaAlterable, size: 4,
+			cycles: tQuick, gen: genQuick(sub, suba, dSubq)},
+
+		// cmp
+		{mask: 0xf1f8, match: 0xb108, size: 1, cycles: tSize(12, 20),
+			gen: genCmpm},
+		{mask: 0xf1f8, match: 0xb148, size: 2, cycles: tSize(12, 20),
+			gen: genCmpm},
+		{mask: 0xf1f8, match: 0xb188, size: 4, cycles: tSize(12, 20),
+			gen: genCmpm},
+		{mask: 0xf1c0, match: 0xb000, ea: eaAll &^ eaAn, size: 1,
+			cycles: tEA(4, 6), gen: genDyadic(cmp, dCmp, false)},
+		{mask: 0xf1c0, match: 0xb040, ea: eaAll, size: 2,
+			cycles: tEA(4, 6), gen: genDyadic(cmp, dCmp, false)},
+		{mask: 0xf1c0, match: 0xb080, ea: eaAll, size: 4,
+			cycles: tEA(4, 6), gen: genDyadic(cmp, dCmp, false)},
+		{mask: 0xf1c0, match: 0xb0c0, ea: eaAll, size: 2,
+			cycles: tEA(6, 6), gen: genAddress(cmpa, dCmp, false)},
+		{mask: 0xf1c0, match: 0xb1c0, ea: eaAll, size: 4,
+			cycles: tEA(6, 6), gen: genAddress(cmpa, dCmp, false)},
+		{mask: 0xffc0, match: 0x0c00, ea: eaDataAlterable, size: 1,
+			cycles: tRM(8, 14, 8, 12),
+			gen:    genImmediate(cmp, dCmpi, false)},
+		{mask: 0xffc0, match: 0x0c40, ea: eaDataAlterable, size: 2,
+			cycles: tRM(8, 14, 8, 12),
+			gen:    genImmediate(cmp, dCmpi, false)},
+		{mask: 0xffc0, match: 0x0c80, ea: eaDataAlterable, size: 4,
+			cycles: tRM(8, 14, 8, 12),
+			gen:    genImmediate(cmp, dCmpi, false)},
+
+		// neg
+		{mask: 0xffc0, match: 0x4000, ea: eaDataAlterable, size: 1,
+			cycles: tRM(4, 6, 8, 12), gen: genSingle(negx, dNegx)},
+		{mask: 0xffc0, match: 0x4040, ea: eaDataAlterable, size: 2,
+			cycles: tRM(4, 6, 8, 12), gen: genSingle(negx, dNegx)},
+		{mask: 0xffc0, match: 0x4080, ea: eaDataAlterable, size: 4,
+			cycles: tRM(4, 6, 8, 12), gen: genSingle(negx, dNegx)},
+		{mask: 0xffc0, match: 0x4400, ea: eaDataAlterable, size: 1,
+			cycles: tRM(4, 6, 8, 12), gen: genSingle(neg, dNeg)},
+		{mask: 0xffc0, match: 0x4440, ea: eaDataAlterable, size: 2,
+			cycles: tRM(4, 6, 8, 12), gen: genSingle(neg, dNeg)},
+		{mask: 0xffc0, match: 0x4480, ea: eaDataAlterable, size: 4,
+			cycles: tRM(4, 6, 8, 12), gen: genSingle(neg, dNeg)},
+
+		// logical
+		{mask: 0xf1c0, match: 0xc000, ea: eaData, size: 1,
+			cycles: tDyadic(4, 6), gen: genDyadic(and, dAnd, true)},
+		{mask: 0xf1c0, match: 0xc040, ea: eaData, size: 2,
+			cycles: tDyadic(4, 6), gen: genDyadic(and, dAnd, true)},
+		{mask: 0xf1c0, match: 0xc080, ea: eaData, size: 4,
+			cycles: tDyadic(4, 6), gen: genDyadic(and, dAnd, true)},
+		{mask: 0xf1c0, match: 0xc100, ea: eaMemoryAlterable, size: 1,
+			cycles: tEA(8, 12), gen: genDyadic(and, dAnd, true)},
+		{mask: 0xf1c0, match: 0xc140, ea: eaMemoryAlterable, size: 2,
+			cycles: tEA(8, 12), gen: genDyadic(and, dAnd, true)},
+		{mask: 0xf1c0, match: 0xc180, ea: eaMemoryAlterable, size: 4,
+			cycles: tEA(8, 12), gen: genDyadic(and, dAnd, true)},
+		{mask: 0xf1c0, match: 0x8000, ea: eaData, size: 1,
+			cycles: tDyadic(4, 6), gen: genDyadic(or, dOr, true)},
+		{mask: 0xf1c0, match: 0x8040, ea: eaData, size: 2,
+			cycles: tDyadic(4, 6), gen: genDyadic(or, dOr, true)},
+		{mask: 0xf1c0, match: 0x8080, ea: eaData, size: 4,
+			cycles: tDyadic(4, 6), gen: genDyadic(or, dOr, true)},
+		{mask: 0xf1c0, match: 0x8100, ea: eaMemoryAlterable, size: 1,
+			cycles: tEA(8, 12), gen: genDyadic(or, dOr, true)},
+		{mask: 0xf1c0, match: 0x8140, ea: eaMemoryAlterable, size: 2,
+			cycles: tEA(8, 12), gen: genDyadic(or, dOr, true)},
+		{mask: 0xf1c0, match: 0x8180, ea: eaMemoryAlterable, size: 4,
+			cycles: tEA(8, 12), gen: genDyadic(or, dOr, true)},
+		{mask: 0xf1c0, match: 0xb100, ea: eaDataAlterable, size: 1,
+			cycles: tRM(4, 8, 8, 12),
+			gen:    genDyadic(eor, dEor, true)},
+		{mask: 0xf1c0, match: 0xb140, ea: eaDataAlterable, size: 2,
+			cycles: tRM(4, 8, 8, 12),
+			gen:    genDyadic(eor, dEor, true)},
+		{mask: 0xf1c0, match: 0xb180, ea: eaDataAlterable, size: 4,
+			cycles: tRM(4, 8, 8, 12),
+			gen:    genDyadic(eor, dEor, true)},
+		{mask: 0xffff, match: 0x023c, size: 1, cycles: tFixed(20),
+			gen: genStatus(andiCCR, dAndi)},
+		{mask: 0xffff, match: 0x027c, size: 2, cycles: tFixed(20),
+			privileged: true, gen: genStatus(andiSR, dAndi)},
+		{mask: 0xffc0, match: 0x0200, ea: eaDataAlterable, size: 1,
+			cycles: tRM(8, 14, 12, 20),
+			gen:    genImmediate(and, dAndi, true)},
+		{mask: 0xffc0, match: 0x0240, ea: eaDataAlterable, size: 2,
+			cycles: tRM(8, 14, 12, 20),
+			gen:    genImmediate(and, dAndi, true)},
+		{mask: 0xffc0, match: 0x0280, ea: eaDataAlterable, size: 4,
+			cycles: tRM(8, 14, 12, 20),
+			gen:    genImmediate(and, dAndi, true)},
+		{mask: 0xffff, match: 0x003c, size: 1, cycles: tFixed(20),
+			gen: genStatus(oriCCR, dOri)},
+		{mask: 0xffff, match: 0x007c, size: 2, cycles: tFixed(20),
+			privileged: true, gen: genStatus(oriSR, dOri)},
+		{mask: 0xffc0, match: 0x0000, ea: eaDataAlterable, size: 1,
+			cycles: tRM(8, 16, 12, 20),
+			gen:    genImmediate(or, dOri, true)},
+		{mask: 0xffc0, match: 0x0040, ea: eaDataAlterable, size: 2,
+			cycles: tRM(8, 16, 12, 20),
+			gen:    genImmediate(or, dOri, true)},
+		{mask: 0xffc0, match: 0x0080, ea: eaDataAlterable, size: 4,
+			cycles: tRM(8, 16, 12, 20),
+			gen:    genImmediate(or, dOri, true)},
+		{mask: 0xffff, match: 0x0a3c, size: 1, cycles: tFixed(20),
+			gen: genStatus(eoriCCR, dEori)},
+		{mask: 0xffff, match: 0x0a7c, size: 2, cycles: tFixed(20),
+			privileged: true, gen: genStatus(eoriSR, dEori)},
+		{mask: 0xffc0, match: 0x0a00, ea: eaDataAlterable, size: 1,
+			cycles: tRM(8, 16, 12, 20),
+			gen:    genImmediate(eor, dEori, true)},
+		{mask: 0xffc0, match: 0x0a40, ea: eaDataAlterable, size: 2,
+			cycles: tRM(8, 16, 12, 20),
+			gen:    genImmediate(eor, dEori, true)},
+		{mask: 0xffc0, match: 0x0a80, ea: eaDataAlterable, size: 4,
+			cycles: tRM(8, 16, 12, 20),
+			gen:    genImmediate(eor, dEori, true)},
+		{mask: 0xffc0, match: 0x4600, ea: eaDataAlterable, size: 1,
+			cycles: tRM(4, 6, 8, 12), gen: genSingle(not, dNot)},
+		{mask: 0xffc0, match: 0x4640, ea: eaDataAlterable, size: 2,
+			cycles: tRM(4, 6, 8, 12), gen: genSingle(not, dNot)},
+		{mask: 0xffc0, match: 0x4680, ea: eaDataAlterable, size: 4,
+			cycles: tRM(4, 6, 8, 12), gen: genSingle(not, dNot)},
+
+		// status register
+		{mask: 0xffc0, match: 0x44c0, ea: eaData, size: 2,
+			cycles: tEA(12, 12),
+			gen:    genSource(moveToCCR, dMoveToCCR)},
+		{mask: 0xffc0, match: 0x46c0, ea: eaData, size: 2,
+			cycles: tEA(12, 12), privileged: true,
+			gen: genSource(moveToSR, dMoveToSR)},
+		{mask: 0xffc0, match: 0x40c0, ea: eaDataAlterable, size: 2,
+			cycles: tRM(6, 6, 8, 8),
+			gen:    genDestination(moveFromSR, dMoveFromSR)},
+		{mask: 0xfff8, match: 0x4e60, size: 4, cycles: tFixed(4),
+			privileged: true, gen: genMoveUSP},
+		{mask: 0xfff8, match: 0x4e68, size: 4, cycles: tFixed(4),
+			privileged: true, gen: genMoveUSP},
+
+		// shift and rotate
+		{mask: 0xf1d8, match: 0xe000, size: 1, cycles: tSize(6, 8),
+			gen: genShift(asr, dAsr)},
+		{mask: 0xf1d8, match: 0xe040, size: 2, cycles: tSize(6, 8),
+			gen: genShift(asr, dAsr)},
+		{mask: 0xf1d8, match: 0xe080, size: 4, cycles: tSize(6, 8),
+			gen: genShift(asr, dAsr)},
+		{mask: 0xffc0, match: 0xe0c0, ea: eaMemoryAlterable, size: 2,
+			cycles: tEA(8, 8), gen: genShiftMemory(asr, dAsr)},
+		{mask: 0xf1d8, match: 0xe100, size: 1, cycles: tSize(6, 8),
+			gen: genShift(asl, dAsl)},
+		{mask: 0xf1d8, match: 0xe140, size: 2, cycles: tSize(6, 8),
+			gen: genShift(asl, dAsl)},
+		{mask: 0xf1d8, match: 0xe180, size: 4, cycles: tSize(6, 8),
+			gen: genShift(asl, dAsl)},
+		{mask: 0xffc0, match: 0xe1c0, ea: eaMemoryAlterable, size: 2,
+			cycles: tEA(8, 8), gen: genShiftMemory(asl, dAsl)},
+		{mask: 0xf1d8, match: 0xe008, size: 1, cycles: tSize(6, 8),
+			gen: genShift(lsr, dLsr)},
+		{mask: 0xf1d8, match: 0xe048, size: 2, cycles: tSize(6, 8),
+			gen: genShift(lsr, dLsr)},
+		{mask: 0xf1d8, match: 0xe088, size: 4, cycles: tSize(6, 8),
+			gen: genShift(lsr, dLsr)},
+		{mask: 0xffc0, match: 0xe2c0, ea: eaMemoryAlterable, size: 2,
+			cycles: tEA(8, 8), gen: genShiftMemory(lsr, dLsr)},
+		{mask: 0xf1d8, match: 0xe108, size: 1, cycles: tSize(6, 8),
+			gen: genShift(lsl, dLsl)},
+		{mask: 0xf1d8, match: 0xe148, size: 2, cycles: tSize(6, 8),
+			gen: genShift(lsl, dLsl)},
+		{mask: 0xf1d8, match: 0xe188, size: 4, cycles: tSize(6, 8),
+			gen: genShift(lsl, dLsl)},
+		{mask: 0xffc0, match: 0xe3c0, ea: eaMemoryAlterable, size: 2,
+			cycles: tEA(8, 8), gen: genShiftMemory(lsl, dLsl)},
+		{mask: 0xf1d8, match: 0xe010, size: 1, cycles: tSize(6, 8),
+			gen: genShift(roxr, dRoxr)},
+		{mask: 0xf1d8, match: 0xe050, size: 2, cycles: tSize(6, 8),
+			gen: genShift(roxr, dRoxr)},
+		{mask: 0xf1d8, match: 0xe090, size: 4, cycles: tSize(6, 8),
+			gen: genShift(roxr, dRoxr)},
+		{mask: 0xffc0, match: 0xe4c0, ea: eaMemoryAlterable, size: 2,
+			cycles: tEA(8, 8), gen: genShiftMemory(roxr, dRoxr)},
+		{mask: 0xf1d8, match: 0xe110, size: 1, cycles: tSize(6, 8),
+			gen: genShift(roxl, dRoxl)},
+		{mask: 0xf1d8, match: 0xe150, size: 2, cycles: tSize(6, 8),
+			gen: genShift(roxl, dRoxl)},
+		{mask: 0xf1d8, match: 0xe190, size: 4, cycles: tSize(6, 8),
+			gen: genShift(roxl, dRoxl)},
+		{mask: 0xffc0, match: 0xe5c0, ea: eaMemoryAlterable, size: 2,
+			cycles: tEA(8, 8), gen: genShiftMemory(roxl, dRoxl)},
+		{mask: 0xf1d8, match: 0xe018, size: 1, cycles: tSize(6, 8),
+			gen: genShift(ror, dRor)},
+		{mask: 0xf1d8, match: 0xe058, size: 2, cycles: tSize(6, 8),
+			gen: genShift(ror, dRor)},
+		{mask: 0xf1d8, match: 0xe098, size: 4, cycles: tSize(6, 8),
+			gen: genShift(ror, dRor)},
+		{mask: 0xffc0, match: 0xe6c0, ea: eaMemoryAlterable, size: 2,
+			cycles: tEA(8, 8), gen: genShiftMemory(ror, dRor)},
+		{mask: 0xf1d8, match: 0xe118, size: 1, cycles: tSize(6, 8),
+			gen: genShift(rol, dRol)},
+		{mask: 0xf1d8, match: 0xe158, size: 2, cycles: tSize(6, 8),
+			gen: genShift(rol, dRol)},
+		{mask: 0xf1d8, match: 0xe198, size: 4, cycles: tSize(6, 8),
+			gen: genShift(rol, dRol)},
+		{mask: 0xffc0, match: 0xe7c0, ea: eaMemoryAlterable, size: 2,
+			cycles: tEA(8, 8), gen: genShiftMemory(rol, dRol)},
+
+		// program control
+		{mask: 0xf000, match: 0x6000, cycles: tBranch, gen: genBranch},
+		{mask: 0xf0f8, match: 0x50c8, size: 2, cycles: tFixed(12),
+			gen: genDbcc},
+		{mask: 0xf0c0, match: 0x50c0, ea: eaDataAlterable, size: 1,
+			cycles: tRM(4, 4, 8, 8),
+			gen:    genDestination(scc, dScc)},
+		{mask: 0xffc0, match: 0x4ec0, ea: eaControl,
+			cycles: tControl(8, 10, 14, 10, 12, 10, 14),
+			gen:    genControl(jmp, dJmp)},
+		{mask: 0xffc0, match: 0x4e80, ea: eaControl,
+			cycles: tControl(16, 18, 22, 18, 20, 18, 22),
+			gen:    genControl(jsr, dJsr)},
+		{mask: 0xffff, match: 0x4e71, cycles: tFixed(4),
+			gen: genImplied(nop, dNop)},
+		{mask: 0xffff, match: 0x4e72, size: 2, cycles: tFixed(4),
+			privileged: true, gen: genStatus(stop, dStop)},
+		{mask: 0xffff, match: 0x4e70, cycles: tFixed(132),
+			privileged: true, gen: genImplied(reset, dReset)},
+		{mask: 0xffff, match: 0x4e73, cycles: tFixed(20),
+			privileged: true, gen: genImplied(rte, dRte)},
+		{mask: 0xffff, match: 0x4e75, cycles: tFixed(16),
+			gen: genImplied(rts, dRts)},
+		{mask: 0xffff, match: 0x4e77, cycles: tFixed(20),
+			gen: genImplied(rtr, dRtr)},
+
+		// exceptions
+		{mask: 0xfff0, match: 0x4e40, cycles: tFixed(34),
+			gen: genImplied(trap, dTrap)},
+		{mask: 0xffff, match: 0x4e76, cycles: tFixed(4),
+			gen: genImplied(trapv, dTrapv)},
+		{mask: 0xffff, match: 0x4afc, cycles: tFixed(34),
+			gen: genImplied(illegal, dIllegal)},
+		{mask: 0xf1c0, match: 0x4180, ea: eaData, size: 2,
+			cycles: tEA(10, 10), gen: genLong(chk, dChk)},
+
+		// multiply and divide
+		{mask: 0xf1c0, match: 0xc0c0, ea: eaData, size: 2,
+			cycles: tEA(38, 38), gen: genLong(mulu, dMulu)},
+		{mask: 0xf1c0, match: 0xc1c0, ea: eaData, size: 2,
+			cycles: tEA(38, 38), gen: genLong(muls, dMuls)},
+		{mask: 0xf1c0, match: 0x80c0, ea: eaData, size: 2,
+			cycles: tEA(0, 0), gen: genLong(divu, dDivu)},
+		{mask: 0xf1c0, match: 0x81c0, ea: eaData, size: 2,
+			cycles: tEA(0, 0), gen: genLong(divs, dDivs)},
+
+		// binary coded decimal
+		{mask: 0xf1f0, match: 0xc100, size: 1, cycles: tX(6, 6, 18, 18),
+			gen: genX(abcd, dAbcd)},
+		{mask: 0xf1f0, match: 0x8100, size: 1, cycles: tX(6, 6, 18, 18),
+			gen: genX(sbcd, dSbcd)},
+		{mask: 0xffc0, match: 0x4800, ea: eaDataAlterable, size: 1,
+			cycles: tRM(6, 6, 8, 8), gen: genSingle(nbcd, dNbcd)},
+
+		// data movement
+		{mask: 0xf1c0, match: 0x41c0, ea: eaControl, size: 4,
+			cycles: tControl(4, 8, 12, 8, 12, 8, 12), gen: genLea},
+		{mask: 0xffc0, match: 0x4840, ea: eaControl, size: 4,
+			cycles: tControl(12, 16, 20, 16, 20, 16, 20),
+			gen:    genControl(pea, dPea)},
+		{mask: 0xfff8, match: 0x4e50, size: 2, cycles: tFixed(16),
+			gen: genWord(link, dLink)},
+		{mask: 0xfff8, match: 0x4e58, cycles: tFixed(12),
+			gen: genImplied(unlk, dUnlk)},
+		{mask: 0xf1f8, match: 0xc140, cycles: tFixed(6),
+			gen: genImplied(exg, dExg)},
+		{mask: 0xf1f8, match: 0xc148, cycles: tFixed(6),
+			gen: genImplied(exg, dExg)},
+		{mask: 0xf1f8, match: 0xc188, cycles: tFixed(6),
+			gen: genImplied(exg, dExg)},
+		{mask: 0xffc0, match: 0x4880, ea: eaControlAlterable | eaPd,
+			size: 2, cycles: tMovem(4),
+			gen: genMovem(movemToMemory, dMovem)},
+		{mask: 0xffc0, match: 0x48c0, ea: eaControlAlterable | eaPd,
+			size: 4, cycles: tMovem(4),
+			gen: genMovem(movemToMemory, dMovem)},
+		{mask: 0xffc0, match: 0x4c80, ea: eaControl | eaPi, size: 2,
+			cycles: tMovem(8),
+			gen:    genMovem(movemToRegisters, dMovem)},
+		{mask: 0xffc0, match: 0x4cc0, ea: eaControl | eaPi, size: 4,
+			cycles: tMovem(8),
+			gen:    genMovem(movemToRegisters, dMovem)},
+		{mask: 0xf1f8, match: 0x0108, size: 2, cycles: tSize(16, 24),
+			gen: genWord(movep, dMovep)},
+		{mask: 0xf1f8, match: 0x0148, size: 4, cycles: tSize(16, 24),
+			gen: genWord(movep, dMovep)},
+		{mask: 0xf1f8, match: 0x0188, size: 2, cycles: tSize(16, 24),
+			gen: genWord(movep, dMovep)},
+		{mask: 0xf1f8, match: 0x01c8, size: 4, cycles: tSize(16, 24),
+			gen: genWord(movep, dMovep)},
+
+		// miscellaneous
+		{mask: 0xfff8, match: 0x4840, size: 4, cycles: tFixed(4),
+			gen: genSingle(swap, dSwap)},
+		{mask: 0xfff8, match: 0x4880, size: 2, cycles: tFixed(4),
+			gen: genSingle(ext, dExt)},
+		{mask: 0xfff8, match: 0x48c0, size: 4, cycles: tFixed(4),
+			gen: genSingle(ext, dExt)},
+		{mask: 0xffc0, match: 0x4200, ea: eaDataAlterable, size: 1,
+			cycles: tRM(4, 6, 8, 12),
+			gen:    genDestination(clr, dClr)},
+		{mask: 0xffc0, match: 0x4240, ea: eaDataAlterable, size: 2,
+			cycles: tRM(4, 6, 8, 12),
+			gen:    genDestination(clr, dClr)},
+		{mask: 0xffc0, match: 0x4280, ea: eaDataAlterable, size: 4,
+			cycles: tRM(4, 6, 8, 12),
+			gen:    genDestination(clr, dClr)},
+		{mask: 0xffc0, match: 0x4a00, ea: eaDataAlterable, size: 1,
+			cycles: tEA(4, 4), gen: genSource(tst, dTst)},
+		{mask: 0xffc0, match: 0x4a40, ea: eaDataAlterable, size: 2,
+			cycles: tEA(4, 4), gen: genSource(tst, dTst)},
+		{mask: 0xffc0, match: 0x4a80, ea: eaDataAlterable, size: 4,
+			cycles: tEA(4, 4), gen: genSource(tst, dTst)},
+		{mask: 0xffc0, match: 0x4ac0, ea: eaDataAlterable, size: 1,
+			cycles: tRM(4, 4, 10, 10), gen: genTas},
+
+		// bit manipulation
+		{mask: 0xf1c0, match: 0x0100, ea: eaData,
+			cycles: tRM(6, 6, 4, 4),
+			gen:    genBit(btst, dBtst, false)},
+		{mask: 0xf1c0, match: 0x0140, ea: eaDataAlterable,
+			cycles: tRM(6, 6, 8, 8),
+			gen:    genBit(bchg, dBchg, true)},
+		{mask: 0xf1c0, match: 0x0180, ea: eaDataAlterable,
+			cycles: tRM(8, 8, 8, 8),
+			gen:    genBit(bclr, dBclr, true)},
+		{mask: 0xf1c0, match: 0x01c0, ea: eaDataAlterable,
+			cycles: tRM(6, 6, 8, 8),
+			gen:    genBit(bset, dBset, true)},
+		{mask: 0xffc0, match: 0x0800, ea: eaData &^ eaImm,
+			cycles: tRM(10, 10, 8, 8),
+			gen:    genBit(btst, dBtst, false)},
+		{mask: 0xffc0, match: 0x0840, ea: eaDataAlterable,
+			cycles: tRM(10, 10, 12, 12),
+			gen:    genBit(bchg, dBchg, true)},
+		{mask: 0xffc0, match: 0x0880, ea: eaDataAlterable,
+			cycles: tRM(12, 12, 12, 12),
+			gen:    genBit(bclr, dBclr, true)},
+		{mask: 0xffc0, match: 0x08c0, ea: eaDataAlterable,
+			cycles: tRM(10, 10, 12, 12),
+			gen:    genBit(bset, dBset, true)},
+	}
+
+	opcodes = generate(patterns68000)
+)
+
+// genMove generates move <ea>,<ea>.
+func genMove(opcode uint16, size uint32) instruction {
+	sm, sr := mr(opcode, 5)
+	dm, dr := rm(opcode, 11)
+	operandSize := extensionSize(sm, sr, size) + extensionSize(dm, dr, size)
+
+	return instruction{
+		disassemble:      dMove,
+		size:             size,
+		operandSize:      operandSize,
+		fetchOperand:     operandFetcher(operandSize),
+		fetchSource:      fetchEA,
+		source:           uint32(sm<<3 | sr),
+		fetchDestination: addressEA,
+		storeDestination: storeEA,
+		destination:      uint32(dm<<3 | dr),
+		execute:          move,
+	}
+}
+
+// genDyadic returns a generator for <ea>,Dn and Dn,<ea> instructions where
+// bit 8 selects the direction.  The result is discarded if store is false.
+func genDyadic(execute executer, disassemble disassembler, store bool) generator {
+	return func(opcode uint16, size uint32) instruction {
+		register, _ := mr(opcode, 11)
+		m, r := mr(opcode, 5)
+		operandSize := extensionSize(m, r, size)
+
+		i := instruction{
+			disassemble:      disassemble,
+			size:             size,
+			operandSize:      operandSize,
+			fetchOperand:     operandFetcher(operandSize),
+			fetchSource:      fetchEA,
+			fetchDestination: fetchEA,
+			storeDestination: storeEA,
+			execute:          execute,
+		}
+		if opcode&0x0100 == 0 {
+			// <ea>,Dn
+			i.source = uint32(m<<3 | r)
+			i.destination = uint32(register)
+		} else {
+			// Dn,<ea>
+			i.source = uint32(register)
+			i.destination = uint32(m<<3 | r)
+		}
+		if !store {
+			i.storeDestination = storeNop
+		}
+
+		return i
+	}
+}
+
+// genAddress returns a generator for <ea>,An instructions.  The address
+// register is always operated on as a long.
+func genAddress(execute executer, disassemble disassembler, store bool) generator {
+	return func(opcode uint16, size uint32) instruction {
+		register, _ := mr(opcode, 11)
+		m, r := mr(opcode, 5)
+		operandSize := extensionSize(m, r, size)
+
+		i := instruction{
+			disassemble:      disassemble,
+			size:             size,
+			operandSize:      operandSize,
+			fetchOperand:     operandFetcher(operandSize),
+			fetchSource:      fetchEA,
+			source:           uint32(m<<3 | r),
+			fetchDestination: fetchAn,
 			storeDestination: storeAn,
-			destination:      2,
-			execute:          movel,
-		},
-		0x2481: {
-			// move.l d1,(a2)
-			disassemble:      dMove,
+			destination:      uint32(register),
+			execute:          execute,
+		}
+		if !store {
+			i.storeDestination = storeNop
+		}
+
+		return i
+	}
+}
+
+// genImmediate returns a generator for #<data>,<ea> instructions.
+func genImmediate(execute executer, disassemble disassembler, store bool) generator {
+	return func(opcode uint16, size uint32) instruction {
+		m, r := mr(opcode, 5)
+		operandSize := extensionSize(0x07, 0x04, size) +
+			extensionSize(m, r, size)
+
+		i := instruction{
+			disassemble:      disassemble,
+			size:             size,
+			operandSize:      operandSize,
+			fetchOperand:     operandFetcher(operandSize),
+			fetchSource:      fetchEA,
+			source:           0x3c, // #<data>
+			fetchDestination: fetchEA,
+			storeDestination: storeEA,
+			destination:      uint32(m<<3 | r),
+			execute:          execute,
+		}
+		if !store {
+			i.storeDestination = storeNop
+		}
+
+		return i
+	}
+}
+
+// genQuick returns a generator for #<1-8>,<ea> instructions.  Address
+// register destinations use executeAn and are always operated on as a long.
+func genQuick(execute, executeAn executer, disassemble disassembler) generator {
+	return func(opcode uint16, size uint32) instruction {
+		data, _ := mr(opcode, 11)
+		if data == 0 {
+			data = 8
+		}
+		m, r := mr(opcode, 5)
+		operandSize := extensionSize(m, r, size)
+
+		i := instruction{
+			disassemble:      disassemble,
+			size:             size,
+			operandSize:      operandSize,
+			fetchOperand:     operandFetcher(operandSize),
+			fetchSource:      fetchData,
+			source:           uint32(data),
+			fetchDestination: fetchEA,
+			storeDestination: storeEA,
+			destination:      uint32(m<<3 | r),
+			execute:          execute,
+		}
+		if m == 0x01 {
+			i.fetchDestination = fetchAn
+			i.storeDestination = storeAn
+			i.destination = uint32(r)
+			i.execute = executeAn
+		}
+
+		return i
+	}
+}
+
+// genX returns a generator for the Dy,Dx and -(Ay),-(Ax) multi precision
+// instructions.
+func genX(execute executer, disassemble disassembler) generator {
+	return func(opcode uint16, size uint32) instruction {
+		rx, _ := mr(opcode, 11)
+		_, ry := mr(opcode, 5)
+		var mode uint16
+		if opcode&0x0008 != 0 {
+			mode = 0x04 // -(An)
+		}
+
+		return instruction{
+			disassemble:      disassemble,
+			size:             size,
 			fetchOperand:     fetchOperandNop,
-			fetchSource:      fetchDn,
-			source:           1,
+			fetchSource:      fetchEA,
+			source:           uint32(mode<<3 | ry),
+			fetchDestination: fetchEA,
+			storeDestination: storeEA,
+			destination:      uint32(mode<<3 | rx),
+			execute:          execute,
+		}
+	}
+}
+
+// genCmpm generates cmpm (Ay)+,(Ax)+.
+func genCmpm(opcode uint16, size uint32) instruction {
+	rx, _ := mr(opcode, 11)
+	_, ry := mr(opcode, 5)
+
+	return instruction{
+		disassemble:      dCmpm,
+		size:             size,
+		fetchOperand:     fetchOperandNop,
+		fetchSource:      fetchEA,
+		source:           uint32(0x03<<3 | ry),
+		fetchDestination: fetchEA,
+		storeDestination: storeNop,
+		destination:      uint32(0x03<<3 | rx),
+		execute:          cmp,
+	}
+}
+
+// genSingle returns a generator for single operand <ea> instructions.
+func genSingle(execute executer, disassemble disassembler) generator {
+	return func(opcode uint16, size uint32) instruction {
+		m, r := mr(opcode, 5)
+		operandSize := extensionSize(m, r, size)
+
+		return instruction{
+			disassemble:      disassemble,
+			size:             size,
+			operandSize:      operandSize,
+			fetchOperand:     operandFetcher(operandSize),
+			fetchSource:      fetchNop,
+			fetchDestination: fetchEA,
+			storeDestination: storeEA,
+			destination:      uint32(m<<3 | r),
+			execute:          execute,
+		}
+	}
+}
+
+// genTas generates tas <ea>.  A memory destination is only addressed, tas
+// reads and writes it in one bus cycle.
+func genTas(opcode uint16, size uint32) instruction {
+	i := genSingle(tas, dTas)(opcode, size)
+	if i.destination>>3 != 0x00 {
+		i.fetchDestination = addressEA
+		i.storeDestination = storeNop
+	}
+	return i
+}
+
+// genSource returns a generator for instructions that only read <ea>.
+func genSource(execute executer, disassemble disassembler) generator {
+	return func(opcode uint16, size uint32) instruction {
+		m, r := mr(opcode, 5)
+		operandSize := extensionSize(m, r, size)
+
+		return instruction{
+			disassemble:      disassemble,
+			size:             size,
+			operandSize:      operandSize,
+			fetchOperand:     operandFetcher(operandSize),
+			fetchSource:      fetchEA,
+			source:           uint32(m<<3 | r),
 			fetchDestination: fetchNop,
-			storeDestination: storeAnIndirect,
-			destination:      2,
-			execute:          movel,
-		},
-		0xd5c1: {
-			// adda.l d1,a2
-			disassemble:      dAdd,
+			storeDestination: storeNop,
+			execute:          execute,
+		}
+	}
+}
+
+// genDestination returns a generator for instructions that only write <ea>.
+func genDestination(execute executer, disassemble disassembler) generator {
+	return func(opcode uint16, size uint32) instruction {
+		m, r := mr(opcode, 5)
+		operandSize := extensionSize(m, r, size)
+
+		return instruction{
+			disassemble:      disassemble,
+			size:             size,
+			operandSize:      operandSize,
+			fetchOperand:     operandFetcher(operandSize),
+			fetchSource:      fetchNop,
+			fetchDestination: addressEA,
+			storeDestination: storeEA,
+			destination:      uint32(m<<3 | r),
+			execute:          execute,
+		}
+	}
+}
+
+// genStatus returns a generator for the #<data>,CCR and #<data>,SR
+// instructions.
+func genStatus(execute executer, disassemble disassembler) generator {
+	return func(opcode uint16, size uint32) instruction {
+		return instruction{
+			disassemble:      disassemble,
+			size:             size,
+			operandSize:      2,
+			fetchOperand:     fetchOperand,
+			fetchSource:      fetchEA,
+			source:           0x3c, // #<data>
+			fetchDestination: fetchNop,
+			storeDestination: storeNop,
+			execute:          execute,
+		}
+	}
+}
+
+// genMoveUSP generates move An,USP and move USP,An.
+func genMoveUSP(opcode uint16, size uint32) instruction {
+	_, r := mr(opcode, 5)
+
+	i := instruction{
+		disassemble:      dMoveUSP,
+		size:             size,
+		fetchOperand:     fetchOperandNop,
+		fetchSource:      fetchAn,
+		source:           uint32(r),
+		fetchDestination: fetchNop,
+		storeDestination: storeNop,
+		execute:          moveToUSP,
+	}
+	if opcode&0x0008 != 0 {
+		i.fetchSource = fetchNop
+		i.storeDestination = storeAn
+		i.destination = uint32(r)
+		i.execute = moveFromUSP
+	}
+
+	return i
+}
+
+// genShift returns a generator for the shift and rotate register forms.  Bit
+// 5 selects between an immediate count of 1-8 and a count register.
+func genShift(execute executer, disassemble disassembler) generator {
+	return func(opcode uint16, size uint32) instruction {
+		count, _ := mr(opcode, 11)
+		_, r := mr(opcode, 5)
+
+		i := instruction{
+			disassemble:      disassemble,
+			size:             size,
 			fetchOperand:     fetchOperandNop,
+			fetchSource:      fetchData,
+			source:           uint32(count),
+			fetchDestination: fetchEA,
+			storeDestination: storeEA,
+			destination:      uint32(r),
+			execute:          execute,
+		}
+		if opcode&0x0020 != 0 {
+			i.fetchSource = fetchDn
+		} else if count == 0 {
+			i.source = 8
+		}
+
+		return i
+	}
+}
+
+// genShiftMemory returns a generator for the shift and rotate memory forms
+// which always shift a word by one bit.
+func genShiftMemory(execute executer, disassemble disassembler) generator {
+	return func(opcode uint16, size uint32) instruction {
+		i := genSingle(execute, disassemble)(opcode, size)
+		i.fetchSource = fetchData
+		i.source = 1
+		return i
+	}
+}
+
+// genImplied returns a generator for instructions without operands.
+func genImplied(execute executer, disassemble disassembler) generator {
+	return func(opcode uint16, size uint32) instruction {
+		return instruction{
+			disassemble:      disassemble,
+			size:             size,
+			fetchOperand:     fetchOperandNop,
+			fetchSource:      fetchNop,
+			fetchDestination: fetchNop,
+			storeDestination: storeNop,
+			execute:          execute,
+		}
+	}
+}
+
+// genBranch generates bra, bsr and bcc.  An 8 bit displacement of zero
+// selects a 16 bit displacement in the extension word.
+func genBranch(opcode uint16, size uint32) instruction {
+	i := instruction{
+		disassemble:      dBcc,
+		size:             1,
+		fetchOperand:     fetchOperandNop,
+		fetchSource:      fetchData,
+		source:           uint32(opcode & 0x00ff),
+		fetchDestination: fetchNop,
+		storeDestination: storeNop,
+		execute:          bcc,
+	}
+	if opcode&0x00ff == 0 {
+		i.size = 2
+		i.operandSize = 2
+		i.fetchOperand = fetchOperand
+		i.fetchSource = fetchEA
+		i.source = 0x3c // #<data>
+	}
+	if opcode&0x0f00 == 0x0100 {
+		i.execute = bsr
+	}
+
+	return i
+}
+
+// genDbcc generates dbcc Dn,<label>.
+func genDbcc(opcode uint16, size uint32) instruction {
+	_, r := mr(opcode, 5)
+
+	return instruction{
+		disassemble:      dDbcc,
+		size:             size,
+		operandSize:      2,
+		fetchOperand:     fetchOperand,
+		fetchSource:      fetchEA,
+		source:           0x3c, // #<data>
+		fetchDestination: fetchEA,
+		storeDestination: storeEA,
+		destination:      uint32(r),
+		execute:          dbcc,
+	}
+}
+
+// genControl returns a generator for instructions that operate on the
+// address of a control <ea>.
+func genControl(execute executer, disassemble disassembler) generator {
+	return func(opcode uint16, size uint32) instruction {
+		m, r := mr(opcode, 5)
+		operandSize := extensionSize(m, r, size)
+
+		return instruction{
+			disassemble:      disassemble,
+			size:             size,
+			operandSize:      operandSize,
+			fetchOperand:     operandFetcher(operandSize),
+			fetchSource:      fetchAddress,
+			source:           uint32(m<<3 | r),
+			fetchDestination: fetchNop,
+			storeDestination: storeNop,
+			execute:          execute,
+		}
+	}
+}
+
+// genLong returns a generator for <ea>,Dn instructions that operate on the
+// full data register, e.g. the word multiply and divide instructions.
+func genLong(execute executer, disassemble disassembler) generator {
+	return func(opcode uint16, size uint32) instruction {
+		register, _ := mr(opcode, 11)
+		m, r := mr(opcode, 5)
+		operandSize := extensionSize(m, r, size)
+
+		return instruction{
+			disassemble:      disassemble,
+			size:             size,
+			operandSize:      operandSize,
+			fetchOperand:     operandFetcher(operandSize),
+			fetchSource:      fetchEA,
+			source:           uint32(m<<3 | r),
+			fetchDestination: fetchDn,
+			storeDestination: storeDn,
+			destination:      uint32(register),
+			execute:          execute,
+		}
+	}
+}
+
+// genMoveq generates moveq #<data>,Dn.
+func genMoveq(opcode uint16, size uint32) instruction {
+	register, _ := mr(opcode, 11)
+
+	return instruction{
+		disassemble:      dMoveq,
+		size:             size,
+		fetchOperand:     fetchOperandNop,
+		fetchSource:      fetchData,
+		source:           signExtend(uint32(opcode&0x00ff), 1),
+		fetchDestination: fetchNop,
+		storeDestination: storeDn,
+		destination:      uint32(register),
+		execute:          move,
+	}
+}
+
+// genLea generates lea <ea>,An.
+func genLea(opcode uint16, size uint32) instruction {
+	register, _ := mr(opcode, 11)
+	i := genControl(lea, dLea)(opcode, size)
+	i.storeDestination = storeAn
+	i.destination = uint32(register)
+	return i
+}
+
+// genWord returns a generator for instructions followed by a single
+// extension word, e.g. a displacement.
+func genWord(execute executer, disassemble disassembler) generator {
+	return func(opcode uint16, size uint32) instruction {
+		return instruction{
+			disassemble:      disassemble,
+			size:             size,
+			operandSize:      2,
+			fetchOperand:     fetchOperand,
+			fetchSource:      fetchWord,
+			fetchDestination: fetchNop,
+			storeDestination: storeNop,
+			execute:          execute,
+		}
+	}
+}
+
+// genMovem returns a generator for movem and moves.  The register list or
+// register extension word precedes the extension words of <ea>.
+func genMovem(execute executer, disassemble disassembler) generator {
+	return func(opcode uint16, size uint32) instruction {
+		m, r := mr(opcode, 5)
+		operandSize := 2 + extensionSize(m, r, size)
+
+		return instruction{
+			disassemble:      disassemble,
+			size:             size,
+			operandSize:      operandSize,
+			fetchOperand:     fetchOperand,
+			fetchSource:      fetchWord,
+			fetchDestination: fetchData,
+			storeDestination: storeNop,
+			destination:      uint32(m<<3 | r),
+			execute:          execute,
+		}
+	}
+}
+
+// genBit returns a generator for the bit manipulation instructions.  Bit 8
+// selects between a bit number in a data register and in an extension word.
+// Data registers are operated on as a long and memory as a byte.
+func genBit(execute executer, disassemble disassembler, store bool) generator {
+	return func(opcode uint16, size uint32) instruction {
+		register, _ := mr(opcode, 11)
+		m, r := mr(opcode, 5)
+		size = 1
+		if m == 0x00 {
+			size = 4
+		}
+		operandSize := extensionSize(m, r, size)
+
+		i := instruction{
+			disassemble:      disassemble,
+			size:             size,
 			fetchSource:      fetchDn,
-			source:           1,
-			fetchDestination: fetchAn,
-			storeDestination: storeAn,
-			destination:      2,
-			execute:          addal,
-		},
+			source:           uint32(register),
+			fetchDestination: fetchEA,
+			storeDestination: storeEA,
+			destination:      uint32(m<<3 | r),
+			execute:          execute,
+		}
+		if opcode&0x0100 == 0 {
+			i.fetchSource = fetchWord
+			operandSize += 2
+		}
+		i.operandSize = operandSize
+		i.fetchOperand = operandFetcher(operandSize)
+		if !store {
+			i.storeDestination = storeNop
+		}
+
+		return i
 	}
-)
+}
@@ -0,0 +1,239 @@
+package m68000
+
+// Instruction execution times in clock periods per the MC68000 user's manual
+// section 8.  The opcode generator stores the time that can be derived from
+// the opcode in the instruction.  Data dependent time, e.g. taken branches,
+// shift counts and multiply and divide, is added during execution.
+
+// timing returns the execution time of opcode.
+type timing = func(opcode uint16, size uint32) int
+
+// Exception processing times.
+const (
+	cyclesGroup0    = 50 // bus and address error
+	cyclesGroup1    = 34 // illegal, privilege, trace, line 1010 and 1111
+	cyclesInterrupt = 44
+	cyclesCHK       = 30 // in addition to the instruction time
+	cyclesTRAPV     = 30 // in addition to the instruction time
+	cyclesDivide    = 38 // divide by zero in addition to the ea time
+)
+
+// eaTime is the effective address calculation time for byte and word operands
+// indexed by the eaBit bit number.  Long memory operands take 4 more clock
+// periods.
+var eaTime = [...]int{0, 0, 4, 4, 6, 8, 10, 8, 12, 8, 10, 4}
+
+// eaCycles returns the effective address calculation time of the mode and
+// register for an operand of size.
+func eaCycles(mode, reg uint16, size uint32) int {
+	n := mode
+	if mode == 7 {
+		n += reg
+	}
+	if n >= uint16(len(eaTime)) {
+		return 0
+	}
+	t := eaTime[n]
+	if size == 4 && mode > 1 {
+		t += 4
+	}
+	return t
+}
+
+// eaCyclesDestination returns the effective address calculation time of a
+// destination operand.  Predecrement is not penalized when writing.
+func eaCyclesDestination(mode, reg uint16, size uint32) int {
+	if mode == 0x04 {
+		mode = 0x02
+	}
+	return eaCycles(mode, reg, size)
+}
+
+// sized returns bw for byte and word operations and l for long operations.
+func sized(size uint32, bw, l int) int {
+	if size == 4 {
+		return l
+	}
+	return bw
+}
+
+// tFixed returns a timing of n clock periods.
+func tFixed(n int) timing {
+	return func(opcode uint16, size uint32) int {
+		return n
+	}
+}
+
+// tSize returns a timing that only depends on the operation size.
+func tSize(bw, l int) timing {
+	return func(opcode uint16, size uint32) int {
+		return sized(size, bw, l)
+	}
+}
+
+// tEA returns a timing of the base time plus the calculation time of the
+// <ea> in bits 5-0.
+func tEA(bw, l int) timing {
+	return func(opcode uint16, size uint32) int {
+		m, r := mr(opcode, 5)
+		return sized(size, bw, l) + eaCycles(m, r, size)
+	}
+}
+
+// tDyadic returns a timing for <ea>,Dn and <ea>,An instructions.  Long
+// operations with a register or immediate source take 2 more clock periods.
+func tDyadic(bw, l int) timing {
+	return func(opcode uint16, size uint32) int {
+		m, r := mr(opcode, 5)
+		t := sized(size, bw, l) + eaCycles(m, r, size)
+		if size == 4 && (m < 2 || m == 7 && r == 4) {
+			t += 2
+		}
+		return t
+	}
+}
+
+// tRM returns a timing for instructions whose time differs for register and
+// memory operands in bits 5-0.  Memory operands add the ea calculation time.
+func tRM(registerBW, registerL, memoryBW, memoryL int) timing {
+	return func(opcode uint16, size uint32) int {
+		m, r := mr(opcode, 5)
+		if m < 2 {
+			return sized(size, registerBW, registerL)
+		}
+		return sized(size, memoryBW, memoryL) + eaCycles(m, r, size)
+	}
+}
+
+// tX returns a timing for the Dy,Dx and -(Ay),-(Ax) instructions.
+func tX(registerBW, registerL, memoryBW, memoryL int) timing {
+	return func(opcode uint16, size uint32) int {
+		if opcode&0x0008 != 0 {
+			return sized(size, memoryBW, memoryL)
+		}
+		return sized(size, registerBW, registerL)
+	}
+}
+
+// tMove returns the timing of move and movea.
+func tMove(opcode uint16, size uint32) int {
+	sm, sr := mr(opcode, 5)
+	dm, dr := rm(opcode, 11)
+	return 4 + eaCycles(sm, sr, size) + eaCyclesDestination(dm, dr, size)
+}
+
+// tQuick returns the timing of addq and subq.
+func tQuick(opcode uint16, size uint32) int {
+	m, r := mr(opcode, 5)
+	switch m {
+	case 0x00:
+		return sized(size, 4, 8)
+	case 0x01:
+		return 8
+	}
+	return sized(size, 8, 12) + eaCycles(m, r, size)
+}
+
+// tControl returns a timing for the control addressing modes in the order
+// (An), (d16,An), (d8,An,Xn), (xxx).W, (xxx).L, (d16,PC) and (d8,PC,Xn).
+func tControl(times ...int) timing {
+	return func(opcode uint16, size uint32) int {
+		m, r := mr(opcode, 5)
+		switch m {
+		case 0x02:
+			return times[0]
+		case 0x05:
+			return times[1]
+		case 0x06:
+			return times[2]
+		}
+		return times[3+r]
+	}
+}
+
+// tMovem returns the timing of movem excluding the per register time.  The ea
+// calculation time is always that of a word operand.
+func tMovem(base int) timing {
+	return func(opcode uint16, size uint32) int {
+		m, r := mr(opcode, 5)
+		return base + eaCyclesDestination(m, r, 2)
+	}
+}
+
+// tBranch returns the timing of a branch that is not taken.  Taken branches
+// take 10 clock periods and bsr always takes 18.
+func tBranch(opcode uint16, size uint32) int {
+	switch {
+	case opcode&0x0f00 == 0x0100:
+		return 18
+	case opcode&0x00ff == 0:
+		return 12
+	}
+	return 8
+}
+
+// divuCycles returns the execution time of divu excluding the ea calculation
+// time.  The microcode performs a non restoring division and the time depends
+// on the quotient bits.
+func divuCycles(dividend uint32, divisor uint16) int {
+	hdivisor := uint32(divisor) << 16
+	if dividend >= hdivisor {
+		// overflow
+		return 10
+	}
+
+	mcycles := 38
+	for i := 0; i < 15; i++ {
+		carried := dividend&0x80000000 != 0
+		dividend <<= 1
+		switch {
+		case carried:
+			dividend -= hdivisor
+		case dividend >= hdivisor:
+			dividend -= hdivisor
+			mcycles++
+		default:
+			mcycles += 2
+		}
+	}
+	return mcycles * 2
+}
+
+// divsCycles returns the execution time of divs excluding the ea calculation
+// time.
+func divsCycles(dividend int32, divisor int16) int {
+	mcycles := 6
+	if dividend < 0 {
+		mcycles++
+	}
+
+	adividend := uint32(dividend)
+	if dividend < 0 {
+		adividend = uint32(-int64(dividend))
+	}
+	adivisor := uint32(uint16(divisor))
+	if divisor < 0 {
+		adivisor = uint32(-int32(divisor))
+	}
+	if adividend>>16 >= adivisor {
+		// overflow
+		return (mcycles + 2) * 2
+	}
+
+	aquot := adividend / adivisor
+	mcycles += 55
+	if divisor >= 0 {
+		if dividend >= 0 {
+			mcycles--
+		} else {
+			mcycles++
+		}
+	}
+	for i := 0; i < 15; i++ {
+		if int16(aquot) >= 0 {
+			mcycles++
+		}
+		aquot <<= 1
+	}
+	return mcycles * 2
+}
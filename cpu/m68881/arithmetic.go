@@ -0,0 +1,488 @@
+package m68881
+
+import (
+	"math"
+	"math/big"
+)
+
+// arithmetic performs the operation opmode with the source operand src and
+// FPn as the destination.
+func (f *FPU) arithmetic(opmode uint16, src extended, n uint16) {
+	dest := f.fp[n]
+	switch {
+	case opmode == 0x38:
+		f.compare(src, dest)
+		return
+	case opmode == 0x3a:
+		f.test(src)
+		return
+	case opmode >= 0x30:
+		// fsincos stores the cosine in FPc and the sine in FPs
+		f.monadic(0x1d, src, opmode&0x07)
+		f.monadic(0x0e, src, n)
+		return
+	case opmode >= 0x20:
+		f.dyadic(opmode, src, dest, n)
+		return
+	}
+	f.monadic(opmode, src, n)
+}
+
+// nans handles NaN operands.  It returns true and stores the result if src or
+// dest is a NaN.  A destination NaN takes precedence, signaling NaNs have
+// been quieted by convertIn.
+func (f *FPU) nans(src, dest extended, dyadic bool, n uint16) bool {
+	switch {
+	case dyadic && dest.isNaN():
+		if dest.isSignaling() {
+			f.fpsr |= snan
+		}
+		f.storeNaN(n, dest.quiet())
+	case src.isNaN():
+		if src.isSignaling() {
+			f.fpsr |= snan
+		}
+		f.storeNaN(n, src.quiet())
+	default:
+		return false
+	}
+	return true
+}
+
+// operandError signals OPERR and stores the default NaN in FPn.
+func (f *FPU) operandError(n uint16) {
+	f.fpsr |= operr
+	f.storeNaN(n, nan)
+}
+
+// divideByZero signals DZ and stores an infinity in FPn.
+func (f *FPU) divideByZero(n uint16, sign bool) {
+	f.fpsr |= dz
+	f.storeNaN(n, inf(sign))
+}
+
+// compare sets the condition codes of dest - src.
+func (f *FPU) compare(src, dest extended) {
+	if src.isNaN() || dest.isNaN() {
+		if src.isSignaling() || dest.isSignaling() {
+			f.fpsr |= snan
+		}
+		f.setCondition(nan)
+		return
+	}
+	f.fpsr &^= ccN | ccZ | ccI | ccNaN
+	switch cmp := dest.big().Cmp(src.big()); {
+	case cmp < 0:
+		f.fpsr |= ccN
+	case cmp > 0:
+	case dest.isZero():
+		f.fpsr |= ccZ
+		if dest.sign() && !src.sign() {
+			f.fpsr |= ccN
+		}
+	default:
+		f.fpsr |= ccZ
+		if dest.isInf() && dest.sign() {
+			f.fpsr |= ccN
+		}
+	}
+}
+
+// test sets the condition codes of src.
+func (f *FPU) test(src extended) {
+	if src.isSignaling() {
+		f.fpsr |= snan
+	}
+	f.setCondition(src)
+}
+
+// dyadic performs the two operand operations.
+func (f *FPU) dyadic(opmode uint16, src, dest extended, n uint16) {
+	if f.nans(src, dest, true, n) {
+		return
+	}
+	s, d := src.big(), dest.big()
+	var r *big.Float
+	switch opmode {
+	case 0x20, 0x24:
+		// fdiv, fsgldiv
+		switch {
+		case src.isZero() && dest.isZero(),
+			src.isInf() && dest.isInf():
+			f.operandError(n)
+			return
+		case src.isZero():
+			f.divideByZero(n, src.sign() != dest.sign())
+			return
+		}
+		r = quotient(d, s)
+		if opmode == 0x24 {
+			f.storeSingle(n, r)
+			return
+		}
+	case 0x21, 0x25:
+		// fmod, frem
+		f.remainder(opmode == 0x25, src, dest, n)
+		return
+	case 0x22:
+		// fadd
+		if src.isInf() && dest.isInf() && src.sign() != dest.sign() {
+			f.operandError(n)
+			return
+		}
+		r = sum(d, s, f.mode())
+	case 0x28:
+		// fsub
+		if src.isInf() && dest.isInf() && src.sign() == dest.sign() {
+			f.operandError(n)
+			return
+		}
+		r = sum(d, new(big.Float).Neg(s), f.mode())
+	case 0x23, 0x27:
+		// fmul, fsglmul
+		if src.isZero() && dest.isInf() ||
+			src.isInf() && dest.isZero() {
+			f.operandError(n)
+			return
+		}
+		r = new(big.Float).SetPrec(128).Mul(d, s)
+		if opmode == 0x27 {
+			f.storeSingle(n, r)
+			return
+		}
+	case 0x26:
+		// fscale
+		f.scale(src, dest, n)
+		return
+	}
+	f.store(n, r)
+}
+
+// sum returns the exact sum of a and b.  An exact zero sum is negative only
+// when rounding towards minus infinity or when both operands are -0.
+func sum(a, b *big.Float, mode big.RoundingMode) *big.Float {
+	prec := uint(64)
+	if !a.IsInf() && !b.IsInf() && a.Sign() != 0 && b.Sign() != 0 {
+		// enough bits to hold the sum exactly
+		ea, eb := a.MantExp(nil), b.MantExp(nil)
+		if ea < eb {
+			ea, eb = eb, ea
+		}
+		prec = uint(ea-eb) + 130
+	}
+	r := new(big.Float).SetPrec(prec).SetMode(mode)
+	r.Add(a, b)
+	if r.Sign() == 0 && !(a.Signbit() && b.Signbit()) {
+		r.SetInt64(0)
+		if mode == big.ToNegativeInf {
+			r.Neg(r)
+		}
+	}
+	return r
+}
+
+// quotient returns a / b with enough precision to round it correctly.  The
+// sticky bit is carried by the rounding accuracy of the quotient.
+func quotient(a, b *big.Float) *big.Float {
+	r := new(big.Float).SetPrec(256).SetMode(big.ToZero).Quo(a, b)
+	if r.Acc() != big.Exact && !r.IsInf() && r.Sign() != 0 {
+		// make the truncated quotient sticky
+		sticky := new(big.Float).SetMantExp(big.NewFloat(1),
+			r.MantExp(nil)-300)
+		if r.Signbit() {
+			sticky.Neg(sticky)
+		}
+		r.SetPrec(320).Add(r, sticky)
+	}
+	return r
+}
+
+// storeSingle stores r rounded to a single precision mantissa with the
+// extended exponent range as fsgldiv and fsglmul do.
+func (f *FPU) storeSingle(n uint16, r *big.Float) {
+	x, status := round(r, 24, f.mode())
+	f.fpsr |= status
+	f.fp[n] = x
+	f.setCondition(x)
+}
+
+// integerParts returns x as mant * 2^exp.
+func integerParts(x extended) (*big.Int, int) {
+	e := x.exp()
+	if e == 0 {
+		e = 1
+	}
+	return new(big.Int).SetUint64(x.mant), e - bias - 63
+}
+
+// remainder performs fmod, which truncates the quotient, and frem, which
+// rounds it to nearest even.  The sign and the low 7 bits of the quotient are
+// stored in the quotient byte of FPSR.
+func (f *FPU) remainder(nearest bool, src, dest extended, n uint16) {
+	f.fpsr &^= quotientMask
+	switch {
+	case dest.isInf(), src.isZero():
+		f.operandError(n)
+		return
+	case src.isInf(), dest.isZero():
+		if dest.sign() != src.sign() {
+			f.fpsr |= quotientSign
+		}
+		f.store(n, dest.big())
+		return
+	}
+
+	a, ea := integerParts(dest)
+	b, eb := integerParts(src)
+	e := ea
+	if eb < e {
+		e = eb
+	}
+	a.Lsh(a, uint(ea-e))
+	b.Lsh(b, uint(eb-e))
+	q, r := new(big.Int).QuoRem(a, b, new(big.Int))
+	if nearest {
+		switch new(big.Int).Lsh(r, 1).Cmp(b) {
+		case 1:
+			q.Add(q, big.NewInt(1))
+			r.Sub(r, b)
+		case 0:
+			if q.Bit(0) != 0 {
+				q.Add(q, big.NewInt(1))
+				r.Sub(r, b)
+			}
+		}
+	}
+
+	if dest.sign() != src.sign() {
+		f.fpsr |= quotientSign
+	}
+	low := new(big.Int).And(q, big.NewInt(0x7f))
+	f.fpsr |= uint32(low.Uint64()) << 16
+
+	result := new(big.Float).SetInt(r)
+	result.SetMantExp(result, e)
+	if dest.sign() {
+		result.Neg(result)
+	}
+	f.store(n, result)
+}
+
+// scale performs fscale, dest * 2^int(src).
+func (f *FPU) scale(src, dest extended, n uint16) {
+	switch {
+	case src.isInf():
+		f.operandError(n)
+		return
+	case dest.isInf(), dest.isZero():
+		f.store(n, dest.big())
+		return
+	}
+	// truncate the scale factor, beyond the exponent range it only
+	// matters that the result overflows or underflows
+	scale := src.float64()
+	scale = math.Max(math.Min(math.Trunc(scale), 1<<16), -(1 << 16))
+	r := new(big.Float).SetMantExp(dest.big(), int(scale))
+	f.store(n, r)
+}
+
+// functions are the monadic operations evaluated in double precision.
+var functions = map[uint16]func(float64) float64{
+	0x02: math.Sinh,
+	0x06: math.Log1p,
+	0x08: math.Expm1,
+	0x09: math.Tanh,
+	0x0a: math.Atan,
+	0x0c: math.Asin,
+	0x0d: math.Atanh,
+	0x0e: math.Sin,
+	0x0f: math.Tan,
+	0x10: math.Exp,
+	0x11: math.Exp2,
+	0x12: func(x float64) float64 { return math.Pow(10, x) },
+	0x14: math.Log,
+	0x15: math.Log10,
+	0x16: math.Log2,
+	0x19: math.Cosh,
+	0x1c: math.Acos,
+	0x1d: math.Cos,
+}
+
+// monadic performs the single operand operations.
+func (f *FPU) monadic(opmode uint16, src extended, n uint16) {
+	if f.nans(src, src, false, n) {
+		return
+	}
+	s := src.big()
+	switch opmode {
+	case 0x00:
+		// fmove
+		f.store(n, s)
+	case 0x01:
+		// fint
+		f.store(n, roundInt(s, f.mode()))
+	case 0x03:
+		// fintrz
+		f.store(n, roundInt(s, big.ToZero))
+	case 0x04:
+		// fsqrt
+		switch {
+		case src.sign() && !src.isZero():
+			f.operandError(n)
+		case src.isInf(), src.isZero():
+			f.store(n, s)
+		default:
+			f.store(n, squareRoot(s))
+		}
+	case 0x18:
+		// fabs
+		f.store(n, s.Abs(s))
+	case 0x1a:
+		// fneg
+		f.store(n, s.Neg(s))
+	case 0x1e:
+		// fgetexp
+		switch {
+		case src.isInf():
+			f.operandError(n)
+		case src.isZero():
+			f.store(n, s)
+		default:
+			f.store(n, big.NewFloat(float64(s.MantExp(nil)-1)))
+		}
+	case 0x1f:
+		// fgetman
+		switch {
+		case src.isInf():
+			f.operandError(n)
+		case src.isZero():
+			f.store(n, s)
+		default:
+			f.store(n, s.SetMantExp(s, 1-s.MantExp(nil)))
+		}
+	default:
+		f.transcendental(opmode, src, n)
+	}
+}
+
+// squareRoot returns the square root of s with enough precision to round it
+// correctly.
+func squareRoot(s *big.Float) *big.Float {
+	r := new(big.Float).SetPrec(256).SetMode(big.ToZero).Sqrt(s)
+	check := new(big.Float).SetPrec(600).Mul(r, r)
+	if check.Cmp(s) != 0 {
+		sticky := new(big.Float).SetMantExp(big.NewFloat(1),
+			r.MantExp(nil)-300)
+		r.SetPrec(320).Add(r, sticky)
+	}
+	return r
+}
+
+// transcendental evaluates a transcendental function.  Operands outside of
+// the domain signal OPERR and the poles signal DZ.  Results are inexact
+// unless they are zero, infinite or integral.
+func (f *FPU) transcendental(opmode uint16, src extended, n uint16) {
+	fn, ok := functions[opmode]
+	if !ok {
+		f.operandError(n)
+		return
+	}
+	x := src.float64()
+	if src.isZero() {
+		switch opmode {
+		case 0x14, 0x15, 0x16:
+			// log of zero
+			f.divideByZero(n, true)
+			return
+		}
+	}
+	switch opmode {
+	case 0x06:
+		if x == -1 {
+			f.divideByZero(n, true)
+			return
+		}
+		if x < -1 {
+			f.operandError(n)
+			return
+		}
+	case 0x0d:
+		if x == 1 || x == -1 {
+			f.divideByZero(n, x < 0)
+			return
+		}
+		if math.Abs(x) > 1 {
+			f.operandError(n)
+			return
+		}
+	case 0x0c, 0x1c:
+		if math.Abs(x) > 1 {
+			f.operandError(n)
+			return
+		}
+	case 0x0e, 0x0f, 0x1d:
+		if src.isInf() {
+			f.operandError(n)
+			return
+		}
+	case 0x14, 0x15, 0x16:
+		if src.sign() {
+			f.operandError(n)
+			return
+		}
+	}
+
+	v := fn(x)
+	if math.IsNaN(v) {
+		f.operandError(n)
+		return
+	}
+	r := big.NewFloat(v)
+	if v == 0 && src.sign() {
+		r.Neg(r)
+	}
+	f.store(n, r)
+	switch {
+	case math.IsInf(v, 0) && !src.isInf():
+		f.fpsr |= ovfl | inex2
+	case v != math.Trunc(v):
+		f.fpsr |= inex2
+	}
+}
+
+// constants are the FMOVECR ROM constants other than the powers of ten.
+var constants = map[uint16]string{
+	0x00: "3.14159265358979323846264338327950288419716939937510582",
+	0x0b: "0.30102999566398119521373889472449302676818988146210854",
+	0x0c: "2.71828182845904523536028747135266249775724709369995957",
+	0x0d: "1.44269504088896340735992468100189213742664595415298594",
+	0x0e: "0.43429448190325182765112891891660508229439700580366656",
+	0x0f: "0",
+	0x30: "0.69314718055994530941723212145817656807550013436025525",
+	0x31: "2.30258509299404568401799145468436420760110148862877298",
+}
+
+// constant returns the FMOVECR ROM constant at offset.  Offsets $32-$3f are
+// the powers of ten 10^0, 10^1, 10^2, 10^4 and so on up to 10^4096, undefined
+// offsets read as zero.
+func constant(offset uint16) *big.Float {
+	if offset >= 0x32 && offset <= 0x3f {
+		exp := int64(0)
+		if offset > 0x32 {
+			exp = 1 << (offset - 0x33)
+		}
+		p := new(big.Int).Exp(big.NewInt(10), big.NewInt(exp), nil)
+		return new(big.Float).SetInt(p)
+	}
+	s, ok := constants[offset]
+	if !ok {
+		s = "0"
+	}
+	v, _, _ := big.ParseFloat(s, 10, 256, big.ToNearestEven)
+	return v
+}
+
+// moveConstant loads FPn with a ROM constant rounded to the FPCR precision.
+func (f *FPU) moveConstant(command uint16) {
+	f.store(command>>7&0x07, constant(command&0x7f))
+}
@@ -0,0 +1,314 @@
+package m68881
+
+import (
+	"math"
+	"math/big"
+)
+
+// extended is a value in the extended precision register format: the sign, a
+// 15 bit exponent biased by 16383 and a 64 bit mantissa with an explicit
+// integer bit.  Zeros, denormals, infinities and NaNs are encoded as in
+// memory.
+type extended struct {
+	se   uint16 // sign and biased exponent
+	mant uint64 // mantissa
+}
+
+const (
+	bias   = 0x3fff // exponent bias
+	maxExp = 0x7fff // exponent of infinities and NaNs
+
+	// denormal is the exponent of the least significant mantissa bit of
+	// a denormal.
+	denormal = 1 - bias - 63
+)
+
+var (
+	nan = extended{se: maxExp, mant: 0xffffffffffffffff} // default NaN
+	one = big.NewFloat(1)
+)
+
+func (x extended) sign() bool {
+	return x.se&0x8000 != 0
+}
+
+func (x extended) exp() int {
+	return int(x.se & maxExp)
+}
+
+func (x extended) isNaN() bool {
+	return x.exp() == maxExp && x.mant<<1 != 0
+}
+
+// isSignaling returns true for a NaN whose most significant fraction bit is
+// clear.
+func (x extended) isSignaling() bool {
+	return x.isNaN() && x.mant&(1<<62) == 0
+}
+
+func (x extended) isInf() bool {
+	return x.exp() == maxExp && x.mant<<1 == 0
+}
+
+func (x extended) isZero() bool {
+	return x.exp() != maxExp && x.mant == 0
+}
+
+func (x extended) neg() extended {
+	x.se ^= 0x8000
+	return x
+}
+
+func (x extended) abs() extended {
+	x.se &^= 0x8000
+	return x
+}
+
+// quiet returns the NaN x with the signaling bit set.
+func (x extended) quiet() extended {
+	x.mant |= 1 << 62
+	return x
+}
+
+// signed returns the zero or infinity of the provided sign.
+func signed(x extended, sign bool) extended {
+	if sign {
+		x.se |= 0x8000
+	}
+	return x
+}
+
+func zero(sign bool) extended {
+	return signed(extended{}, sign)
+}
+
+func inf(sign bool) extended {
+	return signed(extended{se: maxExp}, sign)
+}
+
+// big returns x, which must not be a NaN, as a big.Float.
+func (x extended) big() *big.Float {
+	f := new(big.Float)
+	switch {
+	case x.isInf():
+		f.SetInf(x.sign())
+		return f
+	case x.isZero():
+		if x.sign() {
+			f.Neg(f)
+		}
+		return f
+	}
+	e := x.exp()
+	if e == 0 {
+		e = 1
+	}
+	f.SetUint64(x.mant)
+	f.SetMantExp(f, e-bias-63)
+	if x.sign() {
+		f.Neg(f)
+	}
+	return f
+}
+
+// float64 returns x as the nearest float64.
+func (x extended) float64() float64 {
+	if x.isNaN() {
+		return math.NaN()
+	}
+	v, _ := x.big().Float64()
+	return v
+}
+
+// rounding returns the big.Float rounding mode of FPCR rounding mode rnd.
+func rounding(rnd uint32) big.RoundingMode {
+	switch rnd {
+	case 1:
+		return big.ToZero
+	case 2:
+		return big.ToNegativeInf
+	case 3:
+		return big.ToPositiveInf
+	}
+	return big.ToNearestEven
+}
+
+// round rounds f to prec bits of mantissa in mode and returns the extended
+// value and the exception status bits it raised.  Results outside of the
+// extended exponent range overflow to an infinity or the largest value, or
+// underflow to a denormal or zero.
+func round(f *big.Float, prec uint, mode big.RoundingMode) (extended, uint32) {
+	sign := f.Signbit()
+	switch {
+	case f.IsInf():
+		return inf(sign), 0
+	case f.Sign() == 0:
+		return zero(sign), 0
+	}
+
+	r := new(big.Float).SetMode(mode).SetPrec(prec).Set(f)
+	var status uint32
+	if r.Acc() != big.Exact {
+		status |= inex2
+	}
+	e := r.MantExp(nil) - 1 + bias
+	switch {
+	case e >= maxExp:
+		status |= ovfl | inex2
+		if mode == big.ToZero || mode == big.ToNegativeInf && !sign ||
+			mode == big.ToPositiveInf && sign {
+			// largest value of the precision
+			m := ^uint64(0) << (64 - prec)
+			return signed(extended{se: maxExp - 1, mant: m}, sign),
+				status
+		}
+		return inf(sign), status
+	case e <= 0:
+		// denormal, round to a multiple of the denormal unit
+		d := new(big.Float).SetMantExp(f, -denormal)
+		d = roundInt(d, mode)
+		status &^= inex2
+		if d.Cmp(new(big.Float).SetMantExp(f, -denormal)) != 0 {
+			status |= unfl | inex2
+		}
+		m, _ := d.Uint64()
+		if sign {
+			m, _ = new(big.Float).Neg(d).Uint64()
+		}
+		x := signed(extended{mant: m}, sign)
+		if m&(1<<63) != 0 {
+			x.se |= 1
+		}
+		return x, status
+	}
+
+	m := new(big.Float).SetMantExp(r, 64-r.MantExp(nil))
+	mant, _ := m.Uint64()
+	if sign {
+		mant, _ = m.Neg(m).Uint64()
+	}
+	return signed(extended{se: uint16(e), mant: mant}, sign), status
+}
+
+// roundInt rounds x to an integer in mode.
+func roundInt(x *big.Float, mode big.RoundingMode) *big.Float {
+	if x.IsInf() || x.IsInt() {
+		return new(big.Float).Set(x)
+	}
+	i, _ := x.Int(nil)
+	t := new(big.Float).SetInt(i)
+	away := false
+	switch mode {
+	case big.ToNegativeInf:
+		away = x.Signbit()
+	case big.ToPositiveInf:
+		away = !x.Signbit()
+	case big.ToNearestEven, big.ToNearestAway:
+		frac := new(big.Float).Sub(x, t)
+		switch frac.Abs(frac).Cmp(big.NewFloat(0.5)) {
+		case 1:
+			away = true
+		case 0:
+			away = i.Bit(0) != 0
+		}
+	}
+	if away {
+		if x.Signbit() {
+			t.Sub(t, one)
+		} else {
+			t.Add(t, one)
+		}
+	}
+	if t.Sign() == 0 && x.Signbit() {
+		t.Neg(t)
+	}
+	return t
+}
+
+// fromFloat64 converts v without rounding.
+func fromFloat64(v float64) extended {
+	if math.IsNaN(v) {
+		return nan
+	}
+	x, _ := round(big.NewFloat(v), 64, big.ToNearestEven)
+	return x
+}
+
+// fromSingle converts a single precision operand.  A signaling NaN is
+// reported so that the SNAN exception can be taken.
+func fromSingle(b uint32) (extended, bool) {
+	if b&0x7f800000 == 0x7f800000 && b&0x007fffff != 0 {
+		x := signed(extended{se: maxExp, mant: 1<<63 |
+			uint64(b&0x007fffff)<<40}, b&0x80000000 != 0)
+		return x, x.isSignaling()
+	}
+	return fromFloat64(float64(math.Float32frombits(b))), false
+}
+
+// fromDouble converts a double precision operand.
+func fromDouble(b uint64) (extended, bool) {
+	if b&0x7ff0000000000000 == 0x7ff0000000000000 &&
+		b&0x000fffffffffffff != 0 {
+		x := signed(extended{se: maxExp, mant: 1<<63 |
+			(b&0x000fffffffffffff)<<11}, b&(1<<63) != 0)
+		return x, x.isSignaling()
+	}
+	return fromFloat64(math.Float64frombits(b)), false
+}
+
+// single converts x to a single precision operand rounded in mode.
+func single(x extended, mode big.RoundingMode) (uint32, uint32) {
+	if x.isNaN() {
+		b := uint32(0x7f800000) | uint32(x.mant>>40)&0x007fffff
+		if x.sign() {
+			b |= 0x80000000
+		}
+		return b, 0
+	}
+	r, status := round(x.big(), 24, mode)
+	v, _ := r.big().Float32()
+	if math.IsInf(float64(v), 0) && !x.isInf() {
+		status |= ovfl | inex2
+	}
+	return math.Float32bits(v), status
+}
+
+// double converts x to a double precision operand rounded in mode.
+func double(x extended, mode big.RoundingMode) (uint64, uint32) {
+	if x.isNaN() {
+		b := uint64(0x7ff0000000000000) | x.mant>>11&0x000fffffffffffff
+		if x.sign() {
+			b |= 1 << 63
+		}
+		return b, 0
+	}
+	r, status := round(x.big(), 53, mode)
+	v, _ := r.big().Float64()
+	if math.IsInf(v, 0) && !x.isInf() {
+		status |= ovfl | inex2
+	}
+	return math.Float64bits(v), status
+}
+
+// integer converts x to an integer of size bytes rounded in mode.  NaNs and
+// values out of range raise OPERR and return the largest integer of the sign
+// of x.
+func integer(x extended, size uint32, mode big.RoundingMode) (int64, uint32) {
+	max := int64(1)<<(size*8-1) - 1
+	if x.isNaN() {
+		return max, operr
+	}
+	r := roundInt(x.big(), mode)
+	var status uint32
+	if !x.isInf() && r.Cmp(x.big()) != 0 {
+		status |= inex2
+	}
+	v, acc := r.Int64()
+	switch {
+	case x.isInf() && x.sign(), acc == big.Above || v < -max-1:
+		return -max - 1, operr
+	case x.isInf(), acc == big.Below || v > max:
+		return max, operr
+	}
+	return v, status
+}
@@ -0,0 +1,245 @@
+package m68881
+
+import (
+	"encoding/binary"
+
+	"github.com/marcopeereboom/byo/bus"
+)
+
+// Coprocessor interface register offsets.
+const (
+	cirResponse    = 0x00 // read
+	cirControl     = 0x02 // write
+	cirSave        = 0x04 // read
+	cirRestore     = 0x06 // read and write
+	cirOperation   = 0x08 // write, unused by the FPU
+	cirCommand     = 0x0a // write
+	cirCondition   = 0x0e // write
+	cirOperand     = 0x10 // read and write, 4 bytes
+	cirSelect      = 0x14 // read, unused by the FPU
+	cirInstruction = 0x18 // write, 4 bytes
+	cirAddress     = 0x1c // read and write, 4 bytes
+
+	cirLength = 0x20
+)
+
+// Response primitives.
+const (
+	responseNull    = 0x0802 // processing finished, bit 0 is the result
+	responseTrue    = 0x0001 // condition true
+	responseToFPU   = 0x9500 // transfer n bytes from <ea> to the FPU
+	responseFromFPU = 0xb500 // transfer n bytes from the FPU to <ea>
+	responsePre     = 0x1c00 // take pre-instruction exception vector
+	responsePost    = 0x1e00 // take post-instruction exception vector
+
+	formatInvalid = 0x0002 // restore register after an invalid frame
+	controlAbort  = 0x0003 // exception acknowledge and abort bits
+)
+
+var (
+	_ bus.Buser = (*Interface)(nil) // ensure interface is satisfied
+)
+
+// Interface is the memory mapped coprocessor interface of an FPU for CPUs
+// without the line F coprocessor interface, e.g. the 68000.  Software runs
+// the coprocessor protocol itself: it writes the instruction address and a
+// command word and reads the response register until it reports that
+// processing finished.  While the response requests an operand transfer the
+// operand bytes are written to or read from the operand register in memory
+// order, every access transfers as many bytes as it is wide.  A conditional
+// instruction writes its predicate to the condition register and finds the
+// result in bit 0 of the response.
+//
+// Only static command forms are accepted, software resolves dynamic register
+// lists and k-factors itself.  Reading the save register returns the format
+// word of a state frame, the rest of the frame is then read from the operand
+// register.  Writing a format word to the restore register starts a restore
+// and the rest of the frame is written to the operand register.  The restore
+// register reads back the format word, or $0002 if the frame is invalid.
+type Interface struct {
+	fpu *FPU
+
+	response uint16 // response register
+	after    uint16 // response once the operand has been transferred
+	command  uint16 // command word being executed
+	restore  uint16 // restore register
+	address  uint32 // instruction address register
+	operand  uint32 // operand address register
+
+	in    []byte // operand or frame being received
+	need  int    // length of the operand or frame being received
+	frame bool   // receiving a state frame
+	out   []byte // operand or frame being sent
+}
+
+// NewInterface returns the coprocessor interface registers of f.
+func NewInterface(f *FPU) *Interface {
+	i := Interface{fpu: f}
+	i.abort()
+	return &i
+}
+
+// Length returns the size of the register block.  This is part of the Buser
+// interface.
+func (i *Interface) Length() uint64 {
+	return cirLength
+}
+
+// Reset resets the FPU and aborts any transfer.  This is part of the Buser
+// interface.
+func (i *Interface) Reset(powerOn bool) {
+	i.fpu.Reset()
+	i.abort()
+}
+
+// abort ends the current transfer.
+func (i *Interface) abort() {
+	i.response = responseNull
+	i.after = responseNull
+	i.in, i.need, i.frame = nil, 0, false
+	i.out = nil
+}
+
+// Read reads length bytes of the registers at address.  This is part of the
+// Buser interface.
+func (i *Interface) Read(address, length uint64) []byte {
+	b := make([]byte, length)
+	if address >= cirOperand && address < cirOperand+4 {
+		n := copy(b, i.out)
+		i.out = i.out[n:]
+		if n > 0 && len(i.out) == 0 {
+			i.response = i.after
+		}
+		return b
+	}
+
+	var r [cirLength]byte
+	if address&^1 == cirSave {
+		frame := i.fpu.Save()
+		copy(r[cirSave:], frame[:2])
+		i.abort()
+		i.out = frame[4:]
+	}
+	binary.BigEndian.PutUint16(r[cirResponse:], i.response)
+	binary.BigEndian.PutUint16(r[cirRestore:], i.restore)
+	binary.BigEndian.PutUint32(r[cirAddress:], i.operand)
+	copy(b, r[address:])
+	return b
+}
+
+// Write writes data to the registers at address.  This is part of the Buser
+// interface.
+func (i *Interface) Write(address uint64, data []byte) {
+	switch {
+	case address >= cirOperand && address < cirOperand+4:
+		i.receive(data)
+		return
+	case address >= cirInstruction && address < cirInstruction+4:
+		i.address = update(i.address, address-cirInstruction, data)
+		return
+	case address >= cirAddress && address < cirAddress+4:
+		i.operand = update(i.operand, address-cirAddress, data)
+		return
+	case len(data) < 2:
+		// the word registers are only written as words
+		return
+	}
+
+	v := binary.BigEndian.Uint16(data)
+	switch address {
+	case cirControl:
+		if v&controlAbort != 0 {
+			i.abort()
+		}
+	case cirRestore:
+		i.startRestore(v)
+	case cirCommand:
+		i.general(v)
+	case cirCondition:
+		i.abort()
+		result, vector := i.fpu.Condition(v & 0x3f)
+		switch {
+		case vector != 0:
+			i.response = responsePre | uint16(vector)
+		case result:
+			i.response = responseNull | responseTrue
+		}
+	}
+}
+
+// update returns register with data written at offset.
+func update(register uint32, offset uint64, data []byte) uint32 {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], register)
+	copy(b[offset:], data)
+	return binary.BigEndian.Uint32(b[:])
+}
+
+// general starts a general command.  Commands without an operand or with an
+// operand for <ea> execute immediately, the others once their operand has
+// been received.
+func (i *Interface) general(command uint16) {
+	i.abort()
+	i.command = command
+	direction, size, err := Operand(command)
+	switch {
+	case err != nil:
+		i.response = responsePre | vectorLineF
+	case direction == In:
+		i.need = int(size)
+		i.response = responseToFPU | uint16(size)
+	default:
+		i.execute(nil)
+	}
+}
+
+// startRestore starts restoring the frame with format word v.  A null frame
+// is restored immediately.
+func (i *Interface) startRestore(v uint16) {
+	i.abort()
+	header := []byte{byte(v >> 8), byte(v), 0, 0}
+	length := i.fpu.FrameSize(uint32(v) << 16)
+	switch {
+	case v>>8 == versionNull:
+		i.fpu.Restore(header)
+		i.restore = v
+	case length == 4:
+		i.restore = formatInvalid
+	default:
+		i.restore = v
+		i.in, i.need, i.frame = header, int(length), true
+	}
+}
+
+// receive appends data to the operand or frame being received and executes
+// the command or restores the frame once it is complete.
+func (i *Interface) receive(data []byte) {
+	if len(i.in) >= i.need {
+		return
+	}
+	i.in = append(i.in, data...)
+	if len(i.in) < i.need {
+		return
+	}
+	if i.frame {
+		i.fpu.Restore(i.in[:i.need])
+		i.abort()
+		return
+	}
+	i.execute(i.in[:i.need])
+}
+
+// execute executes the current command and sets the response.  An exception
+// is reported once the result has been transferred.
+func (i *Interface) execute(operand []byte) {
+	out, vector := i.fpu.Execute(i.command, i.address, operand)
+	i.abort()
+	if vector != 0 {
+		i.after = responsePost | uint16(vector)
+	}
+	i.response = i.after
+	if len(out) > 0 {
+		i.out = out
+		i.response = responseFromFPU | uint16(len(out))
+	}
+}
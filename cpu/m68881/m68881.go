@@ -0,0 +1,664 @@
+// Package m68881 emulates the Motorola 68881 and 68882 floating point
+// coprocessors.
+//
+// The FPU is driven through its general command words.  A 68020 decodes the
+// line F coprocessor instructions itself and calls Operand, Execute,
+// Condition, Save and Restore, see cpu/m68000.  Other CPUs talk to the FPU
+// through the memory mapped coprocessor interface registers returned by
+// NewInterface.
+//
+// Registers hold the native 80 bit extended precision format.  The basic
+// arithmetic, square root, conversions and FMOVECR are correctly rounded in
+// all rounding modes and precisions.  Rounding to single or double precision
+// rounds the mantissa only and keeps the extended exponent range.  The
+// transcendental functions are evaluated in double precision.
+//
+// The 68882 only differs in its concurrency and in the size of its FSAVE
+// frames.  Instructions complete before Execute returns so neither model has
+// busy or mid-instruction states and exceptions are reported once the
+// instruction completed.
+package m68881
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"math/bits"
+)
+
+// Supported models.
+const (
+	M68881 = "68881"
+	M68882 = "68882"
+)
+
+// Floating point status register.
+const (
+	// condition code byte
+	ccN   = 1 << 27 // negative
+	ccZ   = 1 << 26 // zero
+	ccI   = 1 << 25 // infinity
+	ccNaN = 1 << 24 // not a number or unordered
+
+	quotientSign = 1 << 23    // sign of the fmod and frem quotient
+	quotientMask = 0x00ff0000 // quotient byte
+
+	// exception status byte, also the exception enable byte of FPCR
+	bsun  = 1 << 15 // branch/set on unordered
+	snan  = 1 << 14 // signaling not a number
+	operr = 1 << 13 // operand error
+	ovfl  = 1 << 12 // overflow
+	unfl  = 1 << 11 // underflow
+	dz    = 1 << 10 // divide by zero
+	inex2 = 1 << 9  // inexact operation
+	inex1 = 1 << 8  // inexact decimal input
+
+	// accrued exception byte
+	aiop  = 1 << 7 // invalid operation
+	aovfl = 1 << 6 // overflow
+	aunfl = 1 << 5 // underflow
+	adz   = 1 << 4 // divide by zero
+	ainex = 1 << 3 // inexact
+
+	fpsrMask = 0x0ffffff8
+	fpcrMask = 0x0000fff0
+)
+
+// Exception vector numbers.
+const (
+	vectorLineF       = 11
+	vectorFormatError = 14
+	vectorBSUN        = 48
+	vectorINEX        = 49
+	vectorDZ          = 50
+	vectorUNFL        = 51
+	vectorOPERR       = 52
+	vectorOVFL        = 53
+	vectorSNAN        = 54
+)
+
+// Direction is the direction of the operand transfer of a command.
+type Direction int
+
+const (
+	None Direction = iota // no operand
+	In                    // from <ea> to the FPU
+	Out                   // from the FPU to <ea>
+)
+
+var (
+	ErrInvalidCommand = errors.New("invalid coprocessor command")
+
+	models = map[string]int{
+		M68881: 0x18,
+		M68882: 0x38,
+	}
+)
+
+// FPU represents a 68881 or 68882.
+type FPU struct {
+	fp    [8]extended // FP0-FP7
+	fpcr  uint32      // control register
+	fpsr  uint32      // status register
+	fpiar uint32      // instruction address register
+
+	frame int  // size of the idle FSAVE frame
+	idle  bool // an instruction was executed since reset
+}
+
+// New returns a new instance of the named model, M68881 or M68882.
+func New(name string) (*FPU, error) {
+	frame, ok := models[name]
+	if !ok {
+		return nil, fmt.Errorf("invalid model: %v", name)
+	}
+	f := FPU{frame: frame}
+	f.Reset()
+	return &f, nil
+}
+
+// Reset puts the FPU in its reset state.  The data registers are loaded with
+// NaNs and the control registers are cleared.
+func (f *FPU) Reset() {
+	for k := range f.fp {
+		f.fp[k] = nan
+	}
+	f.fpcr = 0
+	f.fpsr = 0
+	f.fpiar = 0
+	f.idle = false
+}
+
+// Float64 returns FPn as the nearest float64.
+func (f *FPU) Float64(n int) float64 {
+	return f.fp[n&0x07].float64()
+}
+
+// SetFloat64 loads FPn with v.
+func (f *FPU) SetFloat64(n int, v float64) {
+	f.fp[n&0x07] = fromFloat64(v)
+}
+
+// Control returns FPCR, FPSR and FPIAR.
+func (f *FPU) Control() (fpcr, fpsr, fpiar uint32) {
+	return f.fpcr, f.fpsr, f.fpiar
+}
+
+// formatSizes are the operand sizes of the data formats in encoding order:
+// long, single, extended, packed decimal, word, double, byte and packed
+// decimal with a dynamic k-factor.
+var formatSizes = [8]uint32{4, 4, 12, 12, 2, 8, 1, 12}
+
+// Operand returns the direction and the size in bytes of the <ea> operand
+// that the general command word transfers.  Dynamic k-factors and register
+// lists must have been resolved with Static.
+func Operand(command uint16) (Direction, uint32, error) {
+	opmode := command & 0x7f
+	switch command >> 13 {
+	case 0x0:
+		if !arithmetic(opmode) {
+			break
+		}
+		return None, 0, nil
+	case 0x2:
+		if command&0x1c00 == 0x1c00 {
+			// fmovecr
+			return None, 0, nil
+		}
+		if !arithmetic(opmode) {
+			break
+		}
+		return In, formatSizes[command>>10&0x07], nil
+	case 0x3:
+		return Out, formatSizes[command>>10&0x07], nil
+	case 0x4, 0x5:
+		list := command >> 10 & 0x07
+		if list == 0 || command&0x03ff != 0 {
+			break
+		}
+		size := 4 * uint32(bits.OnesCount16(list))
+		if command>>13 == 0x4 {
+			return In, size, nil
+		}
+		return Out, size, nil
+	case 0x6, 0x7:
+		if command&0x0800 != 0 || command&0x0700 != 0 {
+			// dynamic list
+			break
+		}
+		predecrement := command&0x1000 == 0
+		if predecrement && command>>13 == 0x6 {
+			break
+		}
+		size := 12 * uint32(bits.OnesCount16(command&0xff))
+		if command>>13 == 0x6 {
+			return In, size, nil
+		}
+		return Out, size, nil
+	}
+	return None, 0, ErrInvalidCommand
+}
+
+// Dynamic returns the data register that holds the k-factor or the register
+// list of a command word, false if the command has none.
+func Dynamic(command uint16) (int, bool) {
+	switch {
+	case command>>13 == 0x3 && command>>10&0x07 == 0x7:
+		return int(command >> 4 & 0x07), true
+	case command>>13 >= 0x6 && command&0x0800 != 0:
+		return int(command >> 4 & 0x07), true
+	}
+	return 0, false
+}
+
+// Static returns the static form of a command word with a dynamic k-factor
+// or register list taken from value.
+func Static(command uint16, value uint32) uint16 {
+	if command>>13 == 0x3 {
+		return command&^0x1c7f | 0x0c00 | uint16(value)&0x7f
+	}
+	return command&^0x08ff | uint16(value)&0xff
+}
+
+// arithmetic returns true if opmode is an implemented arithmetic operation.
+func arithmetic(opmode uint16) bool {
+	switch {
+	case opmode >= 0x30 && opmode <= 0x38, opmode == 0x3a:
+		return true
+	case opmode >= 0x29:
+		return false
+	}
+	switch opmode {
+	case 0x05, 0x07, 0x0b, 0x13, 0x17, 0x1b:
+		return false
+	}
+	return true
+}
+
+// Execute executes a general command word.  In commands take their operand
+// from operand which holds the bytes read from <ea>, Out commands return the
+// bytes to write to <ea>.  Address is the address of the instruction which is
+// loaded into FPIAR by the arithmetic instructions.  A non-zero vector is
+// returned when an enabled floating point exception occurred.  Commands that
+// Operand rejects return the line 1111 emulator vector.
+func (f *FPU) Execute(command uint16, address uint32,
+	operand []byte) ([]byte, uint32) {
+
+	direction, size, err := Operand(command)
+	if err != nil || direction == In && uint32(len(operand)) < size {
+		return nil, vectorLineF
+	}
+	f.idle = true
+
+	switch command >> 13 {
+	case 0x4:
+		f.moveControlIn(command, operand)
+		return nil, 0
+	case 0x5:
+		return f.moveControlOut(command), 0
+	case 0x6:
+		f.moveMultipleIn(command, operand)
+		return nil, 0
+	case 0x7:
+		return f.moveMultipleOut(command), 0
+	}
+
+	f.fpsr &^= 0xff00
+	f.fpiar = address
+	var out []byte
+	switch {
+	case command>>13 == 0x3:
+		out = f.moveOut(command)
+	case command&0xfc00 == 0x5c00:
+		f.moveConstant(command)
+	default:
+		dest := command >> 7 & 0x07
+		src := f.fp[command>>10&0x07]
+		if command>>13 == 0x2 {
+			src = f.convertIn(command>>10&0x07, operand)
+		}
+		f.arithmetic(command&0x7f, src, dest)
+	}
+	return out, f.exception()
+}
+
+// exception accrues the exception status byte and returns the vector of the
+// highest priority enabled exception, 0 if there is none.
+func (f *FPU) exception() uint32 {
+	exc := f.fpsr
+	if exc&(bsun|snan|operr) != 0 {
+		f.fpsr |= aiop
+	}
+	if exc&ovfl != 0 {
+		f.fpsr |= aovfl
+	}
+	if exc&unfl != 0 && exc&inex2 != 0 {
+		f.fpsr |= aunfl
+	}
+	if exc&dz != 0 {
+		f.fpsr |= adz
+	}
+	if exc&(inex1|inex2|ovfl) != 0 {
+		f.fpsr |= ainex
+	}
+
+	enabled := exc & f.fpcr & 0xff00
+	switch {
+	case enabled == 0:
+		return 0
+	case enabled&bsun != 0:
+		return vectorBSUN
+	case enabled&snan != 0:
+		return vectorSNAN
+	case enabled&operr != 0:
+		return vectorOPERR
+	case enabled&ovfl != 0:
+		return vectorOVFL
+	case enabled&unfl != 0:
+		return vectorUNFL
+	case enabled&dz != 0:
+		return vectorDZ
+	}
+	return vectorINEX
+}
+
+// precision returns the number of mantissa bits of the FPCR rounding
+// precision.
+func (f *FPU) precision() uint {
+	switch f.fpcr >> 6 & 0x03 {
+	case 0x1:
+		return 24
+	case 0x2:
+		return 53
+	}
+	return 64
+}
+
+// mode returns the FPCR rounding mode.
+func (f *FPU) mode() big.RoundingMode {
+	return rounding(f.fpcr >> 4 & 0x03)
+}
+
+// setCondition sets the FPSR condition code byte from x.
+func (f *FPU) setCondition(x extended) {
+	f.fpsr &^= ccN | ccZ | ccI | ccNaN
+	if x.sign() {
+		f.fpsr |= ccN
+	}
+	switch {
+	case x.isNaN():
+		f.fpsr |= ccNaN
+	case x.isInf():
+		f.fpsr |= ccI
+	case x.isZero():
+		f.fpsr |= ccZ
+	}
+}
+
+// Condition evaluates a conditional predicate against the FPSR condition
+// codes.  The predicates with bit 4 set signal BSUN when the condition codes
+// are unordered, the BSUN vector is returned when that exception is enabled.
+// Predicates above $1f return the line 1111 emulator vector.
+func (f *FPU) Condition(predicate uint16) (bool, uint32) {
+	if predicate > 0x1f {
+		return false, vectorLineF
+	}
+	f.idle = true
+	n := f.fpsr&ccN != 0
+	z := f.fpsr&ccZ != 0
+	u := f.fpsr&ccNaN != 0
+
+	var result bool
+	switch predicate & 0x0f {
+	case 0x0:
+		// f, sf
+	case 0x1:
+		result = z // eq, seq
+	case 0x2:
+		result = !(u || z || n) // ogt, gt
+	case 0x3:
+		result = z || !(u || n) // oge, ge
+	case 0x4:
+		result = n && !(u || z) // olt, lt
+	case 0x5:
+		result = z || n && !u // ole, le
+	case 0x6:
+		result = !(u || z) // ogl, gl
+	case 0x7:
+		result = !u // or, gle
+	case 0x8:
+		result = u // un, ngle
+	case 0x9:
+		result = u || z // ueq, ngl
+	case 0xa:
+		result = u || !(n || z) // ugt, nle
+	case 0xb:
+		result = u || z || !n // uge, nlt
+	case 0xc:
+		result = u || n && !z // ult, nge
+	case 0xd:
+		result = u || z || n // ule, ngt
+	case 0xe:
+		result = !z // ne, sne
+	case 0xf:
+		result = true // t, st
+	}
+
+	if predicate&0x10 == 0 || !u {
+		return result, 0
+	}
+	f.fpsr = f.fpsr&^0xff00 | bsun | aiop
+	if f.fpcr&bsun != 0 {
+		return result, vectorBSUN
+	}
+	return result, 0
+}
+
+// controlRegisters returns the control registers selected by a register list
+// in the order they are transferred.
+func (f *FPU) controlRegisters(list uint16) []*uint32 {
+	var r []*uint32
+	if list&0x4 != 0 {
+		r = append(r, &f.fpcr)
+	}
+	if list&0x2 != 0 {
+		r = append(r, &f.fpsr)
+	}
+	if list&0x1 != 0 {
+		r = append(r, &f.fpiar)
+	}
+	return r
+}
+
+// moveControlIn loads the control registers selected by the command.
+func (f *FPU) moveControlIn(command uint16, operand []byte) {
+	for _, r := range f.controlRegisters(command >> 10 & 0x07) {
+		*r = uint32(operand[0])<<24 | uint32(operand[1])<<16 |
+			uint32(operand[2])<<8 | uint32(operand[3])
+		operand = operand[4:]
+	}
+	f.fpcr &= fpcrMask
+	f.fpsr &= fpsrMask
+}
+
+// moveControlOut returns the control registers selected by the command.
+func (f *FPU) moveControlOut(command uint16) []byte {
+	var out []byte
+	for _, r := range f.controlRegisters(command >> 10 & 0x07) {
+		out = append(out, byte(*r>>24), byte(*r>>16), byte(*r>>8),
+			byte(*r))
+	}
+	return out
+}
+
+// dataRegisters returns the data registers selected by the register list of
+// an FMOVEM command in the order they are transferred, FP0 first.  The list
+// of the predecrement mode has FP7 in bit 7, the others have FP0 in bit 7.
+func (f *FPU) dataRegisters(command uint16) []*extended {
+	list := command & 0xff
+	var r []*extended
+	for n := uint(0); n < 8; n++ {
+		bit := uint16(0x80) >> n
+		if command&0x1000 == 0 {
+			bit = 1 << n
+		}
+		if list&bit != 0 {
+			r = append(r, &f.fp[n])
+		}
+	}
+	return r
+}
+
+// moveMultipleIn loads the data registers selected by the command.  Data
+// registers are transferred without conversion.
+func (f *FPU) moveMultipleIn(command uint16, operand []byte) {
+	for _, r := range f.dataRegisters(command) {
+		*r = unpackExtended(operand)
+		operand = operand[12:]
+	}
+}
+
+// moveMultipleOut returns the data registers selected by the command.
+func (f *FPU) moveMultipleOut(command uint16) []byte {
+	var out []byte
+	for _, r := range f.dataRegisters(command) {
+		out = append(out, packExtended(*r)...)
+	}
+	return out
+}
+
+// unpackExtended decodes an extended precision operand.
+func unpackExtended(b []byte) extended {
+	var x extended
+	x.se = uint16(b[0])<<8 | uint16(b[1])
+	for _, v := range b[4:12] {
+		x.mant = x.mant<<8 | uint64(v)
+	}
+	return x
+}
+
+// packExtended encodes an extended precision operand.
+func packExtended(x extended) []byte {
+	b := []byte{byte(x.se >> 8), byte(x.se), 0, 0}
+	for shift := 56; shift >= 0; shift -= 8 {
+		b = append(b, byte(x.mant>>uint(shift)))
+	}
+	return b
+}
+
+// bigEndian returns the big endian integer in b.
+func bigEndian(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+// convertIn converts an operand in format to extended precision.  Signaling
+// NaNs are quieted and signal SNAN, inexact decimal input signals INEX1.
+func (f *FPU) convertIn(format uint16, operand []byte) extended {
+	var (
+		x        extended
+		signal   bool
+		inexact  bool
+		size     = formatSizes[format]
+		operands = operand[:size]
+	)
+	switch format {
+	case 0x0:
+		x = fromInteger(int64(int32(bigEndian(operands))))
+	case 0x1:
+		x, signal = fromSingle(uint32(bigEndian(operands)))
+	case 0x2:
+		x = unpackExtended(operands)
+		signal = x.isSignaling()
+	case 0x3:
+		x, inexact = fromPacked(operands, f.mode())
+	case 0x4:
+		x = fromInteger(int64(int16(bigEndian(operands))))
+	case 0x5:
+		x, signal = fromDouble(bigEndian(operands))
+	case 0x6:
+		x = fromInteger(int64(int8(operands[0])))
+	}
+	if signal {
+		f.fpsr |= snan
+		x = x.quiet()
+	}
+	if inexact {
+		f.fpsr |= inex1
+	}
+	return x
+}
+
+// fromInteger converts v exactly.
+func fromInteger(v int64) extended {
+	x, _ := round(new(big.Float).SetInt64(v), 64, big.ToNearestEven)
+	return x
+}
+
+// moveOut converts FPn to the destination format of the command.  The
+// condition codes are not affected.
+func (f *FPU) moveOut(command uint16) []byte {
+	x := f.fp[command>>7&0x07]
+	mode := f.mode()
+	if x.isSignaling() {
+		f.fpsr |= snan
+		x = x.quiet()
+	}
+
+	var (
+		v      uint64
+		status uint32
+		size   = formatSizes[command>>10&0x07]
+	)
+	switch command >> 10 & 0x07 {
+	case 0x0, 0x4, 0x6:
+		var i int64
+		i, status = integer(x, size, mode)
+		v = uint64(i)
+	case 0x1:
+		var s uint32
+		s, status = single(x, mode)
+		v = uint64(s)
+	case 0x2:
+		return packExtended(x)
+	case 0x3, 0x7:
+		out, status := toPacked(x, int8(command<<1)>>1, mode)
+		f.fpsr |= status
+		return out
+	case 0x5:
+		v, status = double(x, mode)
+	}
+	f.fpsr |= status
+
+	out := make([]byte, size)
+	for k := range out {
+		out[k] = byte(v >> (8 * (size - 1 - uint32(k))))
+	}
+	return out
+}
+
+// store rounds r to the FPCR precision, stores it in FPn and sets the
+// condition codes.
+func (f *FPU) store(n uint16, r *big.Float) {
+	x, status := round(r, f.precision(), f.mode())
+	f.fpsr |= status
+	f.fp[n] = x
+	f.setCondition(x)
+}
+
+// storeNaN stores x, which is a NaN or an infinity, in FPn and sets the
+// condition codes.
+func (f *FPU) storeNaN(n uint16, x extended) {
+	f.fp[n] = x
+	f.setCondition(x)
+}
+
+// FSAVE frame versions.
+const (
+	versionNull = 0x00 // reset state
+	versionIdle = 0x1f // idle state of the 68881 and 68882
+)
+
+// Save returns the FSAVE state frame.  An FPU that executed no instruction
+// since its reset saves the 4 byte null frame, otherwise an idle frame.  The
+// first long of a frame holds the version in bits 31-24 and the length of the
+// rest of the frame in bits 23-16.
+func (f *FPU) Save() []byte {
+	if !f.idle {
+		return make([]byte, 4)
+	}
+	frame := make([]byte, 4+f.frame)
+	frame[0] = versionIdle
+	frame[1] = byte(f.frame)
+	return frame
+}
+
+// FrameSize returns the length of the state frame that starts with header,
+// including the header.  Frames that the FPU does not accept are 4 bytes
+// long.
+func (f *FPU) FrameSize(header uint32) uint32 {
+	if header>>24 == versionIdle && int(header>>16&0xff) == f.frame {
+		return 4 + uint32(f.frame)
+	}
+	return 4
+}
+
+// Restore restores a state frame saved by Save.  A null frame resets the
+// FPU.  Frames of other versions or lengths return the format error vector.
+func (f *FPU) Restore(frame []byte) uint32 {
+	switch {
+	case len(frame) < 4:
+		return vectorFormatError
+	case frame[0] == versionNull:
+		f.Reset()
+		return 0
+	case frame[0] == versionIdle && int(frame[1]) == f.frame &&
+		len(frame) == 4+f.frame:
+		f.idle = true
+		return 0
+	}
+	return vectorFormatError
+}
@@ -0,0 +1,508 @@
+package m68881
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+func newFPU(t *testing.T) *FPU {
+	f, err := New(M68881)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// execute executes command and fails the test on an exception.
+func execute(t *testing.T, f *FPU, command uint16, operand []byte) []byte {
+	out, vector := f.Execute(command, 0x1000, operand)
+	if vector != 0 {
+		t.Fatalf("command %04x: vector %v", command, vector)
+	}
+	return out
+}
+
+func long(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return b
+}
+
+func quad(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New("68000"); err == nil {
+		t.Fatal("expected error")
+	}
+	for _, name := range []string{M68881, M68882} {
+		f, err := New(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !math.IsNaN(f.Float64(0)) {
+			t.Fatalf("%v: fp0 %v", name, f.Float64(0))
+		}
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	tests := []struct {
+		command uint16
+		src     float64
+		dest    float64
+		want    float64
+	}{
+		{0x0000, 1.5, 0, 1.5},                     // fmove
+		{0x0001, 2.5, 0, 2},                       // fint, nearest even
+		{0x0003, -2.7, 0, -2},                     // fintrz
+		{0x0004, 2, 0, math.Sqrt2},                // fsqrt
+		{0x0018, -3, 0, 3},                        // fabs
+		{0x001a, 3, 0, -3},                        // fneg
+		{0x001e, 12, 0, 3},                        // fgetexp
+		{0x001f, 12, 0, 1.5},                      // fgetman
+		{0x000e, math.Pi / 2, 0, 1},               // fsin
+		{0x001d, 0, 0, 1},                         // fcos
+		{0x0010, 1, 0, math.E},                    // fetox
+		{0x0014, math.E, 0, 1},                    // flogn
+		{0x0016, 8, 0, 3},                         // flog2
+		{0x0012, 3, 0, 1000},                      // ftentox
+		{0x000a, 1, 0, math.Pi / 4},               // fatan
+		{0x0020, 4, 1, 0.25},                      // fdiv
+		{0x0022, 1.25, 2, 3.25},                   // fadd
+		{0x0023, 3, -2, -6},                       // fmul
+		{0x0028, 3, 2, -1},                        // fsub
+		{0x0021, 3, 10, 1},                        // fmod
+		{0x0025, 3, 11, -1},                       // frem
+		{0x0026, 3, 1.5, 12},                      // fscale
+		{0x0024, 3, 1, float64(float32(1) / 3)},   // fsgldiv
+		{0x0027, 1.0 / 3, 3, float64(float32(1))}, // fsglmul
+	}
+	for _, test := range tests {
+		f := newFPU(t)
+		f.SetFloat64(1, test.src)
+		f.SetFloat64(2, test.dest)
+		// FP1 op FP2 -> FP2
+		execute(t, f, 0x0500|test.command, nil)
+		got := f.Float64(2)
+		if math.Abs(got-test.want) > 1e-15*math.Abs(test.want) {
+			t.Errorf("opmode %02x: got %v want %v", test.command,
+				got, test.want)
+		}
+	}
+}
+
+func TestRounding(t *testing.T) {
+	f := newFPU(t)
+	f.SetFloat64(1, 1)
+	f.SetFloat64(2, 3)
+
+	// 1/3 in extended precision is inexact
+	execute(t, f, 0x08a0, nil) // fdiv.x fp2,fp1
+	if f.fp[1].mant != 0xaaaaaaaaaaaaaaab || f.fp[1].se != 0x3ffd {
+		t.Fatalf("1/3: %04x %016x", f.fp[1].se, f.fp[1].mant)
+	}
+	if f.fpsr&(inex2|ainex) != inex2|ainex {
+		t.Fatalf("fpsr %08x", f.fpsr)
+	}
+
+	// round to zero in single precision
+	f.fpcr = 0x0050
+	f.SetFloat64(1, 1)
+	execute(t, f, 0x08a0, nil)
+	if f.fp[1].mant != 0xaaaaaa0000000000 {
+		t.Fatalf("1/3 single rz: %016x", f.fp[1].mant)
+	}
+
+	// 1 + 2^-64 rounds up to plus infinity
+	f.fpcr = 0x0030
+	f.SetFloat64(1, 1)
+	f.SetFloat64(2, math.Ldexp(1, -64))
+	execute(t, f, 0x08a2, nil) // fadd.x fp2,fp1
+	if f.fp[1].mant != 0x8000000000000001 {
+		t.Fatalf("1+2^-64 rp: %016x", f.fp[1].mant)
+	}
+
+	// x - x is -0 when rounding to minus infinity
+	f.fpcr = 0x0020
+	f.SetFloat64(1, 5)
+	execute(t, f, 0x04a8, nil) // fsub.x fp1,fp1
+	if f.fp[1] != zero(true) || f.fpsr&(ccZ|ccN) != ccZ|ccN {
+		t.Fatalf("x-x rm: %v %08x", f.fp[1], f.fpsr)
+	}
+}
+
+func TestExceptions(t *testing.T) {
+	f := newFPU(t)
+	f.SetFloat64(1, 1)
+	f.SetFloat64(2, 0)
+	execute(t, f, 0x08a0, nil) // fdiv.x fp2,fp1
+	if !f.fp[1].isInf() || f.fpsr&(dz|adz|ccI) != dz|adz|ccI {
+		t.Fatalf("1/0: %v %08x", f.fp[1], f.fpsr)
+	}
+
+	// 0/0 with OPERR enabled
+	f.fpcr = operr
+	f.SetFloat64(1, 0)
+	_, vector := f.Execute(0x08a0, 0x1234, nil)
+	if vector != vectorOPERR || !f.fp[1].isNaN() {
+		t.Fatalf("0/0: vector %v %v", vector, f.fp[1])
+	}
+	if f.fpiar != 0x1234 || f.fpsr&(ccNaN|operr|aiop) != ccNaN|operr|aiop {
+		t.Fatalf("0/0: fpiar %x fpsr %08x", f.fpiar, f.fpsr)
+	}
+
+	// overflow to infinity
+	f.fpcr = 0
+	f.fp[1] = extended{se: 0x7ffe, mant: 0x8000000000000000}
+	execute(t, f, 0x04a2, nil) // fadd.x fp1,fp1
+	if !f.fp[1].isInf() || f.fpsr&(ovfl|aovfl|inex2) != ovfl|aovfl|inex2 {
+		t.Fatalf("overflow: %v %08x", f.fp[1], f.fpsr)
+	}
+
+	// signaling NaN operand
+	f.fpcr = snan
+	_, vector = f.Execute(0x4422, 0, long(0x7f800001)) // fadd.s
+	if vector != vectorSNAN || !f.fp[0].isNaN() ||
+		f.fp[0].isSignaling() {
+		t.Fatalf("snan: vector %v %v", vector, f.fp[0])
+	}
+
+	// unimplemented opmode
+	if _, vector = f.Execute(0x0005, 0, nil); vector != vectorLineF {
+		t.Fatalf("opmode 5: vector %v", vector)
+	}
+}
+
+func TestRemainderQuotient(t *testing.T) {
+	f := newFPU(t)
+	f.SetFloat64(1, -3)
+	f.SetFloat64(2, 100)
+	execute(t, f, 0x0521, nil) // fmod.x fp1,fp2
+	if f.Float64(2) != 1 || f.fpsr&quotientMask != quotientSign|33<<16 {
+		t.Fatalf("fmod: %v %08x", f.Float64(2), f.fpsr)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	f := newFPU(t)
+	f.SetFloat64(1, 2)
+	f.SetFloat64(2, 1)
+	execute(t, f, 0x0538, nil) // fcmp.x fp1,fp2
+	tests := map[uint16]bool{
+		0x01: false, // eq
+		0x02: false, // ogt
+		0x04: true,  // olt
+		0x0e: true,  // ne
+		0x14: true,  // lt
+		0x13: false, // ge
+	}
+	for predicate, want := range tests {
+		if got, _ := f.Condition(predicate); got != want {
+			t.Errorf("predicate %02x: got %v want %v", predicate,
+				got, want)
+		}
+	}
+
+	// unordered
+	f.fp[2] = nan
+	f.fpcr = bsun
+	execute(t, f, 0x0538, nil)
+	if got, vector := f.Condition(0x08); !got || vector != 0 {
+		t.Fatalf("un: %v %v", got, vector)
+	}
+	if got, vector := f.Condition(0x12); got || vector != vectorBSUN {
+		t.Fatalf("gt: %v %v", got, vector)
+	}
+	if _, vector := f.Condition(0x20); vector != vectorLineF {
+		t.Fatalf("predicate $20: %v", vector)
+	}
+}
+
+func TestFormats(t *testing.T) {
+	tests := []struct {
+		format  uint16
+		operand []byte
+		want    float64
+	}{
+		{0x0, long(0xfffffffe), -2},
+		{0x1, long(math.Float32bits(1.5)), 1.5},
+		{0x2, []byte{0x40, 0x00, 0, 0, 0xc0, 0, 0, 0, 0, 0, 0, 0}, 3},
+		{0x3, []byte{0x40, 0x02, 0, 0x01, 0x25, 0, 0, 0, 0, 0, 0, 0},
+			0.0125},
+		{0x4, []byte{0x80, 0x00}, -32768},
+		{0x5, quad(math.Float64bits(-0.1)), -0.1},
+		{0x6, []byte{0x7f}, 127},
+	}
+	for _, test := range tests {
+		f := newFPU(t)
+		// fmove.<fmt> <ea>,fp3
+		command := 0x4180 | test.format<<10
+		execute(t, f, command, test.operand)
+		if got := f.Float64(3); got != test.want {
+			t.Errorf("format %v in: got %v want %v", test.format,
+				got, test.want)
+		}
+		// fmove.<fmt> fp3,<ea>, packed with 17 digits
+		command = 0x6180 | test.format<<10
+		if test.format == 0x3 {
+			command |= 17
+		}
+		out := execute(t, f, command, nil)
+		if !bytes.Equal(out, test.operand) {
+			t.Errorf("format %v out: got % x want % x",
+				test.format, out, test.operand)
+		}
+	}
+}
+
+func TestConvertOut(t *testing.T) {
+	f := newFPU(t)
+	f.SetFloat64(0, 2.5)
+	if out := execute(t, f, 0x6000, nil); !bytes.Equal(out, long(2)) {
+		t.Fatalf("fmove.l 2.5: % x", out)
+	}
+	if f.fpsr&inex2 == 0 {
+		t.Fatalf("fpsr %08x", f.fpsr)
+	}
+	f.SetFloat64(0, 300)
+	out := execute(t, f, 0x7800, nil) // fmove.b
+	if !bytes.Equal(out, []byte{0x7f}) || f.fpsr&operr == 0 {
+		t.Fatalf("fmove.b 300: % x %08x", out, f.fpsr)
+	}
+	f.SetFloat64(0, 0.1)
+	out = execute(t, f, 0x6400, nil) // fmove.s
+	if !bytes.Equal(out, long(math.Float32bits(0.1))) {
+		t.Fatalf("fmove.s 0.1: % x", out)
+	}
+}
+
+func TestPacked(t *testing.T) {
+	tests := []struct {
+		v    float64
+		k    int8
+		want []byte
+	}{
+		{math.Pi, 17, []byte{0x00, 0x00, 0x00, 0x03, 0x14, 0x15, 0x92,
+			0x65, 0x35, 0x89, 0x79, 0x31}},
+		{math.Pi, 3, []byte{0x00, 0x00, 0x00, 0x03, 0x14, 0, 0, 0, 0,
+			0, 0, 0}},
+		{-1234.5678, -2, []byte{0x80, 0x03, 0x00, 0x01, 0x23, 0x45,
+			0x70, 0, 0, 0, 0, 0}},
+		{1e-300, 1, []byte{0x43, 0x00, 0x00, 0x01, 0, 0, 0, 0, 0, 0,
+			0, 0}},
+		{math.Inf(-1), 1, []byte{0xff, 0xff, 0, 0, 0, 0, 0, 0, 0, 0,
+			0, 0}},
+	}
+	for _, test := range tests {
+		f := newFPU(t)
+		f.SetFloat64(1, test.v)
+		// fmove.p fp1,<ea>{#k}
+		out := execute(t, f, 0x6c80|uint16(test.k)&0x7f, nil)
+		if !bytes.Equal(out, test.want) {
+			t.Errorf("%v{%v}: got % x want % x", test.v, test.k,
+				out, test.want)
+		}
+	}
+
+	// a k-factor above 17 is an operand error
+	f := newFPU(t)
+	f.SetFloat64(1, 1)
+	execute(t, f, 0x6c80|18, nil)
+	if f.fpsr&operr == 0 {
+		t.Fatalf("k 18: fpsr %08x", f.fpsr)
+	}
+
+	// dynamic k-factor
+	command := uint16(0x7c80 | 2<<4)
+	if n, ok := Dynamic(command); !ok || n != 2 {
+		t.Fatalf("dynamic: %v %v", n, ok)
+	}
+	if static := Static(command, 5); static != 0x6c85 {
+		t.Fatalf("static: %04x", static)
+	}
+}
+
+func TestMoveConstant(t *testing.T) {
+	tests := map[uint16]float64{
+		0x00: math.Pi,
+		0x0c: math.E,
+		0x0f: 0,
+		0x30: math.Ln2,
+		0x32: 1,
+		0x34: 100,
+		0x37: 1e16,
+	}
+	for offset, want := range tests {
+		f := newFPU(t)
+		execute(t, f, 0x5c00|offset, nil) // fmovecr #offset,fp0
+		if got := f.Float64(0); got != want {
+			t.Errorf("offset %02x: got %v want %v", offset, got,
+				want)
+		}
+	}
+	f := newFPU(t)
+	execute(t, f, 0x5c00, nil)
+	if f.fp[0].mant != 0xc90fdaa22168c235 || f.fpsr&inex2 == 0 {
+		t.Fatalf("pi: %016x %08x", f.fp[0].mant, f.fpsr)
+	}
+}
+
+func TestMoveMultiple(t *testing.T) {
+	f := newFPU(t)
+	for n := 0; n < 8; n++ {
+		f.SetFloat64(n, float64(n))
+	}
+
+	// fmovem.x fp1/fp6,-(a7) and fmovem.x (a7)+,fp2/fp5
+	direction, size, err := Operand(0xe042)
+	if err != nil || direction != Out || size != 24 {
+		t.Fatalf("operand: %v %v %v", direction, size, err)
+	}
+	out := execute(t, f, 0xe042, nil)
+	execute(t, f, 0xd024, out)
+	if f.Float64(2) != 1 || f.Float64(5) != 6 {
+		t.Fatalf("fp2 %v fp5 %v", f.Float64(2), f.Float64(5))
+	}
+
+	// fmove.l #$30,fpcr and fmovem.l fpcr/fpiar,<ea>
+	execute(t, f, 0x9000, long(0x30))
+	out = execute(t, f, 0xb400, nil)
+	if !bytes.Equal(out, append(long(0x30), long(0)...)) {
+		t.Fatalf("fpcr/fpiar: % x", out)
+	}
+
+	// a dynamic list must be made static
+	if _, _, err := Operand(0xe830); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestSaveRestore(t *testing.T) {
+	for name, size := range models {
+		f, err := New(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if frame := f.Save(); !bytes.Equal(frame, make([]byte, 4)) {
+			t.Fatalf("%v: null frame % x", name, frame)
+		}
+		f.SetFloat64(0, 1)
+		execute(t, f, 0x0000, nil)
+		frame := f.Save()
+		if len(frame) != 4+size || frame[0] != versionIdle ||
+			int(frame[1]) != size {
+			t.Fatalf("%v: idle frame % x", name, frame)
+		}
+		header := binary.BigEndian.Uint32(frame)
+		if f.FrameSize(header) != uint32(len(frame)) {
+			t.Fatalf("%v: frame size", name)
+		}
+		if vector := f.Restore(frame); vector != 0 {
+			t.Fatalf("%v: restore %v", name, vector)
+		}
+		if vector := f.Restore(long(0x1f000000)); vector !=
+			vectorFormatError {
+			t.Fatalf("%v: restore invalid %v", name, vector)
+		}
+		if vector := f.Restore(make([]byte, 4)); vector != 0 ||
+			!math.IsNaN(f.Float64(0)) {
+			t.Fatalf("%v: restore null %v", name, vector)
+		}
+	}
+}
+
+// cir reads a coprocessor interface word register.
+func cir(i *Interface, address uint64) uint16 {
+	return binary.BigEndian.Uint16(i.Read(address, 2))
+}
+
+func TestInterface(t *testing.T) {
+	f := newFPU(t)
+	i := NewInterface(f)
+	if i.Length() != cirLength || cir(i, cirResponse) != responseNull {
+		t.Fatal("initial state")
+	}
+
+	// fmove.w #3,fp0
+	i.Write(cirInstruction, long(0x2000))
+	i.Write(cirCommand, []byte{0x50, 0x00})
+	if r := cir(i, cirResponse); r != responseToFPU|2 {
+		t.Fatalf("response %04x", r)
+	}
+	i.Write(cirOperand, []byte{0x00, 0x03})
+	if r := cir(i, cirResponse); r != responseNull || f.Float64(0) != 3 {
+		t.Fatalf("response %04x fp0 %v", r, f.Float64(0))
+	}
+
+	// fmul.d #0.5,fp0
+	i.Write(cirCommand, []byte{0x54, 0x23})
+	if r := cir(i, cirResponse); r != responseToFPU|8 {
+		t.Fatalf("response %04x", r)
+	}
+	d := quad(math.Float64bits(0.5))
+	i.Write(cirOperand, d[:4])
+	i.Write(cirOperand, d[4:])
+	if f.Float64(0) != 1.5 {
+		t.Fatalf("fp0 %v", f.Float64(0))
+	}
+
+	// fmove.l fp0,<ea>
+	i.Write(cirCommand, []byte{0x60, 0x00})
+	if r := cir(i, cirResponse); r != responseFromFPU|4 {
+		t.Fatalf("response %04x", r)
+	}
+	if v := i.Read(cirOperand, 4); !bytes.Equal(v, long(2)) {
+		t.Fatalf("operand % x", v)
+	}
+	if r := cir(i, cirResponse); r != responseNull {
+		t.Fatalf("response %04x", r)
+	}
+
+	// fbgt
+	i.Write(cirCondition, []byte{0x00, 0x12})
+	if r := cir(i, cirResponse); r != responseNull|responseTrue {
+		t.Fatalf("condition response %04x", r)
+	}
+
+	// enabled divide by zero is a post-instruction exception
+	i.Write(cirCommand, []byte{0x90, 0x00}) // fmove.l <ea>,fpcr
+	i.Write(cirOperand, long(dz))
+	i.Write(cirCommand, []byte{0x58, 0x20}) // fdiv.b #0,fp0
+	i.Write(cirOperand, []byte{0x00})
+	if r := cir(i, cirResponse); r != responsePost|vectorDZ {
+		t.Fatalf("response %04x", r)
+	}
+	i.Write(cirControl, []byte{0x00, 0x01})
+
+	// invalid command
+	i.Write(cirCommand, []byte{0x00, 0x05})
+	if r := cir(i, cirResponse); r != responsePre|vectorLineF {
+		t.Fatalf("response %04x", r)
+	}
+
+	// save and restore an idle frame
+	header := cir(i, cirSave)
+	if header != 0x1f18 {
+		t.Fatalf("save %04x", header)
+	}
+	for n := 0; n < 0x18; n += 4 {
+		i.Read(cirOperand, 4)
+	}
+	i.Write(cirRestore, []byte{0x1f, 0x18})
+	if r := cir(i, cirRestore); r != 0x1f18 {
+		t.Fatalf("restore %04x", r)
+	}
+	for n := 0; n < 0x18; n += 4 {
+		i.Write(cirOperand, long(0))
+	}
+	i.Write(cirRestore, []byte{0x1f, 0x30})
+	if r := cir(i, cirRestore); r != formatInvalid {
+		t.Fatalf("restore invalid %04x", r)
+	}
+}
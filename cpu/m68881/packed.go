@@ -0,0 +1,194 @@
+package m68881
+
+import "math/big"
+
+// The packed decimal real format holds a 3 digit BCD exponent and a 17 digit
+// BCD mantissa with one digit left of the decimal point:
+//
+//	bit 95     sign of the mantissa
+//	bit 94     sign of the exponent
+//	bits 93-92 set for infinities and NaNs
+//	bits 91-80 exponent
+//	bits 79-76 fourth exponent digit, only written
+//	bits 67-64 integer digit
+//	bits 63-0  16 fraction digits
+//
+// Infinities and NaNs have all exponent bits set and store the fraction like
+// the extended precision format does.
+
+const maxDigits = 17 // mantissa digits
+
+var ten = big.NewInt(10)
+
+// bcd returns the value of n BCD digits of b starting at digit offset off.
+// Digits above 9 are taken as they are.
+func bcd(b []byte, off, n int) int64 {
+	var v int64
+	for k := off; k < off+n; k++ {
+		d := b[k/2]
+		if k%2 == 0 {
+			d >>= 4
+		}
+		v = v*10 + int64(d&0x0f)
+	}
+	return v
+}
+
+// pow10 returns 10^n as a rational, n may be negative.
+func pow10(n int) *big.Rat {
+	if n < 0 {
+		return new(big.Rat).Inv(pow10(-n))
+	}
+	p := new(big.Int).Exp(ten, big.NewInt(int64(n)), nil)
+	return new(big.Rat).SetInt(p)
+}
+
+// fromPacked converts a packed decimal operand.  The value is rounded to
+// extended precision in mode and true is returned when that is inexact.
+func fromPacked(b []byte, mode big.RoundingMode) (extended, bool) {
+	sign := b[0]&0x80 != 0
+	if b[0]&0x7f == 0x7f && b[1] == 0xff {
+		x := extended{se: maxExp, mant: bigEndian(b[4:12])}
+		return signed(x, sign), false
+	}
+
+	exp := int(bcd(b, 1, 3))
+	if b[0]&0x40 != 0 {
+		exp = -exp
+	}
+	// integer digit and fraction as one 17 digit integer
+	mant := big.NewInt(bcd(b, 7, 1))
+	mant.Mul(mant, new(big.Int).Exp(ten, big.NewInt(16), nil))
+	mant.Add(mant, big.NewInt(bcd(b, 8, 16)))
+	if mant.Sign() == 0 {
+		return zero(sign), false
+	}
+
+	r := new(big.Rat).SetInt(mant)
+	r.Mul(r, pow10(exp-16))
+	if sign {
+		r.Neg(r)
+	}
+	v := new(big.Float).SetPrec(64).SetMode(mode).SetRat(r)
+	x, _ := round(v, 64, mode)
+	return x, v.Acc() != big.Exact
+}
+
+// exponent10 returns the decimal exponent of the positive r, the e for which
+// 10^e <= r < 10^(e+1).
+func exponent10(r *big.Rat, binary int) int {
+	// estimate from the binary exponent and correct
+	e := int(float64(binary) * 0.30102999566398120)
+	for r.Cmp(pow10(e)) < 0 {
+		e--
+	}
+	for r.Cmp(pow10(e+1)) >= 0 {
+		e++
+	}
+	return e
+}
+
+// toPacked converts x to packed decimal with the k-factor k.  A positive k
+// is the number of significant digits, zero or a negative k the number of
+// digits right of the decimal point.  More than 17 digits signal OPERR and 17
+// are used.  The last digit is rounded in mode.
+func toPacked(x extended, k int8, mode big.RoundingMode) ([]byte, uint32) {
+	b := make([]byte, 12)
+	if x.sign() {
+		b[0] = 0x80
+	}
+	switch {
+	case x.isNaN(), x.isInf():
+		b[0] |= 0x7f
+		b[1] = 0xff
+		if x.isNaN() {
+			copy(b[4:], packExtended(x)[4:])
+		}
+		return b, 0
+	case x.isZero():
+		return b, 0
+	}
+
+	var status uint32
+	f := x.big()
+	r, _ := new(big.Float).Abs(f).Rat(nil)
+	e := exponent10(r, f.MantExp(nil)-1)
+
+	digits := int(k)
+	if k <= 0 {
+		digits = e + 1 - int(k)
+	}
+	switch {
+	case digits > maxDigits:
+		if k > 0 {
+			status |= operr
+		}
+		digits = maxDigits
+	case digits < 1:
+		digits = 1
+	}
+
+	// scale to an integer of digits digits and round it
+	var mant *big.Int
+	for {
+		s := new(big.Rat).Mul(r, pow10(digits-1-e))
+		q, rem := new(big.Int).QuoRem(s.Num(), s.Denom(), new(big.Int))
+		if rem.Sign() != 0 {
+			status |= inex2
+			if away(q, rem, s.Denom(), x.sign(), mode) {
+				q.Add(q, big.NewInt(1))
+			}
+		}
+		limit := new(big.Int).Exp(ten, big.NewInt(int64(digits)), nil)
+		if q.Cmp(limit) < 0 {
+			mant = q
+			break
+		}
+		// rounded up to the next power of ten
+		e++
+		if k <= 0 && digits < maxDigits {
+			digits++
+		}
+	}
+
+	// left align the mantissa to 17 digits
+	pad := big.NewInt(int64(maxDigits - digits))
+	mant.Mul(mant, pad.Exp(ten, pad, nil))
+	s := mant.String()
+	for n, d := range s {
+		digit := n + 7 // the integer digit is digit 7 of the format
+		b[digit/2] |= byte(d-'0') << uint(4*(1-digit%2))
+	}
+
+	if e < 0 {
+		b[0] |= 0x40
+		e = -e
+	}
+	for n, d := range []int{e / 100 % 10, e / 10 % 10, e % 10} {
+		digit := n + 1
+		b[digit/2] |= byte(d) << uint(4*(1-digit%2))
+	}
+	b[2] |= byte(e/1000%10) << 4
+	return b, status
+}
+
+// away returns true if the truncated quotient q with the remainder rem of a
+// division by d is to be rounded away from zero in mode.  Negative values
+// have been made positive, sign is the sign of the original value.
+func away(q, rem, d *big.Int, sign bool, mode big.RoundingMode) bool {
+	switch mode {
+	case big.ToZero:
+		return false
+	case big.ToNegativeInf:
+		return sign
+	case big.ToPositiveInf:
+		return !sign
+	}
+	switch new(big.Int).Lsh(rem, 1).Cmp(d) {
+	case 1:
+		return true
+	case 0:
+		return q.Bit(0) != 0
+	}
+	return false
+}